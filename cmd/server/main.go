@@ -5,43 +5,91 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
 	"time"
+	// Time zones for the ?tz of the logs endpoints, as the runtime image has no tzdata
+	_ "time/tzdata"
 
 	// OpenTelemetry imports
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/observio/backend/internal/api"
 	"github.com/observio/backend/internal/config"
+	"github.com/observio/backend/internal/logging"
 )
 
-// initTracer sets up OpenTelemetry OTLP exporter
-func initTracer() func() {
-	ctx := context.Background()
+// serviceName identifies the server's own spans
+const serviceName = "observio-backend"
 
-	// Get OTLP endpoint from environment variable, default to localhost for local development
+// initTracer exports the server's spans over OTLP/gRPC to OTLP_ENDPOINT (e.g.
+// "localhost:4317"). Without OTLP_ENDPOINT tracing stays a no-op. The returned
+// func flushes pending spans and stops the exporter, giving up when ctx is done.
+func initTracer(logger logging.Logger) (func(context.Context) error, error) {
 	otlpEndpoint := os.Getenv("OTLP_ENDPOINT")
 	if otlpEndpoint == "" {
-		otlpEndpoint = "localhost:4317" // Default for local development
+		logger.Info("OTLP_ENDPOINT is not set, tracing is disabled")
+		return func(context.Context) error { return nil }, nil
 	}
 
-	exporter, err := otlptracegrpc.New(ctx,
+	exporter, err := otlptracegrpc.New(context.Background(),
 		otlptracegrpc.WithEndpoint(otlpEndpoint),
 		otlptracegrpc.WithInsecure(),
 	)
 	if err != nil {
-		log.Fatalf("failed to create OTLP exporter: %v", err)
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
 	}
-	tp := trace.NewTracerProvider(trace.WithBatcher(exporter))
+	tp := trace.NewTracerProvider(
+		trace.WithBatcher(exporter),
+		trace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))),
+	)
 	otel.SetTracerProvider(tp)
-	return func() { _ = tp.Shutdown(ctx) }
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	logger.Info("exporting traces", "endpoint", otlpEndpoint)
+	return tp.Shutdown, nil
+}
+
+// reloadConfig re-reads the config file and applies the settings that can
+// change at runtime. An invalid file is logged and the active config kept;
+// changed settings that need a restart are only logged.
+func reloadConfig(path string, live *config.Live, logger logging.Logger) {
+	logger.Info("reloading configuration", "path", path)
+
+	next, err := config.Load(path)
+	if err != nil {
+		logger.Error("failed to reload configuration, keeping the active one", "error", err)
+		return
+	}
+
+	current := live.Get()
+	var applied, ignored []string
+	for _, path := range current.Changes(next) {
+		if config.IsReloadable(path) {
+			applied = append(applied, path)
+		} else {
+			ignored = append(ignored, path)
+		}
+	}
+	if len(ignored) > 0 {
+		logger.Warn("configuration changes need a restart to take effect", "settings", ignored)
+	}
+	if len(applied) == 0 {
+		logger.Info("configuration reloaded, nothing to apply")
+		return
+	}
+
+	live.Set(current.Reloaded(next))
+	logger.Info("configuration reloaded", "changed", applied)
 }
 
 func main() {
@@ -55,41 +103,73 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	// Set up logger
-	logger := log.New(os.Stdout, "ObservIO: ", log.LstdFlags|log.Lshortfile)
-	logger.Printf("Starting ObservIO backend server on port %d", cfg.Server.Port)
+	// Set up logger; output of the standard log package goes through it too
+	logger, logOutput, err := logging.New(cfg.Logging)
+	if err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	defer logOutput.Close()
+	slog.SetDefault(logger)
+	logger.Info("starting ObservIO backend server", "port", cfg.Server.Port)
 
-	// Initialize API router
-	router := api.NewRouter(cfg, logger)
+	// Initialize tracing
+	shutdownTracer, err := initTracer(logger)
+	if err != nil {
+		logger.Error("failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+
+	// Initialize API router; settings that can change on SIGHUP are read through live
+	live := config.NewLive(cfg)
+	live.OnChange(func(cfg *config.Config) {
+		if err := logOutput.Reconfigure(cfg.Logging); err != nil {
+			logger.Error("failed to apply logging settings", "error", err)
+		}
+	})
+	router, startJobs, closeRouter := api.NewRouter(live, logger)
 
-	// Debug print all registered chi routes with more detail
-	fmt.Println("==== REGISTERED ROUTES ====")
+	// Log every registered chi route at debug level
 	walkFunc := func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
 		route = strings.Replace(route, "/*/", "/", -1)
-		fmt.Printf("%-6s %-30s %d middlewares\n", method, route, len(middlewares))
+		logger.Debug("registered route", "method", method, "route", route, "middlewares", len(middlewares))
 		return nil
 	}
 
 	if mux, ok := router.(*chi.Mux); ok {
 		chi.Walk(mux, walkFunc)
 	} else {
-		fmt.Println("Router is not a chi.Mux; cannot print routes.")
+		logger.Debug("router is not a chi.Mux; cannot list routes")
 	}
-	fmt.Println("==========================")
 
 	// Configure HTTP server
 	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", cfg.Server.Port),
-		Handler:      router,
-		ReadTimeout:  time.Duration(cfg.Server.ReadTimeoutSeconds) * time.Second,
-		WriteTimeout: time.Duration(cfg.Server.WriteTimeoutSeconds) * time.Second,
-		IdleTimeout:  time.Duration(cfg.Server.IdleTimeoutSeconds) * time.Second,
+		Addr:              fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler:           router,
+		ReadTimeout:       time.Duration(cfg.Server.ReadTimeoutSeconds) * time.Second,
+		WriteTimeout:      time.Duration(cfg.Server.WriteTimeoutSeconds) * time.Second,
+		IdleTimeout:       time.Duration(cfg.Server.IdleTimeoutSeconds) * time.Second,
+		ReadHeaderTimeout: time.Duration(cfg.Server.ReadHeaderTimeoutSeconds) * time.Second,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
 	}
 
+	// Background jobs run until the server shuts down
+	jobs, stopJobs := context.WithCancel(context.Background())
+	startJobs(jobs)
+
 	// Start server in a goroutine
 	go func() {
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Fatalf("Failed to start server: %v", err)
+			logger.Error("failed to start server", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	// Reload the config file on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reloadConfig(*configPath, live, logger)
 		}
 	}()
 
@@ -97,16 +177,27 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	logger.Println("Shutting down server...")
+	signal.Stop(hup)
+	logger.Info("shutting down server")
 
 	// Create shutdown context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeoutSeconds)*time.Second)
 	defer cancel()
 
-	// Attempt graceful shutdown
+	// Attempt graceful shutdown; in-flight requests finish before the
+	// ClickHouse connection is closed underneath them
 	if err := server.Shutdown(ctx); err != nil {
-		logger.Fatalf("Server forced to shutdown: %v", err)
+		logger.Error("server forced to shutdown", "error", err)
+	}
+	stopJobs()
+
+	if err := closeRouter(); err != nil {
+		logger.Error("failed to close ClickHouse connection", "error", err)
+	}
+
+	if err := shutdownTracer(ctx); err != nil {
+		logger.Error("failed to flush traces", "error", err)
 	}
 
-	logger.Println("Server exiting")
+	logger.Info("server exiting")
 }
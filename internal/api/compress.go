@@ -0,0 +1,208 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// compressibleTypes lists the media types worth compressing: the JSON, NDJSON
+// and CSV results of queries and the plain text metrics
+var compressibleTypes = []string{
+	"application/json",
+	"application/x-ndjson",
+	"text/csv",
+	"text/plain",
+}
+
+// gzipWriters reuses gzip writers, which are expensive to allocate
+var gzipWriters = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(io.Discard) },
+}
+
+// compressResponses gzips responses of a compressible type for clients sending
+// Accept-Encoding: gzip. The start of the body is held back until it reaches
+// minBytes, so responses smaller than that are sent as they are. Event streams
+// and WebSocket upgrades are never compressed, and a handler flushing a
+// streamed response sends what it has written so far, compressed or not.
+func compressResponses(minBytes int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !acceptsGzip(r) || r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Accept-Encoding")
+			cw := &compressWriter{ResponseWriter: w, minBytes: minBytes}
+			defer cw.Close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// acceptsGzip reports whether the request's Accept-Encoding allows gzip
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		// gzip;q=0 explicitly refuses gzip
+		return strings.ReplaceAll(strings.TrimSpace(params), " ", "") != "q=0"
+	}
+	return false
+}
+
+// compressWriter buffers the start of a response until it knows whether to
+// compress it: once minBytes have been written, on the first Flush, or when
+// the handler returns
+type compressWriter struct {
+	http.ResponseWriter
+	minBytes int
+
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	gz      *gzip.Writer // nil when the response is sent as is
+}
+
+// WriteHeader holds the status until the response is started
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if cw.decided {
+		return cw.write(p)
+	}
+
+	cw.buf.Write(p)
+	if cw.buf.Len() >= cw.minBytes {
+		if err := cw.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// write sends p directly or through the gzip writer
+func (cw *compressWriter) write(p []byte) (int, error) {
+	if cw.gz != nil {
+		return cw.gz.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// start sends the headers and the buffered bytes, compressing the response if
+// it may be compressed and large is set
+func (cw *compressWriter) start(large bool) error {
+	cw.decided = true
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	if large && cw.compressible() {
+		header := cw.Header()
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		// An ETag names the uncompressed body
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		cw.gz = gzipWriters.Get().(*gzip.Writer)
+		cw.gz.Reset(cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if cw.buf.Len() == 0 {
+		return nil
+	}
+	_, err := cw.write(cw.buf.Bytes())
+	cw.buf.Reset()
+	return err
+}
+
+// compressible reports whether the response has a status with a body, is not
+// encoded already and has a compressible content type
+func (cw *compressWriter) compressible() bool {
+	if cw.status < http.StatusOK || cw.status == http.StatusNoContent || cw.status == http.StatusNotModified {
+		return false
+	}
+	header := cw.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, t := range compressibleTypes {
+		if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Flush starts the response, compressing it if it may be compressed, and
+// sends everything written so far
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if err := cw.start(true); err != nil {
+			return
+		}
+	}
+	if cw.gz != nil {
+		cw.gz.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close sends a response smaller than minBytes as it is, or ends the gzip stream
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		if cw.status == 0 {
+			// The handler wrote nothing, e.g. after hijacking the connection
+			return nil
+		}
+		return cw.start(false)
+	}
+	if cw.gz == nil {
+		return nil
+	}
+	err := cw.gz.Close()
+	gzipWriters.Put(cw.gz)
+	cw.gz = nil
+	return err
+}
+
+// Hijack hands the connection over, e.g. for a WebSocket
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	cw.decided = true
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// lift the write deadline of a long stream
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/observio/backend/internal/config"
+)
+
+func TestCORSCredentialsOnlyForListedOrigins(t *testing.T) {
+	tests := []struct {
+		name            string
+		allowed         []string
+		origin          string
+		wantOrigin      string
+		wantCredentials string
+	}{
+		{"wildcard", []string{"*"}, "https://evil.example", "https://evil.example", ""},
+		{"listed", []string{"https://app.example"}, "https://app.example", "https://app.example", "true"},
+		{"listed with wildcard", []string{"*", "https://app.example"}, "https://app.example", "https://app.example", "true"},
+		{"unlisted with wildcard", []string{"*", "https://app.example"}, "https://evil.example", "https://evil.example", ""},
+		{"unlisted", []string{"https://app.example"}, "https://evil.example", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			live := config.NewLive(&config.Config{Server: config.ServerConfig{CORSAllowedOrigins: tt.allowed}})
+			handler := corsHandler(live)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			for _, method := range []string{http.MethodGet, http.MethodOptions} {
+				req := httptest.NewRequest(method, "/api/v1/logs", nil)
+				req.Header.Set("Origin", tt.origin)
+				if method == http.MethodOptions {
+					req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+				}
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+
+				if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+					t.Errorf("%s: Access-Control-Allow-Origin = %q, want %q", method, got, tt.wantOrigin)
+				}
+				if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != tt.wantCredentials {
+					t.Errorf("%s: Access-Control-Allow-Credentials = %q, want %q", method, got, tt.wantCredentials)
+				}
+			}
+		})
+	}
+}
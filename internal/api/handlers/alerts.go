@@ -1,71 +1,78 @@
 package handlers
 
 import (
-	"encoding/json"
-	"log"
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/observio/backend/internal/api/httputil"
 	"github.com/observio/backend/internal/config"
+	"github.com/observio/backend/internal/database"
+	"github.com/observio/backend/internal/logging"
+	"github.com/observio/backend/internal/services/alerting"
 )
 
 // AlertsHandler handles alert-related API endpoints
 type AlertsHandler struct {
-	cfg    *config.Config
-	logger *log.Logger
+	cfg    *config.Live
+	logger logging.Logger
+	store  AlertRuleStore
+	alerts AlertSource
 }
 
-// Alert represents a monitoring alert
-type Alert struct {
-	ID          string            `json:"id"`
-	Name        string            `json:"name"`
-	Description string            `json:"description"`
-	Query       string            `json:"query"`
-	Threshold   float64           `json:"threshold"`
-	Operator    string            `json:"operator"` // >, <, ==, !=, >=, <=
-	Severity    string            `json:"severity"` // critical, warning, info
-	Status      string            `json:"status"`   // active, resolved, pending
-	Labels      map[string]string `json:"labels"`
-	Annotations map[string]string `json:"annotations"`
-	CreatedAt   time.Time         `json:"createdAt"`
-	UpdatedAt   time.Time         `json:"updatedAt"`
-	LastFiredAt *time.Time        `json:"lastFiredAt,omitempty"`
+// AlertSource exposes the alerts produced by rule evaluation;
+// *alerting.Evaluator implements it
+type AlertSource interface {
+	Alerts(status, severity string) []alerting.Alert
+	Alert(id string) (alerting.Alert, bool)
+	Resolve(id string) (alerting.Alert, bool)
 }
 
-// AlertRule represents a rule for generating alerts
-type AlertRule struct {
-	ID          string            `json:"id"`
-	Name        string            `json:"name"`
-	Description string            `json:"description"`
-	Query       string            `json:"query"`
-	Threshold   float64           `json:"threshold"`
-	Operator    string            `json:"operator"` // >, <, ==, !=, >=, <=
-	Severity    string            `json:"severity"` // critical, warning, info
-	Labels      map[string]string `json:"labels"`
-	Annotations map[string]string `json:"annotations"`
-	Enabled     bool              `json:"enabled"`
-	CreatedAt   time.Time         `json:"createdAt"`
-	UpdatedAt   time.Time         `json:"updatedAt"`
+// AlertRuleStore persists alert rules; *database.ClickHouseClient implements it
+type AlertRuleStore interface {
+	ListAlertRules(ctx context.Context) ([]database.AlertRule, error)
+	GetAlertRule(ctx context.Context, id string) (*database.AlertRule, error)
+	SaveAlertRule(ctx context.Context, rule database.AlertRule) error
+	DeleteAlertRule(ctx context.Context, id string) error
 }
 
-// NewAlertsHandler creates a new alerts handler
-func NewAlertsHandler(cfg *config.Config, logger *log.Logger) http.Handler {
+// validateAlertRule applies the no_data default and validates the rule
+func validateAlertRule(rule *database.AlertRule) error {
+	if rule.NoDataState == "" {
+		rule.NoDataState = database.NoDataStateNoData
+	}
+	return rule.Validate()
+}
+
+// NewAlertsHandler creates a new alerts handler; rule endpoints respond with
+// 503 when store is nil, and alert endpoints when alerts is nil
+func NewAlertsHandler(cfg *config.Live, logger logging.Logger, store AlertRuleStore, alerts AlertSource) http.Handler {
 	h := &AlertsHandler{
 		cfg:    cfg,
 		logger: logger,
+		store:  store,
+		alerts: alerts,
 	}
 
 	r := chi.NewRouter()
 	// Alert endpoints
-	r.Get("/", h.ListAlerts)
-	r.Get("/{id}", h.GetAlert)
-	r.Put("/{id}/resolve", h.ResolveAlert)
+	r.Group(func(r chi.Router) {
+		r.Use(h.requireAlerts)
+		r.Get("/", h.ListAlerts)
+		r.Get("/{id}", h.GetAlert)
+		r.Put("/{id}/resolve", h.ResolveAlert)
+	})
 	
 	// Alert rules endpoints
 	r.Route("/rules", func(r chi.Router) {
+		r.Use(h.requireStore)
 		r.Get("/", h.ListAlertRules)
 		r.Post("/", h.CreateAlertRule)
+		r.Post("/bulk", h.BulkUpdateAlertRules)
 		r.Get("/{id}", h.GetAlertRule)
 		r.Put("/{id}", h.UpdateAlertRule)
 		r.Delete("/{id}", h.DeleteAlertRule)
@@ -76,344 +83,210 @@ func NewAlertsHandler(cfg *config.Config, logger *log.Logger) http.Handler {
 	return r
 }
 
-// ListAlerts returns a list of all active alerts
+// ListAlerts returns the alerts produced by rule evaluation, optionally
+// filtered by ?status and ?severity
 func (h *AlertsHandler) ListAlerts(w http.ResponseWriter, r *http.Request) {
-	// Parse query parameters for filtering
 	status := r.URL.Query().Get("status")
 	severity := r.URL.Query().Get("severity")
-	
-	h.logger.Printf("Listing alerts with status: %s, severity: %s", status, severity)
-	
-	// In a real implementation, this would fetch alerts from a database with filters
-	now := time.Now()
-	firedTime := now.Add(-15 * time.Minute)
-	
-	alerts := []Alert{
-		{
-			ID:          "alert-1",
-			Name:        "High CPU Usage",
-			Description: "CPU usage is above threshold",
-			Query:       "cpu_usage{host=\"server1\"} > 90",
-			Threshold:   90.0,
-			Operator:    ">",
-			Severity:    "critical",
-			Status:      "active",
-			Labels: map[string]string{
-				"host":        "server1",
-				"environment": "production",
-			},
-			Annotations: map[string]string{
-				"summary":     "High CPU usage on server1",
-				"description": "CPU usage is above 90% for more than 5 minutes",
-			},
-			CreatedAt:   now.Add(-30 * time.Minute),
-			UpdatedAt:   now.Add(-15 * time.Minute),
-			LastFiredAt: &firedTime,
-		},
-		{
-			ID:          "alert-2",
-			Name:        "High Memory Usage",
-			Description: "Memory usage is above threshold",
-			Query:       "memory_usage{host=\"server2\"} > 85",
-			Threshold:   85.0,
-			Operator:    ">",
-			Severity:    "warning",
-			Status:      "active",
-			Labels: map[string]string{
-				"host":        "server2",
-				"environment": "production",
-			},
-			Annotations: map[string]string{
-				"summary":     "High memory usage on server2",
-				"description": "Memory usage is above 85% for more than 10 minutes",
-			},
-			CreatedAt:   now.Add(-45 * time.Minute),
-			UpdatedAt:   now.Add(-20 * time.Minute),
-			LastFiredAt: &firedTime,
-		},
-	}
-
-	// Filter by status if provided
-	if status != "" {
-		var filtered []Alert
-		for _, alert := range alerts {
-			if alert.Status == status {
-				filtered = append(filtered, alert)
-			}
-		}
-		alerts = filtered
-	}
 
-	// Filter by severity if provided
-	if severity != "" {
-		var filtered []Alert
-		for _, alert := range alerts {
-			if alert.Severity == severity {
-				filtered = append(filtered, alert)
-			}
-		}
-		alerts = filtered
-	}
-
-	respondJSON(w, http.StatusOK, alerts)
+	httputil.RespondJSON(w, http.StatusOK, h.alerts.Alerts(status, severity))
 }
 
 // GetAlert returns a specific alert by ID
 func (h *AlertsHandler) GetAlert(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	
-	// In a real implementation, this would fetch the alert from a database
-	now := time.Now()
-	firedTime := now.Add(-15 * time.Minute)
-	
-	alert := Alert{
-		ID:          id,
-		Name:        "High CPU Usage",
-		Description: "CPU usage is above threshold",
-		Query:       "cpu_usage{host=\"server1\"} > 90",
-		Threshold:   90.0,
-		Operator:    ">",
-		Severity:    "critical",
-		Status:      "active",
-		Labels: map[string]string{
-			"host":        "server1",
-			"environment": "production",
-		},
-		Annotations: map[string]string{
-			"summary":     "High CPU usage on server1",
-			"description": "CPU usage is above 90% for more than 5 minutes",
-		},
-		CreatedAt:   now.Add(-30 * time.Minute),
-		UpdatedAt:   now.Add(-15 * time.Minute),
-		LastFiredAt: &firedTime,
+
+	alert, ok := h.alerts.Alert(id)
+	if !ok {
+		httputil.RespondError(w, http.StatusNotFound, httputil.CodeNotFound, fmt.Sprintf("Alert %s not found", id))
+		return
 	}
 
-	respondJSON(w, http.StatusOK, alert)
+	httputil.RespondJSON(w, http.StatusOK, alert)
 }
 
-// ResolveAlert marks an alert as resolved
+// ResolveAlert marks an alert as resolved until its rule fires again
 func (h *AlertsHandler) ResolveAlert(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	
-	// In a real implementation, this would update the alert status in a database
-	h.logger.Printf("Resolving alert with ID: %s", id)
-	
-	now := time.Now()
-	firedTime := now.Add(-15 * time.Minute)
-	
-	alert := Alert{
-		ID:          id,
-		Name:        "High CPU Usage",
-		Description: "CPU usage is above threshold",
-		Query:       "cpu_usage{host=\"server1\"} > 90",
-		Threshold:   90.0,
-		Operator:    ">",
-		Severity:    "critical",
-		Status:      "resolved", // Status updated to resolved
-		Labels: map[string]string{
-			"host":        "server1",
-			"environment": "production",
-		},
-		Annotations: map[string]string{
-			"summary":     "High CPU usage on server1",
-			"description": "CPU usage is above 90% for more than 5 minutes",
-		},
-		CreatedAt:   now.Add(-30 * time.Minute),
-		UpdatedAt:   now, // Update time set to now
-		LastFiredAt: &firedTime,
+
+	h.logger.Info("resolving alert", "id", id)
+
+	alert, ok := h.alerts.Resolve(id)
+	if !ok {
+		httputil.RespondError(w, http.StatusNotFound, httputil.CodeNotFound, fmt.Sprintf("Alert %s not found", id))
+		return
 	}
 
-	respondJSON(w, http.StatusOK, alert)
+	httputil.RespondJSON(w, http.StatusOK, alert)
+}
+
+// requireAlerts rejects alert requests when rule evaluation is not running
+func (h *AlertsHandler) requireAlerts(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.alerts == nil {
+			httputil.RespondError(w, http.StatusServiceUnavailable, httputil.CodeServiceUnavailable, "Alert evaluation is unavailable")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireStore rejects alert rule requests when no rule storage is configured
+func (h *AlertsHandler) requireStore(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.store == nil {
+			httputil.RespondError(w, http.StatusServiceUnavailable, httputil.CodeServiceUnavailable, "Alert rule storage is unavailable")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 // ListAlertRules returns a list of all alert rules
 func (h *AlertsHandler) ListAlertRules(w http.ResponseWriter, r *http.Request) {
-	// In a real implementation, this would fetch alert rules from a database
-	now := time.Now()
-	
-	rules := []AlertRule{
-		{
-			ID:          "rule-1",
-			Name:        "High CPU Usage Rule",
-			Description: "Alert when CPU usage is above threshold",
-			Query:       "cpu_usage{host=~\".*\"} > 90",
-			Threshold:   90.0,
-			Operator:    ">",
-			Severity:    "critical",
-			Labels: map[string]string{
-				"service": "system",
-				"team":    "infrastructure",
-			},
-			Annotations: map[string]string{
-				"summary":     "High CPU usage detected",
-				"description": "CPU usage is above 90% for more than 5 minutes",
-			},
-			Enabled:   true,
-			CreatedAt: now.Add(-24 * time.Hour),
-			UpdatedAt: now.Add(-12 * time.Hour),
-		},
-		{
-			ID:          "rule-2",
-			Name:        "High Memory Usage Rule",
-			Description: "Alert when memory usage is above threshold",
-			Query:       "memory_usage{host=~\".*\"} > 85",
-			Threshold:   85.0,
-			Operator:    ">",
-			Severity:    "warning",
-			Labels: map[string]string{
-				"service": "system",
-				"team":    "infrastructure",
-			},
-			Annotations: map[string]string{
-				"summary":     "High memory usage detected",
-				"description": "Memory usage is above 85% for more than 10 minutes",
-			},
-			Enabled:   true,
-			CreatedAt: now.Add(-48 * time.Hour),
-			UpdatedAt: now.Add(-24 * time.Hour),
-		},
+	rules, err := h.store.ListAlertRules(r.Context())
+	if err != nil {
+		h.logger.Error("error listing alert rules", "error", err)
+		respondQueryError(w, err, "Could not fetch alert rules")
+		return
 	}
 
-	respondJSON(w, http.StatusOK, rules)
+	httputil.RespondJSON(w, http.StatusOK, rules)
 }
 
 // GetAlertRule returns a specific alert rule by ID
 func (h *AlertsHandler) GetAlertRule(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	
-	// In a real implementation, this would fetch the alert rule from a database
-	now := time.Now()
-	
-	rule := AlertRule{
-		ID:          id,
-		Name:        "High CPU Usage Rule",
-		Description: "Alert when CPU usage is above threshold",
-		Query:       "cpu_usage{host=~\".*\"} > 90",
-		Threshold:   90.0,
-		Operator:    ">",
-		Severity:    "critical",
-		Labels: map[string]string{
-			"service": "system",
-			"team":    "infrastructure",
-		},
-		Annotations: map[string]string{
-			"summary":     "High CPU usage detected",
-			"description": "CPU usage is above 90% for more than 5 minutes",
-		},
-		Enabled:   true,
-		CreatedAt: now.Add(-24 * time.Hour),
-		UpdatedAt: now.Add(-12 * time.Hour),
+	rule, ok := h.loadAlertRule(w, r)
+	if !ok {
+		return
 	}
 
-	respondJSON(w, http.StatusOK, rule)
+	httputil.RespondJSON(w, http.StatusOK, rule)
 }
 
 // CreateAlertRule creates a new alert rule
 func (h *AlertsHandler) CreateAlertRule(w http.ResponseWriter, r *http.Request) {
-	var rule AlertRule
-	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request payload")
+	var rule database.AlertRule
+	if !httputil.DecodeJSON(w, r, &rule, h.cfg.Get().Server.MaxRequestBodyBytes) {
 		return
 	}
 
-	// In a real implementation, this would save the alert rule to a database
-	rule.ID = "new-rule-id"
-	rule.CreatedAt = time.Now()
-	rule.UpdatedAt = time.Now()
+	if err := validateAlertRule(&rule); err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	now := time.Now().UTC()
+	rule.ID = uuid.NewString()
+	rule.CreatedAt = now
+	rule.UpdatedAt = now
 	rule.Enabled = true
 
-	respondJSON(w, http.StatusCreated, rule)
+	if err := h.store.SaveAlertRule(r.Context(), rule); err != nil {
+		h.logger.Error("error creating alert rule", "error", err)
+		respondQueryError(w, err, "Could not create alert rule")
+		return
+	}
+
+	httputil.RespondJSON(w, http.StatusCreated, rule)
 }
 
 // UpdateAlertRule updates an existing alert rule
 func (h *AlertsHandler) UpdateAlertRule(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	
-	var rule AlertRule
-	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request payload")
+	existing, ok := h.loadAlertRule(w, r)
+	if !ok {
+		return
+	}
+
+	var rule database.AlertRule
+	if !httputil.DecodeJSON(w, r, &rule, h.cfg.Get().Server.MaxRequestBodyBytes) {
+		return
+	}
+
+	if err := validateAlertRule(&rule); err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, err.Error())
 		return
 	}
 
-	// In a real implementation, this would update the alert rule in a database
-	rule.ID = id
-	rule.UpdatedAt = time.Now()
+	rule.ID = existing.ID
+	rule.CreatedAt = existing.CreatedAt
+	rule.UpdatedAt = time.Now().UTC()
+
+	if err := h.store.SaveAlertRule(r.Context(), rule); err != nil {
+		h.logger.Error("error updating alert rule", "id", rule.ID, "error", err)
+		respondQueryError(w, err, "Could not update alert rule")
+		return
+	}
 
-	respondJSON(w, http.StatusOK, rule)
+	httputil.RespondJSON(w, http.StatusOK, rule)
 }
 
 // DeleteAlertRule deletes an alert rule
 func (h *AlertsHandler) DeleteAlertRule(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	
-	// In a real implementation, this would delete the alert rule from a database
-	h.logger.Printf("Deleting alert rule with ID: %s", id)
+	h.logger.Info("deleting alert rule", "id", id)
+
+	err := h.store.DeleteAlertRule(r.Context(), id)
+	if errors.Is(err, database.ErrAlertRuleNotFound) {
+		httputil.RespondError(w, http.StatusNotFound, httputil.CodeNotFound, fmt.Sprintf("Alert rule %s not found", id))
+		return
+	}
+	if err != nil {
+		h.logger.Error("error deleting alert rule", "id", id, "error", err)
+		respondQueryError(w, err, "Could not delete alert rule")
+		return
+	}
 
-	respondJSON(w, http.StatusOK, map[string]string{"message": "Alert rule deleted successfully"})
+	httputil.RespondJSON(w, http.StatusOK, map[string]string{"message": "Alert rule deleted successfully"})
 }
 
 // EnableAlertRule enables an alert rule
 func (h *AlertsHandler) EnableAlertRule(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	
-	// In a real implementation, this would enable the alert rule in a database
-	h.logger.Printf("Enabling alert rule with ID: %s", id)
-
-	// Return the updated rule
-	now := time.Now()
-	rule := AlertRule{
-		ID:          id,
-		Name:        "High CPU Usage Rule",
-		Description: "Alert when CPU usage is above threshold",
-		Query:       "cpu_usage{host=~\".*\"} > 90",
-		Threshold:   90.0,
-		Operator:    ">",
-		Severity:    "critical",
-		Labels: map[string]string{
-			"service": "system",
-			"team":    "infrastructure",
-		},
-		Annotations: map[string]string{
-			"summary":     "High CPU usage detected",
-			"description": "CPU usage is above 90% for more than 5 minutes",
-		},
-		Enabled:   true, // Set to enabled
-		CreatedAt: now.Add(-24 * time.Hour),
-		UpdatedAt: now, // Update time set to now
-	}
-
-	respondJSON(w, http.StatusOK, rule)
+	h.setAlertRuleEnabled(w, r, true)
 }
 
 // DisableAlertRule disables an alert rule
 func (h *AlertsHandler) DisableAlertRule(w http.ResponseWriter, r *http.Request) {
+	h.setAlertRuleEnabled(w, r, false)
+}
+
+// setAlertRuleEnabled stores a new version of the rule with the given enabled flag
+func (h *AlertsHandler) setAlertRuleEnabled(w http.ResponseWriter, r *http.Request, enabled bool) {
+	rule, ok := h.loadAlertRule(w, r)
+	if !ok {
+		return
+	}
+
+	h.logger.Info("setting alert rule enabled state", "id", rule.ID, "enabled", enabled)
+
+	rule.Enabled = enabled
+	rule.UpdatedAt = time.Now().UTC()
+
+	if err := h.store.SaveAlertRule(r.Context(), *rule); err != nil {
+		h.logger.Error("error updating alert rule", "id", rule.ID, "error", err)
+		respondQueryError(w, err, "Could not update alert rule")
+		return
+	}
+
+	httputil.RespondJSON(w, http.StatusOK, rule)
+}
+
+// loadAlertRule fetches the rule named by the {id} URL parameter, writing a
+// 404 or error response and returning false when it cannot be loaded
+func (h *AlertsHandler) loadAlertRule(w http.ResponseWriter, r *http.Request) (*database.AlertRule, bool) {
 	id := chi.URLParam(r, "id")
-	
-	// In a real implementation, this would disable the alert rule in a database
-	h.logger.Printf("Disabling alert rule with ID: %s", id)
-
-	// Return the updated rule
-	now := time.Now()
-	rule := AlertRule{
-		ID:          id,
-		Name:        "High CPU Usage Rule",
-		Description: "Alert when CPU usage is above threshold",
-		Query:       "cpu_usage{host=~\".*\"} > 90",
-		Threshold:   90.0,
-		Operator:    ">",
-		Severity:    "critical",
-		Labels: map[string]string{
-			"service": "system",
-			"team":    "infrastructure",
-		},
-		Annotations: map[string]string{
-			"summary":     "High CPU usage detected",
-			"description": "CPU usage is above 90% for more than 5 minutes",
-		},
-		Enabled:   false, // Set to disabled
-		CreatedAt: now.Add(-24 * time.Hour),
-		UpdatedAt: now, // Update time set to now
+
+	rule, err := h.store.GetAlertRule(r.Context(), id)
+	if errors.Is(err, database.ErrAlertRuleNotFound) {
+		httputil.RespondError(w, http.StatusNotFound, httputil.CodeNotFound, fmt.Sprintf("Alert rule %s not found", id))
+		return nil, false
+	}
+	if err != nil {
+		h.logger.Error("error fetching alert rule", "id", id, "error", err)
+		respondQueryError(w, err, "Could not fetch alert rule")
+		return nil, false
 	}
 
-	respondJSON(w, http.StatusOK, rule)
+	return rule, true
 }
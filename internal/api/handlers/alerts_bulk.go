@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/observio/backend/internal/api/httputil"
+	"github.com/observio/backend/internal/database"
+)
+
+// maxBulkAlertRules is the number of rules a bulk request may name
+const maxBulkAlertRules = 500
+
+// Actions of POST /alerts/rules/bulk
+const (
+	bulkActionEnable  = "enable"
+	bulkActionDisable = "disable"
+	bulkActionDelete  = "delete"
+)
+
+// BulkAlertRuleRequest is the body of POST /alerts/rules/bulk. With Atomic
+// set, the action is applied to every rule or to none of them.
+type BulkAlertRuleRequest struct {
+	IDs    []string `json:"ids"`
+	Action string   `json:"action"`
+	Atomic bool     `json:"atomic"`
+}
+
+// BulkAlertRuleResult is the outcome of the action for one rule: the rule as
+// stored afterwards, nothing for a deleted rule, or the error it failed with
+type BulkAlertRuleResult struct {
+	ID      string              `json:"id"`
+	Success bool                `json:"success"`
+	Rule    *database.AlertRule `json:"rule,omitempty"`
+	Error   *httputil.ErrorBody `json:"error,omitempty"`
+}
+
+// BulkAlertRuleResponse lists the result for every ID of the request, in
+// order. RolledBack is set when an atomic request failed after changing some
+// rules and those changes were undone.
+type BulkAlertRuleResponse struct {
+	Action     string                `json:"action"`
+	Succeeded  int                   `json:"succeeded"`
+	Failed     int                   `json:"failed"`
+	RolledBack bool                  `json:"rolledBack,omitempty"`
+	Results    []BulkAlertRuleResult `json:"results"`
+}
+
+// BulkUpdateAlertRules enables, disables or deletes several alert rules. Each
+// rule is updated like by its own endpoint and a failure is reported in its
+// result without stopping the others, unless the request is atomic: then
+// every rule is loaded before any is changed, and a failed write undoes the
+// writes before it. The store has no transactions, so the undo writes a new
+// version of each rule restoring its previous state.
+func (h *AlertsHandler) BulkUpdateAlertRules(w http.ResponseWriter, r *http.Request) {
+	var req BulkAlertRuleRequest
+	if !httputil.DecodeJSON(w, r, &req, h.cfg.Get().Server.MaxRequestBodyBytes) {
+		return
+	}
+	if err := validateBulkAlertRuleRequest(req); err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	h.logger.Info("applying bulk alert rule action", "action", req.Action, "rules", len(req.IDs), "atomic", req.Atomic)
+
+	var resp BulkAlertRuleResponse
+	if req.Atomic {
+		resp = h.applyBulkAtomically(r.Context(), req)
+	} else {
+		resp = BulkAlertRuleResponse{Action: req.Action, Results: make([]BulkAlertRuleResult, len(req.IDs))}
+		for i, id := range req.IDs {
+			rule, err := h.store.GetAlertRule(r.Context(), id)
+			if err == nil {
+				rule, err = h.applyBulkAction(r.Context(), req.Action, rule)
+			}
+			resp.Results[i] = h.bulkResult(id, rule, err)
+		}
+	}
+
+	for _, result := range resp.Results {
+		if result.Success {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+	}
+	httputil.RespondJSON(w, http.StatusOK, resp)
+}
+
+// validateBulkAlertRuleRequest checks the action and the list of IDs
+func validateBulkAlertRuleRequest(req BulkAlertRuleRequest) error {
+	switch req.Action {
+	case bulkActionEnable, bulkActionDisable, bulkActionDelete:
+	default:
+		return fmt.Errorf("action must be one of %s, %s or %s, got %q", bulkActionEnable, bulkActionDisable, bulkActionDelete, req.Action)
+	}
+	if len(req.IDs) == 0 {
+		return fmt.Errorf("ids must list at least one rule")
+	}
+	if len(req.IDs) > maxBulkAlertRules {
+		return fmt.Errorf("a bulk request cannot name more than %d rules, got %d", maxBulkAlertRules, len(req.IDs))
+	}
+
+	seen := make(map[string]bool, len(req.IDs))
+	for i, id := range req.IDs {
+		if id == "" {
+			return fmt.Errorf("ids[%d] is empty", i)
+		}
+		if seen[id] {
+			return fmt.Errorf("ids[%d]: duplicate id %q", i, id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// applyBulkAtomically applies the action to every rule of req or to none
+func (h *AlertsHandler) applyBulkAtomically(ctx context.Context, req BulkAlertRuleRequest) BulkAlertRuleResponse {
+	resp := BulkAlertRuleResponse{Action: req.Action, Results: make([]BulkAlertRuleResult, len(req.IDs))}
+
+	rules := make([]*database.AlertRule, len(req.IDs))
+	failed := false
+	for i, id := range req.IDs {
+		rule, err := h.store.GetAlertRule(ctx, id)
+		if err != nil {
+			resp.Results[i] = h.bulkResult(id, nil, err)
+			failed = true
+			continue
+		}
+		rules[i] = rule
+	}
+	if failed {
+		markNotApplied(resp.Results, req.IDs, "Not applied, as another rule of the request could not be loaded")
+		return resp
+	}
+
+	for i, rule := range rules {
+		updated, err := h.applyBulkAction(ctx, req.Action, rule)
+		if err == nil {
+			resp.Results[i] = h.bulkResult(rule.ID, updated, nil)
+			continue
+		}
+
+		resp.Results[i] = h.bulkResult(rule.ID, nil, err)
+		// Undo the rules changed so far, newest first
+		for j := i - 1; j >= 0; j-- {
+			restored := *rules[j]
+			restored.UpdatedAt = time.Now().UTC()
+			if err := h.store.SaveAlertRule(ctx, restored); err != nil {
+				h.logger.Error("error restoring alert rule after a failed bulk action", "id", restored.ID, "error", err)
+				resp.Results[j].Error = &httputil.ErrorBody{Code: httputil.CodeQueryFailed,
+					Message: "Applied, but could not be undone after another rule of the request failed"}
+				continue
+			}
+			resp.Results[j] = BulkAlertRuleResult{ID: restored.ID}
+		}
+		resp.RolledBack = true
+		markNotApplied(resp.Results, req.IDs, "Not applied, as another rule of the request failed")
+		return resp
+	}
+	return resp
+}
+
+// markNotApplied reports every rule without a result or error as not applied
+func markNotApplied(results []BulkAlertRuleResult, ids []string, message string) {
+	for i := range results {
+		if results[i].Error != nil {
+			continue
+		}
+		results[i] = BulkAlertRuleResult{ID: ids[i],
+			Error: &httputil.ErrorBody{Code: httputil.CodeConflict, Message: message}}
+	}
+}
+
+// applyBulkAction applies action to rule, returning the rule as stored, or
+// nil for a deleted rule
+func (h *AlertsHandler) applyBulkAction(ctx context.Context, action string, rule *database.AlertRule) (*database.AlertRule, error) {
+	if action == bulkActionDelete {
+		return nil, h.store.DeleteAlertRule(ctx, rule.ID)
+	}
+
+	updated := *rule
+	updated.Enabled = action == bulkActionEnable
+	updated.UpdatedAt = time.Now().UTC()
+	if err := h.store.SaveAlertRule(ctx, updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// bulkResult builds the result for one rule, logging unexpected errors
+func (h *AlertsHandler) bulkResult(id string, rule *database.AlertRule, err error) BulkAlertRuleResult {
+	if errors.Is(err, database.ErrAlertRuleNotFound) {
+		return BulkAlertRuleResult{ID: id,
+			Error: &httputil.ErrorBody{Code: httputil.CodeNotFound, Message: fmt.Sprintf("Alert rule %s not found", id)}}
+	}
+	if err != nil {
+		h.logger.Error("error applying bulk alert rule action", "id", id, "error", err)
+		_, body := queryError(err, "Could not update alert rule")
+		return BulkAlertRuleResult{ID: id, Error: &body}
+	}
+	return BulkAlertRuleResult{ID: id, Success: true, Rule: rule}
+}
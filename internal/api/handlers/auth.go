@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/observio/backend/internal/api/httputil"
+	"github.com/observio/backend/internal/auth"
+	"github.com/observio/backend/internal/config"
+	"github.com/observio/backend/internal/logging"
+)
+
+// AuthHandler issues tokens for the users listed in the auth config
+type AuthHandler struct {
+	cfg    *config.Live
+	logger logging.Logger
+}
+
+// LoginRequest represents the credentials posted to /auth/login
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// LoginResponse represents an issued bearer token
+type LoginResponse struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"tokenType"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// NewAuthHandler creates a new handler for authentication endpoints
+func NewAuthHandler(cfg *config.Live, logger logging.Logger) http.Handler {
+	h := &AuthHandler{
+		cfg:    cfg,
+		logger: logger,
+	}
+
+	r := chi.NewRouter()
+	r.Post("/login", h.Login)
+
+	return r
+}
+
+// Login checks the posted credentials and returns a signed token
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	cfg := h.cfg.Get()
+	if cfg.Auth.JWTSecret == "" {
+		httputil.RespondError(w, http.StatusNotFound, httputil.CodeNotFound, "Authentication is not enabled")
+		return
+	}
+
+	var req LoginRequest
+	if !httputil.DecodeJSON(w, r, &req, cfg.Server.MaxRequestBodyBytes) {
+		return
+	}
+
+	if !h.validCredentials(req.Username, req.Password) {
+		h.logger.Warn("failed login attempt", "user", req.Username)
+		httputil.RespondError(w, http.StatusUnauthorized, httputil.CodeUnauthorized, "Invalid username or password")
+		return
+	}
+
+	ttl := time.Duration(cfg.Auth.JWTExpirationMinutes) * time.Minute
+	token, claims, err := auth.IssueToken(cfg.Auth.JWTSecret, req.Username, ttl)
+	if err != nil {
+		h.logger.Error("error issuing token", "user", req.Username, "error", err)
+		httputil.RespondError(w, http.StatusInternalServerError, httputil.CodeInternal, "Could not issue token")
+		return
+	}
+
+	httputil.RespondJSON(w, http.StatusOK, LoginResponse{
+		Token:     token,
+		TokenType: "Bearer",
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0).UTC(),
+	})
+}
+
+// validCredentials compares against every configured user in constant time
+func (h *AuthHandler) validCredentials(username, password string) bool {
+	if username == "" || password == "" {
+		return false
+	}
+
+	valid := false
+	for _, user := range h.cfg.Get().Auth.Users {
+		userMatch := subtle.ConstantTimeCompare([]byte(user.Username), []byte(username))
+		passwordMatch := subtle.ConstantTimeCompare([]byte(user.Password), []byte(password))
+		if userMatch&passwordMatch == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
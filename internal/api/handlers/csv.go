@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvContentType is the media type for CSV downloads
+const csvContentType = "text/csv"
+
+// csvErrorTrailer is the HTTP trailer that reports a query failing mid-stream
+// when the connection cannot be closed, e.g. over HTTP/2
+const csvErrorTrailer = "X-Stream-Error"
+
+// csvFilenameUnsafe matches characters not allowed in a download filename
+var csvFilenameUnsafe = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// wantsCSV reports whether the client asked for CSV via Accept or ?format=csv
+func wantsCSV(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "csv" ||
+		strings.Contains(r.Header.Get("Accept"), csvContentType)
+}
+
+// csvWriter streams rows as CSV with a header row taken from the result columns
+type csvWriter struct {
+	w        http.ResponseWriter
+	csv      *csv.Writer
+	flusher  http.Flusher
+	filename string
+	columns  []string
+	started  bool
+	pending  int
+}
+
+// newCSVWriter creates a streaming CSV writer that downloads as filename
+func newCSVWriter(w http.ResponseWriter, filename string) *csvWriter {
+	flusher, _ := w.(http.Flusher)
+	return &csvWriter{
+		w:        w,
+		csv:      csv.NewWriter(w),
+		flusher:  flusher,
+		filename: csvFilenameUnsafe.ReplaceAllString(filename, "_"),
+	}
+}
+
+// Start sends the response headers; it is safe to call more than once
+func (c *csvWriter) Start() {
+	if c.started {
+		return
+	}
+	c.started = true
+	c.w.Header().Set("Content-Type", csvContentType+"; charset=utf-8")
+	c.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", c.filename))
+	c.w.Header().Set("Cache-Control", "no-cache")
+	c.w.Header().Add("Trailer", csvErrorTrailer)
+	c.w.WriteHeader(http.StatusOK)
+}
+
+// Columns writes the header row and fixes the column order of later rows
+func (c *csvWriter) Columns(columns, columnTypes []string) error {
+	c.columns = columns
+	c.Start()
+	return c.csv.Write(columns)
+}
+
+// WriteRow writes a single row in header order, flushing periodically
+func (c *csvWriter) WriteRow(row map[string]interface{}) error {
+	c.Start()
+	record := make([]string, len(c.columns))
+	for i, col := range c.columns {
+		record[i] = csvValue(row[col])
+	}
+	if err := c.csv.Write(record); err != nil {
+		return err
+	}
+	c.pending++
+	if c.pending >= ndjsonFlushEvery {
+		c.Flush()
+	}
+	return nil
+}
+
+// Started reports whether headers have already been sent
+func (c *csvWriter) Started() bool {
+	return c.started
+}
+
+// WriteError ends a failed download. CSV has no way to mark an error in the
+// body, so the connection is closed before the end of the chunked response and
+// the client sees a truncated transfer instead of silently partial data. When
+// the connection cannot be taken over the error is sent in csvErrorTrailer.
+func (c *csvWriter) WriteError(code, message string) {
+	c.Flush()
+	conn, _, err := http.NewResponseController(c.w).Hijack()
+	if err != nil {
+		c.w.Header().Set(csvErrorTrailer, code+": "+message)
+		return
+	}
+	conn.Close()
+}
+
+// Flush pushes buffered rows to the client
+func (c *csvWriter) Flush() {
+	c.pending = 0
+	c.csv.Flush()
+	if c.flusher != nil {
+		c.flusher.Flush()
+	}
+}
+
+// Finish ends a successful download, sending the headers if no row was written
+func (c *csvWriter) Finish() {
+	c.Start()
+	c.Flush()
+}
+
+// csvValue formats a value the same way the JSON responses do: timestamps as
+// RFC3339, maps and slices as JSON, and NULL as an empty cell
+func csvValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		return csvValue(v.Elem().Interface())
+	}
+
+	switch val := value.(type) {
+	case string:
+		return val
+	case time.Time:
+		return val.Format(time.RFC3339)
+	case bool:
+		return strconv.FormatBool(val)
+	case float32:
+		return strconv.FormatFloat(float64(val), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	}
+
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Sprint(value)
+		}
+		return string(encoded)
+	}
+
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// failingCSV writes a header and one row, then fails the download
+func failingCSV(w http.ResponseWriter, r *http.Request) {
+	stream := newCSVWriter(w, "query.csv")
+	stream.Columns([]string{"Body"}, []string{"String"})
+	stream.WriteRow(map[string]interface{}{"Body": "first"})
+	stream.WriteError("QUERY_FAILED", "Query failed while streaming results")
+}
+
+func TestCSVWriteErrorClosesConnection(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(failingCSV))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("reading the body returned %v, want a truncated transfer", err)
+	}
+	if string(body) != "Body\nfirst\n" {
+		t.Errorf("body is %q, want the rows written before the error", body)
+	}
+}
+
+func TestCSVWriteErrorSetsTrailer(t *testing.T) {
+	rec := httptest.NewRecorder()
+	failingCSV(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	trailer := rec.Result().Trailer.Get(csvErrorTrailer)
+	if !strings.HasPrefix(trailer, "QUERY_FAILED") {
+		t.Errorf("%s trailer is %q, want the error when the connection cannot be closed", csvErrorTrailer, trailer)
+	}
+}
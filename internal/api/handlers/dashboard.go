@@ -1,206 +1,217 @@
 package handlers
 
 import (
-	"encoding/json"
-	"log"
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/observio/backend/internal/api/httputil"
+	"github.com/observio/backend/internal/auth"
 	"github.com/observio/backend/internal/config"
+	"github.com/observio/backend/internal/database"
+	"github.com/observio/backend/internal/logging"
 )
 
 // DashboardHandler handles dashboard-related API endpoints
 type DashboardHandler struct {
-	cfg    *config.Config
-	logger *log.Logger
+	cfg     *config.Live
+	logger  logging.Logger
+	store   DashboardStore
+	sources *DataSources
+	queries PanelQueryChecker
 }
 
-// Dashboard represents a monitoring dashboard
-type Dashboard struct {
-	ID          string    `json:"id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Panels      []Panel   `json:"panels"`
-	CreatedAt   time.Time `json:"createdAt"`
-	UpdatedAt   time.Time `json:"updatedAt"`
-	CreatedBy   string    `json:"createdBy"`
+// DashboardStore persists dashboards; *database.ClickHouseClient and
+// *database.MemoryDashboardStore implement it
+type DashboardStore interface {
+	ListDashboards(ctx context.Context) ([]database.Dashboard, error)
+	GetDashboard(ctx context.Context, id string) (*database.Dashboard, error)
+	SaveDashboard(ctx context.Context, dashboard database.Dashboard) error
+	DeleteDashboard(ctx context.Context, id string) error
 }
 
-// Panel represents a visualization panel within a dashboard
-type Panel struct {
-	ID          string                 `json:"id"`
-	Title       string                 `json:"title"`
-	Type        string                 `json:"type"` // graph, singlestat, table, etc.
-	Query       string                 `json:"query"`
-	DataSource  string                 `json:"dataSource"`
-	Position    map[string]int         `json:"position"` // x, y, w, h
-	Options     map[string]interface{} `json:"options"`
-}
+// anonymousUser is recorded as the creator when authentication is disabled
+const anonymousUser = "anonymous"
 
-// NewDashboardHandler creates a new dashboard handler
-func NewDashboardHandler(cfg *config.Config, logger *log.Logger) http.Handler {
+// NewDashboardHandler creates a new dashboard handler; every endpoint responds
+// with 503 when store is nil. Data source references are resolved against
+// sources on save, export and import, and the queries of panels using a
+// ClickHouse data source are checked with queries unless it is nil.
+func NewDashboardHandler(cfg *config.Live, logger logging.Logger, store DashboardStore, sources *DataSources, queries PanelQueryChecker) http.Handler {
 	h := &DashboardHandler{
-		cfg:    cfg,
-		logger: logger,
+		cfg:     cfg,
+		logger:  logger,
+		store:   store,
+		sources: sources,
+		queries: queries,
 	}
 
 	r := chi.NewRouter()
+	r.Use(h.requireStore)
 	r.Get("/", h.ListDashboards)
 	r.Post("/", h.CreateDashboard)
+	r.Post("/import", h.ImportDashboard)
 	r.Get("/{id}", h.GetDashboard)
 	r.Put("/{id}", h.UpdateDashboard)
 	r.Delete("/{id}", h.DeleteDashboard)
+	r.Get("/{id}/export", h.ExportDashboard)
 	
 	return r
 }
 
+// requireStore rejects dashboard requests when no dashboard storage is configured
+func (h *DashboardHandler) requireStore(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.store == nil {
+			httputil.RespondError(w, http.StatusServiceUnavailable, httputil.CodeServiceUnavailable, "Dashboard storage is unavailable")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // ListDashboards returns a list of all dashboards
 func (h *DashboardHandler) ListDashboards(w http.ResponseWriter, r *http.Request) {
-	// In a real implementation, this would fetch dashboards from a database
-	dashboards := []Dashboard{
-		{
-			ID:          "dashboard-1",
-			Title:       "System Overview",
-			Description: "Overview of system metrics",
-			CreatedAt:   time.Now().Add(-24 * time.Hour),
-			UpdatedAt:   time.Now().Add(-12 * time.Hour),
-			CreatedBy:   "admin",
-			Panels: []Panel{
-				{
-					ID:         "panel-1",
-					Title:      "CPU Usage",
-					Type:       "graph",
-					Query:      "cpu_usage{host=~\".*\"}",
-					DataSource: "prometheus",
-					Position:   map[string]int{"x": 0, "y": 0, "w": 12, "h": 8},
-				},
-				{
-					ID:         "panel-2",
-					Title:      "Memory Usage",
-					Type:       "graph",
-					Query:      "memory_usage{host=~\".*\"}",
-					DataSource: "prometheus",
-					Position:   map[string]int{"x": 12, "y": 0, "w": 12, "h": 8},
-				},
-			},
-		},
-		{
-			ID:          "dashboard-2",
-			Title:       "Application Performance",
-			Description: "Application performance metrics",
-			CreatedAt:   time.Now().Add(-48 * time.Hour),
-			UpdatedAt:   time.Now().Add(-24 * time.Hour),
-			CreatedBy:   "admin",
-			Panels: []Panel{
-				{
-					ID:         "panel-3",
-					Title:      "Request Duration",
-					Type:       "graph",
-					Query:      "request_duration{service=~\".*\"}",
-					DataSource: "prometheus",
-					Position:   map[string]int{"x": 0, "y": 0, "w": 24, "h": 8},
-				},
-				{
-					ID:         "panel-4",
-					Title:      "Error Rate",
-					Type:       "graph",
-					Query:      "error_rate{service=~\".*\"}",
-					DataSource: "prometheus",
-					Position:   map[string]int{"x": 0, "y": 8, "w": 12, "h": 8},
-				},
-				{
-					ID:         "panel-5",
-					Title:      "Throughput",
-					Type:       "graph",
-					Query:      "throughput{service=~\".*\"}",
-					DataSource: "prometheus",
-					Position:   map[string]int{"x": 12, "y": 8, "w": 12, "h": 8},
-				},
-			},
-		},
+	dashboards, err := h.store.ListDashboards(r.Context())
+	if err != nil {
+		h.logger.Error("error listing dashboards", "error", err)
+		respondQueryError(w, err, "Could not fetch dashboards")
+		return
 	}
 
-	respondJSON(w, http.StatusOK, dashboards)
+	httputil.RespondJSON(w, http.StatusOK, dashboards)
 }
 
 // GetDashboard returns a specific dashboard by ID
 func (h *DashboardHandler) GetDashboard(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	
-	// In a real implementation, this would fetch the dashboard from a database
-	dashboard := Dashboard{
-		ID:          id,
-		Title:       "System Overview",
-		Description: "Overview of system metrics",
-		CreatedAt:   time.Now().Add(-24 * time.Hour),
-		UpdatedAt:   time.Now().Add(-12 * time.Hour),
-		CreatedBy:   "admin",
-		Panels: []Panel{
-			{
-				ID:         "panel-1",
-				Title:      "CPU Usage",
-				Type:       "graph",
-				Query:      "cpu_usage{host=~\".*\"}",
-				DataSource: "prometheus",
-				Position:   map[string]int{"x": 0, "y": 0, "w": 12, "h": 8},
-			},
-			{
-				ID:         "panel-2",
-				Title:      "Memory Usage",
-				Type:       "graph",
-				Query:      "memory_usage{host=~\".*\"}",
-				DataSource: "prometheus",
-				Position:   map[string]int{"x": 12, "y": 0, "w": 12, "h": 8},
-			},
-		},
+	dashboard, ok := h.loadDashboard(w, r)
+	if !ok {
+		return
 	}
 
-	respondJSON(w, http.StatusOK, dashboard)
+	httputil.RespondJSON(w, http.StatusOK, dashboard)
 }
 
-// CreateDashboard creates a new dashboard
+// CreateDashboard creates a new dashboard owned by the authenticated user,
+// reporting problems found in its panels as warnings
 func (h *DashboardHandler) CreateDashboard(w http.ResponseWriter, r *http.Request) {
-	var dashboard Dashboard
-	if err := json.NewDecoder(r.Body).Decode(&dashboard); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request payload")
+	var dashboard database.Dashboard
+	if !httputil.DecodeJSON(w, r, &dashboard, h.cfg.Get().Server.MaxRequestBodyBytes) {
 		return
 	}
 
-	// In a real implementation, this would save the dashboard to a database
-	// For now, we'll just return the dashboard with a generated ID
-	dashboard.ID = "new-dashboard-id"
-	dashboard.CreatedAt = time.Now()
-	dashboard.UpdatedAt = time.Now()
-	dashboard.CreatedBy = "current-user" // In a real app, this would come from auth context
+	now := time.Now().UTC()
+	dashboard.ID = uuid.NewString()
+	dashboard.CreatedAt = now
+	dashboard.UpdatedAt = now
+	dashboard.CreatedBy = currentUser(r)
+	dashboard.Panels = assignPanelIDs(dashboard.Panels)
+
+	if err := h.store.SaveDashboard(r.Context(), dashboard); err != nil {
+		h.logger.Error("error creating dashboard", "error", err)
+		respondQueryError(w, err, "Could not create dashboard")
+		return
+	}
 
-	respondJSON(w, http.StatusCreated, dashboard)
+	httputil.RespondJSON(w, http.StatusCreated, DashboardSaveResponse{
+		Dashboard: dashboard,
+		Warnings:  h.validatePanels(r, dashboard),
+	})
 }
 
-// UpdateDashboard updates an existing dashboard
+// UpdateDashboard replaces an existing dashboard, keeping its creator and
+// creation time, and reports problems found in its panels as warnings
 func (h *DashboardHandler) UpdateDashboard(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	
-	var dashboard Dashboard
-	if err := json.NewDecoder(r.Body).Decode(&dashboard); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request payload")
+	existing, ok := h.loadDashboard(w, r)
+	if !ok {
+		return
+	}
+
+	var dashboard database.Dashboard
+	if !httputil.DecodeJSON(w, r, &dashboard, h.cfg.Get().Server.MaxRequestBodyBytes) {
 		return
 	}
 
-	// In a real implementation, this would update the dashboard in a database
-	dashboard.ID = id
-	dashboard.UpdatedAt = time.Now()
+	dashboard.ID = existing.ID
+	dashboard.CreatedAt = existing.CreatedAt
+	dashboard.CreatedBy = existing.CreatedBy
+	dashboard.UpdatedAt = time.Now().UTC()
+	dashboard.Panels = assignPanelIDs(dashboard.Panels)
 
-	respondJSON(w, http.StatusOK, dashboard)
+	if err := h.store.SaveDashboard(r.Context(), dashboard); err != nil {
+		h.logger.Error("error updating dashboard", "id", dashboard.ID, "error", err)
+		respondQueryError(w, err, "Could not update dashboard")
+		return
+	}
+
+	httputil.RespondJSON(w, http.StatusOK, DashboardSaveResponse{
+		Dashboard: dashboard,
+		Warnings:  h.validatePanels(r, dashboard),
+	})
 }
 
 // DeleteDashboard deletes a dashboard
 func (h *DashboardHandler) DeleteDashboard(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	
-	// In a real implementation, this would delete the dashboard from a database
-	h.logger.Printf("Deleting dashboard with ID: %s", id)
+	h.logger.Info("deleting dashboard", "id", id)
 
-	// Return a success message
-	respondJSON(w, http.StatusOK, map[string]string{"message": "Dashboard deleted successfully"})
+	err := h.store.DeleteDashboard(r.Context(), id)
+	if errors.Is(err, database.ErrDashboardNotFound) {
+		httputil.RespondError(w, http.StatusNotFound, httputil.CodeNotFound, fmt.Sprintf("Dashboard %s not found", id))
+		return
+	}
+	if err != nil {
+		h.logger.Error("error deleting dashboard", "id", id, "error", err)
+		respondQueryError(w, err, "Could not delete dashboard")
+		return
+	}
+
+	httputil.RespondJSON(w, http.StatusOK, map[string]string{"message": "Dashboard deleted successfully"})
+}
+
+// loadDashboard fetches the dashboard named by the {id} URL parameter, writing a
+// 404 or error response and returning false when it cannot be loaded
+func (h *DashboardHandler) loadDashboard(w http.ResponseWriter, r *http.Request) (*database.Dashboard, bool) {
+	id := chi.URLParam(r, "id")
+
+	dashboard, err := h.store.GetDashboard(r.Context(), id)
+	if errors.Is(err, database.ErrDashboardNotFound) {
+		httputil.RespondError(w, http.StatusNotFound, httputil.CodeNotFound, fmt.Sprintf("Dashboard %s not found", id))
+		return nil, false
+	}
+	if err != nil {
+		h.logger.Error("error fetching dashboard", "id", id, "error", err)
+		respondQueryError(w, err, "Could not fetch dashboard")
+		return nil, false
+	}
+
+	return dashboard, true
+}
+
+// assignPanelIDs gives every panel without an ID a new one; a nil slice
+// becomes empty so the dashboard serializes with "panels": []
+func assignPanelIDs(panels []database.Panel) []database.Panel {
+	if panels == nil {
+		return []database.Panel{}
+	}
+	for i := range panels {
+		if panels[i].ID == "" {
+			panels[i].ID = uuid.NewString()
+		}
+	}
+	return panels
+}
+
+// currentUser returns the authenticated user of the request, or anonymousUser
+// when authentication is disabled
+func currentUser(r *http.Request) string {
+	if user, ok := auth.UserFromContext(r.Context()); ok {
+		return user
+	}
+	return anonymousUser
 }
@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/observio/backend/internal/api/httputil"
+	"github.com/observio/backend/internal/database"
+)
+
+// dashboardExportSchemaVersion is the version of the export document format
+const dashboardExportSchemaVersion = 1
+
+// DashboardExport is a self-contained dashboard document modelled on Grafana's
+// dashboard JSON: panels carry a gridPos and query targets, and data sources are
+// referenced by name so the document can be imported into another environment.
+// A dashboard exported from Grafana imports as well: its schemaVersion is
+// above dashboardExportSchemaVersion, and the fields Grafana adds are ignored.
+type DashboardExport struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	Title         string          `json:"title"`
+	Description   string          `json:"description"`
+	Panels        []ExportedPanel `json:"panels"`
+	DataSources   []string        `json:"dataSources"`
+	ExportedAt    *time.Time      `json:"exportedAt,omitempty"`
+	// Inputs are the data source variables of a Grafana dashboard exported
+	// for sharing externally, whose panels use "${DS_NAME}" as data source
+	Inputs []GrafanaInput `json:"__inputs,omitempty"`
+}
+
+// ExportedPanel is a panel in Grafana's shape
+type ExportedPanel struct {
+	ID         PanelID                `json:"id"`
+	Title      string                 `json:"title"`
+	Type       string                 `json:"type"`
+	DataSource PanelDataSource        `json:"datasource"`
+	Targets    []ExportedTarget       `json:"targets"`
+	GridPos    map[string]int         `json:"gridPos"`
+	Options    map[string]interface{} `json:"options,omitempty"`
+	// Panels are the panels of a collapsed Grafana row
+	Panels []ExportedPanel `json:"panels,omitempty"`
+}
+
+// ExportedTarget holds a panel query: Expr for query languages such as
+// PromQL, RawSQL for the SQL data sources of Grafana
+type ExportedTarget struct {
+	RefID  string `json:"refId"`
+	Expr   string `json:"expr"`
+	RawSQL string `json:"rawSql,omitempty"`
+}
+
+// GrafanaInput is an entry of the __inputs of a Grafana export
+type GrafanaInput struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Type  string `json:"type"`
+}
+
+// PanelID is a panel ID, which Grafana writes as a number
+type PanelID string
+
+// UnmarshalJSON accepts a string or a number
+func (id *PanelID) UnmarshalJSON(data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(trimmed, []byte("null")):
+		*id = ""
+		return nil
+	case len(trimmed) > 0 && trimmed[0] == '"':
+		return json.Unmarshal(trimmed, (*string)(id))
+	}
+	var number json.Number
+	if err := json.Unmarshal(trimmed, &number); err != nil {
+		return &json.UnmarshalTypeError{Value: string(trimmed), Type: reflect.TypeOf(""), Field: "id"}
+	}
+	*id = PanelID(number)
+	return nil
+}
+
+// PanelDataSource is a data source reference: a name, or in Grafana since
+// version 8 an object whose uid names the data source
+type PanelDataSource string
+
+// UnmarshalJSON accepts "name" or {"type": ..., "uid": ...}
+func (ds *PanelDataSource) UnmarshalJSON(data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(trimmed, []byte("null")):
+		*ds = ""
+		return nil
+	case len(trimmed) > 0 && trimmed[0] == '"':
+		return json.Unmarshal(trimmed, (*string)(ds))
+	case len(trimmed) > 0 && trimmed[0] == '{':
+		var ref struct {
+			UID string `json:"uid"`
+		}
+		if err := json.Unmarshal(trimmed, &ref); err != nil {
+			return err
+		}
+		*ds = PanelDataSource(ref.UID)
+		return nil
+	}
+	return &json.UnmarshalTypeError{Value: string(trimmed), Type: reflect.TypeOf(""), Field: "datasource"}
+}
+
+// DashboardImportResponse is the dashboard created by an import, plus any
+// problems that did not prevent it
+type DashboardImportResponse struct {
+	Dashboard database.Dashboard `json:"dashboard"`
+	Warnings  []string           `json:"warnings"`
+}
+
+// ExportDashboard returns a dashboard as a DashboardExport document
+func (h *DashboardHandler) ExportDashboard(w http.ResponseWriter, r *http.Request) {
+	dashboard, ok := h.loadDashboard(w, r)
+	if !ok {
+		return
+	}
+
+	doc := exportDashboard(*dashboard, h.sources.List())
+	now := time.Now().UTC()
+	doc.ExportedAt = &now
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "dashboard-"+dashboard.ID+".json"))
+	httputil.RespondJSON(w, http.StatusOK, doc)
+}
+
+// ImportDashboard creates a new dashboard from a DashboardExport document,
+// mapping data source names to local IDs. Unknown data sources are reported
+// as warnings and the panel keeps the original reference.
+func (h *DashboardHandler) ImportDashboard(w http.ResponseWriter, r *http.Request) {
+	var doc DashboardExport
+	if !httputil.DecodeJSONLenient(w, r, &doc, h.cfg.Get().Server.MaxRequestBodyBytes) {
+		return
+	}
+
+	if doc.SchemaVersion < 1 {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest,
+			fmt.Sprintf("Unsupported schemaVersion %d (supported: %d, or a Grafana dashboard)", doc.SchemaVersion, dashboardExportSchemaVersion))
+		return
+	}
+	if doc.Title == "" {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, "Title is required")
+		return
+	}
+
+	dashboard, warnings := importDashboard(doc, h.sources.List())
+
+	now := time.Now().UTC()
+	dashboard.ID = uuid.NewString()
+	dashboard.CreatedAt = now
+	dashboard.UpdatedAt = now
+	dashboard.CreatedBy = currentUser(r)
+	dashboard.Panels = assignPanelIDs(dashboard.Panels)
+
+	if err := h.store.SaveDashboard(r.Context(), dashboard); err != nil {
+		h.logger.Error("error importing dashboard", "error", err)
+		respondQueryError(w, err, "Could not import dashboard")
+		return
+	}
+
+	httputil.RespondJSON(w, http.StatusCreated, DashboardImportResponse{
+		Dashboard: dashboard,
+		Warnings:  warnings,
+	})
+}
+
+// exportDashboard converts a dashboard to its export document, replacing data
+// source IDs with names
+func exportDashboard(dashboard database.Dashboard, dataSources []DataSource) DashboardExport {
+	doc := DashboardExport{
+		SchemaVersion: dashboardExportSchemaVersion,
+		Title:         dashboard.Title,
+		Description:   dashboard.Description,
+		Panels:        make([]ExportedPanel, 0, len(dashboard.Panels)),
+		DataSources:   []string{},
+	}
+
+	seen := make(map[string]bool)
+	for _, panel := range dashboard.Panels {
+		name := panel.DataSource
+		if ds, ok := findDataSourceIn(dataSources, panel.DataSource); ok {
+			name = ds.Name
+		}
+		if name != "" && !seen[name] {
+			seen[name] = true
+			doc.DataSources = append(doc.DataSources, name)
+		}
+
+		exported := ExportedPanel{
+			ID:         PanelID(panel.ID),
+			Title:      panel.Title,
+			Type:       panel.Type,
+			DataSource: PanelDataSource(name),
+			Targets:    []ExportedTarget{},
+			GridPos:    panel.Position,
+			Options:    panel.Options,
+		}
+		if panel.Query != "" {
+			exported.Targets = append(exported.Targets, ExportedTarget{RefID: "A", Expr: panel.Query})
+		}
+		doc.Panels = append(doc.Panels, exported)
+	}
+
+	return doc
+}
+
+// importDashboard converts an export document back to a dashboard, replacing
+// data source names with local IDs and returning a warning for each name that
+// has no local match. Grafana rows are dropped and the panels of collapsed
+// rows imported in their place.
+func importDashboard(doc DashboardExport, dataSources []DataSource) (database.Dashboard, []string) {
+	var panels []ExportedPanel
+	for _, exported := range doc.Panels {
+		if exported.Type == "row" {
+			panels = append(panels, exported.Panels...)
+			continue
+		}
+		panels = append(panels, exported)
+	}
+
+	dashboard := database.Dashboard{
+		Title:       doc.Title,
+		Description: doc.Description,
+		Panels:      make([]database.Panel, 0, len(panels)),
+	}
+	warnings := []string{}
+
+	for i, exported := range panels {
+		dataSource := doc.inputLabel(string(exported.DataSource))
+		if dataSource != "" {
+			if ds, ok := findDataSourceIn(dataSources, dataSource); ok {
+				dataSource = ds.ID
+			} else {
+				warnings = append(warnings, fmt.Sprintf("Panel %d (%q) references unknown data source %q", i, exported.Title, dataSource))
+			}
+		}
+
+		panel := database.Panel{
+			ID:         string(exported.ID),
+			Title:      exported.Title,
+			Type:       exported.Type,
+			DataSource: dataSource,
+			Position:   exported.GridPos,
+			Options:    exported.Options,
+		}
+		if len(exported.Targets) > 0 {
+			panel.Query = exported.Targets[0].Expr
+			if panel.Query == "" {
+				panel.Query = exported.Targets[0].RawSQL
+			}
+		}
+		if len(exported.Targets) > 1 {
+			warnings = append(warnings, fmt.Sprintf("Panel %d (%q) has %d queries; only the first was imported", i, exported.Title, len(exported.Targets)))
+		}
+		dashboard.Panels = append(dashboard.Panels, panel)
+	}
+
+	return dashboard, warnings
+}
+
+// inputLabel resolves a "${DS_NAME}" data source variable to the label of
+// its input, the name of the data source in the exporting Grafana. Any other
+// reference is returned unchanged.
+func (doc DashboardExport) inputLabel(ref string) string {
+	name, ok := strings.CutPrefix(ref, "${")
+	if !ok {
+		return ref
+	}
+	name = strings.TrimSuffix(name, "}")
+	for _, input := range doc.Inputs {
+		if input.Name == name && input.Type == "datasource" && input.Label != "" {
+			return input.Label
+		}
+	}
+	return ref
+}
+
+// findDataSourceIn matches a data source reference by ID, then by name
+func findDataSourceIn(dataSources []DataSource, ref string) (DataSource, bool) {
+	for _, ds := range dataSources {
+		if ds.ID == ref {
+			return ds, true
+		}
+	}
+	for _, ds := range dataSources {
+		if ds.Name == ref {
+			return ds, true
+		}
+	}
+	return DataSource{}, false
+}
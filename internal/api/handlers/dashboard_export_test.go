@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/observio/backend/internal/database"
+)
+
+func TestImportGrafanaDashboard(t *testing.T) {
+	body, err := os.ReadFile("testdata/grafana_dashboard.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := newTestDashboardHandler(database.NewMemoryDashboardStore())
+
+	rec := serve(handler, http.MethodPost, "/import", string(body))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("import: status %d, body %s", rec.Code, rec.Body)
+	}
+	var imported DashboardImportResponse
+	decodeResponse(t, rec, &imported)
+
+	dashboard := imported.Dashboard
+	if dashboard.Title != "Checkout service" || len(dashboard.Panels) != 2 {
+		t.Fatalf("import: got %+v, want the dashboard with its two panels and without the row", dashboard)
+	}
+
+	rate := dashboard.Panels[0]
+	if rate.ID != "2" || rate.Type != "timeseries" || rate.Query != "sum(rate(http_requests_total[5m])) by (status)" {
+		t.Errorf("first panel is %+v, want the numeric ID and PromQL query kept", rate)
+	}
+	if rate.DataSource != "ds-1" {
+		t.Errorf("first panel has data source %q, want ${DS_PROMETHEUS} mapped to ds-1", rate.DataSource)
+	}
+	if want := map[string]int{"h": 8, "w": 12, "x": 0, "y": 0}; !reflect.DeepEqual(rate.Position, want) {
+		t.Errorf("first panel is at %v, want %v", rate.Position, want)
+	}
+
+	recent := dashboard.Panels[1]
+	if recent.ID != "6" || recent.Title != "Recent errors" || recent.Query == "" {
+		t.Errorf("second panel is %+v, want the collapsed row's panel with its SQL query", recent)
+	}
+	if recent.DataSource != "P7E099F39B84EA795" || len(imported.Warnings) != 1 {
+		t.Errorf("second panel has data source %q with warnings %q, want the unknown uid kept and reported", recent.DataSource, imported.Warnings)
+	}
+}
+
+func TestDashboardExportRoundTrip(t *testing.T) {
+	store := database.NewMemoryDashboardStore()
+	handler := newTestDashboardHandler(store)
+
+	rec := serve(handler, http.MethodPost, "/", `{"title":"Checkout","panels":[{"title":"Errors","type":"graph","query":"up","dataSource":"ds-1","position":{"x":0,"y":0,"w":6,"h":4}}]}`)
+	var created DashboardSaveResponse
+	decodeResponse(t, rec, &created)
+
+	rec = serve(handler, http.MethodGet, "/"+created.ID+"/export", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(handler, http.MethodPost, "/import", rec.Body.String())
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("import: status %d, body %s", rec.Code, rec.Body)
+	}
+	var imported DashboardImportResponse
+	decodeResponse(t, rec, &imported)
+	if imported.Dashboard.ID == created.ID || len(imported.Warnings) != 0 {
+		t.Errorf("import: got ID %s with warnings %q, want a new dashboard without warnings", imported.Dashboard.ID, imported.Warnings)
+	}
+	if !reflect.DeepEqual(imported.Dashboard.Panels, created.Panels) {
+		t.Errorf("import: got panels %+v, want %+v", imported.Dashboard.Panels, created.Panels)
+	}
+}
+
+func TestImportRejectsInvalidDocuments(t *testing.T) {
+	handler := newTestDashboardHandler(database.NewMemoryDashboardStore())
+	for _, body := range []string{
+		`{"title":"x","panels":[]}`,
+		`{"schemaVersion":1,"panels":[]}`,
+		`{"schemaVersion":1,"title":"x","panels":[{"id":true}]}`,
+		`{"schemaVersion":1,"title":"x","panels":[{"datasource":1}]}`,
+	} {
+		if rec := serve(handler, http.MethodPost, "/import", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("import of %s: status %d, want 400", body, rec.Code)
+		}
+	}
+}
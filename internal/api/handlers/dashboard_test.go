@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/observio/backend/internal/config"
+	"github.com/observio/backend/internal/database"
+)
+
+// newTestDashboardHandler returns a dashboard handler backed by store, with
+// no panel query checks
+func newTestDashboardHandler(store DashboardStore) http.Handler {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewDashboardHandler(config.NewLive(&config.Config{}), logger, store, NewDataSources(), nil)
+}
+
+// serve sends a request with an optional JSON body to handler and returns the response
+func serve(handler http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeResponse decodes the JSON body of rec into dst
+func decodeResponse(t *testing.T, rec *httptest.ResponseRecorder, dst interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), dst); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body.String(), err)
+	}
+}
+
+func TestDashboardLifecycle(t *testing.T) {
+	store := database.NewMemoryDashboardStore()
+	handler := newTestDashboardHandler(store)
+
+	rec := serve(handler, http.MethodPost, "/", `{"title":"Checkout","panels":[{"title":"Errors","type":"graph"}]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status %d, body %s", rec.Code, rec.Body)
+	}
+	var created DashboardSaveResponse
+	decodeResponse(t, rec, &created)
+	if created.ID == "" || created.CreatedBy != anonymousUser || len(created.Panels) != 1 || created.Panels[0].ID == "" {
+		t.Fatalf("create: got %+v, want an ID, the anonymous creator and a panel ID", created.Dashboard)
+	}
+
+	stored, err := store.GetDashboard(context.Background(), created.ID)
+	if err != nil || stored.Title != "Checkout" {
+		t.Fatalf("store has %+v, %v after create", stored, err)
+	}
+
+	rec = serve(handler, http.MethodPut, "/"+created.ID, `{"title":"Checkout v2","createdBy":"mallory"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: status %d, body %s", rec.Code, rec.Body)
+	}
+	var updated DashboardSaveResponse
+	decodeResponse(t, rec, &updated)
+	if updated.Title != "Checkout v2" || updated.CreatedBy != anonymousUser || !updated.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("update: got %+v, want the new title with the original creator and creation time", updated.Dashboard)
+	}
+	if updated.Panels == nil {
+		t.Error("update: panels are null, want an empty list")
+	}
+
+	rec = serve(handler, http.MethodGet, "/", "")
+	var listed []database.Dashboard
+	decodeResponse(t, rec, &listed)
+	if len(listed) != 1 || listed[0].Title != "Checkout v2" {
+		t.Errorf("list: got %+v, want the updated dashboard", listed)
+	}
+
+	rec = serve(handler, http.MethodDelete, "/"+created.ID, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete: status %d, body %s", rec.Code, rec.Body)
+	}
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		if rec := serve(handler, method, "/"+created.ID, `{"title":"x"}`); rec.Code != http.StatusNotFound {
+			t.Errorf("%s after delete: status %d, want 404", method, rec.Code)
+		}
+	}
+}
+
+func TestDashboardRejectsInvalidBody(t *testing.T) {
+	handler := newTestDashboardHandler(database.NewMemoryDashboardStore())
+	for _, body := range []string{`{"title":`, `{"title":"x"} {}`, `{"panels":"none"}`} {
+		if rec := serve(handler, http.MethodPost, "/", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("create with %s: status %d, want 400", body, rec.Code)
+		}
+	}
+}
+
+func TestDashboardWithoutStore(t *testing.T) {
+	handler := newTestDashboardHandler(nil)
+	if rec := serve(handler, http.MethodGet, "/", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("list without a store: status %d, want 503", rec.Code)
+	}
+}
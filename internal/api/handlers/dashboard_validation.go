@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/observio/backend/internal/database"
+)
+
+// panelQueryCheckTimeout bounds the checks of all panel queries of a dashboard
+const panelQueryCheckTimeout = 10 * time.Second
+
+// panelQueryCheckConcurrency is the number of panel queries checked at once
+const panelQueryCheckConcurrency = 4
+
+// PanelQueryChecker checks panel queries without running them;
+// *database.ClickHouseClient implements it
+type PanelQueryChecker interface {
+	CheckQuery(ctx context.Context, query string) error
+}
+
+// DashboardSaveResponse is a created or updated dashboard, plus the problems
+// found in its panels; they are reported without preventing the save
+type DashboardSaveResponse struct {
+	database.Dashboard
+	Warnings []string `json:"warnings"`
+}
+
+// validatePanels returns a warning for every panel that references an unknown
+// data source or whose query a ClickHouse data source could not run. The
+// queries are checked concurrently within panelQueryCheckTimeout. It is
+// skipped with ?validate=false.
+func (h *DashboardHandler) validatePanels(r *http.Request, dashboard database.Dashboard) []string {
+	warnings := []string{}
+	if validate, err := strconv.ParseBool(r.URL.Query().Get("validate")); err == nil && !validate {
+		return warnings
+	}
+
+	// One warning at most per panel, kept in panel order
+	panelWarnings := make([]string, len(dashboard.Panels))
+	var checks []int
+	dataSources := h.sources.List()
+	for i, panel := range dashboard.Panels {
+		if panel.DataSource == "" {
+			continue
+		}
+		ds, ok := findDataSourceIn(dataSources, panel.DataSource)
+		if !ok {
+			panelWarnings[i] = fmt.Sprintf("Panel %d (%q) references unknown data source %q", i, panel.Title, panel.DataSource)
+			continue
+		}
+		if ds.Type == "clickhouse" && panel.Query != "" && h.queries != nil {
+			checks = append(checks, i)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), panelQueryCheckTimeout)
+	defer cancel()
+	checkPanelQueries(ctx, h.queries, dashboard.Panels, checks, panelWarnings)
+
+	for _, warning := range panelWarnings {
+		if warning != "" {
+			warnings = append(warnings, warning)
+		}
+	}
+	return warnings
+}
+
+// checkPanelQueries checks the queries of the panels at the given indexes,
+// panelQueryCheckConcurrency at a time, and sets the warning of every panel
+// whose query is invalid or could not be checked before ctx is done
+func checkPanelQueries(ctx context.Context, queries PanelQueryChecker, panels []database.Panel, indexes []int, warnings []string) {
+	slots := make(chan struct{}, panelQueryCheckConcurrency)
+	var wg sync.WaitGroup
+	for _, i := range indexes {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			panel := panels[i]
+			err := queries.CheckQuery(ctx, panel.Query)
+			switch {
+			case ctx.Err() != nil:
+				warnings[i] = fmt.Sprintf("Panel %d (%q) was not checked: the dashboard took longer than %s to check", i, panel.Title, panelQueryCheckTimeout)
+			case err != nil:
+				warnings[i] = fmt.Sprintf("Panel %d (%q) has an invalid query: %v", i, panel.Title, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
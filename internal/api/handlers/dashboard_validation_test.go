@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/observio/backend/internal/database"
+)
+
+// slowChecker takes delay to check a query, failing those containing "bad",
+// and records how many checks ran at once
+type slowChecker struct {
+	delay time.Duration
+
+	mu      sync.Mutex
+	running int
+	peak    int
+}
+
+func (c *slowChecker) CheckQuery(ctx context.Context, query string) error {
+	c.mu.Lock()
+	c.running++
+	c.peak = max(c.peak, c.running)
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.running--
+		c.mu.Unlock()
+	}()
+
+	select {
+	case <-time.After(c.delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if strings.Contains(query, "bad") {
+		return errors.New("unknown table")
+	}
+	return nil
+}
+
+func TestCheckPanelQueriesRunsConcurrently(t *testing.T) {
+	checker := &slowChecker{delay: 20 * time.Millisecond}
+	panels := make([]database.Panel, 3*panelQueryCheckConcurrency)
+	indexes := make([]int, len(panels))
+	for i := range panels {
+		panels[i] = database.Panel{Title: "p", Query: "SELECT 1"}
+		indexes[i] = i
+	}
+	panels[5].Query = "SELECT bad"
+
+	warnings := make([]string, len(panels))
+	start := time.Now()
+	checkPanelQueries(context.Background(), checker, panels, indexes, warnings)
+
+	if elapsed := time.Since(start); elapsed >= time.Duration(len(panels))*checker.delay {
+		t.Errorf("checks took %s, want them to overlap", elapsed)
+	}
+	if checker.peak > panelQueryCheckConcurrency {
+		t.Errorf("%d checks ran at once, want at most %d", checker.peak, panelQueryCheckConcurrency)
+	}
+	for i, warning := range warnings {
+		if (warning != "") != (i == 5) {
+			t.Errorf("panel %d has warning %q", i, warning)
+		}
+	}
+}
+
+func TestCheckPanelQueriesStopsAtDeadline(t *testing.T) {
+	checker := &slowChecker{delay: time.Minute}
+	panels := []database.Panel{{Title: "a", Query: "SELECT 1"}, {Title: "b", Query: "SELECT 2"}}
+	warnings := make([]string, len(panels))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	checkPanelQueries(ctx, checker, panels, []int{0, 1}, warnings)
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("checks took %s, want them abandoned at the deadline", elapsed)
+	}
+	for i, warning := range warnings {
+		if !strings.Contains(warning, "was not checked") {
+			t.Errorf("panel %d has warning %q, want it reported as not checked", i, warning)
+		}
+	}
+}
@@ -1,19 +1,27 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/observio/backend/internal/api/httputil"
 	"github.com/observio/backend/internal/config"
+	"github.com/observio/backend/internal/logging"
 )
 
 // DataSourceHandler handles data source-related API endpoints
 type DataSourceHandler struct {
-	cfg    *config.Config
-	logger *log.Logger
+	cfg     *config.Live
+	logger  logging.Logger
+	sources *DataSources
 }
 
 // DataSource represents a data source for metrics, logs, or traces
@@ -29,11 +37,12 @@ type DataSource struct {
 	UpdatedAt   time.Time              `json:"updatedAt"`
 }
 
-// NewDataSourceHandler creates a new data source handler
-func NewDataSourceHandler(cfg *config.Config, logger *log.Logger) http.Handler {
+// NewDataSourceHandler creates a new data source handler serving sources
+func NewDataSourceHandler(cfg *config.Live, logger logging.Logger, sources *DataSources) http.Handler {
 	h := &DataSourceHandler{
-		cfg:    cfg,
-		logger: logger,
+		cfg:     cfg,
+		logger:  logger,
+		sources: sources,
 	}
 
 	r := chi.NewRouter()
@@ -49,10 +58,14 @@ func NewDataSourceHandler(cfg *config.Config, logger *log.Logger) http.Handler {
 
 // ListDataSources returns a list of all data sources
 func (h *DataSourceHandler) ListDataSources(w http.ResponseWriter, r *http.Request) {
-	// In a real implementation, this would fetch data sources from a database
+	httputil.RespondJSON(w, http.StatusOK, h.sources.List())
+}
+
+// sampleDataSources returns the data sources a new store starts out with
+func sampleDataSources() []DataSource {
 	now := time.Now()
 	
-	dataSources := []DataSource{
+	return []DataSource{
 		{
 			ID:          "ds-1",
 			Name:        "Prometheus",
@@ -96,109 +109,257 @@ func (h *DataSourceHandler) ListDataSources(w http.ResponseWriter, r *http.Reque
 			CreatedAt: now.Add(-36 * time.Hour),
 			UpdatedAt: now.Add(-6 * time.Hour),
 		},
+		{
+			ID:          "ds-4",
+			Name:        "ClickHouse",
+			Type:        "clickhouse",
+			URL:         "http://clickhouse:8123",
+			Description: "ClickHouse HTTP interface for logs and traces",
+			Settings: map[string]interface{}{
+				"database": "default",
+			},
+			IsDefault: false,
+			CreatedAt: now.Add(-24 * time.Hour),
+			UpdatedAt: now.Add(-2 * time.Hour),
+		},
 	}
-
-	respondJSON(w, http.StatusOK, dataSources)
 }
 
 // GetDataSource returns a specific data source by ID
 func (h *DataSourceHandler) GetDataSource(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	
-	// In a real implementation, this would fetch the data source from a database
-	now := time.Now()
-	
-	dataSource := DataSource{
-		ID:          id,
-		Name:        "Prometheus",
-		Type:        "prometheus",
-		URL:         "http://prometheus:9090",
-		Description: "Main Prometheus server",
-		Settings: map[string]interface{}{
-			"scrapeInterval": "15s",
-			"timeout":        "10s",
-		},
-		IsDefault: true,
-		CreatedAt: now.Add(-72 * time.Hour),
-		UpdatedAt: now.Add(-24 * time.Hour),
+
+	dataSource, ok := h.sources.Get(id)
+	if !ok {
+		httputil.RespondError(w, http.StatusNotFound, httputil.CodeNotFound, fmt.Sprintf("Data source %s not found", id))
+		return
 	}
 
-	respondJSON(w, http.StatusOK, dataSource)
+	httputil.RespondJSON(w, http.StatusOK, dataSource)
 }
 
-// CreateDataSource creates a new data source
+// CreateDataSource creates a new data source; making it the default clears
+// the previous default
 func (h *DataSourceHandler) CreateDataSource(w http.ResponseWriter, r *http.Request) {
 	var dataSource DataSource
-	if err := json.NewDecoder(r.Body).Decode(&dataSource); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request payload")
+	if !httputil.DecodeJSON(w, r, &dataSource, h.cfg.Get().Server.MaxRequestBodyBytes) {
+		return
+	}
+	if err := validateDataSource(dataSource); err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, err.Error())
 		return
 	}
 
-	// In a real implementation, this would save the data source to a database
-	dataSource.ID = "new-ds-id"
-	dataSource.CreatedAt = time.Now()
-	dataSource.UpdatedAt = time.Now()
-
-	// If this is set as default, we would update other data sources to not be default
+	dataSource = h.sources.Create(dataSource)
 	if dataSource.IsDefault {
-		h.logger.Println("Setting new data source as default")
+		h.logger.Info("data source set as default", "id", dataSource.ID)
 	}
 
-	respondJSON(w, http.StatusCreated, dataSource)
+	httputil.RespondJSON(w, http.StatusCreated, dataSource)
 }
 
-// UpdateDataSource updates an existing data source
+// UpdateDataSource updates an existing data source; making it the default
+// clears the previous default, and the default cannot be unset directly
 func (h *DataSourceHandler) UpdateDataSource(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	
+
 	var dataSource DataSource
-	if err := json.NewDecoder(r.Body).Decode(&dataSource); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request payload")
+	if !httputil.DecodeJSON(w, r, &dataSource, h.cfg.Get().Server.MaxRequestBodyBytes) {
+		return
+	}
+	if err := validateDataSource(dataSource); err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, err.Error())
 		return
 	}
 
-	// In a real implementation, this would update the data source in a database
-	dataSource.ID = id
-	dataSource.UpdatedAt = time.Now()
-
-	// If this is set as default, we would update other data sources to not be default
+	dataSource, err := h.sources.Update(id, dataSource)
+	switch {
+	case errors.Is(err, ErrDataSourceNotFound):
+		httputil.RespondError(w, http.StatusNotFound, httputil.CodeNotFound, fmt.Sprintf("Data source %s not found", id))
+		return
+	case errors.Is(err, ErrDefaultDataSourceRequired):
+		httputil.RespondError(w, http.StatusConflict, httputil.CodeConflict,
+			fmt.Sprintf("Data source %s is the default; make another data source the default instead", id))
+		return
+	}
 	if dataSource.IsDefault {
-		h.logger.Println("Setting updated data source as default")
+		h.logger.Info("data source set as default", "id", id)
 	}
 
-	respondJSON(w, http.StatusOK, dataSource)
+	httputil.RespondJSON(w, http.StatusOK, dataSource)
 }
 
-// DeleteDataSource deletes a data source
+// DeleteDataSource deletes a data source. The default data source can only
+// be deleted with ?successor=<id> naming the data source that becomes the
+// default instead.
 func (h *DataSourceHandler) DeleteDataSource(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	
-	// In a real implementation, this would delete the data source from a database
-	h.logger.Printf("Deleting data source with ID: %s", id)
+	successor := r.URL.Query().Get("successor")
 
-	// Check if this is a default data source
-	// In a real implementation, we would prevent deletion of the default data source
-	// or automatically set another one as default
+	err := h.sources.Delete(id, successor)
+	switch {
+	case errors.Is(err, ErrDataSourceNotFound):
+		httputil.RespondError(w, http.StatusNotFound, httputil.CodeNotFound, fmt.Sprintf("Data source %s not found", id))
+		return
+	case errors.Is(err, ErrDefaultDataSourceRequired):
+		httputil.RespondError(w, http.StatusConflict, httputil.CodeConflict,
+			fmt.Sprintf("Data source %s is the default; pass ?successor=<id> to choose the new default", id))
+		return
+	case errors.Is(err, ErrInvalidSuccessor):
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest,
+			fmt.Sprintf("successor %q must be the ID of another data source", successor))
+		return
+	}
 
-	respondJSON(w, http.StatusOK, map[string]string{"message": "Data source deleted successfully"})
+	h.logger.Info("deleted data source", "id", id, "successor", successor)
+	httputil.RespondJSON(w, http.StatusOK, map[string]string{"message": "Data source deleted successfully"})
 }
 
-// TestDataSource tests the connection to a data source
+// validateDataSource checks the fields every data source needs
+func validateDataSource(ds DataSource) error {
+	if strings.TrimSpace(ds.Name) == "" {
+		return errors.New("name is required")
+	}
+	if strings.TrimSpace(ds.Type) == "" {
+		return errors.New("type is required")
+	}
+	return nil
+}
+
+// dataSourceProbeTimeout bounds a connection test so a hung data source
+// cannot block the request
+const dataSourceProbeTimeout = 5 * time.Second
+
+// TestDataSource tests the connection to a data source by probing it according
+// to its type, reporting the round-trip time and answering 502 when it fails
 func (h *DataSourceHandler) TestDataSource(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	
-	// In a real implementation, this would test the connection to the data source
-	h.logger.Printf("Testing connection to data source with ID: %s", id)
+	dataSource, ok := h.sources.Get(id)
+	if !ok {
+		httputil.RespondError(w, http.StatusNotFound, httputil.CodeNotFound, fmt.Sprintf("Data source %s not found", id))
+		return
+	}
+
+	h.logger.Info("testing data source connection", "id", id, "type", dataSource.Type, "url", dataSource.URL)
+
+	ctx, cancel := context.WithTimeout(r.Context(), dataSourceProbeTimeout)
+	defer cancel()
+
+	startedAt := time.Now()
+	version, err := probeDataSource(ctx, dataSource)
+	elapsed := time.Since(startedAt)
 
-	// Simulate a successful connection test
-	result := map[string]interface{}{
+	details := map[string]interface{}{
+		"responseTime": elapsed.Round(time.Millisecond).String(),
+	}
+	if version != "" {
+		details["version"] = version
+	}
+
+	if err != nil {
+		h.logger.Warn("data source connection test failed", "id", id, "error", err)
+		httputil.RespondJSON(w, http.StatusBadGateway, map[string]interface{}{
+			"status":  "error",
+			"message": err.Error(),
+			"details": details,
+		})
+		return
+	}
+
+	httputil.RespondJSON(w, http.StatusOK, map[string]interface{}{
 		"status":  "success",
 		"message": "Connection successful",
-		"details": map[string]interface{}{
-			"version":      "2.30.0",
-			"responseTime": "42ms",
-		},
+		"details": details,
+	})
+}
+
+// probeDataSource performs a type-specific health check and returns the
+// server version when the data source reports one
+func probeDataSource(ctx context.Context, ds DataSource) (string, error) {
+	if ds.URL == "" {
+		return "", fmt.Errorf("data source has no URL")
+	}
+	base := strings.TrimSuffix(ds.URL, "/")
+
+	switch ds.Type {
+	case "prometheus":
+		var buildInfo struct {
+			Data struct {
+				Version string `json:"version"`
+			} `json:"data"`
+		}
+		if err := probeJSON(ctx, ds, base+"/api/v1/status/buildinfo", &buildInfo); err != nil {
+			return "", err
+		}
+		return buildInfo.Data.Version, nil
+	case "elasticsearch":
+		var info struct {
+			Version struct {
+				Number string `json:"number"`
+			} `json:"version"`
+		}
+		if err := probeJSON(ctx, ds, base+"/", &info); err != nil {
+			return "", err
+		}
+		return info.Version.Number, nil
+	case "clickhouse":
+		body, err := probeGet(ctx, ds, base+"/?query="+url.QueryEscape("SELECT 1"))
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(string(body)) != "1" {
+			return "", fmt.Errorf("unexpected response to SELECT 1: %q", strings.TrimSpace(string(body)))
+		}
+		return "", nil
+	case "jaeger":
+		_, err := probeGet(ctx, ds, base+"/api/services")
+		return "", err
+	case "loki":
+		_, err := probeGet(ctx, ds, base+"/ready")
+		return "", err
+	default:
+		_, err := probeGet(ctx, ds, base+"/")
+		return "", err
+	}
+}
+
+// probeJSON fetches target and decodes the JSON response into dest
+func probeJSON(ctx context.Context, ds DataSource, target string, dest interface{}) error {
+	body, err := probeGet(ctx, ds, target)
+	if err != nil {
+		return err
 	}
+	if err := json.Unmarshal(body, dest); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", target, err)
+	}
+	return nil
+}
 
-	respondJSON(w, http.StatusOK, result)
+// probeGet issues a GET request, treating any non-2xx status as a failure.
+// Credentials are taken from the data source's username/password settings.
+func probeGet(ctx context.Context, ds DataSource, target string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data source URL: %w", err)
+	}
+	if username, _ := ds.Settings["username"].(string); username != "" {
+		password, _ := ds.Settings["password"].(string)
+		req.SetBasicAuth(username, password)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach data source: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("could not read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("data source returned %s", resp.Status)
+	}
+	return body, nil
 }
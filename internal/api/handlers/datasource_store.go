@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrDataSourceNotFound is returned for an unknown data source ID
+	ErrDataSourceNotFound = errors.New("data source not found")
+	// ErrDefaultDataSourceRequired is returned when a change would leave no
+	// default data source while others exist
+	ErrDefaultDataSourceRequired = errors.New("a default data source is required")
+	// ErrInvalidSuccessor is returned when the data source named to replace a
+	// deleted default is unknown or the deleted one itself
+	ErrInvalidSuccessor = errors.New("invalid successor data source")
+)
+
+// DataSources holds the data sources shared by the data source, metrics and
+// dashboard endpoints. Every change runs under one lock, so there is always
+// exactly one default data source unless there are none at all.
+type DataSources struct {
+	mu      sync.Mutex
+	sources []DataSource
+}
+
+// NewDataSources creates a store holding the sample data sources
+func NewDataSources() *DataSources {
+	return &DataSources{sources: sampleDataSources()}
+}
+
+// List returns every data source in creation order
+func (s *DataSources) List() []DataSource {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.sources)
+}
+
+// Get returns the data source with the given ID
+func (s *DataSources) Get(id string) (DataSource, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(id)
+	if i < 0 {
+		return DataSource{}, false
+	}
+	return s.sources[i], true
+}
+
+// Create adds a data source with a new ID. It becomes the default when asked
+// to or when it is the first one, and the previous default is cleared.
+func (s *DataSources) Create(ds DataSource) DataSource {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	ds.ID = uuid.NewString()
+	ds.CreatedAt = now
+	ds.UpdatedAt = now
+	if len(s.sources) == 0 {
+		ds.IsDefault = true
+	}
+
+	s.sources = append(s.sources, ds)
+	if ds.IsDefault {
+		s.setDefault(ds.ID)
+	}
+	return ds
+}
+
+// Update replaces a data source, keeping its ID and creation time. Making it
+// the default clears the previous default; the default can only be unset by
+// making another data source the default.
+func (s *DataSources) Update(id string, ds DataSource) (DataSource, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(id)
+	if i < 0 {
+		return DataSource{}, ErrDataSourceNotFound
+	}
+	if s.sources[i].IsDefault && !ds.IsDefault {
+		return DataSource{}, ErrDefaultDataSourceRequired
+	}
+
+	ds.ID = id
+	ds.CreatedAt = s.sources[i].CreatedAt
+	ds.UpdatedAt = time.Now()
+	s.sources[i] = ds
+	if ds.IsDefault {
+		s.setDefault(id)
+	}
+	return ds, nil
+}
+
+// Delete removes a data source. Deleting the default requires the ID of the
+// data source that becomes the default instead, so the last data source
+// cannot be deleted; successor is ignored for other data sources.
+func (s *DataSources) Delete(id, successor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(id)
+	if i < 0 {
+		return ErrDataSourceNotFound
+	}
+
+	if s.sources[i].IsDefault {
+		if successor == "" {
+			return ErrDefaultDataSourceRequired
+		}
+		if successor == id || s.index(successor) < 0 {
+			return ErrInvalidSuccessor
+		}
+		s.setDefault(successor)
+	}
+
+	s.sources = slices.Delete(s.sources, i, i+1)
+	return nil
+}
+
+// setDefault makes the data source with the given ID the only default
+func (s *DataSources) setDefault(id string) {
+	now := time.Now()
+	for i := range s.sources {
+		isDefault := s.sources[i].ID == id
+		if s.sources[i].IsDefault != isDefault {
+			s.sources[i].IsDefault = isDefault
+			s.sources[i].UpdatedAt = now
+		}
+	}
+}
+
+// index returns the position of the data source with the given ID, or -1
+func (s *DataSources) index(id string) int {
+	return slices.IndexFunc(s.sources, func(ds DataSource) bool { return ds.ID == id })
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// assertOneDefault fails unless exactly one data source of s is the default,
+// and returns its ID
+func assertOneDefault(t *testing.T, s *DataSources) string {
+	t.Helper()
+	var defaults []string
+	for _, ds := range s.List() {
+		if ds.IsDefault {
+			defaults = append(defaults, ds.ID)
+		}
+	}
+	if len(defaults) != 1 {
+		t.Fatalf("%d default data sources %v, want exactly one", len(defaults), defaults)
+	}
+	return defaults[0]
+}
+
+func TestDataSourcesKeepOneDefault(t *testing.T) {
+	s := &DataSources{}
+	first := s.Create(DataSource{Name: "first", Type: "clickhouse"})
+	if !first.IsDefault || assertOneDefault(t, s) != first.ID {
+		t.Fatal("the first data source did not become the default")
+	}
+
+	second := s.Create(DataSource{Name: "second", Type: "prometheus"})
+	if assertOneDefault(t, s) != first.ID {
+		t.Error("creating a non-default data source changed the default")
+	}
+
+	third := s.Create(DataSource{Name: "third", Type: "loki", IsDefault: true})
+	if assertOneDefault(t, s) != third.ID {
+		t.Error("creating a default data source did not make it the only default")
+	}
+
+	// Set-default is an update with isDefault
+	second.IsDefault = true
+	if _, err := s.Update(second.ID, second); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if assertOneDefault(t, s) != second.ID {
+		t.Error("updating a data source to default did not make it the only default")
+	}
+
+	second.IsDefault = false
+	if _, err := s.Update(second.ID, second); !errors.Is(err, ErrDefaultDataSourceRequired) {
+		t.Errorf("unsetting the default: err = %v, want ErrDefaultDataSourceRequired", err)
+	}
+	assertOneDefault(t, s)
+
+	// Deleting the default needs a valid successor
+	for _, successor := range []string{"", second.ID, "missing"} {
+		if err := s.Delete(second.ID, successor); err == nil {
+			t.Errorf("deleting the default with successor %q succeeded", successor)
+		}
+		assertOneDefault(t, s)
+	}
+	if err := s.Delete(second.ID, first.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if assertOneDefault(t, s) != first.ID {
+		t.Error("deleting the default did not make the successor the default")
+	}
+
+	// Deleting another data source keeps the default
+	if err := s.Delete(third.ID, ""); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if assertOneDefault(t, s) != first.ID {
+		t.Error("deleting a non-default data source changed the default")
+	}
+
+	// The last data source has no successor to hand the default to
+	if err := s.Delete(first.ID, ""); !errors.Is(err, ErrDefaultDataSourceRequired) {
+		t.Errorf("deleting the last data source: err = %v, want ErrDefaultDataSourceRequired", err)
+	}
+	assertOneDefault(t, s)
+}
+
+func TestDataSourcesKeepOneDefaultConcurrently(t *testing.T) {
+	s := NewDataSources()
+	assertOneDefault(t, s)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ds := s.Create(DataSource{Name: "candidate", Type: "clickhouse", IsDefault: true})
+			ds.IsDefault = true
+			s.Update(ds.ID, ds)
+			for _, other := range s.List() {
+				if other.ID != ds.ID && !other.IsDefault {
+					s.Delete(other.ID, "")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assertOneDefault(t, s)
+}
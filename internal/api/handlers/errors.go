@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/observio/backend/internal/api/httputil"
+	"github.com/observio/backend/internal/database"
+)
+
+// respondQueryError maps a ClickHouse failure to a status code and error code,
+// telling clients to back off when the server is at its concurrent query limit
+// and distinguishing a missing table, an unreachable server, a timed out query
+// or an oversized result from a query that failed
+func respondQueryError(w http.ResponseWriter, err error, message string) {
+	status, body := queryError(err, message)
+	if errors.Is(err, database.ErrTooManyQueries) {
+		w.Header().Set("Retry-After", "1")
+	}
+	httputil.RespondError(w, status, body.Code, body.Message)
+}
+
+// queryError returns the status code and error body respondQueryError
+// answers a ClickHouse failure with
+func queryError(err error, message string) (int, httputil.ErrorBody) {
+	var timeoutErr *database.QueryTimeoutError
+	var notFoundErr *database.TableNotFoundError
+	var tooManyRowsErr *database.TooManyRowsError
+	switch {
+	case errors.As(err, &notFoundErr):
+		if notFoundErr.Table == "" {
+			return http.StatusNotFound, httputil.ErrorBody{Code: httputil.CodeTableNotFound,
+				Message: fmt.Sprintf("Database %s not found", notFoundErr.Database)}
+		}
+		return http.StatusNotFound, httputil.ErrorBody{Code: httputil.CodeTableNotFound,
+			Message: fmt.Sprintf("Table %s.%s not found", notFoundErr.Database, notFoundErr.Table)}
+	case errors.As(err, &timeoutErr):
+		return http.StatusGatewayTimeout, httputil.ErrorBody{Code: httputil.CodeQueryTimeout,
+			Message: fmt.Sprintf("Query exceeded %d seconds and was stopped", int(math.Ceil(timeoutErr.Limit.Seconds())))}
+	case errors.As(err, &tooManyRowsErr):
+		return http.StatusUnprocessableEntity, httputil.ErrorBody{Code: httputil.CodeResultTooLarge, Message: tooManyRowsMessage(tooManyRowsErr)}
+	case errors.Is(err, database.ErrTooManyUserQueries):
+		return http.StatusTooManyRequests, httputil.ErrorBody{Code: httputil.CodeTooManyQueries,
+			Message: "You have too many queries running, please retry shortly"}
+	case errors.Is(err, database.ErrTooManyQueries):
+		return http.StatusTooManyRequests, httputil.ErrorBody{Code: httputil.CodeTooManyQueries,
+			Message: "Too many concurrent queries, please retry shortly"}
+	case database.IsConnectionError(err):
+		return http.StatusServiceUnavailable, httputil.ErrorBody{Code: httputil.CodeClickHouseUnavailable,
+			Message: "ClickHouse is unavailable"}
+	default:
+		return http.StatusInternalServerError, httputil.ErrorBody{Code: httputil.CodeQueryFailed, Message: message}
+	}
+}
+
+// ClickHouseUnavailable answers every request with 503 CLICKHOUSE_UNAVAILABLE.
+// It stands in for the ClickHouse-backed endpoints when no client could be
+// created, so clients see a server-side outage instead of a missing route.
+func ClickHouseUnavailable(w http.ResponseWriter, r *http.Request) {
+	httputil.RespondError(w, http.StatusServiceUnavailable, httputil.CodeClickHouseUnavailable,
+		"ClickHouse is unavailable")
+}
+
+// respondStreamError reports a failed streamed query: with a regular error
+// response when nothing has been sent yet, or at the end of the stream otherwise
+func respondStreamError(w http.ResponseWriter, stream resultStream, err error, message string) {
+	if !stream.Started() {
+		respondQueryError(w, err, message)
+		return
+	}
+
+	var tooManyRowsErr *database.TooManyRowsError
+	if errors.As(err, &tooManyRowsErr) {
+		stream.WriteError(httputil.CodeResultTooLarge, tooManyRowsMessage(tooManyRowsErr))
+		return
+	}
+	stream.WriteError(httputil.CodeQueryFailed, "Query failed while streaming results")
+}
+
+// tooManyRowsMessage tells the client how to get a result under the row cap
+func tooManyRowsMessage(err *database.TooManyRowsError) string {
+	return fmt.Sprintf("Query returned more than %d rows and was stopped; add a LIMIT or narrow the filters", err.Limit)
+}
@@ -3,21 +3,49 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/observio/backend/internal/api/httputil"
 	"github.com/observio/backend/internal/config"
 	"github.com/observio/backend/internal/database"
+	"github.com/observio/backend/internal/logging"
+	"github.com/observio/backend/internal/services"
+)
+
+const (
+	// defaultPreviewLimit is the number of rows returned by a table preview without ?limit=
+	defaultPreviewLimit = 20
+	// maxPreviewLimit caps table previews so they stay cheap
+	maxPreviewLimit = 100
+	// maxSampleLimit caps table samples, which allow a larger peek than previews
+	maxSampleLimit = 200
+	// defaultFieldValuesLimit is the number of distinct values returned without ?limit=
+	defaultFieldValuesLimit = 1000
+	// maxFieldValuesLimit caps distinct value lookups
+	maxFieldValuesLimit = 10000
+	// defaultCardinalityWindow is the time range sampled for column
+	// cardinality without ?windowSeconds=
+	defaultCardinalityWindow = time.Hour
+	// defaultCardinalitySampleRows is the number of rows sampled for column
+	// cardinality without ?sampleRows=
+	defaultCardinalitySampleRows = 100000
+	// maxCardinalitySampleRows caps the rows sampled for column cardinality
+	maxCardinalitySampleRows = 1000000
 )
 
 // ExploreHandler serves explore data for query builder
 type ExploreHandler struct {
-	cfg    *config.Config
-	logger *log.Logger
-	db     *database.ClickHouseClient
+	cfg     *config.Live
+	logger  logging.Logger
+	db      *database.ClickHouseClient
+	service *services.ExploreService
+	saved   SavedQueryStore
 }
 
 // DatabaseResponse represents the response structure for databases
@@ -54,145 +82,435 @@ type AutocompleteResponse struct {
 	Suggestions []AutocompleteSuggestion `json:"suggestions"`
 }
 
+// FieldValuesResponse represents the distinct values of a single field
+type FieldValuesResponse struct {
+	Values []string `json:"values"`
+}
+
 // RawSQLRequest represents a raw SQL query request
 type RawSQLRequest struct {
 	Database string `json:"database"`
 	Query    string `json:"query"`
+	// TimeoutSeconds overrides the default query timeout, up to the server's maximum
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+	// Params are bound to the ? placeholders of the query, in order
+	Params []interface{} `json:"params,omitempty"`
+	// Settings are ClickHouse settings applied to this query only, from query.allowedSettings
+	Settings map[string]interface{} `json:"settings,omitempty"`
 }
 
-// RawSQLResponse represents the response from a raw SQL query
-type RawSQLResponse struct {
-	Columns []string                 `json:"columns"`
-	Rows    []map[string]interface{} `json:"rows"`
-	Total   int                      `json:"total"`
-	Query   string                   `json:"query"`
+// QueryHistoryResponse represents a page of query history entries
+type QueryHistoryResponse struct {
+	Entries []database.QueryHistoryEntry `json:"entries"`
+	Total   uint64                       `json:"total"`
+	Limit   int                          `json:"limit"`
+	Offset  int                          `json:"offset"`
+}
+
+// ExploreCapabilitiesResponse lists what the explore query builder supports
+type ExploreCapabilitiesResponse struct {
+	Aggregates []string `json:"aggregates"`
+	FilterOps  []string `json:"filterOps"`
+	OrderDirs  []string `json:"orderDirs"`
 }
 
 // NewExploreHandler creates a new handler for explore endpoints
-func NewExploreHandler(cfg *config.Config, logger *log.Logger, db *database.ClickHouseClient) http.Handler {
+func NewExploreHandler(cfg *config.Live, logger logging.Logger, db *database.ClickHouseClient) http.Handler {
 	h := &ExploreHandler{
-		cfg:    cfg,
-		logger: logger,
-		db:     db,
+		cfg:     cfg,
+		logger:  logger,
+		db:      db,
+		service: services.NewExploreService(db, time.Duration(cfg.Get().ClickHouse.MetadataCacheTTLSeconds)*time.Second, logger),
+		saved:   db,
 	}
 	
 	r := chi.NewRouter()
 	r.Get("/databases", h.GetDatabases)
 	r.Get("/databases/{database}/tables", h.GetTables)
 	r.Get("/databases/{database}/tables/{table}/fields", h.GetTableFields)
+	r.Get("/databases/{database}/tables/{table}/fields/{field}/values", h.GetFieldValues)
+	r.Get("/databases/{database}/tables/{table}/preview", h.PreviewTable)
+	r.Get("/databases/{database}/tables/{table}/sample", h.SampleTable)
+	r.Get("/databases/{database}/tables/{table}/schema", h.GetTableSchema)
+	r.Get("/databases/{database}/tables/{table}/cardinality", h.GetColumnCardinality)
+	// The same routes without a database segment use the default database
+	r.Get("/tables", h.GetTables)
+	r.Get("/tables/{table}/fields", h.GetTableFields)
+	r.Get("/tables/{table}/fields/{field}/values", h.GetFieldValues)
+	r.Get("/tables/{table}/preview", h.PreviewTable)
+	r.Get("/tables/{table}/sample", h.SampleTable)
+	r.Get("/tables/{table}/schema", h.GetTableSchema)
+	r.Get("/tables/{table}/cardinality", h.GetColumnCardinality)
 	r.Post("/query", h.ExecuteQuery)
+	r.Post("/batch", h.ExecuteBatch)
+	r.Get("/ws", h.LiveQuery)
+	r.Post("/validate", h.ValidateQuery)
 	r.Post("/autocomplete", h.GetAutocomplete)
 	r.Post("/execute-sql", h.ExecuteRawSQL)
+	r.Post("/explain", h.ExplainRawSQL)
+	r.Get("/history", h.GetQueryHistory)
+	r.Get("/capabilities", h.GetCapabilities)
+	r.Post("/refresh", h.RefreshMetadata)
+	r.Get("/saved", h.ListSavedQueries)
+	r.Post("/saved", h.CreateSavedQuery)
+	r.Get("/saved/{id}", h.GetSavedQuery)
+	r.Put("/saved/{id}", h.UpdateSavedQuery)
+	r.Delete("/saved/{id}", h.DeleteSavedQuery)
+	r.Post("/saved/{id}/run", h.RunSavedQuery)
 	
 	return r
 }
 
+// GetCapabilities returns the aggregate functions, filter operations and order
+// directions accepted by explore queries
+func (h *ExploreHandler) GetCapabilities(w http.ResponseWriter, r *http.Request) {
+	httputil.RespondJSON(w, http.StatusOK, ExploreCapabilitiesResponse{
+		Aggregates: h.service.GetAvailableAggregates(),
+		FilterOps:  h.service.GetAvailableFilterOperations(),
+		OrderDirs:  h.service.GetAvailableOrderDirections(),
+	})
+}
+
+// RefreshMetadata clears the cached database, table and field lists, e.g.
+// after a table was created or altered
+func (h *ExploreHandler) RefreshMetadata(w http.ResponseWriter, r *http.Request) {
+	h.service.RefreshMetadata()
+	h.logger.Info("explore metadata cache cleared")
+
+	httputil.RespondJSON(w, http.StatusOK, map[string]string{"message": "Metadata cache cleared"})
+}
+
 // GetDatabases retrieves all available databases
 func (h *ExploreHandler) GetDatabases(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	
-	h.logger.Printf("Fetching databases from ClickHouse")
+	h.logger.Debug("fetching databases from ClickHouse")
 	
-	databases, err := h.db.GetDatabases(ctx)
+	databases, err := h.service.GetDatabases(ctx)
 	if err != nil {
-		h.logger.Printf("Error fetching databases from ClickHouse: %v", err)
-		respondError(w, http.StatusInternalServerError, "Could not fetch databases")
+		h.logger.Error("error fetching databases from ClickHouse", "error", err)
+		respondQueryError(w, err, "Could not fetch databases")
 		return
 	}
 	
-	h.logger.Printf("Successfully fetched %d databases", len(databases))
+	h.logger.Debug("fetched databases", "count", len(databases))
 	
 	response := DatabaseResponse{
 		Databases: databases,
 	}
 	
-	respondJSON(w, http.StatusOK, response)
+	httputil.RespondJSONWithETag(w, r, response)
 }
 
 // GetTables retrieves all tables for the specified database
 func (h *ExploreHandler) GetTables(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	database := chi.URLParam(r, "database")
+	database := h.databaseParam(r)
 	
 	if database == "" {
-		respondError(w, http.StatusBadRequest, "Database parameter is required")
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, "Database parameter is required")
 		return
 	}
 	
-	h.logger.Printf("Fetching tables for database: %s", database)
+	h.logger.Debug("fetching tables", "database", database)
 	
-	tables, err := h.db.GetTables(ctx, database)
+	tables, err := h.service.GetTables(ctx, database)
 	if err != nil {
-		h.logger.Printf("Error fetching tables for database %s: %v", database, err)
-		respondError(w, http.StatusInternalServerError, "Could not fetch tables")
+		h.logger.Error("error fetching tables", "database", database, "error", err)
+		respondQueryError(w, err, "Could not fetch tables")
 		return
 	}
 	
-	h.logger.Printf("Successfully fetched %d tables for database %s", len(tables), database)
+	h.logger.Debug("fetched tables", "database", database, "count", len(tables))
 	
 	response := TablesResponse{
 		Tables: tables,
 	}
 	
-	respondJSON(w, http.StatusOK, response)
+	httputil.RespondJSONWithETag(w, r, response)
 }
 
-// GetTableFields retrieves all fields for the specified table (excluding id fields)
+// GetTableFields retrieves all fields for the specified table; ?excludeIds=true
+// leaves out identifier columns such as id, span_id or TraceId
 func (h *ExploreHandler) GetTableFields(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	database := chi.URLParam(r, "database")
+	database := h.databaseParam(r)
 	table := chi.URLParam(r, "table")
 	
 	if database == "" || table == "" {
-		respondError(w, http.StatusBadRequest, "Database and table parameters are required")
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, "Database and table parameters are required")
 		return
 	}
+
+	excludeIDs := false
+	if v := r.URL.Query().Get("excludeIds"); v != "" {
+		var err error
+		if excludeIDs, err = strconv.ParseBool(v); err != nil {
+			httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, "excludeIds must be true or false")
+			return
+		}
+	}
 	
-	h.logger.Printf("Fetching fields for table: %s.%s", database, table)
+	h.logger.Debug("fetching fields", "database", database, "table", table)
 	
-	fields, err := h.db.GetTableFields(ctx, database, table)
+	fields, err := h.service.GetTableFields(ctx, database, table)
 	if err != nil {
-		h.logger.Printf("Error fetching fields for table %s.%s: %v", database, table, err)
-		respondError(w, http.StatusInternalServerError, "Could not fetch table fields")
+		h.logger.Error("error fetching fields", "database", database, "table", table, "error", err)
+		respondQueryError(w, err, "Could not fetch table fields")
 		return
 	}
+	if excludeIDs {
+		fields = withoutIDFields(fields)
+	}
 	
-	h.logger.Printf("Successfully fetched %d fields for table %s.%s", len(fields), database, table)
+	h.logger.Debug("fetched fields", "database", database, "table", table, "count", len(fields))
 	
 	response := TableFieldsResponse{
 		Fields: fields,
 	}
 	
-	respondJSON(w, http.StatusOK, response)
+	httputil.RespondJSONWithETag(w, r, response)
+}
+
+// withoutIDFields drops the fields whose names are identifier columns
+func withoutIDFields(fields []database.TableField) []database.TableField {
+	kept := make([]database.TableField, 0, len(fields))
+	for _, field := range fields {
+		if !database.IsIDColumn(field.Name) {
+			kept = append(kept, field)
+		}
+	}
+	return kept
+}
+
+// GetFieldValues returns the distinct values of a field, e.g. to fill a filter dropdown
+func (h *ExploreHandler) GetFieldValues(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	databaseName := h.databaseParam(r)
+	table := chi.URLParam(r, "table")
+	field := chi.URLParam(r, "field")
+	
+	if databaseName == "" || table == "" || field == "" {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, "Database, table and field parameters are required")
+		return
+	}
+	
+	limit := defaultFieldValuesLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, "Limit must be a positive integer")
+			return
+		}
+		limit = parsed
+	}
+	if limit > maxFieldValuesLimit {
+		limit = maxFieldValuesLimit
+	}
+	
+	values, err := h.db.GetDistinctValues(ctx, databaseName, table, field, limit)
+	switch {
+	case errors.Is(err, database.ErrInvalidIdentifier):
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, err.Error())
+		return
+	case err != nil:
+		h.logger.Error("error fetching field values", "database", databaseName, "table", table, "field", field, "error", err)
+		respondQueryError(w, err, "Could not fetch field values")
+		return
+	}
+	
+	httputil.RespondJSON(w, http.StatusOK, FieldValuesResponse{Values: values})
+}
+
+// PreviewTable returns a small sample of rows from the specified table
+func (h *ExploreHandler) PreviewTable(w http.ResponseWriter, r *http.Request) {
+	h.previewTable(w, r, maxPreviewLimit)
+}
+
+// SampleTable returns the first rows of the specified table with their column
+// types, for a quick look at a table without building a query
+func (h *ExploreHandler) SampleTable(w http.ResponseWriter, r *http.Request) {
+	h.previewTable(w, r, maxSampleLimit)
+}
+
+// previewTable returns up to ?limit rows of a table, defaulting to
+// defaultPreviewLimit and capped at maxLimit
+func (h *ExploreHandler) previewTable(w http.ResponseWriter, r *http.Request, maxLimit int) {
+	ctx := r.Context()
+	databaseName := h.databaseParam(r)
+	table := chi.URLParam(r, "table")
+	
+	if databaseName == "" || table == "" {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, "Database and table parameters are required")
+		return
+	}
+	
+	limit := defaultPreviewLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, "Limit must be a positive integer")
+			return
+		}
+		limit = parsed
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	
+	h.logger.Debug("previewing table", "database", databaseName, "table", table, "limit", limit)
+	
+	response, err := h.db.PreviewTable(ctx, databaseName, table, limit)
+	if err != nil {
+		h.logger.Error("error previewing table", "database", databaseName, "table", table, "error", err)
+		respondQueryError(w, err, "Could not preview table")
+		return
+	}
+	
+	httputil.RespondJSON(w, http.StatusOK, response)
+}
+
+// GetTableSchema returns the engine, partition, sorting and primary keys,
+// columns and data skipping indexes of a table
+func (h *ExploreHandler) GetTableSchema(w http.ResponseWriter, r *http.Request) {
+	databaseName := h.databaseParam(r)
+	table := chi.URLParam(r, "table")
+	
+	if databaseName == "" || table == "" {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, "Database and table parameters are required")
+		return
+	}
+	
+	schema, err := h.db.GetTableSchema(r.Context(), databaseName, table)
+	if err != nil {
+		h.logger.Error("error fetching table schema", "database", databaseName, "table", table, "error", err)
+		respondQueryError(w, err, "Could not fetch table schema")
+		return
+	}
+	
+	httputil.RespondJSON(w, http.StatusOK, schema)
+}
+
+// GetColumnCardinality returns the approximate number of distinct values of
+// every column of a table, sampled over the last ?windowSeconds (default an
+// hour) and at most ?sampleRows rows, to help pick group-by columns
+func (h *ExploreHandler) GetColumnCardinality(w http.ResponseWriter, r *http.Request) {
+	databaseName := h.databaseParam(r)
+	table := chi.URLParam(r, "table")
+	
+	if databaseName == "" || table == "" {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, "Database and table parameters are required")
+		return
+	}
+	
+	window := defaultCardinalityWindow
+	if windowStr := r.URL.Query().Get("windowSeconds"); windowStr != "" {
+		parsed, err := strconv.Atoi(windowStr)
+		if err != nil || parsed <= 0 {
+			httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, "windowSeconds must be a positive integer")
+			return
+		}
+		window = time.Duration(parsed) * time.Second
+	}
+	
+	sampleRows := defaultCardinalitySampleRows
+	if sampleStr := r.URL.Query().Get("sampleRows"); sampleStr != "" {
+		parsed, err := strconv.Atoi(sampleStr)
+		if err != nil || parsed <= 0 || parsed > maxCardinalitySampleRows {
+			httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest,
+				fmt.Sprintf("sampleRows must be between 1 and %d", maxCardinalitySampleRows))
+			return
+		}
+		sampleRows = parsed
+	}
+	
+	cardinality, err := h.db.GetColumnCardinality(r.Context(), databaseName, table, window, sampleRows)
+	if err != nil {
+		h.logger.Error("error estimating column cardinality", "database", databaseName, "table", table, "error", err)
+		respondQueryError(w, err, "Could not estimate column cardinality")
+		return
+	}
+	
+	httputil.RespondJSON(w, http.StatusOK, cardinality)
 }
 
 // ExecuteQuery executes a dynamic explore query
 func (h *ExploreHandler) ExecuteQuery(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	var req database.ExploreRequest
+	if !httputil.DecodeJSON(w, r, &req, h.cfg.Get().Server.MaxRequestBodyBytes) {
+		return
+	}
+	
+	h.runExploreQuery(w, r, req)
+}
+
+// runExploreQuery validates and executes an explore query, streaming the
+// results as JSON, or as CSV or NDJSON when the client asks for it
+func (h *ExploreHandler) runExploreQuery(w http.ResponseWriter, r *http.Request, req database.ExploreRequest) {
+	req.Database = h.orDefaultDatabase(req.Database)
+	if req.Database == "" || req.Table == "" {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, "Database and table are required")
+		return
+	}
+	if err := h.checkRequestSettings(req.Settings); err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, err.Error())
+		return
+	}
+	
+	timeout, ok := h.queryTimeout(w, req.TimeoutSeconds)
+	if !ok {
+		return
+	}
+	req.TimeoutSeconds = int(timeout / time.Second)
 	
+	if req.Limit, ok = resolveLimit(w, h.cfg.Get().Query, req.Limit); !ok {
+		return
+	}
+	
+	h.logger.Debug("executing explore query", "database", req.Database, "table", req.Table)
+	
+	stream, ok := newResultStream(w, r, req.Table+".csv")
+	if !ok {
+		stream = newJSONStream(w, "data", nil)
+	}
+	h.streamExploreQuery(w, r, req, stream)
+}
+
+// ValidateQuery checks an explore query and returns the SQL it would run with
+// ClickHouse's estimate of the rows it would read, without executing it
+func (h *ExploreHandler) ValidateQuery(w http.ResponseWriter, r *http.Request) {
 	var req database.ExploreRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body")
+	if !httputil.DecodeJSON(w, r, &req, h.cfg.Get().Server.MaxRequestBodyBytes) {
 		return
 	}
 	
+	req.Database = h.orDefaultDatabase(req.Database)
 	if req.Database == "" || req.Table == "" {
-		respondError(w, http.StatusBadRequest, "Database and table are required")
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, "Database and table are required")
+		return
+	}
+	if err := h.checkRequestSettings(req.Settings); err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, err.Error())
 		return
 	}
 	
-	h.logger.Printf("Executing explore query for table: %s.%s", req.Database, req.Table)
+	var ok bool
+	if req.Limit, ok = resolveLimit(w, h.cfg.Get().Query, req.Limit); !ok {
+		return
+	}
 	
-	result, err := h.db.ExecuteExploreQuery(ctx, req)
+	explanation, err := h.service.ExplainExploreQuery(r.Context(), req)
+	if errors.Is(err, services.ErrInvalidRequest) {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidQuery, err.Error())
+		return
+	}
 	if err != nil {
-		h.logger.Printf("Error executing explore query: %v", err)
-		respondError(w, http.StatusInternalServerError, "Could not execute query")
+		h.logger.Error("error validating explore query", "error", err)
+		respondQueryError(w, err, "Could not validate query")
 		return
 	}
 	
-	h.logger.Printf("Successfully executed explore query, returning %d rows", result.Total)
-	
-	respondJSON(w, http.StatusOK, result)
+	httputil.RespondJSON(w, http.StatusOK, explanation)
 }
 
 // GetAutocomplete provides SQL autocomplete suggestions
@@ -200,22 +518,22 @@ func (h *ExploreHandler) GetAutocomplete(w http.ResponseWriter, r *http.Request)
 	ctx := r.Context()
 	
 	var req AutocompleteRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body")
+	if !httputil.DecodeJSON(w, r, &req, h.cfg.Get().Server.MaxRequestBodyBytes) {
 		return
 	}
 	
+	req.Database = h.orDefaultDatabase(req.Database)
 	if req.Database == "" {
-		respondError(w, http.StatusBadRequest, "Database is required")
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, "Database is required")
 		return
 	}
 	
-	h.logger.Printf("Getting autocomplete suggestions for database: %s, query: %s", req.Database, req.Query)
+	h.logger.Debug("getting autocomplete suggestions", "database", req.Database, "query", req.Query)
 	
 	suggestions, err := h.getAutocompleteSuggestions(ctx, req)
 	if err != nil {
-		h.logger.Printf("Error getting autocomplete suggestions: %v", err)
-		respondError(w, http.StatusInternalServerError, "Could not get autocomplete suggestions")
+		h.logger.Error("error getting autocomplete suggestions", "error", err)
+		respondQueryError(w, err, "Could not get autocomplete suggestions")
 		return
 	}
 	
@@ -223,186 +541,597 @@ func (h *ExploreHandler) GetAutocomplete(w http.ResponseWriter, r *http.Request)
 		Suggestions: suggestions,
 	}
 	
-	respondJSON(w, http.StatusOK, response)
+	httputil.RespondJSON(w, http.StatusOK, response)
+}
+
+// maxAutocompleteSuggestions keeps the suggestion list short enough for the UI
+const maxAutocompleteSuggestions = 20
+
+// autocompleteKeywords are suggested wherever a keyword may follow
+var autocompleteKeywords = []string{
+	"SELECT", "FROM", "WHERE", "GROUP BY", "ORDER BY", "HAVING", "LIMIT", "OFFSET",
+	"JOIN", "LEFT JOIN", "RIGHT JOIN", "INNER JOIN", "OUTER JOIN", "FULL JOIN",
+	"ON", "AND", "OR", "NOT", "IN", "LIKE", "BETWEEN", "IS", "NULL", "TRUE", "FALSE",
+	"COUNT", "SUM", "AVG", "MIN", "MAX", "DISTINCT", "AS", "ASC", "DESC",
+}
+
+// columnClauses are the clauses in which column names are suggested
+var columnClauses = map[string]bool{
+	"select":   true,
+	"on":       true,
+	"using":    true,
+	"where":    true,
+	"group by": true,
+	"order by": true,
+	"having":   true,
 }
 
-// getAutocompleteSuggestions generates autocomplete suggestions based on the query context
+// getAutocompleteSuggestions suggests tables after FROM and JOIN, the columns
+// of the tables in the query elsewhere, and keywords. "alias." narrows the
+// columns to that table, and columns found in several tables are qualified.
 func (h *ExploreHandler) getAutocompleteSuggestions(ctx context.Context, req AutocompleteRequest) ([]AutocompleteSuggestion, error) {
-	var suggestions []AutocompleteSuggestion
-	
-	// Convert query to lowercase for pattern matching
-	query := strings.ToLower(req.Query)
-	
-	// Get the word at cursor position
-	wordAtCursor := h.getWordAtPosition(req.Query, req.Position)
-	
-	// Always include SQL keywords
-	keywords := []string{
-		"SELECT", "FROM", "WHERE", "GROUP BY", "ORDER BY", "HAVING", "LIMIT", "OFFSET",
-		"JOIN", "LEFT JOIN", "RIGHT JOIN", "INNER JOIN", "OUTER JOIN", "FULL JOIN",
-		"ON", "AND", "OR", "NOT", "IN", "LIKE", "BETWEEN", "IS", "NULL", "TRUE", "FALSE",
-		"COUNT", "SUM", "AVG", "MIN", "MAX", "DISTINCT", "AS", "ASC", "DESC",
+	sql := database.AnalyzeSQL(req.Query, req.Position)
+	suggestions := []AutocompleteSuggestion{}
+	if sql.InLiteral {
+		return suggestions, nil
 	}
-	
-	for _, keyword := range keywords {
-		if strings.HasPrefix(strings.ToLower(keyword), strings.ToLower(wordAtCursor)) {
-			suggestions = append(suggestions, AutocompleteSuggestion{
-				Text:        keyword,
-				Type:        "keyword",
-				Description: "SQL keyword",
-			})
+	prefix := strings.ToLower(sql.Prefix)
+
+	switch {
+	case sql.ExpectTable:
+		databaseName := req.Database
+		if sql.Qualifier != "" {
+			databaseName = sql.Qualifier
 		}
-	}
-	
-	// Get table suggestions if we're in a context where tables are expected
-	if h.shouldSuggestTables(query, req.Position) {
-		tables, err := h.db.GetTables(ctx, req.Database)
-		if err == nil {
-			for _, table := range tables {
-				if strings.HasPrefix(strings.ToLower(table), strings.ToLower(wordAtCursor)) {
-					suggestions = append(suggestions, AutocompleteSuggestion{
-						Text:        table,
-						Type:        "table",
-						Description: fmt.Sprintf("Table in %s database", req.Database),
-					})
+		tables, err := h.service.GetTables(ctx, databaseName)
+		if err != nil {
+			return nil, err
+		}
+		for _, table := range tables {
+			if strings.HasPrefix(strings.ToLower(table), prefix) {
+				suggestions = append(suggestions, AutocompleteSuggestion{
+					Text:        table,
+					Type:        "table",
+					Description: fmt.Sprintf("Table in %s database", databaseName),
+				})
+			}
+		}
+	case sql.Qualifier != "":
+		for _, ref := range sql.Tables {
+			if ref.Name() != sql.Qualifier {
+				continue
+			}
+			columns := h.autocompleteColumns(ctx, req.Database, []database.SQLTableRef{ref})
+			for _, column := range columns {
+				if strings.HasPrefix(strings.ToLower(column.name), prefix) {
+					suggestions = append(suggestions, column.suggestion(false))
 				}
 			}
+			break
+		}
+	case columnClauses[sql.Clause]:
+		columns := h.autocompleteColumns(ctx, req.Database, sql.Tables)
+		seen := make(map[string]int, len(columns))
+		for _, column := range columns {
+			seen[column.name]++
+		}
+		for _, column := range columns {
+			if strings.HasPrefix(strings.ToLower(column.name), prefix) {
+				suggestions = append(suggestions, column.suggestion(seen[column.name] > 1))
+			}
 		}
 	}
-	
-	// Get column suggestions if we're in a context where columns are expected
-	if tableName := h.getTableFromQuery(query); tableName != "" {
-		fields, err := h.db.GetTableFields(ctx, req.Database, tableName)
-		if err == nil {
-			for _, field := range fields {
-				if strings.HasPrefix(strings.ToLower(field.Name), strings.ToLower(wordAtCursor)) {
-					suggestions = append(suggestions, AutocompleteSuggestion{
-						Text:        field.Name,
-						Type:        "column",
-						Description: fmt.Sprintf("Column (%s) in %s.%s", field.Type, req.Database, tableName),
-					})
-				}
+
+	if !sql.ExpectTable && sql.Qualifier == "" {
+		for _, keyword := range autocompleteKeywords {
+			if strings.HasPrefix(strings.ToLower(keyword), prefix) {
+				suggestions = append(suggestions, AutocompleteSuggestion{
+					Text:        keyword,
+					Type:        "keyword",
+					Description: "SQL keyword",
+				})
 			}
 		}
 	}
-	
-	// Limit suggestions to avoid overwhelming the UI
-	if len(suggestions) > 20 {
-		suggestions = suggestions[:20]
+
+	if len(suggestions) > maxAutocompleteSuggestions {
+		suggestions = suggestions[:maxAutocompleteSuggestions]
 	}
-	
+
 	return suggestions, nil
 }
 
-// getWordAtPosition extracts the word at the given cursor position
-func (h *ExploreHandler) getWordAtPosition(query string, position int) string {
-	if position < 0 || position > len(query) {
-		return ""
+// autocompleteColumn is a column of a table referenced by the query being completed
+type autocompleteColumn struct {
+	name     string
+	typ      string
+	database string
+	ref      database.SQLTableRef
+}
+
+// suggestion renders the column, as "table.column" when qualified
+func (c autocompleteColumn) suggestion(qualified bool) AutocompleteSuggestion {
+	text := c.name
+	if qualified {
+		text = c.ref.Name() + "." + c.name
 	}
-	
-	// Find the start of the word
-	start := position
-	for start > 0 && (isAlphaNumeric(query[start-1]) || query[start-1] == '_') {
-		start--
+	return AutocompleteSuggestion{
+		Text:        text,
+		Type:        "column",
+		Description: fmt.Sprintf("Column (%s) in %s.%s", c.typ, c.database, c.ref.Table),
 	}
-	
-	// Find the end of the word
-	end := position
-	for end < len(query) && (isAlphaNumeric(query[end]) || query[end] == '_') {
-		end++
+}
+
+// autocompleteColumns returns the columns of the given tables; tables that
+// cannot be looked up, e.g. because their name is still being typed, are skipped
+func (h *ExploreHandler) autocompleteColumns(ctx context.Context, defaultDatabase string, refs []database.SQLTableRef) []autocompleteColumn {
+	var columns []autocompleteColumn
+	for _, ref := range refs {
+		databaseName := ref.Database
+		if databaseName == "" {
+			databaseName = defaultDatabase
+		}
+		fields, err := h.service.GetTableFields(ctx, databaseName, ref.Table)
+		if err != nil {
+			h.logger.Debug("skipping autocomplete columns", "database", databaseName, "table", ref.Table, "error", err)
+			continue
+		}
+		for _, field := range fields {
+			columns = append(columns, autocompleteColumn{name: field.Name, typ: field.Type, database: databaseName, ref: ref})
+		}
 	}
-	
-	return query[start:end]
+	return columns
 }
 
-// shouldSuggestTables determines if we should suggest table names based on query context
-func (h *ExploreHandler) shouldSuggestTables(query string, position int) bool {
-	// Simple heuristics for when to suggest tables
-	fromIndex := strings.LastIndex(query[:position], "from")
-	joinIndex := strings.LastIndex(query[:position], "join")
+// ExecuteRawSQL executes a raw SQL query
+func (h *ExploreHandler) ExecuteRawSQL(w http.ResponseWriter, r *http.Request) {
+	var req RawSQLRequest
+	if !httputil.DecodeJSON(w, r, &req, h.cfg.Get().Server.MaxRequestBodyBytes) {
+		return
+	}
 	
-	// If we find FROM or JOIN keywords recently, suggest tables
-	return fromIndex >= 0 || joinIndex >= 0
+	h.runRawSQL(w, r, req)
 }
 
-// getTableFromQuery attempts to extract the main table name from the query
-func (h *ExploreHandler) getTableFromQuery(query string) string {
-	// Simple regex to find "FROM tablename" pattern
-	fromIndex := strings.Index(query, "from")
-	if fromIndex == -1 {
-		return ""
+// runRawSQL checks that a raw SQL statement is a single read-only query and
+// executes it, streaming the results as JSON, or as CSV or NDJSON when the
+// client asks for it
+func (h *ExploreHandler) runRawSQL(w http.ResponseWriter, r *http.Request, req RawSQLRequest) {
+	req.Database = h.orDefaultDatabase(req.Database)
+	if req.Database == "" {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, "Database is required")
+		return
+	}
+	
+	if req.Query == "" {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, "Query is required")
+		return
+	}
+	if err := h.checkRequestSettings(req.Settings); err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, err.Error())
+		return
 	}
 	
-	// Look for the table name after FROM
-	afterFrom := query[fromIndex+4:] // Skip "from"
-	afterFrom = strings.TrimSpace(afterFrom)
+	// Only a single read-only statement may run
+	if err := database.ValidateReadOnlyQuery(req.Query); err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidQuery, err.Error())
+		return
+	}
+	if err := validateRawSQLParams(req); err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidQuery, err.Error())
+		return
+	}
+	rowLimit, ok := h.rawSQLRowLimit(w, req.Query)
+	if !ok {
+		return
+	}
 	
-	// Get the first word (table name)
-	words := strings.Fields(afterFrom)
-	if len(words) > 0 {
-		return words[0]
+	timeout, ok := h.queryTimeout(w, req.TimeoutSeconds)
+	if !ok {
+		return
 	}
+	req.TimeoutSeconds = int(timeout / time.Second)
 	
-	return ""
+	h.logger.Debug("executing raw SQL query", "database", req.Database, "query", req.Query, "rowLimit", rowLimit)
+	
+	stream, ok := newResultStream(w, r, "query.csv")
+	if !ok {
+		trailer := map[string]interface{}{"query": req.Query}
+		if len(req.Params) > 0 {
+			trailer["params"] = req.Params
+		}
+		stream = newJSONStream(w, "rows", trailer)
+	}
+	if rowLimit > 0 {
+		// CSV and NDJSON have no room for the flag in the body, so the limit
+		// is a header and whether rows were left out a trailer
+		w.Header().Set("X-Auto-Limit", strconv.Itoa(rowLimit))
+		w.Header().Add("Trailer", truncatedTrailer)
+	}
+	h.streamRawSQL(w, r, req, stream, rowLimit)
 }
 
-// isAlphaNumeric checks if a character is alphanumeric
-func isAlphaNumeric(c byte) bool {
-	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+// truncatedTrailer is the HTTP trailer telling whether a raw SQL result was
+// cut short by the row limit the server applied
+const truncatedTrailer = "X-Truncated"
+
+// rawSQLRowLimit applies query.rawSQLLimitPolicy to a raw SQL query: it
+// returns the number of rows to cap it at, query.rawSQLDefaultLimit for a
+// query without a LIMIT and query.maxLimit for one with its own, or 0 for a
+// query that runs as it is. Like the limit of other queries, a LIMIT above
+// query.maxLimit is refused when query.rejectOverMaxLimit is set. It writes a
+// 400 and returns false for a refused query.
+func (h *ExploreHandler) rawSQLRowLimit(w http.ResponseWriter, query string) (int, bool) {
+	cfg := h.cfg.Get().Query
+	if cfg.RawSQLLimitPolicy == config.RawSQLLimitOff {
+		return 0, true
+	}
+	if database.HasRowLimit(query) {
+		if limit, ok := database.RowLimitValue(query); ok && limit > cfg.MaxLimit && cfg.RejectOverMaxLimit {
+			httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidQuery,
+				fmt.Sprintf("limit cannot exceed %d", cfg.MaxLimit))
+			return 0, false
+		}
+		return cfg.MaxLimit, true
+	}
+	if cfg.RawSQLLimitPolicy == config.RawSQLLimitReject {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidQuery,
+			fmt.Sprintf("Query has no LIMIT; add one, e.g. LIMIT %d", cfg.RawSQLDefaultLimit))
+		return 0, false
+	}
+	return cfg.RawSQLDefaultLimit, true
 }
 
-// ExecuteRawSQL executes a raw SQL query
-func (h *ExploreHandler) ExecuteRawSQL(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	
+// RawSQLExplanation is the response of POST /explore/explain
+type RawSQLExplanation struct {
+	Query  string        `json:"query"`
+	Params []interface{} `json:"params,omitempty"`
+	*database.RawQueryExplanation
+}
+
+// ExplainRawSQL checks a raw SQL query like ExecuteRawSQL and returns
+// ClickHouse's plan for it with an estimate of the rows and bytes it would
+// read, without executing it
+func (h *ExploreHandler) ExplainRawSQL(w http.ResponseWriter, r *http.Request) {
 	var req RawSQLRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body")
+	if !httputil.DecodeJSON(w, r, &req, h.cfg.Get().Server.MaxRequestBodyBytes) {
 		return
 	}
-	
-	if req.Database == "" {
-		respondError(w, http.StatusBadRequest, "Database is required")
+
+	if req.Query == "" {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, "Query is required")
 		return
 	}
-	
-	if req.Query == "" {
-		respondError(w, http.StatusBadRequest, "Query is required")
+	if err := h.checkRequestSettings(req.Settings); err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, err.Error())
+		return
+	}
+	if err := database.ValidateReadOnlyQuery(req.Query); err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidQuery, err.Error())
+		return
+	}
+	if err := validateRawSQLParams(req); err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidQuery, err.Error())
+		return
+	}
+
+	timeout, ok := h.queryTimeout(w, req.TimeoutSeconds)
+	if !ok {
+		return
+	}
+
+	ctx := database.WithRequestSettings(r.Context(), req.Settings)
+	explanation, err := h.db.ExplainRawQuery(ctx, req.Query, req.Params, timeout)
+	if errors.Is(err, database.ErrQueryRejected) {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidQuery, err.Error())
+		return
+	}
+	if err != nil {
+		h.logger.Error("error explaining raw SQL query", "error", err)
+		respondQueryError(w, err, "Could not explain query")
 		return
 	}
+
+	httputil.RespondJSON(w, http.StatusOK, RawSQLExplanation{Query: req.Query, Params: req.Params, RawQueryExplanation: explanation})
+}
+
+// validateRawSQLParams checks that a raw SQL query with params has one ? per
+// param and that every param is a plain value. The driver binds params by
+// quoting them into the query. A query without params is left alone, as
+// nothing is bound and it may use ? as ClickHouse's ternary operator.
+func validateRawSQLParams(req RawSQLRequest) error {
+	if len(req.Params) == 0 {
+		return nil
+	}
+	placeholders, err := database.CountPlaceholders(req.Query)
+	if err != nil {
+		return err
+	}
+	if placeholders != len(req.Params) {
+		return fmt.Errorf("query has %d ? placeholders but %d params were given; write a literal ? as \\?", placeholders, len(req.Params))
+	}
+	for i, param := range req.Params {
+		switch param.(type) {
+		case string, float64, bool, nil:
+		default:
+			return fmt.Errorf("params[%d] must be a string, number, boolean or null", i)
+		}
+	}
+	return nil
+}
+
+// rawHistoryQuery is the query text recorded for a raw SQL query: the query,
+// followed by its params in a comment when it has any
+func rawHistoryQuery(req RawSQLRequest) string {
+	if len(req.Params) == 0 {
+		return req.Query
+	}
+	encoded, err := json.Marshal(req.Params)
+	if err != nil {
+		return req.Query
+	}
+	return req.Query + "\n-- params: " + string(encoded)
+}
+
+// checkRequestSettings checks the ClickHouse settings of a request against
+// query.allowedSettings
+func (h *ExploreHandler) checkRequestSettings(settings map[string]interface{}) error {
+	return database.ValidateRequestSettings(settings, h.cfg.Get().Query.AllowedSettings)
+}
+
+// defaultDatabase returns the database used when a request names none:
+// query.defaultDatabase, or else the database of the ClickHouse connection
+func (h *ExploreHandler) defaultDatabase() string {
+	cfg := h.cfg.Get()
+	if cfg.Query.DefaultDatabase != "" {
+		return cfg.Query.DefaultDatabase
+	}
+	return cfg.ClickHouse.Database
+}
+
+// orDefaultDatabase returns name, or the default database when it is empty
+func (h *ExploreHandler) orDefaultDatabase(name string) string {
+	if name == "" {
+		return h.defaultDatabase()
+	}
+	return name
+}
+
+// databaseParam returns the {database} path parameter, or the default
+// database on the routes without one
+func (h *ExploreHandler) databaseParam(r *http.Request) string {
+	return h.orDefaultDatabase(chi.URLParam(r, "database"))
+}
+
+// queryTimeout resolves the time limit of an explore or raw SQL query: the
+// requested number of seconds, or the configured default when it is 0. It
+// writes a 400 and returns false when the request exceeds the server maximum.
+func (h *ExploreHandler) queryTimeout(w http.ResponseWriter, requestedSeconds int) (time.Duration, bool) {
+	timeout, err := h.resolveQueryTimeout(requestedSeconds)
+	if err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, err.Error())
+		return 0, false
+	}
+	return timeout, true
+}
+
+// resolveQueryTimeout is queryTimeout without the response, returning an
+// error for a rejected timeout
+func (h *ExploreHandler) resolveQueryTimeout(requestedSeconds int) (time.Duration, error) {
+	cfg := h.cfg.Get()
+	maxSeconds := cfg.ClickHouse.MaxQueryTimeoutSeconds
+	switch {
+	case requestedSeconds < 0:
+		return 0, fmt.Errorf("timeoutSeconds cannot be negative")
+	case requestedSeconds > maxSeconds:
+		return 0, fmt.Errorf("timeoutSeconds cannot exceed %d", maxSeconds)
+	case requestedSeconds == 0:
+		return time.Duration(cfg.ClickHouse.QueryTimeoutSeconds) * time.Second, nil
+	}
+	return time.Duration(requestedSeconds) * time.Second, nil
+}
+
+// streamExploreQuery writes explore results to stream row by row
+func (h *ExploreHandler) streamExploreQuery(w http.ResponseWriter, r *http.Request, req database.ExploreRequest, stream resultStream) {
+	ctx := withStreamProgress(database.WithRequestSettings(r.Context(), req.Settings), stream)
+	rowCount := 0
+	startedAt := time.Now()
+	onColumns, onRow := h.streamRows(ctx, stream, &rowCount)
 	
-	// Basic security: prevent dangerous operations
-	queryLower := strings.ToLower(strings.TrimSpace(req.Query))
-	if strings.HasPrefix(queryLower, "drop") || 
-	   strings.HasPrefix(queryLower, "delete") || 
-	   strings.HasPrefix(queryLower, "truncate") || 
-	   strings.HasPrefix(queryLower, "alter") ||
-	   strings.HasPrefix(queryLower, "create") ||
-	   strings.HasPrefix(queryLower, "insert") ||
-	   strings.HasPrefix(queryLower, "update") {
-		respondError(w, http.StatusBadRequest, "Only SELECT queries are allowed")
+	err := h.service.StreamExploreQuery(ctx, req, onColumns, onRow)
+	h.recordQuery(r, "explore", req.Database, exploreHistoryQuery(req), startedAt, rowCount, err)
+	if err != nil {
+		h.logger.Error("error streaming explore query", "rows", rowCount, "error", err)
+		if !stream.Started() && errors.Is(err, services.ErrInvalidRequest) {
+			httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidQuery, err.Error())
+			return
+		}
+		respondStreamError(w, stream, err, "Could not execute query")
 		return
 	}
 	
-	h.logger.Printf("Executing raw SQL query on database %s: %s", req.Database, req.Query)
+	stream.Finish()
+	h.logger.Debug("streamed explore query", "rows", rowCount)
+}
+
+// streamRawSQL writes raw SQL results to stream row by row. A non-zero
+// rowLimit caps the query at that many rows, telling the client whether it
+// had more.
+func (h *ExploreHandler) streamRawSQL(w http.ResponseWriter, r *http.Request, req RawSQLRequest, stream resultStream, rowLimit int) {
+	ctx := withStreamProgress(database.WithRequestSettings(r.Context(), req.Settings), stream)
+	rowCount := 0
+	startedAt := time.Now()
+	onColumns, onRow := h.streamRows(ctx, stream, &rowCount)
+	
+	query := req.Query
+	truncated := false
+	if rowLimit > 0 {
+		// One row more than the limit tells whether the result was cut short
+		query = database.WithRowLimit(req.Query, rowLimit+1)
+		writeRow := onRow
+		onRow = func(row map[string]interface{}) error {
+			if rowCount >= rowLimit {
+				truncated = true
+				return nil
+			}
+			return writeRow(row)
+		}
+	}
 	
-	// Execute the query
-	columns, results, err := h.db.QueryRaw(ctx, req.Query)
+	err := h.db.QueryRawStream(ctx, query, req.Params, time.Duration(req.TimeoutSeconds)*time.Second, onColumns, onRow)
+	h.recordQuery(r, "raw", req.Database, rawHistoryQuery(req), startedAt, rowCount, err)
 	if err != nil {
-		h.logger.Printf("Error executing raw SQL query: %v", err)
-		respondError(w, http.StatusInternalServerError, "Failed to execute query")
+		h.logger.Error("error streaming raw SQL query", "rows", rowCount, "error", err)
+		respondStreamError(w, stream, err, "Failed to execute query")
 		return
 	}
 	
-	response := RawSQLResponse{
-		Columns: columns,
-		Rows:    results,
-		Total:   len(results),
-		Query:   req.Query,
+	if rowLimit > 0 {
+		if limited, ok := stream.(limitedStream); ok {
+			limited.RowLimit(rowLimit, truncated)
+		}
 	}
-	
-	h.logger.Printf("Successfully executed raw SQL query, returning %d rows", len(results))
-	respondJSON(w, http.StatusOK, response)
+	stream.Finish()
+	if rowLimit > 0 {
+		// Declared as a trailer by runRawSQL, so sent after the body
+		w.Header().Set(truncatedTrailer, strconv.FormatBool(truncated))
+	}
+	h.logger.Debug("streamed raw SQL query", "rows", rowCount, "truncated", truncated)
+}
+
+// streamRows returns the callbacks that hand query results to stream, counting
+// the rows written in rowCount. The query stops once the client has gone away
+// or the result grows past clickhouse.maxResultRows.
+func (h *ExploreHandler) streamRows(ctx context.Context, stream resultStream, rowCount *int) (database.ColumnsFunc, database.RowFunc) {
+	onRow := func(row map[string]interface{}) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := stream.WriteRow(row); err != nil {
+			return err
+		}
+		*rowCount++
+		return nil
+	}
+	return stream.Columns, database.LimitRows(h.cfg.Get().ClickHouse.MaxResultRows, onRow)
 }
 
-// Helper functions are imported from logs.go handler
\ No newline at end of file
+// withStreamProgress reports query progress to stream when it shows progress
+func withStreamProgress(ctx context.Context, stream resultStream) context.Context {
+	if progress, ok := stream.(progressStream); ok {
+		return database.WithProgress(ctx, progress.Progress)
+	}
+	return ctx
+}
+
+// recordQuery stores a query execution in the history table with the user who
+// ran it; failures are only logged so they never fail the query itself
+func (h *ExploreHandler) recordQuery(r *http.Request, queryType, databaseName, query string, startedAt time.Time, rowCount int, queryErr error) {
+	entry := database.QueryHistoryEntry{
+		QueryType:  queryType,
+		User:       currentUser(r),
+		Database:   databaseName,
+		Query:      query,
+		RowCount:   uint64(rowCount),
+		DurationMs: uint64(time.Since(startedAt).Milliseconds()),
+		Success:    queryErr == nil,
+		StartedAt:  startedAt,
+	}
+	if queryErr != nil {
+		entry.Error = queryErr.Error()
+	}
+
+	if err := h.db.RecordQuery(context.WithoutCancel(r.Context()), entry); err != nil {
+		h.logger.Warn("error recording query history", "error", err)
+	}
+}
+
+// exploreHistoryQuery is the query text recorded for an explore query: the
+// request itself, which holds the filter values the SQL only binds
+func exploreHistoryQuery(req database.ExploreRequest) string {
+	encoded, err := json.Marshal(req)
+	if err != nil {
+		return req.Database + "." + req.Table
+	}
+	return string(encoded)
+}
+
+// GetQueryHistory lists recorded raw SQL and explore queries, newest first,
+// with optional filters
+func (h *ExploreHandler) GetQueryHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := r.URL.Query()
+
+	filter := database.QueryHistoryFilter{Limit: 50}
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > 1000 {
+			httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "limit must be between 1 and 1000")
+			return
+		}
+		filter.Limit = limit
+	}
+	if v := params.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "offset must be a non-negative integer")
+			return
+		}
+		filter.Offset = offset
+	}
+	switch v := params.Get("type"); v {
+	case "", "raw", "explore":
+		filter.QueryType = v
+	default:
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "type must be raw or explore")
+		return
+	}
+	filter.User = params.Get("user")
+	if v := params.Get("start"); v != "" {
+		start, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "start must be an RFC3339 timestamp")
+			return
+		}
+		filter.Start = &start
+	}
+	if v := params.Get("end"); v != "" {
+		end, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "end must be an RFC3339 timestamp")
+			return
+		}
+		filter.End = &end
+	}
+	if v := params.Get("success"); v != "" {
+		success, err := strconv.ParseBool(v)
+		if err != nil {
+			httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "success must be true or false")
+			return
+		}
+		filter.Success = &success
+	}
+	if v := params.Get("minDuration"); v != "" {
+		minDuration, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "minDuration must be a non-negative number of milliseconds")
+			return
+		}
+		filter.MinDurationMs = minDuration
+	}
+
+	entries, total, err := h.db.ListQueryHistory(ctx, filter)
+	if err != nil {
+		h.logger.Error("error fetching query history", "error", err)
+		respondQueryError(w, err, "Could not fetch query history")
+		return
+	}
+
+	httputil.RespondJSON(w, http.StatusOK, QueryHistoryResponse{
+		Entries: entries,
+		Total:   total,
+		Limit:   filter.Limit,
+		Offset:  filter.Offset,
+	})
+}
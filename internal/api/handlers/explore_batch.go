@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/observio/backend/internal/api/httputil"
+	"github.com/observio/backend/internal/database"
+	"github.com/observio/backend/internal/services"
+)
+
+// BatchQuery is one explore query of a batch, identified by a key the client
+// chooses, e.g. a dashboard panel ID
+type BatchQuery struct {
+	Key string `json:"key"`
+	database.ExploreRequest
+}
+
+// BatchRequest is the body of POST /explore/batch
+type BatchRequest struct {
+	Queries []BatchQuery `json:"queries"`
+}
+
+// BatchResult is the outcome of one query of a batch: its result, or the
+// error it failed with
+type BatchResult struct {
+	*database.ExploreResponse
+	Error *httputil.ErrorBody `json:"error,omitempty"`
+}
+
+// BatchResponse maps the key of every query of a batch to its result
+type BatchResponse struct {
+	Results map[string]BatchResult `json:"results"`
+}
+
+// ExecuteBatch runs several explore queries concurrently and returns all of
+// their results at once. A query that fails only fails its own result.
+func (h *ExploreHandler) ExecuteBatch(w http.ResponseWriter, r *http.Request) {
+	cfg := h.cfg.Get()
+	var req BatchRequest
+	if !httputil.DecodeJSON(w, r, &req, cfg.Server.MaxRequestBodyBytes) {
+		return
+	}
+	if err := validateBatch(req, cfg.Query.MaxBatchQueries); err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	batchTimeout := time.Duration(cfg.Query.BatchTimeoutSeconds) * time.Second
+	ctx, cancel := context.WithTimeout(r.Context(), batchTimeout)
+	defer cancel()
+
+	// At most batchConcurrency queries run at once
+	results := make([]BatchResult, len(req.Queries))
+	slots := make(chan struct{}, cfg.Query.BatchConcurrency)
+	var wg sync.WaitGroup
+	for i, query := range req.Queries {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = h.runBatchQuery(ctx, r, query.ExploreRequest, batchTimeout)
+		}()
+	}
+	wg.Wait()
+
+	response := BatchResponse{Results: make(map[string]BatchResult, len(req.Queries))}
+	for i, query := range req.Queries {
+		response.Results[query.Key] = results[i]
+	}
+	httputil.RespondJSON(w, http.StatusOK, response)
+}
+
+// validateBatch checks that a batch holds between 1 and maxQueries queries
+// with unique, non-empty keys
+func validateBatch(req BatchRequest, maxQueries int) error {
+	if len(req.Queries) == 0 {
+		return fmt.Errorf("queries must list at least one query")
+	}
+	if len(req.Queries) > maxQueries {
+		return fmt.Errorf("a batch cannot hold more than %d queries, got %d", maxQueries, len(req.Queries))
+	}
+
+	keys := make(map[string]bool, len(req.Queries))
+	for i, query := range req.Queries {
+		if query.Key == "" {
+			return fmt.Errorf("queries[%d]: key is required", i)
+		}
+		if keys[query.Key] {
+			return fmt.Errorf("queries[%d]: duplicate key %q", i, query.Key)
+		}
+		keys[query.Key] = true
+	}
+	return nil
+}
+
+// prepareExploreRequest fills in the default database, the timeout and the
+// limit of an explore query that is not answered with a regular response, such
+// as a query of a batch, and returns the error body for a rejected one
+func (h *ExploreHandler) prepareExploreRequest(req database.ExploreRequest) (database.ExploreRequest, *httputil.ErrorBody) {
+	req.Database = h.orDefaultDatabase(req.Database)
+	if req.Database == "" || req.Table == "" {
+		return req, &httputil.ErrorBody{Code: httputil.CodeInvalidRequest, Message: "Database and table are required"}
+	}
+	if err := h.checkRequestSettings(req.Settings); err != nil {
+		return req, &httputil.ErrorBody{Code: httputil.CodeInvalidRequest, Message: err.Error()}
+	}
+
+	timeout, err := h.resolveQueryTimeout(req.TimeoutSeconds)
+	if err != nil {
+		return req, &httputil.ErrorBody{Code: httputil.CodeInvalidRequest, Message: err.Error()}
+	}
+	req.TimeoutSeconds = int(timeout / time.Second)
+
+	if req.Limit, err = applyLimits(h.cfg.Get().Query, req.Limit); err != nil {
+		return req, &httputil.ErrorBody{Code: httputil.CodeInvalidFilter, Message: err.Error()}
+	}
+	return req, nil
+}
+
+// collectExploreQuery runs an explore query holding its rows in memory, up to
+// clickhouse.maxResultRows of them
+func (h *ExploreHandler) collectExploreQuery(ctx context.Context, req database.ExploreRequest) (*database.ExploreResponse, error) {
+	result := &database.ExploreResponse{Data: []map[string]interface{}{}}
+	onColumns := func(columns, columnTypes []string) error {
+		result.Columns = columns
+		result.ColumnTypes = columnTypes
+		return nil
+	}
+	onRow := database.LimitRows(h.cfg.Get().ClickHouse.MaxResultRows, func(row map[string]interface{}) error {
+		result.Data = append(result.Data, row)
+		return nil
+	})
+
+	err := h.service.StreamExploreQuery(database.WithRequestSettings(ctx, req.Settings), req, onColumns, onRow)
+	result.Total = len(result.Data)
+	return result, err
+}
+
+// runBatchQuery validates and executes one query of a batch, holding its rows
+// in memory, and reports a failure as the error of its result. ctx is the
+// batch's context, which is cancelled after batchTimeout.
+func (h *ExploreHandler) runBatchQuery(ctx context.Context, r *http.Request, req database.ExploreRequest, batchTimeout time.Duration) BatchResult {
+	req, errBody := h.prepareExploreRequest(req)
+	if errBody != nil {
+		return BatchResult{Error: errBody}
+	}
+
+	startedAt := time.Now()
+	result, err := h.collectExploreQuery(ctx, req)
+	h.recordQuery(r, "explore", req.Database, exploreHistoryQuery(req), startedAt, result.Total, err)
+	if err == nil {
+		return BatchResult{ExploreResponse: result}
+	}
+
+	h.logger.Error("error executing batch query", "database", req.Database, "table", req.Table, "error", err)
+	switch {
+	case errors.Is(err, services.ErrInvalidRequest):
+		return BatchResult{Error: &httputil.ErrorBody{Code: httputil.CodeInvalidQuery, Message: err.Error()}}
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return BatchResult{Error: &httputil.ErrorBody{Code: httputil.CodeQueryTimeout,
+			Message: fmt.Sprintf("Batch exceeded %d seconds and the query was stopped", int(batchTimeout/time.Second))}}
+	}
+	_, body := queryError(err, "Could not execute query")
+	return BatchResult{Error: &body}
+}
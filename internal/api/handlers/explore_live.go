@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/observio/backend/internal/api/httputil"
+	"github.com/observio/backend/internal/database"
+	"github.com/observio/backend/internal/services"
+	"golang.org/x/net/websocket"
+)
+
+// liveWriteTimeout bounds sending one message to a live query client
+const liveWriteTimeout = 10 * time.Second
+
+// LiveQueryMessage is a message sent by the client of GET /explore/ws: "query"
+// starts running Query every IntervalSeconds, replacing the previous query,
+// and "stop" stops it while keeping the connection open
+type LiveQueryMessage struct {
+	Type            string                   `json:"type"`
+	Query           *database.ExploreRequest `json:"query,omitempty"`
+	IntervalSeconds int                      `json:"intervalSeconds,omitempty"`
+}
+
+// LiveQueryEvent is a message sent to the client of GET /explore/ws: the
+// "result" of a run whose rows changed since the previous run, "unchanged"
+// when they did not, or an "error". Seq counts the runs of the current query
+// from 1.
+type LiveQueryEvent struct {
+	Type   string                    `json:"type"`
+	Seq    int                       `json:"seq,omitempty"`
+	Result *database.ExploreResponse `json:"result,omitempty"`
+	Error  *httputil.ErrorBody       `json:"error,omitempty"`
+}
+
+// liveQuery is the query a live connection currently runs
+type liveQuery struct {
+	req      database.ExploreRequest
+	interval time.Duration
+	seq      int
+	// last is the encoding of the previous result, to detect unchanged runs
+	last []byte
+}
+
+// LiveQuery upgrades the request to a WebSocket on which the client sends
+// explore queries that are run on an interval, each result being pushed to
+// the client. The query may be replaced at any time without reconnecting.
+func (h *ExploreHandler) LiveQuery(w http.ResponseWriter, r *http.Request) {
+	server := websocket.Server{
+		Handshake: h.checkLiveOrigin,
+		Handler:   h.serveLiveQuery,
+	}
+	server.ServeHTTP(w, r)
+}
+
+// checkLiveOrigin accepts connections from the origins allowed by
+// server.corsAllowedOrigins, as CORS does not apply to WebSockets, and from
+// non-browser clients sending no Origin
+func (h *ExploreHandler) checkLiveOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" || httputil.OriginAllowed(h.cfg.Get().Server.CORSAllowedOrigins, origin) {
+		return nil
+	}
+	return fmt.Errorf("origin %q is not allowed", origin)
+}
+
+// serveLiveQuery runs the queries of one live connection until the client
+// disconnects. A goroutine reads the client's messages while this one runs
+// the queries and writes every event; when the client leaves, ctx is
+// cancelled, which also stops a running query.
+func (h *ExploreHandler) serveLiveQuery(ws *websocket.Conn) {
+	defer ws.Close()
+	// The server's read and write timeouts still apply to the hijacked connection
+	ws.SetReadDeadline(time.Time{})
+	ws.MaxPayloadBytes = int(h.cfg.Get().Server.MaxRequestBodyBytes)
+
+	ctx, cancel := context.WithCancel(ws.Request().Context())
+	defer cancel()
+
+	messages := make(chan LiveQueryMessage)
+	go func() {
+		defer cancel()
+		for {
+			var msg LiveQueryMessage
+			if err := websocket.JSON.Receive(ws, &msg); err != nil {
+				var syntaxErr *json.SyntaxError
+				var typeErr *json.UnmarshalTypeError
+				if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+					// A malformed message is reported and the connection kept
+					msg = LiveQueryMessage{Type: "invalid"}
+				} else {
+					return
+				}
+			}
+			select {
+			case messages <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var query *liveQuery
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	stopTicker := func() {
+		if ticker != nil {
+			ticker.Stop()
+			ticker, tick = nil, nil
+		}
+	}
+	defer stopTicker()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-messages:
+			next, errBody := h.handleLiveMessage(msg)
+			if errBody != nil {
+				if !h.sendLiveEvent(ws, LiveQueryEvent{Type: "error", Error: errBody}) {
+					return
+				}
+				continue
+			}
+			stopTicker()
+			query = next
+			if query == nil {
+				continue
+			}
+			ticker = time.NewTicker(query.interval)
+			tick = ticker.C
+		case <-tick:
+		}
+
+		if query == nil {
+			continue
+		}
+		event := h.runLiveQuery(ctx, query)
+		if ctx.Err() != nil {
+			return
+		}
+		if event.Error != nil && event.Error.Code == httputil.CodeInvalidQuery {
+			// Running it again would fail the same way
+			stopTicker()
+			query = nil
+		}
+		if !h.sendLiveEvent(ws, event) {
+			return
+		}
+	}
+}
+
+// handleLiveMessage returns the query a "query" message starts, nil for a
+// "stop" message, or the error body for a rejected message
+func (h *ExploreHandler) handleLiveMessage(msg LiveQueryMessage) (*liveQuery, *httputil.ErrorBody) {
+	switch msg.Type {
+	case "query":
+	case "stop":
+		return nil, nil
+	case "invalid":
+		return nil, &httputil.ErrorBody{Code: httputil.CodeInvalidRequest, Message: "Message must be a JSON object with a string type"}
+	default:
+		return nil, &httputil.ErrorBody{Code: httputil.CodeInvalidRequest,
+			Message: fmt.Sprintf("Unknown message type %q (must be query or stop)", msg.Type)}
+	}
+	if msg.Query == nil {
+		return nil, &httputil.ErrorBody{Code: httputil.CodeInvalidRequest, Message: "query is required"}
+	}
+
+	cfg := h.cfg.Get().Query
+	intervalSeconds := msg.IntervalSeconds
+	if intervalSeconds == 0 {
+		intervalSeconds = cfg.LiveIntervalSeconds
+	}
+	if intervalSeconds < cfg.LiveMinIntervalSeconds {
+		return nil, &httputil.ErrorBody{Code: httputil.CodeInvalidRequest,
+			Message: fmt.Sprintf("intervalSeconds must be at least %d", cfg.LiveMinIntervalSeconds)}
+	}
+
+	req, errBody := h.prepareExploreRequest(*msg.Query)
+	if errBody != nil {
+		return nil, errBody
+	}
+	return &liveQuery{req: req, interval: time.Duration(intervalSeconds) * time.Second}, nil
+}
+
+// runLiveQuery runs the query once and returns the event reporting it. Runs
+// are not recorded in the query history.
+func (h *ExploreHandler) runLiveQuery(ctx context.Context, query *liveQuery) LiveQueryEvent {
+	query.seq++
+	result, err := h.collectExploreQuery(ctx, query.req)
+	if err != nil {
+		if ctx.Err() == nil {
+			h.logger.Error("error executing live query", "database", query.req.Database, "table", query.req.Table, "error", err)
+		}
+		if errors.Is(err, services.ErrInvalidRequest) {
+			return LiveQueryEvent{Type: "error", Seq: query.seq,
+				Error: &httputil.ErrorBody{Code: httputil.CodeInvalidQuery, Message: err.Error()}}
+		}
+		_, body := queryError(err, "Could not execute query")
+		return LiveQueryEvent{Type: "error", Seq: query.seq, Error: &body}
+	}
+
+	encoded, err := json.Marshal(result)
+	if err == nil && bytes.Equal(encoded, query.last) {
+		return LiveQueryEvent{Type: "unchanged", Seq: query.seq}
+	}
+	query.last = encoded
+	return LiveQueryEvent{Type: "result", Seq: query.seq, Result: result}
+}
+
+// sendLiveEvent writes an event to the client; it returns false when the
+// connection is gone
+func (h *ExploreHandler) sendLiveEvent(ws *websocket.Conn, event LiveQueryEvent) bool {
+	ws.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+	if err := websocket.JSON.Send(ws, event); err != nil {
+		h.logger.Debug("live query client is gone", "error", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/observio/backend/internal/api/httputil"
+)
+
+// jsonStream writes a query result as a single JSON object whose rows array
+// is written row by row instead of being built in memory:
+//
+//	{"columns": [...], "columnTypes": [...], "<rowsKey>": [...], "total": N, ...}
+//
+// Headers are sent with the first row, so errors raised before it can still
+// be reported with a normal status code. A failure after that closes the
+// document with an "error" field holding the usual error body.
+type jsonStream struct {
+	w           http.ResponseWriter
+	flusher     http.Flusher
+	rowsKey     string
+	trailer     map[string]interface{}
+	columns     []string
+	columnTypes []string
+	started     bool
+	total       int
+	pending     int
+}
+
+// newJSONStream creates a streaming JSON writer that puts the rows under
+// rowsKey and the trailer fields after the total
+func newJSONStream(w http.ResponseWriter, rowsKey string, trailer map[string]interface{}) *jsonStream {
+	flusher, _ := w.(http.Flusher)
+	return &jsonStream{
+		w:       w,
+		flusher: flusher,
+		rowsKey: rowsKey,
+		trailer: trailer,
+	}
+}
+
+// Start sends the response headers and opens the rows array; it is safe to
+// call more than once
+func (j *jsonStream) Start() {
+	if j.started {
+		return
+	}
+	j.started = true
+	j.w.Header().Set("Content-Type", "application/json")
+	j.w.Header().Set("Cache-Control", "no-cache")
+	j.w.WriteHeader(http.StatusOK)
+
+	j.write("{")
+	j.writeField("columns", j.columns)
+	j.write(",")
+	j.writeField("columnTypes", j.columnTypes)
+	j.write(",")
+	j.writeKey(j.rowsKey)
+	j.write("[")
+}
+
+// Columns keeps the result columns for the head of the document
+func (j *jsonStream) Columns(columns, columnTypes []string) error {
+	j.columns = columns
+	j.columnTypes = columnTypes
+	return nil
+}
+
+// WriteRow appends a single row to the rows array, flushing periodically
+func (j *jsonStream) WriteRow(row map[string]interface{}) error {
+	encoded, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	j.Start()
+	if j.total > 0 {
+		if _, err := j.w.Write([]byte(",")); err != nil {
+			return err
+		}
+	}
+	if _, err := j.w.Write(encoded); err != nil {
+		return err
+	}
+	j.total++
+	j.pending++
+	if j.pending >= ndjsonFlushEvery {
+		j.Flush()
+	}
+	return nil
+}
+
+// Started reports whether headers have already been sent
+func (j *jsonStream) Started() bool {
+	return j.started
+}
+
+// WriteError closes the document with the rows sent so far and an error field
+func (j *jsonStream) WriteError(code, message string) {
+	j.end(&httputil.ErrorBody{Code: code, Message: message})
+	j.Flush()
+}
+
+// Flush pushes buffered rows to the client
+func (j *jsonStream) Flush() {
+	j.pending = 0
+	if j.flusher != nil {
+		j.flusher.Flush()
+	}
+}
+
+// RowLimit adds the row limit the server applied, as autoLimit, and whether
+// it left rows out, as truncated, to the trailer fields
+func (j *jsonStream) RowLimit(limit int, truncated bool) {
+	if j.trailer == nil {
+		j.trailer = make(map[string]interface{})
+	}
+	j.trailer["autoLimit"] = limit
+	j.trailer["truncated"] = truncated
+}
+
+// Finish closes the document of a successful query
+func (j *jsonStream) Finish() {
+	j.Start()
+	j.end(nil)
+	j.Flush()
+}
+
+// end closes the rows array and writes the total, the trailer fields in key
+// order and errBody when it is set
+func (j *jsonStream) end(errBody *httputil.ErrorBody) {
+	j.write("],")
+	j.writeField("total", j.total)
+
+	keys := make([]string, 0, len(j.trailer))
+	for key := range j.trailer {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		j.write(",")
+		j.writeField(key, j.trailer[key])
+	}
+
+	if errBody != nil {
+		j.write(",")
+		j.writeField("error", errBody)
+	}
+	j.write("}")
+}
+
+// writeField writes "key":value; a value that cannot be encoded becomes null
+func (j *jsonStream) writeField(key string, value interface{}) {
+	j.writeKey(key)
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded = []byte("null")
+	}
+	j.w.Write(encoded)
+}
+
+// writeKey writes an object key with its colon
+func (j *jsonStream) writeKey(key string) {
+	encoded, _ := json.Marshal(key)
+	j.w.Write(encoded)
+	j.write(":")
+}
+
+// write writes a literal piece of the document; write errors surface on the
+// next WriteRow
+func (j *jsonStream) write(s string) {
+	j.w.Write([]byte(s))
+}
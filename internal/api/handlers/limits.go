@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/observio/backend/internal/api/httputil"
+	"github.com/observio/backend/internal/config"
+)
+
+// resolveLimit applies the query limits to the row limit of a request: 0
+// means query.defaultLimit, and a limit above query.maxLimit is lowered to it,
+// or rejected when query.rejectOverMaxLimit is set. It writes a 400 and
+// returns false for a rejected limit.
+func resolveLimit(w http.ResponseWriter, limits config.QueryConfig, requested int) (int, bool) {
+	limit, err := applyLimits(limits, requested)
+	if err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, err.Error())
+		return 0, false
+	}
+	return limit, true
+}
+
+// applyLimits is resolveLimit without the response, returning an error for a
+// rejected limit
+func applyLimits(limits config.QueryConfig, requested int) (int, error) {
+	switch {
+	case requested < 0:
+		return 0, fmt.Errorf("limit cannot be negative")
+	case requested == 0:
+		return limits.DefaultLimit, nil
+	case requested > limits.MaxLimit && limits.RejectOverMaxLimit:
+		return 0, fmt.Errorf("limit cannot exceed %d", limits.MaxLimit)
+	case requested > limits.MaxLimit:
+		return limits.MaxLimit, nil
+	}
+	return requested, nil
+}
+
+// limitParam reads ?limit and applies the query limits to it like resolveLimit
+func limitParam(w http.ResponseWriter, r *http.Request, limits config.QueryConfig) (int, bool) {
+	requested := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil {
+			httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "limit must be an integer")
+			return 0, false
+		}
+		requested = parsed
+	}
+	return resolveLimit(w, limits, requested)
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/observio/backend/internal/config"
+)
+
+func TestApplyLimits(t *testing.T) {
+	clamp := config.QueryConfig{DefaultLimit: 100, MaxLimit: 1000}
+	reject := config.QueryConfig{DefaultLimit: 100, MaxLimit: 1000, RejectOverMaxLimit: true}
+	tests := []struct {
+		limits    config.QueryConfig
+		requested int
+		want      int
+		wantErr   bool
+	}{
+		{clamp, 0, 100, false},
+		{clamp, 50, 50, false},
+		{clamp, 1000, 1000, false},
+		{clamp, 5000, 1000, false},
+		{clamp, -1, 0, true},
+		{reject, 0, 100, false},
+		{reject, 1000, 1000, false},
+		{reject, 1001, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := applyLimits(tt.limits, tt.requested)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("applyLimits(%+v, %d) = %d, %v, want %d, error %v", tt.limits, tt.requested, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -1,27 +1,32 @@
 package handlers
 
 import (
-	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/observio/backend/internal/api/httputil"
 	"github.com/observio/backend/internal/config"
 	"github.com/observio/backend/internal/database"
+	"github.com/observio/backend/internal/logging"
 )
 
 
 // LogsHandler serves log data
 type LogsHandler struct {
-	cfg *config.Config
-	logger *log.Logger
+	cfg *config.Live
+	logger logging.Logger
 	db *database.ClickHouseClient
 }
 
 
 // NewLogsHandler creates a new handler for logs
-func NewLogsHandler(cfg *config.Config, logger *log.Logger, db *database.ClickHouseClient) http.Handler {
+func NewLogsHandler(cfg *config.Live, logger logging.Logger, db *database.ClickHouseClient) http.Handler {
 	h := &LogsHandler{
 		cfg: cfg,
 		logger: logger,
@@ -30,44 +35,133 @@ func NewLogsHandler(cfg *config.Config, logger *log.Logger, db *database.ClickHo
 	r := chi.NewRouter()
 	r.Get("/", h.GetLogs)
 	r.Get("/top100", h.GetTop100Logs)
+	r.Get("/histogram", h.GetLogHistogram)
+	r.Get("/context", h.GetLogContext)
+	r.Get("/topn", h.GetTopN)
+	r.Get("/grouped", h.GetGroupedLogs)
+	r.Get("/stream", h.StreamLogs)
+	r.Post("/ingest", h.IngestLogs)
 	return r
 }
 
+// LogsResponse represents a page of log entries with pagination metadata
+type LogsResponse struct {
+	Logs    []database.LogEntry `json:"logs"`
+	Total   uint64              `json:"total"`
+	Limit   int                 `json:"limit"`
+	Offset  int                 `json:"offset"`
+	HasMore bool                `json:"hasMore"`
+	// NextCursor is passed as ?before to fetch the following page without OFFSET
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+const (
+	// logStreamPollInterval is how often StreamLogs checks ClickHouse for new entries
+	logStreamPollInterval = 2 * time.Second
+	// logStreamHeartbeatInterval is how often StreamLogs sends a keep-alive comment
+	logStreamHeartbeatInterval = 15 * time.Second
+	// logStreamBatchSize caps the entries read per poll; the rest follow on the next poll
+	logStreamBatchSize = 1000
+)
+
+const (
+	// defaultHistogramRange is the time range of a histogram when start is omitted
+	defaultHistogramRange = time.Hour
+	// defaultHistogramInterval is the bucket width in seconds when interval is omitted
+	defaultHistogramInterval = 60
+	// maxHistogramBuckets caps the number of buckets a single histogram may return
+	maxHistogramBuckets = 10000
+)
+
+// LogHistogramResponse is the log volume over time, one bucket per interval
+type LogHistogramResponse struct {
+	Interval int                           `json:"interval"`
+	Buckets  []database.LogHistogramBucket `json:"buckets"`
+}
+
+const (
+	// defaultLogContextLines is the number of entries before and after the
+	// anchor returned by GetLogContext when ?before or ?after is omitted
+	defaultLogContextLines = 10
+	// maxLogContextLines caps ?before and ?after
+	maxLogContextLines = 500
+)
+
+const (
+	// defaultTopN is the number of values returned by GetTopN when ?n is omitted
+	defaultTopN = 10
+	// maxTopN caps ?n
+	maxTopN = 1000
+)
+
+// defaultLogGroupOrder is the order of GetGroupedLogs when ?sort is omitted
+const defaultLogGroupOrder = "count"
+
+// LogGroupsResponse is the log entries collapsed by message
+type LogGroupsResponse struct {
+	Groups []database.LogGroup `json:"groups"`
+	Limit  int                 `json:"limit"`
+	Sort   string              `json:"sort"`
+}
+
+// maxIngestBodyBytes caps the size of a single ingestion request body
+const maxIngestBodyBytes = 32 << 20
+
+// IngestLogsRequest represents a batch of log entries pushed by a client
+type IngestLogsRequest struct {
+	Logs []database.LogEntry `json:"logs"`
+}
+
+// IngestLogsResponse reports how many entries of a batch were written
+type IngestLogsResponse struct {
+	Accepted int           `json:"accepted"`
+	Rejected int           `json:"rejected"`
+	Errors   []IngestError `json:"errors,omitempty"`
+}
+
+// IngestError describes why a single entry of a batch was rejected
+type IngestError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
 
 // GetTop100Logs returns the top 100 logs
 func (h *LogsHandler) GetTop100Logs(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	loc, ok := timeZoneParam(w, r)
+	if !ok {
+		return
+	}
 	
 	logs, err := h.db.GetTop100Logs(ctx)
 	if err != nil {
-		h.logger.Printf("Error fetching logs from ClickHouse: %v", err)
-		respondError(w, http.StatusInternalServerError, "Could not fetch logs")
+		h.logger.Error("error fetching logs from ClickHouse", "error", err)
+		respondQueryError(w, err, "Could not fetch logs")
 		return
 	}
+	logsInLocation(logs, loc)
 
-	respondJSON(w, http.StatusOK, logs)
+	httputil.RespondJSON(w, http.StatusOK, logs)
 }
 
 // GetLogs reads logs and returns them as JSON with filtering
 func (h *LogsHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	
-	// Optional query params: level, component, pattern, limit, offset
+	// Optional query params: level, minLevel, component, pattern, traceId, start, end, limit, offset, before
 	level := r.URL.Query().Get("level")
 	component := r.URL.Query().Get("component")
 	pattern := r.URL.Query().Get("pattern")
-	limitStr := r.URL.Query().Get("limit")
+	traceID := r.URL.Query().Get("traceId")
 	offsetStr := r.URL.Query().Get("offset")
 
-	var limit int = 100
+	limit, ok := limitParam(w, r, h.cfg.Get().Query)
+	if !ok {
+		return
+	}
 	var offset int = 0
 	var err error
-	if limitStr != "" {
-		limit, err = strconv.Atoi(limitStr)
-		if err != nil || limit <= 0 {
-			limit = 100
-		}
-	}
 	if offsetStr != "" {
 		offset, err = strconv.Atoi(offsetStr)
 		if err != nil || offset < 0 {
@@ -75,30 +169,580 @@ func (h *LogsHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	logs, err := h.db.GetLogs(ctx, limit, offset, level, component, pattern)
+	loc, ok := timeZoneParam(w, r)
+	if !ok {
+		return
+	}
+	start, err := parseTimeParamIn(r.URL.Query().Get("start"), loc)
+	if err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "start must be an RFC3339 timestamp, a date and time in tz or Unix epoch milliseconds")
+		return
+	}
+	end, err := parseTimeParamIn(r.URL.Query().Get("end"), loc)
+	if err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "end must be an RFC3339 timestamp, a date and time in tz or Unix epoch milliseconds")
+		return
+	}
+	if start != nil && end != nil && start.After(*end) {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "start must not be after end")
+		return
+	}
+
+	minSeverity, ok := minLevelParam(w, r)
+	if !ok {
+		return
+	}
+
+	var before *database.LogCursor
+	if beforeStr := r.URL.Query().Get("before"); beforeStr != "" {
+		if offset > 0 {
+			httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "before and offset cannot be combined")
+			return
+		}
+		cursor, err := database.ParseLogCursor(beforeStr)
+		if err != nil {
+			httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "before must be a nextCursor returned by a previous request")
+			return
+		}
+		before = &cursor
+	}
+
+	filter := database.LogFilter{
+		Level:       level,
+		MinSeverity: minSeverity,
+		Component:   component,
+		Pattern:     pattern,
+		TraceId:     traceID,
+		Start:       start,
+		End:         end,
+		Before:      before,
+		Limit:       limit,
+		Offset:      offset,
+	}
+
+	logs, err := h.db.GetLogs(ctx, filter)
+	if err != nil {
+		h.logger.Error("error fetching logs from ClickHouse", "error", err)
+		respondQueryError(w, err, "Could not fetch logs")
+		return
+	}
+	if logs == nil {
+		logs = []database.LogEntry{}
+	}
+	logsInLocation(logs, loc)
+
+	total, err := h.db.CountLogs(ctx, filter)
+	if err != nil {
+		h.logger.Error("error counting logs in ClickHouse", "error", err)
+		respondQueryError(w, err, "Could not fetch logs")
+		return
+	}
+
+	response := LogsResponse{
+		Logs:    logs,
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+		HasMore: uint64(offset+len(logs)) < total,
+	}
+	if before != nil {
+		// Total ignores the cursor, so a full page is the only sign of more rows
+		response.HasMore = len(logs) == limit
+	}
+	if response.HasMore && len(logs) > 0 {
+		response.NextCursor = logs[len(logs)-1].Cursor().String()
+	}
+
+	httputil.RespondJSON(w, http.StatusOK, response)
+}
+
+
+// GetLogHistogram returns the number of log entries per time bucket, accepting
+// the level, component, pattern and traceId filters of GetLogs. interval is the
+// bucket width in seconds; start defaults to an hour before end, end to now.
+func (h *LogsHandler) GetLogHistogram(w http.ResponseWriter, r *http.Request) {
+	interval := defaultHistogramInterval
+	if intervalStr := r.URL.Query().Get("interval"); intervalStr != "" {
+		parsed, err := strconv.Atoi(intervalStr)
+		if err != nil || parsed < 1 {
+			httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "interval must be a whole number of seconds, at least 1")
+			return
+		}
+		interval = parsed
+	}
+
+	loc, ok := timeZoneParam(w, r)
+	if !ok {
+		return
+	}
+	start, err := parseTimeParamIn(r.URL.Query().Get("start"), loc)
+	if err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "start must be an RFC3339 timestamp, a date and time in tz or Unix epoch milliseconds")
+		return
+	}
+	end, err := parseTimeParamIn(r.URL.Query().Get("end"), loc)
+	if err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "end must be an RFC3339 timestamp, a date and time in tz or Unix epoch milliseconds")
+		return
+	}
+	if end == nil {
+		now := time.Now().UTC()
+		end = &now
+	}
+	if start == nil {
+		from := end.Add(-defaultHistogramRange)
+		start = &from
+	}
+	if start.After(*end) {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "start must not be after end")
+		return
+	}
+	if end.Sub(*start)/(time.Duration(interval)*time.Second) >= maxHistogramBuckets {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter,
+			fmt.Sprintf("Range would produce more than %d buckets, use a larger interval", maxHistogramBuckets))
+		return
+	}
+
+	minSeverity, ok := minLevelParam(w, r)
+	if !ok {
+		return
+	}
+
+	filter := database.LogFilter{
+		Level:       r.URL.Query().Get("level"),
+		MinSeverity: minSeverity,
+		Component:   r.URL.Query().Get("component"),
+		Pattern:     r.URL.Query().Get("pattern"),
+		TraceId:     r.URL.Query().Get("traceId"),
+	}
+
+	buckets, err := h.db.GetLogHistogram(r.Context(), *start, *end, time.Duration(interval)*time.Second, filter)
 	if err != nil {
-		h.logger.Printf("Error fetching logs from ClickHouse: %v", err)
-		respondError(w, http.StatusInternalServerError, "Could not fetch logs")
+		h.logger.Error("error fetching log histogram from ClickHouse", "error", err)
+		respondQueryError(w, err, "Could not fetch log histogram")
 		return
 	}
+	for i := range buckets {
+		buckets[i].Bucket = buckets[i].Bucket.In(loc)
+	}
 
-	respondJSON(w, http.StatusOK, logs)
+	httputil.RespondJSON(w, http.StatusOK, LogHistogramResponse{
+		Interval: interval,
+		Buckets:  buckets,
+	})
 }
 
+// GetTopN returns the most frequent values of ?field among the log entries
+// matching the level, minLevel, component, pattern, traceId, start and end
+// filters of GetLogs, most frequent first
+func (h *LogsHandler) GetTopN(w http.ResponseWriter, r *http.Request) {
+	field := r.URL.Query().Get("field")
+	if !slices.Contains(database.LogTopNFields(), field) {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter,
+			fmt.Sprintf("field must be one of %s", strings.Join(database.LogTopNFields(), ", ")))
+		return
+	}
+
+	n := defaultTopN
+	if nStr := r.URL.Query().Get("n"); nStr != "" {
+		parsed, err := strconv.Atoi(nStr)
+		if err != nil || parsed < 1 || parsed > maxTopN {
+			httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, fmt.Sprintf("n must be between 1 and %d", maxTopN))
+			return
+		}
+		n = parsed
+	}
 
-// Helper functions for HTTP responses - these should be moved to a common utility package later
-func respondJSON(w http.ResponseWriter, status int, payload interface{}) {
-	response, err := json.Marshal(payload)
+	loc, ok := timeZoneParam(w, r)
+	if !ok {
+		return
+	}
+	start, err := parseTimeParamIn(r.URL.Query().Get("start"), loc)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "start must be an RFC3339 timestamp, a date and time in tz or Unix epoch milliseconds")
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	w.Write(response)
+	end, err := parseTimeParamIn(r.URL.Query().Get("end"), loc)
+	if err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "end must be an RFC3339 timestamp, a date and time in tz or Unix epoch milliseconds")
+		return
+	}
+	if start != nil && end != nil && start.After(*end) {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "start must not be after end")
+		return
+	}
+
+	minSeverity, ok := minLevelParam(w, r)
+	if !ok {
+		return
+	}
+
+	filter := database.LogFilter{
+		Level:       r.URL.Query().Get("level"),
+		MinSeverity: minSeverity,
+		Component:   r.URL.Query().Get("component"),
+		Pattern:     r.URL.Query().Get("pattern"),
+		TraceId:     r.URL.Query().Get("traceId"),
+		Start:       start,
+		End:         end,
+	}
+
+	entries, err := h.db.GetTopN(r.Context(), field, n, filter)
+	if err != nil {
+		h.logger.Error("error fetching top log values from ClickHouse", "field", field, "error", err)
+		respondQueryError(w, err, "Could not fetch top values")
+		return
+	}
+
+	httputil.RespondJSON(w, http.StatusOK, entries)
 }
 
-func respondError(w http.ResponseWriter, code int, message string) {
-	respondJSON(w, code, map[string]string{"error": message})
+// GetGroupedLogs collapses the log entries matching the level, minLevel,
+// component, pattern, traceId, start and end filters of GetLogs into one group
+// per message, with its count and first and last occurrence. ?sort orders the
+// groups by count (default), lastSeen or firstSeen, descending; ?limit caps
+// the number of groups like the limit of GetLogs.
+func (h *LogsHandler) GetGroupedLogs(w http.ResponseWriter, r *http.Request) {
+	order := r.URL.Query().Get("sort")
+	if order == "" {
+		order = defaultLogGroupOrder
+	}
+	if !slices.Contains(database.LogGroupOrders(), order) {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter,
+			fmt.Sprintf("sort must be one of %s", strings.Join(database.LogGroupOrders(), ", ")))
+		return
+	}
+
+	limit, ok := limitParam(w, r, h.cfg.Get().Query)
+	if !ok {
+		return
+	}
+
+	loc, ok := timeZoneParam(w, r)
+	if !ok {
+		return
+	}
+	start, err := parseTimeParamIn(r.URL.Query().Get("start"), loc)
+	if err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "start must be an RFC3339 timestamp, a date and time in tz or Unix epoch milliseconds")
+		return
+	}
+	end, err := parseTimeParamIn(r.URL.Query().Get("end"), loc)
+	if err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "end must be an RFC3339 timestamp, a date and time in tz or Unix epoch milliseconds")
+		return
+	}
+	if start != nil && end != nil && start.After(*end) {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "start must not be after end")
+		return
+	}
+
+	minSeverity, ok := minLevelParam(w, r)
+	if !ok {
+		return
+	}
+
+	filter := database.LogFilter{
+		Level:       r.URL.Query().Get("level"),
+		MinSeverity: minSeverity,
+		Component:   r.URL.Query().Get("component"),
+		Pattern:     r.URL.Query().Get("pattern"),
+		TraceId:     r.URL.Query().Get("traceId"),
+		Start:       start,
+		End:         end,
+		Limit:       limit,
+	}
+
+	groups, err := h.db.GetGroupedLogs(r.Context(), filter, order)
+	if err != nil {
+		h.logger.Error("error fetching grouped logs from ClickHouse", "sort", order, "error", err)
+		respondQueryError(w, err, "Could not fetch grouped logs")
+		return
+	}
+	for i := range groups {
+		groups[i] = groups[i].InLocation(loc)
+	}
+
+	httputil.RespondJSON(w, http.StatusOK, LogGroupsResponse{
+		Groups: groups,
+		Limit:  limit,
+		Sort:   order,
+	})
+}
+
+// StreamLogs follows new log entries as Server-Sent Events until the client disconnects.
+// Each entry is sent as a data event; it accepts the level, minLevel, component,
+// pattern and traceId filters of GetLogs.
+func (h *LogsHandler) StreamLogs(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	minSeverity, ok := minLevelParam(w, r)
+	if !ok {
+		return
+	}
+	loc, ok := timeZoneParam(w, r)
+	if !ok {
+		return
+	}
+	filter := database.LogFilter{
+		Level:       r.URL.Query().Get("level"),
+		MinSeverity: minSeverity,
+		Component:   r.URL.Query().Get("component"),
+		Pattern:     r.URL.Query().Get("pattern"),
+		TraceId:     r.URL.Query().Get("traceId"),
+		Limit:       logStreamBatchSize,
+	}
+
+	stream, ok := newSSEWriter(w)
+	if !ok {
+		httputil.RespondError(w, http.StatusInternalServerError, httputil.CodeInternal, "Streaming is not supported by this connection")
+		return
+	}
+
+	h.logger.Info("client started tailing logs", "level", filter.Level, "component", filter.Component, "pattern", filter.Pattern)
+
+	lastSeen := database.LogCursor{Timestamp: time.Now().UTC()}
+	poll := time.NewTicker(logStreamPollInterval)
+	defer poll.Stop()
+	heartbeat := time.NewTicker(logStreamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			h.logger.Info("client stopped tailing logs")
+			return
+		case <-heartbeat.C:
+			if err := stream.Comment("heartbeat"); err != nil {
+				return
+			}
+		case <-poll.C:
+			logs, latest, err := h.db.TailLogs(ctx, filter, lastSeen)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				h.logger.Error("error tailing logs from ClickHouse", "error", err)
+				if err := stream.Event("error", httputil.ErrorResponse{Error: httputil.ErrorBody{Code: httputil.CodeQueryFailed, Message: "Could not fetch new logs"}}); err != nil {
+					return
+				}
+				continue
+			}
+			for _, entry := range logs {
+				if err := stream.Event("", entry.InLocation(loc)); err != nil {
+					return
+				}
+			}
+			lastSeen = latest
+		}
+	}
+}
+
+// GetLogContext returns the entries logged just before and after the one
+// named by ?lineId by the same component, oldest first, like grep -C
+func (h *LogsHandler) GetLogContext(w http.ResponseWriter, r *http.Request) {
+	lineID := r.URL.Query().Get("lineId")
+	if lineID == "" {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "lineId is required")
+		return
+	}
+	anchor, err := database.ParseLogCursor(lineID)
+	if err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "lineId must be the lineId of a log entry")
+		return
+	}
+
+	before, ok := contextLinesParam(w, r, "before")
+	if !ok {
+		return
+	}
+	after, ok := contextLinesParam(w, r, "after")
+	if !ok {
+		return
+	}
+	loc, ok := timeZoneParam(w, r)
+	if !ok {
+		return
+	}
+
+	logContext, err := h.db.GetLogContext(r.Context(), anchor, before, after)
+	if errors.Is(err, database.ErrLogNotFound) {
+		httputil.RespondError(w, http.StatusNotFound, httputil.CodeNotFound, "Log entry not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("error fetching log context from ClickHouse", "error", err)
+		respondQueryError(w, err, "Could not fetch log context")
+		return
+	}
+	logsInLocation(logContext.Logs, loc)
+
+	httputil.RespondJSON(w, http.StatusOK, logContext)
+}
+
+// contextLinesParam reads the ?before or ?after line count of GetLogContext,
+// writing a 400 and returning false when it is not between 0 and maxLogContextLines
+func contextLinesParam(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultLogContextLines, true
+	}
+	lines, err := strconv.Atoi(value)
+	if err != nil || lines < 0 || lines > maxLogContextLines {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter,
+			fmt.Sprintf("%s must be an integer between 0 and %d", name, maxLogContextLines))
+		return 0, false
+	}
+	return lines, true
+}
+
+// minLevelParam reads the optional minLevel query param as an OTel severity
+// number, writing a 400 and returning false when it is not a known level
+func minLevelParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	minLevel := r.URL.Query().Get("minLevel")
+	if minLevel == "" {
+		return 0, true
+	}
+	severity, ok := database.SeverityNumber(minLevel)
+	if !ok {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter,
+			fmt.Sprintf("minLevel %q is not a known level or OTel severity number (1-24)", minLevel))
+		return 0, false
+	}
+	return severity, true
+}
+
+// parseTimeParam parses an optional RFC3339 timestamp or Unix epoch milliseconds value
+func parseTimeParam(value string) (*time.Time, error) {
+	return parseTimeParamIn(value, time.UTC)
+}
+
+// localTimeLayouts are the layouts of timestamps without an offset, which
+// parseTimeParamIn reads in the given location
+var localTimeLayouts = []string{
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// parseTimeParamIn is parseTimeParam reading timestamps without an offset,
+// such as 2024-05-01T09:00:00 or 2024-05-01, in loc
+func parseTimeParamIn(value string, loc *time.Location) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+		t := time.UnixMilli(millis).UTC()
+		return &t, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return &t, nil
+	}
+	for _, layout := range localTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid timestamp %q", value)
+}
+
+// timeZoneParam reads the ?tz of the logs endpoints, an IANA time zone such as
+// Europe/Paris, defaulting to UTC. It writes a 400 and returns false for an
+// unknown zone.
+func timeZoneParam(w http.ResponseWriter, r *http.Request) (*time.Location, bool) {
+	name := r.URL.Query().Get("tz")
+	if name == "" {
+		return time.UTC, true
+	}
+	// "Local" would depend on the server's own zone
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "Local" {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter,
+			fmt.Sprintf("tz must be an IANA time zone such as UTC or Europe/Paris, got %q", name))
+		return nil, false
+	}
+	return loc, true
+}
+
+// logsInLocation shows the timestamps of logs in loc
+func logsInLocation(logs []database.LogEntry, loc *time.Location) {
+	for i := range logs {
+		logs[i] = logs[i].InLocation(loc)
+	}
+}
+
+
+// IngestLogs validates a batch of log entries and inserts the valid ones into otel_logs
+func (h *LogsHandler) IngestLogs(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req IngestLogsRequest
+	if !httputil.DecodeJSON(w, r, &req, maxIngestBodyBytes) {
+		return
+	}
+
+	if len(req.Logs) == 0 {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, "At least one log entry is required")
+		return
+	}
+
+	maxBatch := h.cfg.Get().ClickHouse.MaxIngestBatchSize
+	if maxBatch > 0 && len(req.Logs) > maxBatch {
+		httputil.RespondError(w, http.StatusRequestEntityTooLarge, httputil.CodePayloadTooLarge,
+			fmt.Sprintf("Batch of %d entries exceeds the maximum of %d", len(req.Logs), maxBatch))
+		return
+	}
+
+	response := IngestLogsResponse{}
+	records := make([]database.LogRecord, 0, len(req.Logs))
+	for i, entry := range req.Logs {
+		record, err := logRecordFromEntry(entry)
+		if err != nil {
+			response.Errors = append(response.Errors, IngestError{Index: i, Error: err.Error()})
+			continue
+		}
+		records = append(records, record)
+	}
+
+	if err := h.db.InsertLogs(ctx, records); err != nil {
+		h.logger.Error("error inserting logs into ClickHouse", "error", err)
+		respondQueryError(w, err, "Could not ingest logs")
+		return
+	}
+
+	response.Accepted = len(records)
+	response.Rejected = len(response.Errors)
+
+	h.logger.Info("ingested log entries", "accepted", response.Accepted, "rejected", response.Rejected)
+
+	httputil.RespondJSON(w, http.StatusOK, response)
+}
+
+// logRecordFromEntry validates an ingested entry and converts it to an insertable record
+func logRecordFromEntry(entry database.LogEntry) (database.LogRecord, error) {
+	body := entry.Content
+	if body == "" {
+		body = entry.RawMessage
+	}
+	if strings.TrimSpace(body) == "" {
+		return database.LogRecord{}, fmt.Errorf("content is required")
+	}
+
+	timestamp := time.Now().UTC()
+	if entry.Timestamp != "" {
+		parsed, err := time.Parse(time.RFC3339Nano, entry.Timestamp)
+		if err != nil {
+			return database.LogRecord{}, fmt.Errorf("invalid timestamp %q: must be RFC3339", entry.Timestamp)
+		}
+		timestamp = parsed.UTC()
+	}
+
+	return database.LogRecord{
+		Timestamp: timestamp,
+		Level:     entry.Level,
+		Component: entry.Component,
+		PID:       entry.PID,
+		Body:      body,
+		TraceId:   entry.TraceId,
+		SpanId:    entry.SpanId,
+	}, nil
 }
@@ -1,19 +1,25 @@
 package handlers
 
 import (
-	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/observio/backend/internal/api/httputil"
 	"github.com/observio/backend/internal/config"
+	"github.com/observio/backend/internal/logging"
+	"github.com/observio/backend/internal/prometheus"
 )
 
 // MetricsHandler handles metrics-related API endpoints
 type MetricsHandler struct {
-	cfg    *config.Config
-	logger *log.Logger
+	cfg     *config.Live
+	logger  logging.Logger
+	sources *DataSources
 }
 
 // MetricResponse represents a metric data point or series
@@ -33,85 +39,182 @@ type MetricQuery struct {
 	DataSource string    `json:"dataSource"`
 }
 
-// NewMetricsHandler creates a new metrics handler
-func NewMetricsHandler(cfg *config.Config, logger *log.Logger) http.Handler {
+// NewMetricsHandler creates a new metrics handler querying the Prometheus
+// data sources of sources
+func NewMetricsHandler(cfg *config.Live, logger logging.Logger, sources *DataSources) http.Handler {
 	h := &MetricsHandler{
-		cfg:    cfg,
-		logger: logger,
+		cfg:     cfg,
+		logger:  logger,
+		sources: sources,
 	}
 
 	r := chi.NewRouter()
 	r.Get("/", h.GetMetrics)
 	r.Post("/query", h.QueryMetrics)
-	r.Get("/{name}", h.GetMetricByName)
+	// Lookups by name live under /series so that a metric name can never
+	// collide with another route such as /query
+	r.Get("/series/{name}", h.GetMetricByName)
 	
 	return r
 }
 
+// availableMetrics are the metrics listed by GetMetrics and served by
+// GetMetricByName. In a real implementation, these would be fetched from a
+// database or time series database.
+var availableMetrics = []string{
+	"cpu_usage",
+	"memory_usage",
+	"request_duration",
+	"error_rate",
+	"throughput",
+}
+
 // GetMetrics returns a list of available metrics
 func (h *MetricsHandler) GetMetrics(w http.ResponseWriter, r *http.Request) {
-	// In a real implementation, this would fetch metrics from a database or time series database
-	metrics := []string{
-		"cpu_usage",
-		"memory_usage",
-		"request_duration",
-		"error_rate",
-		"throughput",
-	}
-
-	respondJSON(w, http.StatusOK, metrics)
+	httputil.RespondJSON(w, http.StatusOK, availableMetrics)
 }
 
-// QueryMetrics handles complex metric queries
+// Defaults applied to range queries that leave these fields out
+const (
+	defaultMetricRange = time.Hour
+	defaultMetricStep  = "60s"
+)
+
+// prometheusQueryTimeout bounds a single proxied range query
+const prometheusQueryTimeout = 30 * time.Second
+
+// QueryMetrics runs a PromQL range query against a Prometheus data source and
+// returns every sample of the resulting series as a MetricResponse
 func (h *MetricsHandler) QueryMetrics(w http.ResponseWriter, r *http.Request) {
 	var query MetricQuery
-	if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request payload")
+	if !httputil.DecodeJSON(w, r, &query, h.cfg.Get().Server.MaxRequestBodyBytes) {
 		return
 	}
 
-	// In a real implementation, this would query a time series database like Prometheus
-	// For now, we'll return sample data
-	now := time.Now()
-	metrics := []MetricResponse{
-		{
-			Name:      "cpu_usage",
-			Labels:    map[string]string{"host": "server1", "env": "prod"},
-			Value:     42.5,
-			Timestamp: now.Add(-5 * time.Minute),
-		},
-		{
-			Name:      "cpu_usage",
-			Labels:    map[string]string{"host": "server1", "env": "prod"},
-			Value:     45.2,
-			Timestamp: now.Add(-4 * time.Minute),
-		},
-		{
-			Name:      "cpu_usage",
-			Labels:    map[string]string{"host": "server1", "env": "prod"},
-			Value:     47.8,
-			Timestamp: now.Add(-3 * time.Minute),
-		},
-		{
-			Name:      "cpu_usage",
-			Labels:    map[string]string{"host": "server1", "env": "prod"},
-			Value:     44.3,
-			Timestamp: now.Add(-2 * time.Minute),
-		},
-		{
-			Name:      "cpu_usage",
-			Labels:    map[string]string{"host": "server1", "env": "prod"},
-			Value:     43.1,
-			Timestamp: now.Add(-1 * time.Minute),
-		},
-	}
-
-	respondJSON(w, http.StatusOK, metrics)
+	if strings.TrimSpace(query.Query) == "" {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidQuery, "query is required")
+		return
+	}
+	if query.End.IsZero() {
+		query.End = time.Now().UTC()
+	}
+	if query.Start.IsZero() {
+		query.Start = query.End.Add(-defaultMetricRange)
+	}
+	if query.Step == "" {
+		query.Step = defaultMetricStep
+	}
+	step, err := prometheus.ParseStep(query.Step)
+	if err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, err.Error())
+		return
+	}
+	if !query.Start.Before(query.End) {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest,
+			fmt.Sprintf("start (%s) must be before end (%s)", query.Start.Format(time.RFC3339), query.End.Format(time.RFC3339)))
+		return
+	}
+	if points := prometheus.MaxRangePoints(query.Start, query.End, step); points > prometheus.MaxPoints {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest,
+			fmt.Sprintf("range of %s with step %s returns %d points per series, more than the maximum of %d; use a step of at least %s",
+				query.End.Sub(query.Start), step, points, prometheus.MaxPoints, minMetricStep(query.End.Sub(query.Start))))
+		return
+	}
+
+	ds, ok := prometheusDataSource(h.sources.List(), query.DataSource)
+	if !ok {
+		if query.DataSource == "" {
+			httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, "No Prometheus data source is configured")
+		} else {
+			httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest,
+				fmt.Sprintf("Data source %q is not a Prometheus data source", query.DataSource))
+		}
+		return
+	}
+
+	username, _ := ds.Settings["username"].(string)
+	password, _ := ds.Settings["password"].(string)
+	client := prometheus.NewClient(ds.URL, username, password, prometheusQueryTimeout)
+
+	series, err := client.QueryRange(r.Context(), query.Query, query.Start, query.End, prometheus.FormatStep(step))
+	var apiErr *prometheus.APIError
+	if errors.As(err, &apiErr) && apiErr.BadQuery() {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidQuery, apiErr.Message)
+		return
+	}
+	if err != nil {
+		h.logger.Error("error querying Prometheus data source", "dataSource", ds.ID, "error", err)
+		httputil.RespondError(w, http.StatusBadGateway, httputil.CodeUpstreamError, "Prometheus query failed: "+err.Error())
+		return
+	}
+
+	httputil.RespondJSON(w, http.StatusOK, metricResponses(series))
 }
 
-// GetMetricByName returns data for a specific metric
+// minMetricStep returns the smallest whole-second step keeping a range query
+// over span within prometheus.MaxPoints points per series
+func minMetricStep(span time.Duration) time.Duration {
+	return (span / (prometheus.MaxPoints - 1)).Truncate(time.Second) + time.Second
+}
+
+// prometheusDataSource resolves ref by ID or name; an empty ref picks the
+// default Prometheus data source, falling back to the first one configured
+func prometheusDataSource(dataSources []DataSource, ref string) (DataSource, bool) {
+	if ref != "" {
+		ds, ok := findDataSourceIn(dataSources, ref)
+		return ds, ok && ds.Type == "prometheus"
+	}
+
+	var fallback *DataSource
+	for i, ds := range dataSources {
+		if ds.Type != "prometheus" {
+			continue
+		}
+		if ds.IsDefault {
+			return ds, true
+		}
+		if fallback == nil {
+			fallback = &dataSources[i]
+		}
+	}
+	if fallback == nil {
+		return DataSource{}, false
+	}
+	return *fallback, true
+}
+
+// metricResponses flattens a matrix result into one MetricResponse per sample;
+// the __name__ label becomes the metric name
+func metricResponses(series []prometheus.Series) []MetricResponse {
+	metrics := []MetricResponse{}
+	for _, s := range series {
+		name := s.Metric["__name__"]
+		labels := make(map[string]string, len(s.Metric))
+		for k, v := range s.Metric {
+			if k != "__name__" {
+				labels[k] = v
+			}
+		}
+		for _, sample := range s.Samples {
+			metrics = append(metrics, MetricResponse{
+				Name:      name,
+				Labels:    labels,
+				Value:     sample.Value,
+				Timestamp: sample.Timestamp,
+			})
+		}
+	}
+	return metrics
+}
+
+// GetMetricByName returns data for a specific metric, or 404 for a metric
+// that is not one of availableMetrics
 func (h *MetricsHandler) GetMetricByName(w http.ResponseWriter, r *http.Request) {
 	name := chi.URLParam(r, "name")
+	if !slices.Contains(availableMetrics, name) {
+		httputil.RespondError(w, http.StatusNotFound, httputil.CodeNotFound, fmt.Sprintf("Metric %s not found", name))
+		return
+	}
 	
 	// In a real implementation, this would fetch the specific metric from a database
 	now := time.Now()
@@ -122,5 +225,5 @@ func (h *MetricsHandler) GetMetricByName(w http.ResponseWriter, r *http.Request)
 		Timestamp: now,
 	}
 
-	respondJSON(w, http.StatusOK, metric)
+	httputil.RespondJSON(w, http.StatusOK, metric)
 }
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/observio/backend/internal/api/httputil"
+)
+
+// ndjsonContentType is the media type for newline-delimited JSON responses
+const ndjsonContentType = "application/x-ndjson"
+
+// ndjsonFlushEvery controls how many rows are buffered between flushes
+const ndjsonFlushEvery = 100
+
+// resultStream writes query results incrementally; it is implemented by the
+// JSON, NDJSON, CSV and Server-Sent Events writers
+type resultStream interface {
+	Start()
+	Columns(columns, columnTypes []string) error
+	WriteRow(row map[string]interface{}) error
+	Started() bool
+	WriteError(code, message string)
+	Flush()
+	Finish()
+}
+
+// limitedStream is a resultStream that reports in its body that the server
+// capped the result at limit rows, and whether rows were left out
+type limitedStream interface {
+	resultStream
+	RowLimit(limit int, truncated bool)
+}
+
+// newResultStream returns the streaming writer the client asked for, if any
+func newResultStream(w http.ResponseWriter, r *http.Request, filename string) (resultStream, bool) {
+	switch {
+	case wantsCSV(r):
+		return newCSVWriter(w, filename), true
+	case wantsNDJSON(r):
+		return newNDJSONWriter(w), true
+	case wantsSSE(r):
+		if stream, ok := newSSEResultStream(w); ok {
+			return stream, true
+		}
+		return nil, false
+	default:
+		return nil, false
+	}
+}
+
+// wantsNDJSON reports whether the client asked for a newline-delimited JSON stream
+func wantsNDJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), ndjsonContentType)
+}
+
+// ndjsonWriter streams one JSON object per line, writing headers lazily so that
+// errors raised before the first row can still be reported with a normal status code
+type ndjsonWriter struct {
+	w       http.ResponseWriter
+	enc     *json.Encoder
+	flusher http.Flusher
+	started bool
+	pending int
+}
+
+// newNDJSONWriter creates a streaming writer on top of the response
+func newNDJSONWriter(w http.ResponseWriter) *ndjsonWriter {
+	flusher, _ := w.(http.Flusher)
+	return &ndjsonWriter{
+		w:       w,
+		enc:     json.NewEncoder(w),
+		flusher: flusher,
+	}
+}
+
+// Start sends the response headers; it is safe to call more than once
+func (n *ndjsonWriter) Start() {
+	if n.started {
+		return
+	}
+	n.started = true
+	n.w.Header().Set("Content-Type", ndjsonContentType)
+	n.w.Header().Set("Cache-Control", "no-cache")
+	n.w.WriteHeader(http.StatusOK)
+}
+
+// Columns is a no-op; every NDJSON line carries its own keys
+func (n *ndjsonWriter) Columns(columns, columnTypes []string) error {
+	return nil
+}
+
+// WriteRow encodes a single row as one line, flushing periodically
+func (n *ndjsonWriter) WriteRow(row map[string]interface{}) error {
+	n.Start()
+	if err := n.enc.Encode(row); err != nil {
+		return err
+	}
+	n.pending++
+	if n.pending >= ndjsonFlushEvery {
+		n.Flush()
+	}
+	return nil
+}
+
+// Started reports whether headers have already been sent
+func (n *ndjsonWriter) Started() bool {
+	return n.started
+}
+
+// WriteError reports a failure that happened after the stream started as a final line
+func (n *ndjsonWriter) WriteError(code, message string) {
+	n.enc.Encode(httputil.ErrorResponse{Error: httputil.ErrorBody{Code: code, Message: message}})
+	n.Flush()
+}
+
+// Flush pushes buffered rows to the client
+func (n *ndjsonWriter) Flush() {
+	n.pending = 0
+	if n.flusher != nil {
+		n.flusher.Flush()
+	}
+}
+
+// Finish ends a successful stream, sending the headers if no row was written
+func (n *ndjsonWriter) Finish() {
+	n.Start()
+	n.Flush()
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJSONStreamReportsRowLimit(t *testing.T) {
+	rec := httptest.NewRecorder()
+	stream := newJSONStream(rec, "rows", map[string]interface{}{"query": "SELECT 1"})
+	stream.Columns([]string{"n"}, []string{"UInt8"})
+	stream.WriteRow(map[string]interface{}{"n": 1})
+	stream.RowLimit(1, true)
+	stream.Finish()
+
+	var body struct {
+		Total     int    `json:"total"`
+		Query     string `json:"query"`
+		AutoLimit int    `json:"autoLimit"`
+		Truncated bool   `json:"truncated"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body, err)
+	}
+	if body.Total != 1 || body.Query != "SELECT 1" || body.AutoLimit != 1 || !body.Truncated {
+		t.Errorf("body = %+v, want the trailer fields with autoLimit 1 and truncated", body)
+	}
+
+	// Without a trailer map of its own, the fields are still added
+	rec = httptest.NewRecorder()
+	stream = newJSONStream(rec, "rows", nil)
+	stream.RowLimit(1000, false)
+	stream.Finish()
+	if !strings.Contains(rec.Body.String(), `"autoLimit":1000,"truncated":false`) {
+		t.Errorf("body = %s, want autoLimit and truncated", rec.Body)
+	}
+}
+
+func TestSSEStreamReportsRowLimitInDoneEvent(t *testing.T) {
+	rec := httptest.NewRecorder()
+	stream, ok := newSSEResultStream(rec)
+	if !ok {
+		t.Fatal("newSSEResultStream refused a flushable recorder")
+	}
+	stream.WriteRow(map[string]interface{}{"n": 1})
+	stream.RowLimit(1, true)
+	stream.Finish()
+
+	done := doneEvent(t, rec.Body.String())
+	if done["total"] != float64(1) || done["autoLimit"] != float64(1) || done["truncated"] != true {
+		t.Errorf("done = %v, want total 1, autoLimit 1 and truncated", done)
+	}
+
+	// Without a row limit the done event is unchanged
+	rec = httptest.NewRecorder()
+	stream, _ = newSSEResultStream(rec)
+	stream.Finish()
+	done = doneEvent(t, rec.Body.String())
+	if _, ok := done["autoLimit"]; ok {
+		t.Errorf("done = %v, want no autoLimit without a row limit", done)
+	}
+	if _, ok := done["truncated"]; ok {
+		t.Errorf("done = %v, want no truncated without a row limit", done)
+	}
+}
+
+// doneEvent returns the payload of the done event of an event stream
+func doneEvent(t *testing.T, body string) map[string]interface{} {
+	t.Helper()
+	_, after, ok := strings.Cut(body, "event: done\ndata: ")
+	if !ok {
+		t.Fatalf("no done event in %q", body)
+	}
+	data, _, _ := strings.Cut(after, "\n")
+	var payload map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &payload); err != nil {
+		t.Fatalf("decoding done event %s: %v", data, err)
+	}
+	return payload
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/observio/backend/internal/api/httputil"
+	"github.com/observio/backend/internal/database"
+)
+
+// SavedQueryStore persists saved explore queries; *database.ClickHouseClient implements it
+type SavedQueryStore interface {
+	ListSavedQueries(ctx context.Context) ([]database.SavedQuery, error)
+	GetSavedQuery(ctx context.Context, id string) (*database.SavedQuery, error)
+	SaveSavedQuery(ctx context.Context, saved database.SavedQuery) error
+	DeleteSavedQuery(ctx context.Context, id string) error
+}
+
+// ListSavedQueries returns every saved query, oldest first
+func (h *ExploreHandler) ListSavedQueries(w http.ResponseWriter, r *http.Request) {
+	queries, err := h.saved.ListSavedQueries(r.Context())
+	if err != nil {
+		h.logger.Error("error listing saved queries", "error", err)
+		respondQueryError(w, err, "Could not fetch saved queries")
+		return
+	}
+
+	httputil.RespondJSON(w, http.StatusOK, queries)
+}
+
+// GetSavedQuery returns a single saved query by ID
+func (h *ExploreHandler) GetSavedQuery(w http.ResponseWriter, r *http.Request) {
+	saved, ok := h.loadSavedQuery(w, r)
+	if !ok {
+		return
+	}
+
+	httputil.RespondJSON(w, http.StatusOK, saved)
+}
+
+// CreateSavedQuery stores a new query owned by the authenticated user
+func (h *ExploreHandler) CreateSavedQuery(w http.ResponseWriter, r *http.Request) {
+	var saved database.SavedQuery
+	if !httputil.DecodeJSON(w, r, &saved, h.cfg.Get().Server.MaxRequestBodyBytes) {
+		return
+	}
+	h.fillSavedQueryDatabase(&saved)
+	if err := validateSavedQuery(saved); err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	now := time.Now().UTC()
+	saved.ID = uuid.NewString()
+	saved.CreatedAt = now
+	saved.UpdatedAt = now
+	saved.CreatedBy = currentUser(r)
+
+	if err := h.saved.SaveSavedQuery(r.Context(), saved); err != nil {
+		h.logger.Error("error creating saved query", "error", err)
+		respondQueryError(w, err, "Could not save query")
+		return
+	}
+
+	httputil.RespondJSON(w, http.StatusCreated, saved)
+}
+
+// UpdateSavedQuery replaces an existing saved query, keeping its creator and creation time
+func (h *ExploreHandler) UpdateSavedQuery(w http.ResponseWriter, r *http.Request) {
+	existing, ok := h.loadSavedQuery(w, r)
+	if !ok {
+		return
+	}
+
+	var saved database.SavedQuery
+	if !httputil.DecodeJSON(w, r, &saved, h.cfg.Get().Server.MaxRequestBodyBytes) {
+		return
+	}
+	h.fillSavedQueryDatabase(&saved)
+	if err := validateSavedQuery(saved); err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	saved.ID = existing.ID
+	saved.CreatedAt = existing.CreatedAt
+	saved.CreatedBy = existing.CreatedBy
+	saved.UpdatedAt = time.Now().UTC()
+
+	if err := h.saved.SaveSavedQuery(r.Context(), saved); err != nil {
+		h.logger.Error("error updating saved query", "id", saved.ID, "error", err)
+		respondQueryError(w, err, "Could not update saved query")
+		return
+	}
+
+	httputil.RespondJSON(w, http.StatusOK, saved)
+}
+
+// DeleteSavedQuery deletes a saved query
+func (h *ExploreHandler) DeleteSavedQuery(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	err := h.saved.DeleteSavedQuery(r.Context(), id)
+	if errors.Is(err, database.ErrSavedQueryNotFound) {
+		httputil.RespondError(w, http.StatusNotFound, httputil.CodeNotFound, fmt.Sprintf("Saved query %s not found", id))
+		return
+	}
+	if err != nil {
+		h.logger.Error("error deleting saved query", "id", id, "error", err)
+		respondQueryError(w, err, "Could not delete saved query")
+		return
+	}
+
+	httputil.RespondJSON(w, http.StatusOK, map[string]string{"message": "Saved query deleted successfully"})
+}
+
+// RunSavedQuery executes a saved query and returns its results like
+// /query or /execute-sql would. The stored query is validated again since
+// the schema may have changed after it was saved.
+func (h *ExploreHandler) RunSavedQuery(w http.ResponseWriter, r *http.Request) {
+	saved, ok := h.loadSavedQuery(w, r)
+	if !ok {
+		return
+	}
+
+	h.logger.Debug("running saved query", "id", saved.ID, "name", saved.Name)
+
+	if saved.Explore != nil {
+		h.runExploreQuery(w, r, *saved.Explore)
+		return
+	}
+	h.runRawSQL(w, r, RawSQLRequest{
+		Database:       saved.RawSQL.Database,
+		Query:          saved.RawSQL.Query,
+		TimeoutSeconds: saved.RawSQL.TimeoutSeconds,
+		Settings:       saved.RawSQL.Settings,
+	})
+}
+
+// loadSavedQuery fetches the saved query named by the {id} URL parameter,
+// writing a 404 or error response and returning false when it cannot be loaded
+func (h *ExploreHandler) loadSavedQuery(w http.ResponseWriter, r *http.Request) (*database.SavedQuery, bool) {
+	id := chi.URLParam(r, "id")
+
+	saved, err := h.saved.GetSavedQuery(r.Context(), id)
+	if errors.Is(err, database.ErrSavedQueryNotFound) {
+		httputil.RespondError(w, http.StatusNotFound, httputil.CodeNotFound, fmt.Sprintf("Saved query %s not found", id))
+		return nil, false
+	}
+	if err != nil {
+		h.logger.Error("error fetching saved query", "id", id, "error", err)
+		respondQueryError(w, err, "Could not fetch saved query")
+		return nil, false
+	}
+
+	return saved, true
+}
+
+// fillSavedQueryDatabase stores the default database in a saved query that
+// names none, so the query keeps running against the same database even if
+// the default changes later
+func (h *ExploreHandler) fillSavedQueryDatabase(saved *database.SavedQuery) {
+	if saved.Explore != nil {
+		saved.Explore.Database = h.orDefaultDatabase(saved.Explore.Database)
+	}
+	if saved.RawSQL != nil {
+		saved.RawSQL.Database = h.orDefaultDatabase(saved.RawSQL.Database)
+	}
+}
+
+// validateSavedQuery checks that a query to be saved has a name and exactly
+// one well-formed explore query or raw SQL statement
+func validateSavedQuery(saved database.SavedQuery) error {
+	if strings.TrimSpace(saved.Name) == "" {
+		return errors.New("name is required")
+	}
+
+	switch {
+	case saved.Explore == nil && saved.RawSQL == nil:
+		return errors.New("either explore or rawSql is required")
+	case saved.Explore != nil && saved.RawSQL != nil:
+		return errors.New("only one of explore and rawSql may be set")
+	case saved.Explore != nil:
+		if saved.Explore.Database == "" || saved.Explore.Table == "" {
+			return errors.New("explore.database and explore.table are required")
+		}
+	default:
+		if saved.RawSQL.Database == "" || saved.RawSQL.Query == "" {
+			return errors.New("rawSql.database and rawSql.query are required")
+		}
+		if err := database.ValidateReadOnlyQuery(saved.RawSQL.Query); err != nil {
+			return fmt.Errorf("rawSql.query: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/observio/backend/internal/api/httputil"
+	"github.com/observio/backend/internal/config"
+	"github.com/observio/backend/internal/database"
+	"github.com/observio/backend/internal/logging"
+)
+
+const (
+	// defaultSettingsNamespace is used when the client does not pass ?namespace=
+	defaultSettingsNamespace = "default"
+	// maxSettingValueBytes caps the size of a single JSON setting value
+	maxSettingValueBytes = 64 * 1024
+)
+
+// settingNamePattern restricts keys and namespaces to short, URL-safe names
+var settingNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,127}$`)
+
+// SettingsHandler serves the generic key/value settings store
+type SettingsHandler struct {
+	cfg    *config.Live
+	logger logging.Logger
+	db     *database.ClickHouseClient
+}
+
+// SettingsResponse represents the response structure for listing settings
+type SettingsResponse struct {
+	Namespace string             `json:"namespace"`
+	Settings  []database.Setting `json:"settings"`
+}
+
+// PutSettingRequest represents the request body for storing a setting
+type PutSettingRequest struct {
+	Value json.RawMessage `json:"value"`
+}
+
+// NewSettingsHandler creates a new handler for settings endpoints
+func NewSettingsHandler(cfg *config.Live, logger logging.Logger, db *database.ClickHouseClient) http.Handler {
+	h := &SettingsHandler{
+		cfg:    cfg,
+		logger: logger,
+		db:     db,
+	}
+
+	r := chi.NewRouter()
+	r.Get("/", h.ListSettings)
+	r.Get("/{key}", h.GetSetting)
+	r.Put("/{key}", h.PutSetting)
+
+	return r
+}
+
+// ListSettings returns all settings in the requested namespace
+func (h *SettingsHandler) ListSettings(w http.ResponseWriter, r *http.Request) {
+	namespace, err := settingsNamespace(r)
+	if err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	settings, err := h.db.ListSettings(r.Context(), namespace)
+	if err != nil {
+		h.logger.Error("error listing settings", "namespace", namespace, "error", err)
+		respondQueryError(w, err, "Could not fetch settings")
+		return
+	}
+
+	httputil.RespondJSON(w, http.StatusOK, SettingsResponse{
+		Namespace: namespace,
+		Settings:  settings,
+	})
+}
+
+// GetSetting returns a single setting by key
+func (h *SettingsHandler) GetSetting(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+	if !settingNamePattern.MatchString(key) {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, fmt.Sprintf("Invalid setting key: %q", key))
+		return
+	}
+
+	namespace, err := settingsNamespace(r)
+	if err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	setting, err := h.db.GetSetting(r.Context(), namespace, key)
+	if errors.Is(err, database.ErrSettingNotFound) {
+		httputil.RespondError(w, http.StatusNotFound, httputil.CodeNotFound, fmt.Sprintf("Setting %q not found in namespace %q", key, namespace))
+		return
+	}
+	if err != nil {
+		h.logger.Error("error fetching setting", "namespace", namespace, "key", key, "error", err)
+		respondQueryError(w, err, "Could not fetch setting")
+		return
+	}
+
+	httputil.RespondJSON(w, http.StatusOK, setting)
+}
+
+// PutSetting creates or replaces a setting value
+func (h *SettingsHandler) PutSetting(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+	if !settingNamePattern.MatchString(key) {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, fmt.Sprintf("Invalid setting key: %q", key))
+		return
+	}
+
+	namespace, err := settingsNamespace(r)
+	if err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	var req PutSettingRequest
+	if !httputil.DecodeJSON(w, r, &req, maxSettingValueBytes+1024) {
+		return
+	}
+
+	if len(req.Value) == 0 {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, "Value is required")
+		return
+	}
+	if len(req.Value) > maxSettingValueBytes {
+		httputil.RespondError(w, http.StatusRequestEntityTooLarge, httputil.CodePayloadTooLarge, fmt.Sprintf("Setting value exceeds %d bytes", maxSettingValueBytes))
+		return
+	}
+
+	setting, err := h.db.PutSetting(r.Context(), namespace, key, req.Value)
+	if err != nil {
+		h.logger.Error("error storing setting", "namespace", namespace, "key", key, "error", err)
+		respondQueryError(w, err, "Could not store setting")
+		return
+	}
+
+	httputil.RespondJSON(w, http.StatusOK, setting)
+}
+
+// settingsNamespace extracts and validates the optional ?namespace= parameter
+func settingsNamespace(r *http.Request) (string, error) {
+	namespace := r.URL.Query().Get("namespace")
+	if namespace == "" {
+		return defaultSettingsNamespace, nil
+	}
+	if !settingNamePattern.MatchString(namespace) {
+		return "", fmt.Errorf("Invalid namespace: %q", namespace)
+	}
+	return namespace, nil
+}
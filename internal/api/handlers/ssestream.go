@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/observio/backend/internal/api/httputil"
+	"github.com/observio/backend/internal/database"
+)
+
+// sseContentType is the media type of Server-Sent Events
+const sseContentType = "text/event-stream"
+
+// progressInterval is the least time between two progress events
+const progressInterval = 500 * time.Millisecond
+
+// wantsSSE reports whether the client asked for results as Server-Sent Events
+func wantsSSE(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), sseContentType)
+}
+
+// progressStream is a resultStream that also reports the progress of the
+// running query
+type progressStream interface {
+	resultStream
+	Progress(progress database.QueryProgress)
+}
+
+// sseResultStream sends a query result as Server-Sent Events, with progress
+// events while ClickHouse is still reading:
+//
+//	event: progress  {"readRows", "readBytes", "totalRowsToRead", "elapsedMs"}
+//	event: columns   {"columns": [...], "columnTypes": [...]}
+//	event: rows      [{...}, ...]   (up to ndjsonFlushEvery rows each)
+//	event: done      {"total": N, "progress": {...}, "autoLimit": N, "truncated": bool}
+//	event: error     {"code", "message"}
+//
+// Like the other streams it sends headers lazily, with the first progress
+// report or row, so errors raised before that get a normal status code.
+// Progress arrives from the driver while rows are written, hence the mutex.
+type sseResultStream struct {
+	w http.ResponseWriter
+
+	mu           sync.Mutex
+	sse          *sseWriter
+	columns      []string
+	columnTypes  []string
+	pending      []map[string]interface{}
+	total        int
+	columnsSent  bool
+	progress     database.QueryProgress
+	lastProgress time.Time
+	rowLimit     int // the row limit the server applied, if any
+	truncated    bool
+	err          error // the first failed write, after which nothing is sent
+}
+
+// newSSEResultStream creates an event stream writer; it returns false when the
+// response cannot be flushed
+func newSSEResultStream(w http.ResponseWriter) (*sseResultStream, bool) {
+	if _, ok := w.(http.Flusher); !ok {
+		return nil, false
+	}
+	return &sseResultStream{w: w}, true
+}
+
+// Start sends the headers and the columns; it is safe to call more than once
+func (s *sseResultStream) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.start()
+}
+
+// start is Start with the mutex held
+func (s *sseResultStream) start() {
+	if s.sse == nil {
+		s.sse, _ = newSSEWriter(s.w)
+	}
+	s.sendColumns()
+}
+
+// sendColumns sends the columns event once the columns are known
+func (s *sseResultStream) sendColumns() {
+	if s.columnsSent || s.columns == nil {
+		return
+	}
+	s.columnsSent = true
+	s.event("columns", map[string][]string{"columns": s.columns, "columnTypes": s.columnTypes})
+}
+
+// Columns keeps the result columns, sent ahead of the first rows
+func (s *sseResultStream) Columns(columns, columnTypes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.columns = columns
+	s.columnTypes = columnTypes
+	if s.sse != nil {
+		// Progress started the stream before the columns were known
+		s.sendColumns()
+	}
+	return s.err
+}
+
+// WriteRow queues a row, sending queued rows in batches
+func (s *sseResultStream) WriteRow(row map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.start()
+	s.pending = append(s.pending, row)
+	s.total++
+	if len(s.pending) >= ndjsonFlushEvery {
+		s.flushRows()
+	}
+	return s.err
+}
+
+// Progress sends a progress event, at most one per progressInterval
+func (s *sseResultStream) Progress(progress database.QueryProgress) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.progress = progress
+	if time.Since(s.lastProgress) < progressInterval {
+		return
+	}
+	s.lastProgress = time.Now()
+	if s.sse == nil {
+		s.sse, _ = newSSEWriter(s.w)
+	}
+	s.event("progress", progress)
+}
+
+// Started reports whether headers have already been sent
+func (s *sseResultStream) Started() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sse != nil
+}
+
+// WriteError sends the rows queued so far and an error event
+func (s *sseResultStream) WriteError(code, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.start()
+	s.flushRows()
+	s.event("error", httputil.ErrorBody{Code: code, Message: message})
+}
+
+// Flush sends the rows queued so far
+func (s *sseResultStream) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sse != nil {
+		s.flushRows()
+	}
+}
+
+// RowLimit adds the row limit the server applied and whether it left rows out
+// to the done event
+func (s *sseResultStream) RowLimit(limit int, truncated bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rowLimit = limit
+	s.truncated = truncated
+}
+
+// Finish sends the remaining rows and the done event with the final progress
+func (s *sseResultStream) Finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.start()
+	s.flushRows()
+	done := map[string]interface{}{"total": s.total, "progress": s.progress}
+	if s.rowLimit > 0 {
+		done["autoLimit"] = s.rowLimit
+		done["truncated"] = s.truncated
+	}
+	s.event("done", done)
+}
+
+// flushRows sends the queued rows as one rows event
+func (s *sseResultStream) flushRows() {
+	if len(s.pending) == 0 {
+		return
+	}
+	s.event("rows", s.pending)
+	s.pending = nil
+}
+
+// event sends an event, remembering a failed write so the query stops
+func (s *sseResultStream) event(name string, payload interface{}) {
+	if s.err != nil {
+		return
+	}
+	s.err = s.sse.Event(name, payload)
+}
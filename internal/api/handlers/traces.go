@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/observio/backend/internal/api/httputil"
+	"github.com/observio/backend/internal/config"
+	"github.com/observio/backend/internal/database"
+	"github.com/observio/backend/internal/logging"
+)
+
+const (
+	// defaultTraceSearchLimit is the number of traces returned without ?limit=
+	defaultTraceSearchLimit = 20
+	// maxTraceSearchLimit caps a single trace search
+	maxTraceSearchLimit = 1000
+	// maxTraceLogs caps the number of log lines returned for one trace
+	maxTraceLogs = 1000
+)
+
+// TracesHandler serves trace data from otel_traces
+type TracesHandler struct {
+	cfg    *config.Live
+	logger logging.Logger
+	db     *database.ClickHouseClient
+}
+
+// TracesResponse represents the response structure for trace searches
+type TracesResponse struct {
+	Traces []database.TraceSummary `json:"traces"`
+	Total  int                     `json:"total"`
+}
+
+// NewTracesHandler creates a new handler for traces
+func NewTracesHandler(cfg *config.Live, logger logging.Logger, db *database.ClickHouseClient) http.Handler {
+	h := &TracesHandler{
+		cfg:    cfg,
+		logger: logger,
+		db:     db,
+	}
+
+	r := chi.NewRouter()
+	r.Get("/", h.SearchTraces)
+	r.Get("/{traceId}", h.GetTrace)
+	r.Get("/{traceId}/logs", h.GetTraceLogs)
+
+	return r
+}
+
+// SearchTraces lists recent traces, optionally filtered by service, operation and span duration
+func (h *TracesHandler) SearchTraces(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	// Optional query params: service, operation, minDuration, maxDuration (ms), start, end, limit
+	filter := database.TraceFilter{
+		Service:   query.Get("service"),
+		Operation: query.Get("operation"),
+		Limit:     defaultTraceSearchLimit,
+	}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "Limit must be a positive integer")
+			return
+		}
+		filter.Limit = limit
+	}
+	if filter.Limit > maxTraceSearchLimit {
+		filter.Limit = maxTraceSearchLimit
+	}
+
+	var err error
+	if filter.MinDurationNs, err = durationParamNs(query.Get("minDuration")); err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "minDuration must be a non-negative number of milliseconds")
+		return
+	}
+	if filter.MaxDurationNs, err = durationParamNs(query.Get("maxDuration")); err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "maxDuration must be a non-negative number of milliseconds")
+		return
+	}
+	if filter.MaxDurationNs > 0 && filter.MinDurationNs > filter.MaxDurationNs {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "minDuration must not be greater than maxDuration")
+		return
+	}
+	if filter.Start, err = parseTimeParam(query.Get("start")); err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "start must be an RFC3339 timestamp or Unix epoch milliseconds")
+		return
+	}
+	if filter.End, err = parseTimeParam(query.Get("end")); err != nil {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "end must be an RFC3339 timestamp or Unix epoch milliseconds")
+		return
+	}
+	if filter.Start != nil && filter.End != nil && filter.Start.After(*filter.End) {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidFilter, "start must not be after end")
+		return
+	}
+
+	traces, err := h.db.SearchTraces(ctx, filter)
+	if err != nil {
+		h.logger.Error("error searching traces in ClickHouse", "error", err)
+		respondQueryError(w, err, "Could not fetch traces")
+		return
+	}
+
+	httputil.RespondJSON(w, http.StatusOK, TracesResponse{
+		Traces: traces,
+		Total:  len(traces),
+	})
+}
+
+// GetTrace returns all spans of a single trace
+func (h *TracesHandler) GetTrace(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	traceID := chi.URLParam(r, "traceId")
+
+	if traceID == "" {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, "Trace ID is required")
+		return
+	}
+
+	trace, err := h.db.GetTrace(ctx, traceID)
+	if errors.Is(err, database.ErrTraceNotFound) {
+		httputil.RespondError(w, http.StatusNotFound, httputil.CodeNotFound, fmt.Sprintf("Trace %s not found", traceID))
+		return
+	}
+	if err != nil {
+		h.logger.Error("error fetching trace from ClickHouse", "traceId", traceID, "error", err)
+		respondQueryError(w, err, "Could not fetch trace")
+		return
+	}
+
+	httputil.RespondJSON(w, http.StatusOK, trace)
+}
+
+// GetTraceLogs returns the log lines emitted while handling a trace
+func (h *TracesHandler) GetTraceLogs(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	traceID := chi.URLParam(r, "traceId")
+
+	if traceID == "" {
+		httputil.RespondError(w, http.StatusBadRequest, httputil.CodeInvalidRequest, "Trace ID is required")
+		return
+	}
+
+	logs, err := h.db.GetLogs(ctx, database.LogFilter{TraceId: traceID, Limit: maxTraceLogs})
+	if err != nil {
+		h.logger.Error("error fetching trace logs from ClickHouse", "traceId", traceID, "error", err)
+		respondQueryError(w, err, "Could not fetch trace logs")
+		return
+	}
+	if logs == nil {
+		logs = []database.LogEntry{}
+	}
+
+	httputil.RespondJSON(w, http.StatusOK, logs)
+}
+
+// durationParamNs parses an optional millisecond query parameter into nanoseconds
+func durationParamNs(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	ms, err := strconv.ParseFloat(value, 64)
+	if err != nil || ms < 0 {
+		return 0, fmt.Errorf("invalid duration: %q", value)
+	}
+	return int64(ms * 1e6), nil
+}
@@ -0,0 +1,81 @@
+package httputil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultMaxBodyBytes is the request body limit used when none is configured
+const DefaultMaxBodyBytes = 1 << 20
+
+// DecodeJSON decodes a single JSON value from the request body into dst,
+// rejecting bodies larger than maxBytes (DefaultMaxBodyBytes when <= 0) and
+// fields that dst does not declare. On failure it writes a 400 or 413 error
+// response naming the problem and returns false.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}, maxBytes int64) bool {
+	return decodeJSON(w, r, dst, maxBytes, true)
+}
+
+// DecodeJSONLenient is DecodeJSON for documents written by other tools, such
+// as Grafana dashboards: fields that dst does not declare are ignored
+func DecodeJSONLenient(w http.ResponseWriter, r *http.Request, dst interface{}, maxBytes int64) bool {
+	return decodeJSON(w, r, dst, maxBytes, false)
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}, maxBytes int64, strict bool) bool {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBodyBytes
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBytes))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+
+	err := dec.Decode(dst)
+	if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+		err = errTrailingData
+	}
+	if err != nil {
+		respondDecodeError(w, err)
+		return false
+	}
+	return true
+}
+
+var errTrailingData = errors.New("request body must contain a single JSON value")
+
+// respondDecodeError translates a json decoding failure into an error response
+func respondDecodeError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		RespondError(w, http.StatusRequestEntityTooLarge, CodePayloadTooLarge,
+			fmt.Sprintf("Request body exceeds %d bytes", maxBytesErr.Limit))
+	case errors.Is(err, io.EOF):
+		RespondError(w, http.StatusBadRequest, CodeInvalidRequest, "Request body is empty")
+	case errors.Is(err, errTrailingData):
+		RespondError(w, http.StatusBadRequest, CodeInvalidRequest, "Request body must contain a single JSON value")
+	case errors.As(err, &syntaxErr):
+		RespondError(w, http.StatusBadRequest, CodeInvalidRequest,
+			fmt.Sprintf("Malformed JSON at offset %d", syntaxErr.Offset))
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		RespondError(w, http.StatusBadRequest, CodeInvalidRequest, "Malformed JSON: unexpected end of body")
+	case errors.As(err, &typeErr):
+		RespondError(w, http.StatusBadRequest, CodeInvalidRequest,
+			fmt.Sprintf("Field %q must be of type %s", typeErr.Field, typeErr.Type))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no typed error for unknown fields
+		field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		RespondError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("Unknown field %s", field))
+	default:
+		RespondError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request payload")
+	}
+}
@@ -0,0 +1,25 @@
+package httputil
+
+import "strings"
+
+// OriginAllowed reports whether a browser origin is in the allowed list,
+// where "*" allows any origin
+func OriginAllowed(allowed []string, origin string) bool {
+	for _, a := range allowed {
+		if a == "*" || strings.EqualFold(a, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// OriginListed reports whether a browser origin is named in the allowed list
+// itself rather than only matched by "*"
+func OriginListed(allowed []string, origin string) bool {
+	for _, a := range allowed {
+		if a != "*" && strings.EqualFold(a, origin) {
+			return true
+		}
+	}
+	return false
+}
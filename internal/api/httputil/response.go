@@ -0,0 +1,59 @@
+// Package httputil holds the JSON response helpers shared by every API handler.
+package httputil
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Stable error codes returned in the "code" field of error responses. Clients
+// should branch on these rather than on the human-readable message.
+const (
+	CodeInvalidRequest        = "INVALID_REQUEST"
+	CodeInvalidFilter         = "INVALID_FILTER"
+	CodeInvalidQuery          = "INVALID_QUERY"
+	CodeUnauthorized          = "UNAUTHORIZED"
+	CodeNotFound              = "NOT_FOUND"
+	CodeConflict              = "CONFLICT"
+	CodeTableNotFound         = "TABLE_NOT_FOUND"
+	CodeMethodNotAllowed      = "METHOD_NOT_ALLOWED"
+	CodePayloadTooLarge       = "PAYLOAD_TOO_LARGE"
+	CodeTooManyQueries        = "TOO_MANY_QUERIES"
+	CodeRateLimited           = "RATE_LIMITED"
+	CodeQueryFailed           = "QUERY_FAILED"
+	CodeQueryTimeout          = "QUERY_TIMEOUT"
+	CodeResultTooLarge        = "RESULT_TOO_LARGE"
+	CodeClickHouseUnavailable = "CLICKHOUSE_UNAVAILABLE"
+	CodeServiceUnavailable    = "SERVICE_UNAVAILABLE"
+	CodeUpstreamError         = "UPSTREAM_ERROR"
+	CodeInternal              = "INTERNAL_ERROR"
+)
+
+// ErrorBody describes a failed request
+type ErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ErrorResponse is the envelope of every error response: {"error": {"code", "message"}}
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+// RespondJSON writes payload as JSON with the given status code
+func RespondJSON(w http.ResponseWriter, status int, payload interface{}) {
+	response, err := json.Marshal(payload)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// RespondError writes the standard error envelope with a stable code and a message
+func RespondError(w http.ResponseWriter, status int, code, message string) {
+	RespondJSON(w, status, ErrorResponse{Error: ErrorBody{Code: code, Message: message}})
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestRecordRequestMetrics(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(recordRequestMetrics)
+	r.Get("/api/v1/traces/{traceId}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	for _, path := range []string{"/api/v1/traces/abc", "/api/v1/traces/def", "/wp-login.php"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	exposition := string(body)
+
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="/api/v1/traces/{traceId}",status="418"} 2`,
+		`http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/api/v1/traces/{traceId}",status="418"} 2`,
+		`http_requests_in_flight 0`,
+		`clickhouse_inflight_queries 0`,
+	} {
+		if !strings.Contains(exposition, want) {
+			t.Errorf("/metrics is missing %q", want)
+		}
+	}
+}
@@ -1,22 +1,37 @@
 package api
 
 import (
-	"log"
+	"context"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/observio/backend/internal/api/handlers"
+	"github.com/observio/backend/internal/api/httputil"
+	"github.com/observio/backend/internal/auth"
 	"github.com/observio/backend/internal/config"
 	"github.com/observio/backend/internal/database"
+	"github.com/observio/backend/internal/logging"
+	"github.com/observio/backend/internal/ratelimit"
+	"github.com/observio/backend/internal/services"
+	"github.com/observio/backend/internal/services/alerting"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 
-// NewRouter creates and configures a new HTTP router
-func NewRouter(cfg *config.Config, logger *log.Logger) http.Handler {
+// NewRouter creates and configures a new HTTP router. Settings that can be
+// reloaded are read from live on every request; the rest are read once here.
+// The returned start func starts the background jobs, query history
+// retention and alert rule evaluation, which run until its ctx is cancelled.
+// The returned cleanup func closes the ClickHouse connection; call it after
+// the HTTP server has shut down so in-flight queries have finished.
+func NewRouter(live *config.Live, logger logging.Logger) (http.Handler, func(ctx context.Context), func() error) {
 	r := chi.NewRouter()
+	cfg := live.Get()
 
 	// Initialize ClickHouse client
 	clickhouseClient, err := database.NewClickHouseClient(
@@ -25,63 +40,332 @@ func NewRouter(cfg *config.Config, logger *log.Logger) http.Handler {
 		cfg.ClickHouse.Username,
 		cfg.ClickHouse.Password,
 		cfg.ClickHouse.Database,
+		database.ClientOptions{
+			MaxConcurrentQueries:        cfg.ClickHouse.MaxConcurrentQueries,
+			MaxConcurrentQueriesPerUser: cfg.ClickHouse.MaxConcurrentQueriesPerUser,
+			QueueTimeout:                time.Duration(cfg.ClickHouse.QueryQueueTimeoutSeconds) * time.Second,
+			MaxRetries:                  cfg.ClickHouse.MaxRetries,
+			RetryBackoff:                time.Duration(cfg.ClickHouse.RetryBackoffMs) * time.Millisecond,
+			MaxOpenConns:                cfg.ClickHouse.MaxOpenConns,
+			MaxIdleConns:                cfg.ClickHouse.MaxIdleConns,
+			ConnMaxLifetime:             time.Duration(cfg.ClickHouse.ConnMaxLifetimeMinutes) * time.Minute,
+			DialTimeout:                 time.Duration(cfg.ClickHouse.DialTimeoutSeconds) * time.Second,
+			ReadTimeout:                 time.Duration(cfg.ClickHouse.ReadTimeoutSeconds) * time.Second,
+			HTTP:                        cfg.ClickHouse.IsHTTP(),
+			Secure:                      cfg.ClickHouse.Secure,
+			CAFile:                      cfg.ClickHouse.TLSCAFile,
+			InsecureSkipVerify:          cfg.ClickHouse.TLSSkipVerify,
+			ReadOnlyQueries:             cfg.ClickHouse.ReadOnlyQueries,
+			SlowQueryThreshold:          time.Duration(cfg.ClickHouse.SlowQueryThresholdMs) * time.Millisecond,
+		},
 		logger,
 	)
+	schemaReady := false
 	if err != nil {
-		logger.Printf("Warning: Failed to connect to ClickHouse: %v. Logs endpoint may not work properly.", err)
+		logger.Warn("failed to create the ClickHouse client, ClickHouse-backed endpoints will answer 503", "error", err)
 		clickhouseClient = nil
+	} else if err := clickhouseClient.EnsureSchema(context.Background()); err != nil {
+		logger.Warn("failed to create ClickHouse tables, retrying in the background", "error", err)
+	} else {
+		schemaReady = true
+	}
+
+	// Alert rules are evaluated in the background while ClickHouse is available
+	var alertEvaluator *alerting.Evaluator
+	if clickhouseClient != nil {
+		alertEvaluator = alerting.NewEvaluator(clickhouseClient, clickhouseClient, cfg.Alerting, logger)
 	}
 
 	// Middleware
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
+	r.Use(traceRequests)
+	r.Use(recordRequestMetrics)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(time.Duration(cfg.Server.ReadTimeoutSeconds) * time.Second))
+	if cfg.Server.Compression {
+		r.Use(compressResponses(cfg.Server.CompressionMinBytes))
+	}
+	r.Use(timeoutUnlessStreaming(live))
 	// Allow both /logs and /logs/ (and similar) to work
 	r.Use(middleware.StripSlashes)
 
 	// CORS configuration
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"*"}, // Adjust for production
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: true,
-		MaxAge:           300,
-	}))
-
-	// Health check endpoint
+	r.Use(corsHandler(live))
+
+	// JSON responses for unknown routes and unsupported methods
+	notFound := func(w http.ResponseWriter, req *http.Request) {
+		httputil.RespondError(w, http.StatusNotFound, httputil.CodeNotFound,
+			fmt.Sprintf("No route matches %s %s", req.Method, req.URL.Path))
+	}
+	r.NotFound(notFound)
+	prefix := cfg.Server.RoutePrefix()
+	r.MethodNotAllowed(func(w http.ResponseWriter, req *http.Request) {
+		allowed := allowedMethods(r, strings.TrimPrefix(req.URL.Path, prefix))
+		if len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+		}
+		httputil.RespondError(w, http.StatusMethodNotAllowed, httputil.CodeMethodNotAllowed,
+			fmt.Sprintf("Method %s is not allowed for %s", req.Method, req.URL.Path))
+	})
+
+	// Liveness endpoint: the process is up, regardless of ClickHouse
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
 
+	// Readiness endpoint: only ready to serve while ClickHouse answers a ping
+	r.Get("/ready", func(w http.ResponseWriter, req *http.Request) {
+		status := http.StatusOK
+		body := map[string]string{"status": "ready", "clickhouse": "ok"}
+		if err := pingClickHouse(req.Context(), clickhouseClient); err != nil {
+			logger.Warn("readiness check failed", "error", err)
+			status = http.StatusServiceUnavailable
+			body = map[string]string{"status": "not_ready", "clickhouse": "unreachable"}
+		}
+		httputil.RespondJSON(w, status, body)
+	})
+
+	// Prometheus scrape endpoint; unauthenticated like the other operational routes
+	r.Method(http.MethodGet, "/metrics", promhttp.Handler())
+
 	// API routes
 	r.Route("/api/v1", func(r chi.Router) {
-		// Metrics endpoints
-		r.Mount("/metrics", handlers.NewMetricsHandler(cfg, logger))
+		// Login is public; everything else requires a bearer token when auth is enabled
+		r.Mount("/auth", handlers.NewAuthHandler(live, logger))
 
-		// Dashboard endpoints
-		r.Mount("/dashboards", handlers.NewDashboardHandler(cfg, logger))
+		r.Group(func(r chi.Router) {
+			if cfg.Auth.JWTSecret != "" {
+				r.Use(auth.Middleware(cfg.Auth.JWTSecret))
+			} else {
+				logger.Warn("auth.jwtSecret is not set, API endpoints are unauthenticated")
+			}
 
-		// Alerts endpoints
-		r.Mount("/alerts", handlers.NewAlertsHandler(cfg, logger))
+			// Data sources are shared by the metrics, dashboard and data source endpoints
+			dataSources := handlers.NewDataSources()
 
-		// Data sources endpoints
-		r.Mount("/datasources", handlers.NewDataSourceHandler(cfg, logger))
+			// Metrics endpoints
+			r.Mount("/metrics", handlers.NewMetricsHandler(live, logger, dataSources))
 
-		// Logs exploration endpoint (ClickHouse-based)
-		if clickhouseClient != nil {
-			r.Mount("/logs", handlers.NewLogsHandler(cfg, logger, clickhouseClient))
-			r.Mount("/explore", handlers.NewExploreHandler(cfg, logger, clickhouseClient))
-		} else {
-			logger.Printf("Warning: ClickHouse client not available, logs and explore endpoints disabled")
-		}
+			// Dashboard endpoints; dashboards are stored in ClickHouse when it is available
+			var dashboardStore handlers.DashboardStore
+			var panelQueries handlers.PanelQueryChecker
+			if clickhouseClient != nil {
+				dashboardStore = clickhouseClient
+				panelQueries = clickhouseClient
+			}
+			r.Mount("/dashboards", handlers.NewDashboardHandler(live, logger, dashboardStore, dataSources, panelQueries))
+
+			// Alerts endpoints; rules are stored in ClickHouse when it is available
+			var alertRuleStore handlers.AlertRuleStore
+			var alertSource handlers.AlertSource
+			if clickhouseClient != nil {
+				alertRuleStore = clickhouseClient
+				alertSource = alertEvaluator
+			}
+			r.Mount("/alerts", handlers.NewAlertsHandler(live, logger, alertRuleStore, alertSource))
+
+			// Data sources endpoints
+			r.Mount("/datasources", handlers.NewDataSourceHandler(live, logger, dataSources))
+
+			// Query-heavy endpoints are rate limited per client IP
+			limiter := ratelimit.New(cfg.Server.RateLimitPerMinute)
+			live.OnChange(func(cfg *config.Config) {
+				limiter.SetLimit(cfg.Server.RateLimitPerMinute)
+			})
+			limited := r.With(ratelimit.Middleware(limiter))
+
+			// Logs exploration endpoint (ClickHouse-based). Without a client the
+			// routes stay mounted and answer 503, which clients can retry.
+			if clickhouseClient != nil {
+				limited.Mount("/logs", handlers.NewLogsHandler(live, logger, clickhouseClient))
+				r.Mount("/traces", handlers.NewTracesHandler(live, logger, clickhouseClient))
+				limited.Mount("/explore", handlers.NewExploreHandler(live, logger, clickhouseClient))
+				r.Mount("/settings", handlers.NewSettingsHandler(live, logger, clickhouseClient))
+			} else {
+				logger.Warn("ClickHouse client not available, logs, traces, explore and settings endpoints answer 503")
+				unavailable := http.HandlerFunc(handlers.ClickHouseUnavailable)
+				limited.Mount("/logs", unavailable)
+				r.Mount("/traces", unavailable)
+				limited.Mount("/explore", unavailable)
+				r.Mount("/settings", unavailable)
+			}
+		})
 	})
 
-	// Cleanup function for ClickHouse client could be added here if needed
-	// For now, we'll let the connection be cleaned up when the program exits
-	
-	return r
+	// Behind a reverse proxy that routes a path prefix to the server, every
+	// route, including /health and /metrics, moves under server.basePath
+	var handler http.Handler = r
+	if prefix != "" {
+		root := chi.NewRouter()
+		root.NotFound(notFound)
+		root.Mount(prefix, r)
+		handler = root
+	}
+
+	start := func(ctx context.Context) {
+		if clickhouseClient == nil {
+			return
+		}
+		retention := services.NewHistoryRetention(clickhouseClient, cfg.History, logger)
+		go func() {
+			if !schemaReady {
+				ensureSchemaWithRetry(ctx, clickhouseClient, logger)
+			}
+			retention.Run(ctx)
+		}()
+		go alertEvaluator.Run(ctx)
+	}
+
+	cleanup := func() error {
+		if clickhouseClient == nil {
+			return nil
+		}
+		logger.Info("closing ClickHouse connection")
+		return clickhouseClient.Close()
+	}
+
+	return handler, start, cleanup
+}
+
+// maxSchemaRetryDelay caps the wait between EnsureSchema attempts
+const maxSchemaRetryDelay = time.Minute
+
+// ensureSchemaWithRetry keeps applying the schema until it succeeds, for when
+// ClickHouse was not reachable at startup
+func ensureSchemaWithRetry(ctx context.Context, client *database.ClickHouseClient, logger logging.Logger) {
+	delay := time.Second
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		if err := client.EnsureSchema(ctx); err != nil {
+			logger.Warn("failed to create ClickHouse tables", "error", err)
+			delay *= 2
+			if delay > maxSchemaRetryDelay {
+				delay = maxSchemaRetryDelay
+			}
+			continue
+		}
+
+		logger.Info("ClickHouse tables created")
+		return
+	}
+}
+
+// readinessPingTimeout bounds the ClickHouse ping done by /ready
+const readinessPingTimeout = 2 * time.Second
+
+// pingClickHouse pings the client with a short timeout; a nil client never connected
+func pingClickHouse(ctx context.Context, client *database.ClickHouseClient) error {
+	if client == nil {
+		return fmt.Errorf("ClickHouse client is not connected")
+	}
+	ctx, cancel := context.WithTimeout(ctx, readinessPingTimeout)
+	defer cancel()
+	return client.Ping(ctx)
+}
+
+// queryDeadlineMargin is how much longer than its longest query an explore
+// request may take, so the query reports its own timeout before the request
+// is cut off
+const queryDeadlineMargin = 5 * time.Second
+
+// timeoutUnlessStreaming applies middleware.Timeout to every request except
+// long-lived event streams such as /logs/stream and WebSocket connections such
+// as /explore/ws, which end when the client leaves. The timeout is the one of
+// requestTimeout; when it outlasts server.writeTimeoutSeconds, the write
+// deadline of the connection is pushed back to match.
+func timeoutUnlessStreaming(live *config.Live) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			path := strings.TrimSuffix(req.URL.Path, "/")
+			if strings.HasSuffix(path, "/stream") || strings.HasSuffix(path, "/ws") {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			cfg := live.Get()
+			timeout := requestTimeout(cfg, path)
+			if timeout > time.Duration(cfg.Server.WriteTimeoutSeconds)*time.Second {
+				// Unsupported only for writers that cannot time out anyway
+				_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout))
+			}
+			middleware.Timeout(timeout)(next).ServeHTTP(w, req)
+		})
+	}
+}
+
+// requestTimeout returns how long a request to path may take:
+// server.readTimeoutSeconds, or for explore requests, which run queries with
+// a time limit of their own, clickhouse.maxQueryTimeoutSeconds plus a margin
+// when that is longer. A batch is bounded by query.batchTimeoutSeconds instead.
+func requestTimeout(cfg *config.Config, path string) time.Duration {
+	timeout := time.Duration(cfg.Server.ReadTimeoutSeconds) * time.Second
+	if !strings.Contains(path, "/api/v1/explore/") {
+		return timeout
+	}
+	if strings.HasSuffix(path, "/api/v1/explore/batch") {
+		batchTimeout := time.Duration(cfg.Query.BatchTimeoutSeconds)*time.Second + queryDeadlineMargin
+		return max(timeout, batchTimeout)
+	}
+	queryTimeout := time.Duration(cfg.ClickHouse.MaxQueryTimeoutSeconds)*time.Second + queryDeadlineMargin
+	return max(timeout, queryTimeout)
+}
+
+// routeMethods lists the methods probed when building the Allow header
+var routeMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// allowedMethods returns the methods the router can serve for the given path
+func allowedMethods(mux *chi.Mux, path string) []string {
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+
+	var allowed []string
+	for _, method := range routeMethods {
+		if mux.Match(chi.NewRouteContext(), method, path) {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
+
+// corsHandler allows the origins in server.corsAllowedOrigins. Credentials
+// are only allowed for origins listed by name: an origin matched by "*" may
+// call the API, but the browser does not send it cookies or credentials, so
+// the default lets no other site make authenticated requests.
+func corsHandler(live *config.Live) func(http.Handler) http.Handler {
+	options := func(allow func(allowed []string, origin string) bool, credentials bool) cors.Options {
+		return cors.Options{
+			AllowOriginFunc: func(_ *http.Request, origin string) bool {
+				return allow(live.Get().Server.CORSAllowedOrigins, origin)
+			},
+			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+			ExposedHeaders:   []string{"Link"},
+			AllowCredentials: credentials,
+			MaxAge:           300,
+		}
+	}
+	listed := cors.Handler(options(httputil.OriginListed, true))
+	wildcard := cors.Handler(options(httputil.OriginAllowed, false))
+
+	return func(next http.Handler) http.Handler {
+		withCredentials, withoutCredentials := listed(next), wildcard(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if httputil.OriginListed(live.Get().Server.CORSAllowedOrigins, req.Header.Get("Origin")) {
+				withCredentials.ServeHTTP(w, req)
+				return
+			}
+			withoutCredentials.ServeHTTP(w, req)
+		})
+	}
 }
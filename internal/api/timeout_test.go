@@ -0,0 +1,74 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/observio/backend/internal/config"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	cfg := &config.Config{
+		Server:     config.ServerConfig{ReadTimeoutSeconds: 30},
+		ClickHouse: config.ClickHouseConfig{MaxQueryTimeoutSeconds: 300},
+		Query:      config.QueryConfig{BatchTimeoutSeconds: 60},
+	}
+	tests := []struct {
+		path string
+		want time.Duration
+	}{
+		{"/api/v1/logs", 30 * time.Second},
+		{"/api/v1/explore/query", 300*time.Second + queryDeadlineMargin},
+		{"/observio/api/v1/explore/execute-sql", 300*time.Second + queryDeadlineMargin},
+		{"/api/v1/explore/batch", 60*time.Second + queryDeadlineMargin},
+	}
+	for _, tt := range tests {
+		if got := requestTimeout(cfg, tt.path); got != tt.want {
+			t.Errorf("requestTimeout(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	// A maximum query timeout below the server timeout keeps the server timeout
+	cfg.ClickHouse.MaxQueryTimeoutSeconds = 10
+	if got := requestTimeout(cfg, "/api/v1/explore/query"); got != 30*time.Second {
+		t.Errorf("requestTimeout with a short query timeout = %v, want 30s", got)
+	}
+	// but does not cut a batch short of its own timeout
+	if got := requestTimeout(cfg, "/api/v1/explore/batch"); got != 60*time.Second+queryDeadlineMargin {
+		t.Errorf("requestTimeout of a batch = %v, want %v", got, 60*time.Second+queryDeadlineMargin)
+	}
+}
+
+func TestTimeoutUnlessStreamingExtendsWriteDeadline(t *testing.T) {
+	live := config.NewLive(&config.Config{
+		Server:     config.ServerConfig{ReadTimeoutSeconds: 0},
+		ClickHouse: config.ClickHouseConfig{MaxQueryTimeoutSeconds: 1},
+	})
+	handler := timeoutUnlessStreaming(live)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte("done"))
+	}))
+
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	// Without the extension the connection would be closed before the response
+	resp, err := http.Get(server.URL + "/api/v1/explore/query")
+	if err != nil {
+		t.Fatalf("explore request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || string(body) != "done" {
+		t.Fatalf("explore response = %q, %v; want done", body, err)
+	}
+
+	if _, err := http.Get(server.URL + "/api/v1/logs"); err == nil {
+		t.Errorf("logs request outlived the write timeout")
+	}
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/observio/backend/internal/api/httputil"
+)
+
+// contextKey is the type of the request context key holding Claims
+type contextKey struct{}
+
+// ClaimsFromContext returns the claims stored by Middleware, if any
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(Claims)
+	return claims, ok
+}
+
+// UserFromContext returns the ID of the user authenticated by Middleware; ok
+// is false when authentication is disabled or the token names no user
+func UserFromContext(ctx context.Context) (string, bool) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok || claims.UserID() == "" {
+		return "", false
+	}
+	return claims.UserID(), true
+}
+
+// Middleware rejects requests without a valid "Authorization: Bearer <token>"
+// header with 401 and stores the token's claims in the request context
+func Middleware(secret string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok || strings.TrimSpace(token) == "" {
+				unauthorized(w, "Missing bearer token")
+				return
+			}
+
+			claims, err := ParseToken(secret, strings.TrimSpace(token))
+			if errors.Is(err, ErrExpiredToken) {
+				unauthorized(w, "Token has expired")
+				return
+			}
+			if err != nil {
+				unauthorized(w, "Invalid token")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, claims)))
+		})
+	}
+}
+
+// unauthorized writes a 401 with a bearer challenge
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="observio"`)
+	httputil.RespondError(w, http.StatusUnauthorized, httputil.CodeUnauthorized, message)
+}
@@ -1,8 +1,12 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -12,18 +16,46 @@ type Config struct {
 	Server     ServerConfig     `yaml:"server"`
 	Database   DatabaseConfig   `yaml:"database"`
 	ClickHouse ClickHouseConfig `yaml:"clickhouse"`
+	Query      QueryConfig      `yaml:"query"`
 	Logging    LoggingConfig    `yaml:"logging"`
 	Auth       AuthConfig       `yaml:"auth"`
+	History    HistoryConfig    `yaml:"history"`
+	Alerting   AlertingConfig   `yaml:"alerting"`
 }
 
 // ServerConfig holds HTTP server configuration
 type ServerConfig struct {
-	Port                  int    `yaml:"port"`
-	Host                  string `yaml:"host"`
-	ReadTimeoutSeconds    int    `yaml:"readTimeoutSeconds"`
-	WriteTimeoutSeconds   int    `yaml:"writeTimeoutSeconds"`
-	IdleTimeoutSeconds    int    `yaml:"idleTimeoutSeconds"`
-	ShutdownTimeoutSeconds int    `yaml:"shutdownTimeoutSeconds"`
+	Port                int    `yaml:"port"`
+	Host                string `yaml:"host"`
+	ReadTimeoutSeconds  int    `yaml:"readTimeoutSeconds"`
+	WriteTimeoutSeconds int    `yaml:"writeTimeoutSeconds"`
+	IdleTimeoutSeconds  int    `yaml:"idleTimeoutSeconds"`
+	// ReadHeaderTimeoutSeconds bounds reading the request headers, so slow
+	// clients can not hold connections open (Slowloris); default 10
+	ReadHeaderTimeoutSeconds int `yaml:"readHeaderTimeoutSeconds"`
+	// MaxHeaderBytes caps the size of the request headers (default 1MB)
+	MaxHeaderBytes         int   `yaml:"maxHeaderBytes"`
+	ShutdownTimeoutSeconds int   `yaml:"shutdownTimeoutSeconds"`
+	MaxRequestBodyBytes    int64 `yaml:"maxRequestBodyBytes"`
+	// RateLimitPerMinute caps explore and logs requests per client IP; 0 disables it
+	RateLimitPerMinute int `yaml:"rateLimitPerMinute"`
+	// CORSAllowedOrigins lists the origins browsers may call the API from;
+	// "*" allows any origin (default), but only listed origins may send
+	// credentials
+	CORSAllowedOrigins []string `yaml:"corsAllowedOrigins"`
+	// Compression gzips responses for clients that accept it (default true)
+	Compression bool `yaml:"compression"`
+	// CompressionMinBytes leaves responses smaller than this uncompressed (default 1024)
+	CompressionMinBytes int `yaml:"compressionMinBytes"`
+	// BasePath serves every route under this prefix, e.g. "/observio" for a
+	// reverse proxy routing that path to the server; empty serves them at the root
+	BasePath string `yaml:"basePath"`
+}
+
+// RoutePrefix returns BasePath without its trailing slashes, empty when
+// routes are served at the root
+func (s ServerConfig) RoutePrefix() string {
+	return strings.TrimRight(strings.TrimSpace(s.BasePath), "/")
 }
 
 // DatabaseConfig holds database connection configuration
@@ -37,13 +69,65 @@ type DatabaseConfig struct {
 	SSLMode  string `yaml:"sslMode"`
 }
 
-// ClickHouseConfig holds ClickHouse connection configuration
+// ClickHouseConfig holds ClickHouse connection configuration. Connection fields
+// left empty in the YAML are read from CLICKHOUSE_HOST, CLICKHOUSE_PORT,
+// CLICKHOUSE_DATABASE, CLICKHOUSE_USER and CLICKHOUSE_PASSWORD, and then
+// default to localhost with the "default" user and database, on the standard
+// port of the protocol (9000, 9440 with TLS, 8123 over HTTP, 8443 over HTTPS).
 type ClickHouseConfig struct {
 	Host     string `yaml:"host"`
 	Port     int    `yaml:"port"`
 	Database string `yaml:"database"`
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
+	// Protocol is "native" (default) or "http", for when only the HTTP port is reachable
+	Protocol string `yaml:"protocol"`
+	// Secure connects over TLS, as ClickHouse Cloud requires
+	Secure bool `yaml:"secure"`
+	// TLSCAFile is a PEM file of CAs trusted instead of the system ones
+	TLSCAFile string `yaml:"tlsCaFile"`
+	// TLSSkipVerify disables certificate verification; for testing only
+	TLSSkipVerify bool `yaml:"tlsSkipVerify"`
+	// MaxIngestBatchSize caps the number of records accepted by POST /logs/ingest (default 1000)
+	MaxIngestBatchSize int `yaml:"maxIngestBatchSize"`
+	// MaxConcurrentQueries bounds in-flight ClickHouse queries; 0 disables the limit (default 20)
+	MaxConcurrentQueries int `yaml:"maxConcurrentQueries"`
+	// MaxConcurrentQueriesPerUser bounds the in-flight ClickHouse queries of one
+	// authenticated user; 0 disables the limit (default 0)
+	MaxConcurrentQueriesPerUser int `yaml:"maxConcurrentQueriesPerUser"`
+	// QueryQueueTimeoutSeconds is how long a query waits for a free slot before failing (default 5)
+	QueryQueueTimeoutSeconds int `yaml:"queryQueueTimeoutSeconds"`
+	// MaxRetries is how many times a query is retried after a connection error (default 1)
+	MaxRetries int `yaml:"maxRetries"`
+	// RetryBackoffMs is the delay before the first retry, doubling on each attempt (default 500)
+	RetryBackoffMs int `yaml:"retryBackoffMs"`
+	// MaxOpenConns caps the connections in the pool (default 10)
+	MaxOpenConns int `yaml:"maxOpenConns"`
+	// MaxIdleConns is how many unused connections the pool keeps open (default 5)
+	MaxIdleConns int `yaml:"maxIdleConns"`
+	// ConnMaxLifetimeMinutes replaces connections older than this (default 60)
+	ConnMaxLifetimeMinutes int `yaml:"connMaxLifetimeMinutes"`
+	// DialTimeoutSeconds bounds opening a new connection (default 10)
+	DialTimeoutSeconds int `yaml:"dialTimeoutSeconds"`
+	// ReadTimeoutSeconds bounds waiting for the server while a query runs (default 300)
+	ReadTimeoutSeconds int `yaml:"readTimeoutSeconds"`
+	// QueryTimeoutSeconds limits explore and raw SQL queries that do not ask for
+	// their own timeout; 0 disables the limit (default 30)
+	QueryTimeoutSeconds int `yaml:"queryTimeoutSeconds"`
+	// MaxQueryTimeoutSeconds is the largest timeout a request may ask for (default 300)
+	MaxQueryTimeoutSeconds int `yaml:"maxQueryTimeoutSeconds"`
+	// ReadOnlyQueries runs explore and raw SQL queries with ClickHouse's readonly
+	// and allow_ddl settings so the server rejects writes itself (default true)
+	ReadOnlyQueries bool `yaml:"readOnlyQueries"`
+	// MaxResultRows stops explore and raw SQL queries returning more rows than
+	// this; 0 disables the limit (default 100000)
+	MaxResultRows int `yaml:"maxResultRows"`
+	// MetadataCacheTTLSeconds is how long database, table and field lists are
+	// cached for the explore endpoints; 0 disables the cache (default 60)
+	MetadataCacheTTLSeconds int `yaml:"metadataCacheTTLSeconds"`
+	// SlowQueryThresholdMs logs queries running at least this long at warn
+	// level; 0 disables the slow query log (default 0)
+	SlowQueryThresholdMs int `yaml:"slowQueryThresholdMs"`
 }
 
 // LoggingConfig holds logging configuration
@@ -53,10 +137,83 @@ type LoggingConfig struct {
 	File   string `yaml:"file"`
 }
 
-// AuthConfig holds authentication configuration
+// AuthConfig holds authentication configuration. When JWTSecret is empty,
+// authentication is disabled and /api/v1 is open.
 type AuthConfig struct {
-	JWTSecret            string `yaml:"jwtSecret"`
-	JWTExpirationMinutes int    `yaml:"jwtExpirationMinutes"`
+	JWTSecret            string     `yaml:"jwtSecret"`
+	JWTExpirationMinutes int        `yaml:"jwtExpirationMinutes"`
+	Users                []AuthUser `yaml:"users"`
+}
+
+// AuthUser is an account allowed to log in via /api/v1/auth/login
+type AuthUser struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// AlertingConfig holds alert rule evaluation configuration
+type AlertingConfig struct {
+	// EvaluationIntervalSeconds controls how often enabled rules are evaluated (0 disables, default 60)
+	EvaluationIntervalSeconds int `yaml:"evaluationIntervalSeconds"`
+	// QueryTimeoutSeconds bounds a single rule query (default 30)
+	QueryTimeoutSeconds int `yaml:"queryTimeoutSeconds"`
+}
+
+// QueryConfig holds the row limits shared by the logs and explore endpoints,
+// the limits of explore query batches and live queries, the default explore
+// database and the ClickHouse settings requests may override
+type QueryConfig struct {
+	// DefaultLimit is the number of rows returned when a request sets no limit (default 100)
+	DefaultLimit int `yaml:"defaultLimit"`
+	// MaxLimit is the largest limit a request may set (default 10000)
+	MaxLimit int `yaml:"maxLimit"`
+	// RejectOverMaxLimit answers a limit above MaxLimit with 400 instead of
+	// lowering it to MaxLimit (default false)
+	RejectOverMaxLimit bool `yaml:"rejectOverMaxLimit"`
+	// MaxBatchQueries is the number of queries a batch may hold (default 20)
+	MaxBatchQueries int `yaml:"maxBatchQueries"`
+	// BatchConcurrency is the number of queries of a batch run at once (default 4)
+	BatchConcurrency int `yaml:"batchConcurrency"`
+	// BatchTimeoutSeconds stops the queries of a batch still running after
+	// this long (default 60)
+	BatchTimeoutSeconds int `yaml:"batchTimeoutSeconds"`
+	// DefaultDatabase is the database of explore requests and routes that name
+	// none; empty uses clickhouse.database (default empty)
+	DefaultDatabase string `yaml:"defaultDatabase"`
+	// LiveIntervalSeconds is how often a live query over /explore/ws runs when
+	// the client sets no interval (default 5)
+	LiveIntervalSeconds int `yaml:"liveIntervalSeconds"`
+	// LiveMinIntervalSeconds is the shortest interval a live query may ask for (default 1)
+	LiveMinIntervalSeconds int `yaml:"liveMinIntervalSeconds"`
+	// AllowedSettings lists the ClickHouse settings explore and raw SQL
+	// requests may set for their own query (default: memory, thread, cache
+	// and spilling settings)
+	AllowedSettings []string `yaml:"allowedSettings"`
+	// RawSQLLimitPolicy decides what happens to a raw SQL query without a
+	// LIMIT: "limit" caps it at RawSQLDefaultLimit rows (default), "reject"
+	// refuses it and "off" runs it as it is. Under the first two, a query
+	// with its own LIMIT is capped at MaxLimit rows.
+	RawSQLLimitPolicy string `yaml:"rawSQLLimitPolicy"`
+	// RawSQLDefaultLimit is the number of rows a raw SQL query without a LIMIT
+	// returns under the "limit" policy, at most MaxLimit (default 1000)
+	RawSQLDefaultLimit int `yaml:"rawSQLDefaultLimit"`
+}
+
+// Policies of query.rawSQLLimitPolicy
+const (
+	RawSQLLimitAuto   = "limit"
+	RawSQLLimitReject = "reject"
+	RawSQLLimitOff    = "off"
+)
+
+// HistoryConfig holds query history retention configuration
+type HistoryConfig struct {
+	// RetentionDays deletes entries older than this many days (0 disables, default 30)
+	RetentionDays int `yaml:"retentionDays"`
+	// MaxRows keeps at most this many of the newest entries (0 disables, default 100000)
+	MaxRows int `yaml:"maxRows"`
+	// CleanupIntervalMinutes controls how often retention is enforced (default 60)
+	CleanupIntervalMinutes int `yaml:"cleanupIntervalMinutes"`
 }
 
 // Load reads the configuration from a file
@@ -64,17 +221,65 @@ func Load(path string) (*Config, error) {
 	// Set default configuration
 	config := &Config{
 		Server: ServerConfig{
-			Port:                  8080,
-			Host:                  "localhost",
-			ReadTimeoutSeconds:    30,
-			WriteTimeoutSeconds:   30,
-			IdleTimeoutSeconds:    60,
-			ShutdownTimeoutSeconds: 30,
+			Port:                     8080,
+			Host:                     "localhost",
+			ReadTimeoutSeconds:       30,
+			WriteTimeoutSeconds:      30,
+			IdleTimeoutSeconds:       60,
+			ReadHeaderTimeoutSeconds: 10,
+			MaxHeaderBytes:           1 << 20,
+			ShutdownTimeoutSeconds:   30,
+			MaxRequestBodyBytes:      1 << 20,
+			RateLimitPerMinute:       600,
+			CORSAllowedOrigins:       []string{"*"},
+			Compression:              true,
+			CompressionMinBytes:      1024,
+		},
+		ClickHouse: ClickHouseConfig{
+			MaxIngestBatchSize:       1000,
+			MaxConcurrentQueries:     20,
+			QueryQueueTimeoutSeconds: 5,
+			MaxRetries:               1,
+			RetryBackoffMs:           500,
+			MaxOpenConns:             10,
+			MaxIdleConns:             5,
+			ConnMaxLifetimeMinutes:   60,
+			DialTimeoutSeconds:       10,
+			ReadTimeoutSeconds:       300,
+			QueryTimeoutSeconds:      30,
+			MaxQueryTimeoutSeconds:   300,
+			ReadOnlyQueries:          true,
+			MaxResultRows:            100000,
+			MetadataCacheTTLSeconds:  60,
+		},
+		Query: QueryConfig{
+			DefaultLimit:           100,
+			MaxLimit:               10000,
+			MaxBatchQueries:        20,
+			BatchConcurrency:       4,
+			BatchTimeoutSeconds:    60,
+			LiveIntervalSeconds:    5,
+			LiveMinIntervalSeconds: 1,
+			AllowedSettings:        slices.Clone(defaultAllowedSettings),
+			RawSQLLimitPolicy:      RawSQLLimitAuto,
+			RawSQLDefaultLimit:     1000,
 		},
 		Logging: LoggingConfig{
 			Level:  "info",
 			Format: "text",
 		},
+		Auth: AuthConfig{
+			JWTExpirationMinutes: 60,
+		},
+		History: HistoryConfig{
+			RetentionDays:          30,
+			MaxRows:                100000,
+			CleanupIntervalMinutes: 60,
+		},
+		Alerting: AlertingConfig{
+			EvaluationIntervalSeconds: 60,
+			QueryTimeoutSeconds:       30,
+		},
 	}
 
 	// Read configuration file
@@ -88,5 +293,232 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("error parsing config file: %w", err)
 	}
 
+	if err := config.ClickHouse.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
 	return config, nil
 }
+
+// Recognized values of logging.level and logging.format
+var (
+	validLogLevels  = []string{"debug", "info", "warn", "error"}
+	validLogFormats = []string{"text", "json"}
+	// validRawSQLLimitPolicies are the values of query.rawSQLLimitPolicy
+	validRawSQLLimitPolicies = []string{RawSQLLimitAuto, RawSQLLimitReject, RawSQLLimitOff}
+)
+
+// defaultAllowedSettings are the ClickHouse settings requests may override
+// unless query.allowedSettings says otherwise: resource limits and tuning a
+// heavy query may need, none of which can write data or lift the read-only mode
+var defaultAllowedSettings = []string{
+	"max_memory_usage",
+	"max_threads",
+	"max_block_size",
+	"max_bytes_before_external_group_by",
+	"max_bytes_before_external_sort",
+	"use_uncompressed_cache",
+	"optimize_read_in_order",
+	"join_algorithm",
+}
+
+// protectedSettings can never be overridden by a request, as they keep
+// queries read-only
+var protectedSettings = []string{"readonly", "allow_ddl"}
+
+// Validate reports every setting that can not work, naming each offending
+// field by its YAML path
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(field string, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s %s", field, fmt.Sprintf(format, args...)))
+	}
+	nonNegative := func(field string, value int) {
+		if value < 0 {
+			invalid(field, "must not be negative, got %d", value)
+		}
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		invalid("server.port", "must be between 1 and 65535, got %d", c.Server.Port)
+	}
+	nonNegative("server.readTimeoutSeconds", c.Server.ReadTimeoutSeconds)
+	nonNegative("server.writeTimeoutSeconds", c.Server.WriteTimeoutSeconds)
+	nonNegative("server.idleTimeoutSeconds", c.Server.IdleTimeoutSeconds)
+	nonNegative("server.readHeaderTimeoutSeconds", c.Server.ReadHeaderTimeoutSeconds)
+	if c.Server.MaxHeaderBytes <= 0 {
+		invalid("server.maxHeaderBytes", "must be positive, got %d", c.Server.MaxHeaderBytes)
+	}
+	nonNegative("server.shutdownTimeoutSeconds", c.Server.ShutdownTimeoutSeconds)
+	if c.Server.MaxRequestBodyBytes <= 0 {
+		invalid("server.maxRequestBodyBytes", "must be positive, got %d", c.Server.MaxRequestBodyBytes)
+	}
+	nonNegative("server.rateLimitPerMinute", c.Server.RateLimitPerMinute)
+	for i, origin := range c.Server.CORSAllowedOrigins {
+		if strings.TrimSpace(origin) == "" {
+			invalid(fmt.Sprintf("server.corsAllowedOrigins[%d]", i), "must not be empty")
+		}
+	}
+	nonNegative("server.compressionMinBytes", c.Server.CompressionMinBytes)
+	if prefix := c.Server.RoutePrefix(); prefix != "" {
+		if !strings.HasPrefix(prefix, "/") {
+			invalid("server.basePath", "must start with /, got %q", c.Server.BasePath)
+		} else if strings.Contains(prefix, "//") || strings.ContainsAny(prefix, "*{}?#") {
+			invalid("server.basePath", "must be a plain path such as /observio, got %q", c.Server.BasePath)
+		}
+	}
+
+	if c.ClickHouse.Port < 1 || c.ClickHouse.Port > 65535 {
+		invalid("clickhouse.port", "must be between 1 and 65535, got %d", c.ClickHouse.Port)
+	}
+	if !c.ClickHouse.IsHTTP() && c.ClickHouse.Protocol != "" && !strings.EqualFold(c.ClickHouse.Protocol, "native") {
+		invalid("clickhouse.protocol", "must be native or http, got %q", c.ClickHouse.Protocol)
+	}
+	if (c.ClickHouse.TLSCAFile != "" || c.ClickHouse.TLSSkipVerify) && !c.ClickHouse.Secure {
+		invalid("clickhouse.secure", "must be true when clickhouse.tlsCaFile or clickhouse.tlsSkipVerify is set")
+	}
+	nonNegative("clickhouse.maxConcurrentQueries", c.ClickHouse.MaxConcurrentQueries)
+	nonNegative("clickhouse.maxConcurrentQueriesPerUser", c.ClickHouse.MaxConcurrentQueriesPerUser)
+	nonNegative("clickhouse.queryQueueTimeoutSeconds", c.ClickHouse.QueryQueueTimeoutSeconds)
+	nonNegative("clickhouse.maxRetries", c.ClickHouse.MaxRetries)
+	nonNegative("clickhouse.retryBackoffMs", c.ClickHouse.RetryBackoffMs)
+	if c.ClickHouse.MaxOpenConns < 1 {
+		invalid("clickhouse.maxOpenConns", "must be positive, got %d", c.ClickHouse.MaxOpenConns)
+	}
+	if c.ClickHouse.MaxIdleConns < 0 || c.ClickHouse.MaxIdleConns > c.ClickHouse.MaxOpenConns {
+		invalid("clickhouse.maxIdleConns", "must be between 0 and clickhouse.maxOpenConns (%d), got %d", c.ClickHouse.MaxOpenConns, c.ClickHouse.MaxIdleConns)
+	}
+	nonNegative("clickhouse.connMaxLifetimeMinutes", c.ClickHouse.ConnMaxLifetimeMinutes)
+	nonNegative("clickhouse.dialTimeoutSeconds", c.ClickHouse.DialTimeoutSeconds)
+	nonNegative("clickhouse.readTimeoutSeconds", c.ClickHouse.ReadTimeoutSeconds)
+	nonNegative("clickhouse.maxQueryTimeoutSeconds", c.ClickHouse.MaxQueryTimeoutSeconds)
+	nonNegative("clickhouse.maxResultRows", c.ClickHouse.MaxResultRows)
+	nonNegative("clickhouse.metadataCacheTTLSeconds", c.ClickHouse.MetadataCacheTTLSeconds)
+	nonNegative("clickhouse.slowQueryThresholdMs", c.ClickHouse.SlowQueryThresholdMs)
+	if c.ClickHouse.QueryTimeoutSeconds < 0 || c.ClickHouse.QueryTimeoutSeconds > c.ClickHouse.MaxQueryTimeoutSeconds {
+		invalid("clickhouse.queryTimeoutSeconds", "must be between 0 and clickhouse.maxQueryTimeoutSeconds (%d), got %d", c.ClickHouse.MaxQueryTimeoutSeconds, c.ClickHouse.QueryTimeoutSeconds)
+	}
+
+	if c.Query.DefaultLimit < 1 {
+		invalid("query.defaultLimit", "must be at least 1, got %d", c.Query.DefaultLimit)
+	}
+	if c.Query.MaxLimit < c.Query.DefaultLimit {
+		invalid("query.maxLimit", "must be at least query.defaultLimit (%d), got %d", c.Query.DefaultLimit, c.Query.MaxLimit)
+	}
+	if c.Query.MaxBatchQueries < 1 {
+		invalid("query.maxBatchQueries", "must be positive, got %d", c.Query.MaxBatchQueries)
+	}
+	if c.Query.BatchConcurrency < 1 {
+		invalid("query.batchConcurrency", "must be positive, got %d", c.Query.BatchConcurrency)
+	}
+	if c.Query.BatchTimeoutSeconds < 1 {
+		invalid("query.batchTimeoutSeconds", "must be positive, got %d", c.Query.BatchTimeoutSeconds)
+	}
+	if c.Query.LiveMinIntervalSeconds < 1 {
+		invalid("query.liveMinIntervalSeconds", "must be positive, got %d", c.Query.LiveMinIntervalSeconds)
+	}
+	if c.Query.LiveIntervalSeconds < c.Query.LiveMinIntervalSeconds {
+		invalid("query.liveIntervalSeconds", "must be at least query.liveMinIntervalSeconds (%d), got %d", c.Query.LiveMinIntervalSeconds, c.Query.LiveIntervalSeconds)
+	}
+	for i, setting := range c.Query.AllowedSettings {
+		if slices.Contains(protectedSettings, setting) {
+			invalid(fmt.Sprintf("query.allowedSettings[%d]", i), "must not be %s, which keeps queries read-only", setting)
+		}
+	}
+	if !slices.Contains(validRawSQLLimitPolicies, c.Query.RawSQLLimitPolicy) {
+		invalid("query.rawSQLLimitPolicy", "must be one of %s, got %q", strings.Join(validRawSQLLimitPolicies, ", "), c.Query.RawSQLLimitPolicy)
+	}
+	if c.Query.RawSQLDefaultLimit < 1 || c.Query.RawSQLDefaultLimit > c.Query.MaxLimit {
+		invalid("query.rawSQLDefaultLimit", "must be between 1 and query.maxLimit (%d), got %d", c.Query.MaxLimit, c.Query.RawSQLDefaultLimit)
+	}
+
+	if !slices.Contains(validLogLevels, strings.ToLower(c.Logging.Level)) {
+		invalid("logging.level", "must be one of %s, got %q", strings.Join(validLogLevels, ", "), c.Logging.Level)
+	}
+	if !slices.Contains(validLogFormats, strings.ToLower(c.Logging.Format)) {
+		invalid("logging.format", "must be one of %s, got %q", strings.Join(validLogFormats, ", "), c.Logging.Format)
+	}
+
+	// Auth is enabled by setting a secret; accounts without one could never log in
+	if c.Auth.JWTSecret == "" && len(c.Auth.Users) > 0 {
+		invalid("auth.jwtSecret", "is required when auth.users are configured")
+	}
+	if c.Auth.JWTSecret != "" && c.Auth.JWTExpirationMinutes <= 0 {
+		invalid("auth.jwtExpirationMinutes", "must be positive when auth is enabled, got %d", c.Auth.JWTExpirationMinutes)
+	}
+
+	nonNegative("history.retentionDays", c.History.RetentionDays)
+	nonNegative("history.maxRows", c.History.MaxRows)
+	if c.History.CleanupIntervalMinutes <= 0 {
+		invalid("history.cleanupIntervalMinutes", "must be positive, got %d", c.History.CleanupIntervalMinutes)
+	}
+
+	nonNegative("alerting.evaluationIntervalSeconds", c.Alerting.EvaluationIntervalSeconds)
+	nonNegative("alerting.queryTimeoutSeconds", c.Alerting.QueryTimeoutSeconds)
+
+	return errors.Join(errs...)
+}
+
+// IsHTTP reports whether the ClickHouse HTTP interface is used instead of the native protocol
+func (c *ClickHouseConfig) IsHTTP() bool {
+	return strings.EqualFold(c.Protocol, "http")
+}
+
+// defaultPort returns ClickHouse's standard port for the configured protocol
+func (c *ClickHouseConfig) defaultPort() int {
+	switch {
+	case c.IsHTTP() && c.Secure:
+		return 8443
+	case c.IsHTTP():
+		return 8123
+	case c.Secure:
+		return 9440
+	default:
+		return 9000
+	}
+}
+
+// applyEnv fills connection fields the YAML left empty from the environment,
+// then falls back to a local development server
+func (c *ClickHouseConfig) applyEnv() error {
+	if c.Host == "" {
+		c.Host = os.Getenv("CLICKHOUSE_HOST")
+	}
+	if c.Port == 0 {
+		if port := os.Getenv("CLICKHOUSE_PORT"); port != "" {
+			parsed, err := strconv.Atoi(port)
+			if err != nil {
+				return fmt.Errorf("invalid CLICKHOUSE_PORT %q: %w", port, err)
+			}
+			c.Port = parsed
+		}
+	}
+	if c.Database == "" {
+		c.Database = os.Getenv("CLICKHOUSE_DATABASE")
+	}
+	if c.Username == "" {
+		c.Username = os.Getenv("CLICKHOUSE_USER")
+	}
+	if c.Password == "" {
+		c.Password = os.Getenv("CLICKHOUSE_PASSWORD")
+	}
+
+	if c.Host == "" {
+		c.Host = "localhost"
+	}
+	if c.Port == 0 {
+		c.Port = c.defaultPort()
+	}
+	if c.Database == "" {
+		c.Database = "default"
+	}
+	if c.Username == "" {
+		c.Username = "default"
+	}
+
+	return nil
+}
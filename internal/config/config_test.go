@@ -0,0 +1,141 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadDefaults loads a config file that only pins the ClickHouse address,
+// so every other setting keeps its default
+func loadDefaults(t *testing.T) *Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("clickhouse:\n  host: localhost\n  port: 9000\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		field  string // expected at the start of the error
+		modify func(c *Config)
+	}{
+		{"server.port", func(c *Config) { c.Server.Port = 0 }},
+		{"server.port", func(c *Config) { c.Server.Port = 65536 }},
+		{"server.readTimeoutSeconds", func(c *Config) { c.Server.ReadTimeoutSeconds = -1 }},
+		{"server.writeTimeoutSeconds", func(c *Config) { c.Server.WriteTimeoutSeconds = -1 }},
+		{"server.idleTimeoutSeconds", func(c *Config) { c.Server.IdleTimeoutSeconds = -1 }},
+		{"server.readHeaderTimeoutSeconds", func(c *Config) { c.Server.ReadHeaderTimeoutSeconds = -1 }},
+		{"server.maxHeaderBytes", func(c *Config) { c.Server.MaxHeaderBytes = 0 }},
+		{"server.shutdownTimeoutSeconds", func(c *Config) { c.Server.ShutdownTimeoutSeconds = -1 }},
+		{"server.maxRequestBodyBytes", func(c *Config) { c.Server.MaxRequestBodyBytes = 0 }},
+		{"server.rateLimitPerMinute", func(c *Config) { c.Server.RateLimitPerMinute = -1 }},
+		{"server.corsAllowedOrigins[1]", func(c *Config) { c.Server.CORSAllowedOrigins = []string{"*", " "} }},
+		{"server.compressionMinBytes", func(c *Config) { c.Server.CompressionMinBytes = -1 }},
+		{"server.basePath", func(c *Config) { c.Server.BasePath = "observio" }},
+		{"server.basePath", func(c *Config) { c.Server.BasePath = "/observio/*" }},
+		{"server.basePath", func(c *Config) { c.Server.BasePath = "/a//b" }},
+
+		{"clickhouse.port", func(c *Config) { c.ClickHouse.Port = 0 }},
+		{"clickhouse.port", func(c *Config) { c.ClickHouse.Port = 70000 }},
+		{"clickhouse.protocol", func(c *Config) { c.ClickHouse.Protocol = "grpc" }},
+		{"clickhouse.secure", func(c *Config) { c.ClickHouse.TLSCAFile = "/etc/ca.pem" }},
+		{"clickhouse.secure", func(c *Config) { c.ClickHouse.TLSSkipVerify = true }},
+		{"clickhouse.maxConcurrentQueries", func(c *Config) { c.ClickHouse.MaxConcurrentQueries = -1 }},
+		{"clickhouse.maxConcurrentQueriesPerUser", func(c *Config) { c.ClickHouse.MaxConcurrentQueriesPerUser = -1 }},
+		{"clickhouse.queryQueueTimeoutSeconds", func(c *Config) { c.ClickHouse.QueryQueueTimeoutSeconds = -1 }},
+		{"clickhouse.maxRetries", func(c *Config) { c.ClickHouse.MaxRetries = -1 }},
+		{"clickhouse.retryBackoffMs", func(c *Config) { c.ClickHouse.RetryBackoffMs = -1 }},
+		{"clickhouse.maxOpenConns", func(c *Config) { c.ClickHouse.MaxOpenConns = 0; c.ClickHouse.MaxIdleConns = 0 }},
+		{"clickhouse.maxIdleConns", func(c *Config) { c.ClickHouse.MaxIdleConns = -1 }},
+		{"clickhouse.maxIdleConns", func(c *Config) { c.ClickHouse.MaxIdleConns = c.ClickHouse.MaxOpenConns + 1 }},
+		{"clickhouse.connMaxLifetimeMinutes", func(c *Config) { c.ClickHouse.ConnMaxLifetimeMinutes = -1 }},
+		{"clickhouse.dialTimeoutSeconds", func(c *Config) { c.ClickHouse.DialTimeoutSeconds = -1 }},
+		{"clickhouse.readTimeoutSeconds", func(c *Config) { c.ClickHouse.ReadTimeoutSeconds = -1 }},
+		// A negative maximum also leaves no valid query timeout
+		{"clickhouse.maxQueryTimeoutSeconds", func(c *Config) { c.ClickHouse.MaxQueryTimeoutSeconds = -1; c.ClickHouse.QueryTimeoutSeconds = 0 }},
+		{"clickhouse.maxResultRows", func(c *Config) { c.ClickHouse.MaxResultRows = -1 }},
+		{"clickhouse.metadataCacheTTLSeconds", func(c *Config) { c.ClickHouse.MetadataCacheTTLSeconds = -1 }},
+		{"clickhouse.slowQueryThresholdMs", func(c *Config) { c.ClickHouse.SlowQueryThresholdMs = -1 }},
+		{"clickhouse.queryTimeoutSeconds", func(c *Config) { c.ClickHouse.QueryTimeoutSeconds = -1 }},
+		{"clickhouse.queryTimeoutSeconds", func(c *Config) { c.ClickHouse.QueryTimeoutSeconds = c.ClickHouse.MaxQueryTimeoutSeconds + 1 }},
+
+		{"query.defaultLimit", func(c *Config) { c.Query.DefaultLimit = 0 }},
+		{"query.maxLimit", func(c *Config) { c.Query.MaxLimit = c.Query.DefaultLimit - 1 }},
+		{"query.maxBatchQueries", func(c *Config) { c.Query.MaxBatchQueries = 0 }},
+		{"query.batchConcurrency", func(c *Config) { c.Query.BatchConcurrency = 0 }},
+		{"query.batchTimeoutSeconds", func(c *Config) { c.Query.BatchTimeoutSeconds = 0 }},
+		{"query.liveMinIntervalSeconds", func(c *Config) { c.Query.LiveMinIntervalSeconds = 0; c.Query.LiveIntervalSeconds = 0 }},
+		{"query.liveIntervalSeconds", func(c *Config) { c.Query.LiveIntervalSeconds = c.Query.LiveMinIntervalSeconds - 1 }},
+		{"query.allowedSettings[1]", func(c *Config) { c.Query.AllowedSettings = []string{"max_threads", "readonly"} }},
+		{"query.allowedSettings[0]", func(c *Config) { c.Query.AllowedSettings = []string{"allow_ddl"} }},
+		{"query.rawSQLLimitPolicy", func(c *Config) { c.Query.RawSQLLimitPolicy = "sometimes" }},
+		{"query.rawSQLDefaultLimit", func(c *Config) { c.Query.RawSQLDefaultLimit = 0 }},
+		{"query.rawSQLDefaultLimit", func(c *Config) { c.Query.RawSQLDefaultLimit = c.Query.MaxLimit + 1 }},
+
+		{"logging.level", func(c *Config) { c.Logging.Level = "verbose" }},
+		{"logging.format", func(c *Config) { c.Logging.Format = "xml" }},
+
+		{"auth.jwtSecret", func(c *Config) { c.Auth.Users = []AuthUser{{Username: "admin"}} }},
+		{"auth.jwtExpirationMinutes", func(c *Config) { c.Auth.JWTSecret = "secret"; c.Auth.JWTExpirationMinutes = 0 }},
+
+		{"history.retentionDays", func(c *Config) { c.History.RetentionDays = -1 }},
+		{"history.maxRows", func(c *Config) { c.History.MaxRows = -1 }},
+		{"history.cleanupIntervalMinutes", func(c *Config) { c.History.CleanupIntervalMinutes = 0 }},
+
+		{"alerting.evaluationIntervalSeconds", func(c *Config) { c.Alerting.EvaluationIntervalSeconds = -1 }},
+		{"alerting.queryTimeoutSeconds", func(c *Config) { c.Alerting.QueryTimeoutSeconds = -1 }},
+	}
+	for _, tt := range tests {
+		cfg := loadDefaults(t)
+		tt.modify(cfg)
+		err := cfg.Validate()
+		if err == nil {
+			t.Errorf("%s: Validate accepted an invalid value", tt.field)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), tt.field+" ") {
+			t.Errorf("%s: Validate() = %q, want it to name the field first", tt.field, err)
+		}
+	}
+}
+
+func TestValidateAcceptsDefaults(t *testing.T) {
+	cfg := loadDefaults(t)
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate rejected the defaults: %v", err)
+	}
+
+	cfg.ClickHouse.Protocol = "HTTP"
+	cfg.ClickHouse.Secure = true
+	cfg.ClickHouse.TLSSkipVerify = true
+	cfg.Server.BasePath = "/observio/"
+	cfg.Logging.Level = "DEBUG"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate rejected valid settings: %v", err)
+	}
+}
+
+func TestValidateReportsEveryError(t *testing.T) {
+	cfg := loadDefaults(t)
+	cfg.Server.Port = 0
+	cfg.Query.DefaultLimit = 0
+	cfg.Logging.Format = "xml"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate accepted an invalid config")
+	}
+	for _, field := range []string{"server.port", "query.defaultLimit", "logging.format"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("Validate() = %q, want it to name %s", err, field)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Live holds the active configuration. Readers get the whole configuration
+// as of one moment from Get, so a reload never shows them a mix of old and
+// new settings; a *Config returned by Get must not be modified.
+type Live struct {
+	current atomic.Pointer[Config]
+
+	mu        sync.Mutex
+	listeners []func(*Config)
+}
+
+// NewLive makes cfg the active configuration
+func NewLive(cfg *Config) *Live {
+	l := &Live{}
+	l.current.Store(cfg)
+	return l
+}
+
+// Get returns the active configuration
+func (l *Live) Get() *Config {
+	return l.current.Load()
+}
+
+// Set makes cfg the active configuration and then calls every OnChange func with it
+func (l *Live) Set(cfg *Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.current.Store(cfg)
+	for _, fn := range l.listeners {
+		fn(cfg)
+	}
+}
+
+// OnChange registers fn to be called with the new configuration after each
+// Set, for settings that are copied into long-lived objects at startup
+func (l *Live) OnChange(fn func(*Config)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.listeners = append(l.listeners, fn)
+}
+
+// reloadable lists the YAML paths of the settings that take effect without a
+// restart; everything else, such as the listen address or the ClickHouse
+// connection, is read once at startup
+var reloadable = []string{
+	"server.rateLimitPerMinute",
+	"server.corsAllowedOrigins",
+	"clickhouse.queryTimeoutSeconds",
+	"clickhouse.maxQueryTimeoutSeconds",
+	"clickhouse.maxResultRows",
+	"query.defaultLimit",
+	"query.maxLimit",
+	"query.rejectOverMaxLimit",
+	"query.maxBatchQueries",
+	"query.batchConcurrency",
+	"query.batchTimeoutSeconds",
+	"query.defaultDatabase",
+	"query.liveIntervalSeconds",
+	"query.liveMinIntervalSeconds",
+	"query.allowedSettings",
+	"query.rawSQLLimitPolicy",
+	"query.rawSQLDefaultLimit",
+	"logging.level",
+	"logging.format",
+}
+
+// Reloaded returns a copy of c with the reloadable settings taken from next
+func (c *Config) Reloaded(next *Config) *Config {
+	reloaded := *c
+	reloaded.Server.RateLimitPerMinute = next.Server.RateLimitPerMinute
+	reloaded.Server.CORSAllowedOrigins = next.Server.CORSAllowedOrigins
+	reloaded.ClickHouse.QueryTimeoutSeconds = next.ClickHouse.QueryTimeoutSeconds
+	reloaded.ClickHouse.MaxQueryTimeoutSeconds = next.ClickHouse.MaxQueryTimeoutSeconds
+	reloaded.ClickHouse.MaxResultRows = next.ClickHouse.MaxResultRows
+	reloaded.Query = next.Query
+	reloaded.Logging.Level = next.Logging.Level
+	reloaded.Logging.Format = next.Logging.Format
+	return &reloaded
+}
+
+// IsReloadable reports whether the setting at a YAML path returned by Changes
+// takes effect without a restart
+func IsReloadable(path string) bool {
+	return slices.Contains(reloadable, path)
+}
+
+// Changes returns the YAML paths of the settings that differ between c and
+// other, e.g. "logging.level". Values are left out since some are secrets.
+func (c *Config) Changes(other *Config) []string {
+	var changes []string
+	diffFields(reflect.ValueOf(*c), reflect.ValueOf(*other), "", &changes)
+	return changes
+}
+
+// diffFields appends the paths of the fields that differ between two structs
+// of the same type, descending into nested structs
+func diffFields(a, b reflect.Value, prefix string, changes *[]string) {
+	for i := 0; i < a.NumField(); i++ {
+		field := a.Type().Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		path := prefix + name
+
+		if field.Type.Kind() == reflect.Struct {
+			diffFields(a.Field(i), b.Field(i), path+".", changes)
+			continue
+		}
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			*changes = append(*changes, path)
+		}
+	}
+}
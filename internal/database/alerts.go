@@ -0,0 +1,201 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrAlertRuleNotFound is returned when no live alert rule has the requested ID
+var ErrAlertRuleNotFound = errors.New("alert rule not found")
+
+// States an alert rule can resolve to when its query returns no rows
+const (
+	NoDataStateOK       = "ok"
+	NoDataStateAlerting = "alerting"
+	NoDataStateNoData   = "no_data"
+)
+
+// Operators compare a rule's query result with its threshold; severities grade its alerts
+var (
+	AlertOperators  = []string{">", "<", "==", "!=", ">=", "<="}
+	AlertSeverities = []string{"critical", "warning", "info"}
+	noDataStates    = []string{NoDataStateOK, NoDataStateAlerting, NoDataStateNoData}
+)
+
+// AlertRule represents a rule for generating alerts
+type AlertRule struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Query       string            `json:"query"`
+	Threshold   float64           `json:"threshold"`
+	Operator    string            `json:"operator"`    // >, <, ==, !=, >=, <=
+	Severity    string            `json:"severity"`    // critical, warning, info
+	NoDataState string            `json:"noDataState"` // ok, alerting, no_data
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	Enabled     bool              `json:"enabled"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
+}
+
+// Validate checks the fields the evaluator relies on: a known operator,
+// severity and no-data state, and a finite threshold
+func (r AlertRule) Validate() error {
+	if !slices.Contains(AlertOperators, r.Operator) {
+		return fmt.Errorf("invalid operator %q (must be one of %s)", r.Operator, strings.Join(AlertOperators, " "))
+	}
+	if !slices.Contains(AlertSeverities, r.Severity) {
+		return fmt.Errorf("invalid severity %q (must be one of %s)", r.Severity, strings.Join(AlertSeverities, ", "))
+	}
+	if math.IsNaN(r.Threshold) || math.IsInf(r.Threshold, 0) {
+		return fmt.Errorf("invalid threshold %v (must be a finite number)", r.Threshold)
+	}
+	if !slices.Contains(noDataStates, r.NoDataState) {
+		return fmt.Errorf("invalid noDataState %q (must be one of %s)", r.NoDataState, strings.Join(noDataStates, ", "))
+	}
+	return nil
+}
+
+// alertRuleColumns is the column list shared by the alert rule queries
+const alertRuleColumns = `id, name, description, query, threshold, operator, severity, no_data_state, labels, annotations, enabled, created_at, updated_at`
+
+// ListAlertRules retrieves all alert rules that have not been deleted
+func (c *ClickHouseClient) ListAlertRules(ctx context.Context) ([]AlertRule, error) {
+	query := `SELECT ` + alertRuleColumns + ` FROM alert_rules FINAL WHERE deleted = 0 ORDER BY created_at`
+
+	rows, err := c.query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alert rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []AlertRule{}
+	for rows.Next() {
+		rule, err := scanAlertRule(rows)
+		if err != nil {
+			c.logger.Error("error scanning alert rule row", "error", err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating alert rule rows: %w", err)
+	}
+
+	return rules, nil
+}
+
+// GetAlertRule retrieves a single alert rule by ID
+func (c *ClickHouseClient) GetAlertRule(ctx context.Context, id string) (*AlertRule, error) {
+	query := `SELECT ` + alertRuleColumns + ` FROM alert_rules FINAL WHERE id = ? AND deleted = 0 LIMIT 1`
+
+	rows, err := c.query(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alert rule %s: %w", id, err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error iterating alert rule rows: %w", err)
+		}
+		return nil, ErrAlertRuleNotFound
+	}
+
+	rule, err := scanAlertRule(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan alert rule %s: %w", id, err)
+	}
+
+	return &rule, nil
+}
+
+// SaveAlertRule inserts a new version of an alert rule; the latest write wins
+func (c *ClickHouseClient) SaveAlertRule(ctx context.Context, rule AlertRule) error {
+	if err := c.insertAlertRule(ctx, rule, false); err != nil {
+		return fmt.Errorf("failed to store alert rule %s: %w", rule.ID, err)
+	}
+	return nil
+}
+
+// DeleteAlertRule hides an alert rule by writing a newer, deleted version of it
+func (c *ClickHouseClient) DeleteAlertRule(ctx context.Context, id string) error {
+	rule, err := c.GetAlertRule(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	rule.UpdatedAt = time.Now().UTC()
+	if err := c.insertAlertRule(ctx, *rule, true); err != nil {
+		return fmt.Errorf("failed to delete alert rule %s: %w", id, err)
+	}
+	return nil
+}
+
+// insertAlertRule writes a single row to alert_rules
+func (c *ClickHouseClient) insertAlertRule(ctx context.Context, rule AlertRule, deleted bool) error {
+	labels := rule.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	annotations := rule.Annotations
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	var deletedFlag uint8
+	if deleted {
+		deletedFlag = 1
+	}
+
+	query := `INSERT INTO alert_rules (` + alertRuleColumns + `, deleted) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	return c.exec(ctx, query,
+		rule.ID,
+		rule.Name,
+		rule.Description,
+		rule.Query,
+		rule.Threshold,
+		rule.Operator,
+		rule.Severity,
+		rule.NoDataState,
+		labels,
+		annotations,
+		rule.Enabled,
+		rule.CreatedAt,
+		rule.UpdatedAt,
+		deletedFlag,
+	)
+}
+
+// rowScanner is implemented by both driver.Rows and driver.Row
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanAlertRule scans a row selected with alertRuleColumns
+func scanAlertRule(row rowScanner) (AlertRule, error) {
+	var rule AlertRule
+	err := row.Scan(
+		&rule.ID,
+		&rule.Name,
+		&rule.Description,
+		&rule.Query,
+		&rule.Threshold,
+		&rule.Operator,
+		&rule.Severity,
+		&rule.NoDataState,
+		&rule.Labels,
+		&rule.Annotations,
+		&rule.Enabled,
+		&rule.CreatedAt,
+		&rule.UpdatedAt,
+	)
+	return rule, err
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ColumnCardinality is the approximate number of distinct values of a column
+// among the sampled rows of its table
+type ColumnCardinality struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	BaseType string `json:"baseType"`
+	// Distinct is null for a skipped column
+	Distinct *uint64 `json:"distinct"`
+	// Skipped explains why the column was not counted, e.g. for maps
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// TableCardinality is the result of GetColumnCardinality
+type TableCardinality struct {
+	Columns []ColumnCardinality `json:"columns"`
+	// SampledRows is the number of rows the counts were computed over
+	SampledRows uint64 `json:"sampledRows"`
+	// TimeColumn restricted the sample to the window; empty when the table has
+	// no date or time column, in which case any rows were sampled
+	TimeColumn    string `json:"timeColumn,omitempty"`
+	WindowSeconds int64  `json:"windowSeconds,omitempty"`
+}
+
+// GetColumnCardinality estimates the number of distinct values of every column
+// of a table with uniqCombined, in a single query over at most sampleRows rows
+// of the last window, to tell cheap group-by columns from ones such as Body
+// that are nearly unique. The window applies to the table's time column: the
+// first date or time column of its sorting key, or else the first one. Maps
+// and other composite columns are skipped as too expensive to count.
+func (c *ClickHouseClient) GetColumnCardinality(ctx context.Context, database, table string, window time.Duration, sampleRows int) (*TableCardinality, error) {
+	if err := c.checkTableExists(ctx, database, table); err != nil {
+		return nil, err
+	}
+	columns, err := c.tableSchemaColumns(ctx, database, table)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &TableCardinality{Columns: make([]ColumnCardinality, 0, len(columns))}
+	var counted []int
+	for _, col := range columns {
+		baseType, _, _ := describeColumnType(col.Type)
+		entry := ColumnCardinality{Name: col.Name, Type: col.Type, BaseType: baseType}
+		switch {
+		case col.DefaultKind == "EPHEMERAL":
+			entry.Skipped = "ephemeral columns hold no data"
+		case baseType == BaseTypeMap || baseType == BaseTypeOther:
+			entry.Skipped = "composite columns are too expensive to count"
+		default:
+			counted = append(counted, len(result.Columns))
+		}
+		result.Columns = append(result.Columns, entry)
+	}
+	result.TimeColumn = cardinalityTimeColumn(columns)
+	if result.TimeColumn != "" {
+		result.WindowSeconds = int64(window / time.Second)
+	}
+	if len(counted) == 0 {
+		return result, nil
+	}
+
+	selected := make([]string, len(counted))
+	uniqs := make([]string, len(counted))
+	for i, index := range counted {
+		quoted := quoteIdentifier(result.Columns[index].Name)
+		selected[i] = quoted
+		uniqs[i] = "uniqCombined(" + quoted + ")"
+	}
+	sample := fmt.Sprintf("SELECT %s FROM %s.%s", strings.Join(selected, ", "), quoteIdentifier(database), quoteIdentifier(table))
+	var args []interface{}
+	if result.TimeColumn != "" {
+		sample += fmt.Sprintf(" WHERE %s >= now() - toIntervalSecond(?)", quoteIdentifier(result.TimeColumn))
+		args = append(args, result.WindowSeconds)
+	}
+	sample += " LIMIT ?"
+	args = append(args, sampleRows)
+	query := fmt.Sprintf("SELECT count(), %s FROM (%s)", strings.Join(uniqs, ", "), sample)
+
+	distinct := make([]uint64, len(counted))
+	dest := make([]interface{}, 0, len(counted)+1)
+	dest = append(dest, &result.SampledRows)
+	for i := range distinct {
+		dest = append(dest, &distinct[i])
+	}
+	if err := c.queryRow(ctx, query, args...).Scan(dest...); err != nil {
+		return nil, fmt.Errorf("failed to estimate column cardinality of %s.%s: %w", database, table, err)
+	}
+	for i, index := range counted {
+		result.Columns[index].Distinct = &distinct[i]
+	}
+	return result, nil
+}
+
+// cardinalityTimeColumn picks the column a cardinality sample is windowed on:
+// the first date or time column of the sorting key, or else the first one
+func cardinalityTimeColumn(columns []TableSchemaColumn) string {
+	first := ""
+	for _, col := range columns {
+		baseType, _, array := describeColumnType(col.Type)
+		if array || (baseType != BaseTypeDateTime && baseType != BaseTypeDate) || col.DefaultKind == "EPHEMERAL" {
+			continue
+		}
+		if col.InSortingKey {
+			return col.Name
+		}
+		if first == "" {
+			first = col.Name
+		}
+	}
+	return first
+}
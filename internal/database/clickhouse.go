@@ -4,20 +4,86 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/observio/backend/internal/logging"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
 )
 
+
 type ClickHouseClient struct {
 	conn   clickhouse.Conn
-	logger *log.Logger
+	logger logging.Logger
+
+	// querySlots bounds the number of in-flight queries; nil means unbounded
+	querySlots   chan struct{}
+	queueTimeout time.Duration
+
+	// userSlots bounds the in-flight queries of each authenticated user,
+	// holding one channel of maxUserQueries slots per user
+	maxUserQueries int
+	userSlotsMu    sync.Mutex
+	userSlots      map[string]chan struct{}
+
+	// maxRetries and retryBackoff control reconnect attempts after connection errors
+	maxRetries   int
+	retryBackoff time.Duration
+
+	// readOnlyQueries runs explore and raw SQL queries in ClickHouse's readonly mode
+	readOnlyQueries bool
+
+	// slowQueryThreshold logs queries running at least this long; 0 disables it
+	slowQueryThreshold time.Duration
+}
+
+// ClientOptions tunes how the client uses the ClickHouse server
+type ClientOptions struct {
+	// MaxConcurrentQueries bounds in-flight queries; 0 disables the limit
+	MaxConcurrentQueries int
+	// MaxConcurrentQueriesPerUser bounds the in-flight queries of a single
+	// authenticated user; 0 disables the limit
+	MaxConcurrentQueriesPerUser int
+	// QueueTimeout is how long a query waits for a free slot before ErrTooManyQueries
+	QueueTimeout time.Duration
+	// MaxRetries is how many times a query (or the startup ping) is retried after
+	// a connection error; 0 disables retries
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry, doubling on each attempt
+	RetryBackoff time.Duration
+	// MaxOpenConns caps the connections in the pool
+	MaxOpenConns int
+	// MaxIdleConns is how many unused connections the pool keeps open
+	MaxIdleConns int
+	// ConnMaxLifetime closes and replaces connections older than this
+	ConnMaxLifetime time.Duration
+	// DialTimeout bounds opening a new connection
+	DialTimeout time.Duration
+	// ReadTimeout bounds waiting for the server while a query runs, so a stalled
+	// query can not hold a pooled connection forever
+	ReadTimeout time.Duration
+	// HTTP connects through the HTTP interface instead of the native protocol
+	HTTP bool
+	// Secure connects over TLS; CAFile replaces the system CAs and
+	// InsecureSkipVerify disables certificate verification
+	Secure             bool
+	CAFile             string
+	InsecureSkipVerify bool
+	// ReadOnlyQueries has ClickHouse reject writes and DDL in explore and raw
+	// SQL queries through the readonly and allow_ddl settings
+	ReadOnlyQueries bool
+	// SlowQueryThreshold logs every query running at least this long at warn
+	// level, with its SQL and elapsed time; 0 disables the slow query log
+	SlowQueryThreshold time.Duration
 }
 
 type LogEntry struct {
+	// LineId identifies the row by its timestamp and content, so the same row
+	// gets the same ID in every query; it can be decoded with ParseLogCursor
 	LineId      string `json:"lineId"`
+	// Timestamp is RFC3339 with nanoseconds, in UTC unless converted with InLocation
 	Timestamp   string `json:"timestamp"`
 	Level       string `json:"level"`
 	Component   string `json:"component"`
@@ -25,85 +91,146 @@ type LogEntry struct {
 	Content     string `json:"content"`
 	EventId     string `json:"eventId,omitempty"`
 	RawMessage  string `json:"rawMessage"`
+	// TraceId and SpanId are always serialized, empty when the entry has no trace
+	TraceId     string `json:"traceId"`
+	SpanId      string `json:"spanId"`
+
+	// at is the raw row timestamp, used to resume tailing
+	at time.Time
+	// cursorKey breaks timestamp ties for keyset pagination
+	cursorKey uint64
 }
 
-func NewClickHouseClient(host string, port int, username, password, database string, logger *log.Logger) (*ClickHouseClient, error) {
+func NewClickHouseClient(host string, port int, username, password, database string, opts ClientOptions, logger logging.Logger) (*ClickHouseClient, error) {
+	tlsConfig, err := opts.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	protocol := clickhouse.Native
+	if opts.HTTP {
+		protocol = clickhouse.HTTP
+	}
+
 	conn, err := clickhouse.Open(&clickhouse.Options{
-		Addr: []string{fmt.Sprintf("%s:%d", host, port)},
+		Addr:     []string{fmt.Sprintf("%s:%d", host, port)},
+		Protocol: protocol,
+		TLS:      tlsConfig,
 		Auth: clickhouse.Auth{
 			Database: database,
 			Username: username,
 			Password: password,
 		},
+		MaxOpenConns:    opts.MaxOpenConns,
+		MaxIdleConns:    opts.MaxIdleConns,
+		ConnMaxLifetime: opts.ConnMaxLifetime,
+		DialTimeout:     opts.DialTimeout,
+		ReadTimeout:     opts.ReadTimeout,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to ClickHouse: %w", err)
 	}
 
-	if err := conn.Ping(context.Background()); err != nil {
-		return nil, fmt.Errorf("failed to ping ClickHouse: %w", err)
+	client := &ClickHouseClient{
+		conn:         conn,
+		logger:       logger,
+		queueTimeout: opts.QueueTimeout,
+		maxRetries:   opts.MaxRetries,
+		retryBackoff: opts.RetryBackoff,
+
+		readOnlyQueries:    opts.ReadOnlyQueries,
+		slowQueryThreshold: opts.SlowQueryThreshold,
+	}
+	if opts.MaxConcurrentQueries > 0 {
+		client.querySlots = make(chan struct{}, opts.MaxConcurrentQueries)
+	}
+	if opts.MaxConcurrentQueriesPerUser > 0 {
+		client.maxUserQueries = opts.MaxConcurrentQueriesPerUser
+		client.userSlots = make(map[string]chan struct{})
+	}
+
+	// Connections are opened lazily by the pool, so a server that is down at
+	// startup only delays the first successful query instead of failing it forever
+	ctx := context.Background()
+	if err := client.withRetry(ctx, func() error { return conn.Ping(ctx) }); err != nil {
+		logger.Warn("ClickHouse is not reachable yet, will reconnect on first use", "error", err)
 	}
 
-	return &ClickHouseClient{
-		conn:   conn,
-		logger: logger,
-	}, nil
+	return client, nil
+}
+
+// Ping checks that the ClickHouse server is reachable; it bypasses the query
+// limit so health checks keep working while the server is busy
+func (c *ClickHouseClient) Ping(ctx context.Context) error {
+	return c.conn.Ping(ctx)
 }
 
 func (c *ClickHouseClient) Close() error {
 	return c.conn.Close()
 }
 
-func (c *ClickHouseClient) GetLogs(ctx context.Context, limit, offset int, level, component, pattern string) ([]LogEntry, error) {
+// LogFilter narrows down the entries returned by GetLogs; zero values are ignored
+type LogFilter struct {
+	Level string
+	// MinSeverity keeps entries at or above this OTel severity number
+	MinSeverity int
+	Component   string
+	// Service keeps only entries whose component is exactly this, unlike the
+	// substring match of Component
+	Service     string
+	Pattern     string
+	TraceId     string
+	Start       *time.Time
+	End         *time.Time
+	// Before keeps only entries older than this cursor (keyset pagination)
+	Before *LogCursor
+	// Since keeps only entries newer than this cursor
+	Since *LogCursor
+	// At keeps only the entry at this cursor
+	At *LogCursor
+	// Ascending returns the oldest entries first instead of the newest
+	Ascending bool
+	Limit     int
+	Offset    int
+}
+
+func (c *ClickHouseClient) GetLogs(ctx context.Context, filter LogFilter) ([]LogEntry, error) {
+	where, args := buildLogsWhere(filter)
+	argIndex := len(args) + 1
+
 	query := `
 		SELECT 
-			toString(rowNumberInAllBlocks()) as line_id,
-			toString(Timestamp) as timestamp,
 			SeverityText as level,
 			ServiceName as component,
 			ResourceAttributes['process.pid'] as pid,
 			Body as content,
 			toString(cityHash64(Body)) as event_id,
-			Body as raw_message
+			Body as raw_message,
+			TraceId as trace_id,
+			SpanId as span_id,
+			Timestamp as ts,
+			` + logCursorKeyExpr + ` as cursor_key
 		FROM otel_logs 
-		WHERE 1=1
-	`
-	
-	args := []interface{}{}
-	argIndex := 1
+	` + where
 
-	if level != "" {
-		query += fmt.Sprintf(" AND lower(SeverityText) = lower($%d)", argIndex)
-		args = append(args, level)
-		argIndex++
-	}
-
-	if component != "" {
-		query += fmt.Sprintf(" AND lower(ServiceName) LIKE lower($%d)", argIndex)
-		args = append(args, "%"+component+"%")
-		argIndex++
-	}
-
-	if pattern != "" {
-		query += fmt.Sprintf(" AND lower(Body) LIKE lower($%d)", argIndex)
-		args = append(args, "%"+pattern+"%")
-		argIndex++
+	if filter.Ascending {
+		query += " ORDER BY Timestamp ASC, cursor_key ASC"
+	} else {
+		query += " ORDER BY Timestamp DESC, cursor_key DESC"
 	}
-
-	query += " ORDER BY Timestamp DESC"
 	
-	if limit > 0 {
+	if filter.Limit > 0 {
 		query += fmt.Sprintf(" LIMIT $%d", argIndex)
-		args = append(args, limit)
+		args = append(args, filter.Limit)
 		argIndex++
 	}
 
-	if offset > 0 {
+	if filter.Offset > 0 {
 		query += fmt.Sprintf(" OFFSET $%d", argIndex)
-		args = append(args, offset)
+		args = append(args, filter.Offset)
 	}
 
-	rows, err := c.conn.Query(ctx, query, args...)
+	rows, err := c.query(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query logs: %w", err)
 	}
@@ -115,23 +242,28 @@ func (c *ClickHouseClient) GetLogs(ctx context.Context, limit, offset int, level
 		var pid sql.NullString
 		
 		err := rows.Scan(
-			&log.LineId,
-			&log.Timestamp,
 			&log.Level,
 			&log.Component,
 			&pid,
 			&log.Content,
 			&log.EventId,
 			&log.RawMessage,
+			&log.TraceId,
+			&log.SpanId,
+			&log.at,
+			&log.cursorKey,
 		)
 		if err != nil {
-			c.logger.Printf("Error scanning row: %v", err)
+			c.logger.Error("error scanning row", "error", err)
 			continue
 		}
 
 		if pid.Valid {
 			log.PID = pid.String
 		}
+		log.at = log.at.UTC()
+		log.Timestamp = formatLogTime(log.at)
+		log.LineId = LogCursor{Timestamp: log.at, Key: log.cursorKey}.String()
 
 		logs = append(logs, log)
 	}
@@ -143,15 +275,264 @@ func (c *ClickHouseClient) GetLogs(ctx context.Context, limit, offset int, level
 	return logs, nil
 }
 
+// CountLogs returns the number of log entries matching the filter, ignoring
+// Limit, Offset and Before
+func (c *ClickHouseClient) CountLogs(ctx context.Context, filter LogFilter) (uint64, error) {
+	filter.Before = nil
+	where, args := buildLogsWhere(filter)
+
+	var total uint64
+	if err := c.queryRow(ctx, "SELECT count() FROM otel_logs "+where, args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("failed to count logs: %w", err)
+	}
+
+	return total, nil
+}
+
+// LogHistogramBucket is the number of log entries in one time bucket
+type LogHistogramBucket struct {
+	Bucket time.Time `json:"bucket"`
+	Count  int64     `json:"count"`
+}
+
+// GetLogHistogram counts the log entries matching filter in buckets of interval
+// between start and end. Buckets are aligned to the Unix epoch like
+// toStartOfInterval, and buckets without entries are returned with a zero count.
+func (c *ClickHouseClient) GetLogHistogram(ctx context.Context, start, end time.Time, interval time.Duration, filter LogFilter) ([]LogHistogramBucket, error) {
+	seconds := int64(interval / time.Second)
+	if seconds < 1 {
+		return nil, fmt.Errorf("histogram interval must be at least 1 second")
+	}
+
+	filter.Start = &start
+	filter.End = &end
+	filter.Before = nil
+	filter.Since = nil
+	where, args := buildLogsWhere(filter)
+
+	query := fmt.Sprintf(`
+		SELECT 
+			toStartOfInterval(Timestamp, INTERVAL %d SECOND) as bucket,
+			count() as count
+		FROM otel_logs 
+	`, seconds) + where + " GROUP BY bucket ORDER BY bucket"
+
+	rows, err := c.query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query log histogram: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[int64]int64)
+	for rows.Next() {
+		var bucket time.Time
+		var count uint64
+		if err := rows.Scan(&bucket, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan log histogram bucket: %w", err)
+		}
+		counts[bucket.Unix()] = int64(count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	first := start.Unix() - floorMod(start.Unix(), seconds)
+	buckets := make([]LogHistogramBucket, 0, (end.Unix()-first)/seconds+1)
+	for ts := first; ts <= end.Unix(); ts += seconds {
+		buckets = append(buckets, LogHistogramBucket{
+			Bucket: time.Unix(ts, 0).UTC(),
+			Count:  counts[ts],
+		})
+	}
+
+	return buckets, nil
+}
+
+// floorMod returns a mod b rounded towards negative infinity, so pre-epoch
+// times fall into the same buckets as toStartOfInterval
+func floorMod(a, b int64) int64 {
+	m := a % b
+	if m < 0 {
+		m += b
+	}
+	return m
+}
+
+// buildLogsWhere builds the WHERE clause shared by GetLogs and CountLogs, with
+// arguments numbered from $1
+func buildLogsWhere(filter LogFilter) (string, []interface{}) {
+	where := "WHERE 1=1"
+	args := []interface{}{}
+	argIndex := 1
+
+	if filter.Level != "" {
+		where += fmt.Sprintf(" AND lower(SeverityText) = lower($%d)", argIndex)
+		args = append(args, filter.Level)
+		argIndex++
+	}
+
+	if filter.MinSeverity > 0 {
+		// Rows without a SeverityNumber fall back to their normalized SeverityText
+		where += fmt.Sprintf(" AND (SeverityNumber >= $%d OR (SeverityNumber = 0 AND has($%d, lower(SeverityText))))", argIndex, argIndex+1)
+		args = append(args, filter.MinSeverity, severityTextsAtLeast(filter.MinSeverity))
+		argIndex += 2
+	}
+
+	if filter.Component != "" {
+		where += fmt.Sprintf(" AND lower(ServiceName) LIKE lower($%d)", argIndex)
+		args = append(args, "%"+filter.Component+"%")
+		argIndex++
+	}
+
+	if filter.Service != "" {
+		where += fmt.Sprintf(" AND ServiceName = $%d", argIndex)
+		args = append(args, filter.Service)
+		argIndex++
+	}
+
+	if filter.Pattern != "" {
+		where += fmt.Sprintf(" AND lower(Body) LIKE lower($%d)", argIndex)
+		args = append(args, "%"+filter.Pattern+"%")
+		argIndex++
+	}
+
+	if filter.TraceId != "" {
+		where += fmt.Sprintf(" AND TraceId = $%d", argIndex)
+		args = append(args, filter.TraceId)
+		argIndex++
+	}
+
+	switch {
+	case filter.Start != nil && filter.End != nil:
+		where += fmt.Sprintf(" AND Timestamp BETWEEN $%d AND $%d", argIndex, argIndex+1)
+		args = append(args, *filter.Start, *filter.End)
+		argIndex += 2
+	case filter.Start != nil:
+		where += fmt.Sprintf(" AND Timestamp >= $%d", argIndex)
+		args = append(args, *filter.Start)
+		argIndex++
+	case filter.End != nil:
+		where += fmt.Sprintf(" AND Timestamp <= $%d", argIndex)
+		args = append(args, *filter.End)
+		argIndex++
+	}
+
+	if filter.Before != nil {
+		// Bound as nanoseconds: time.Time arguments are sent with second precision
+		where += fmt.Sprintf(" AND (Timestamp, %s) < (fromUnixTimestamp64Nano($%d), $%d)", logCursorKeyExpr, argIndex, argIndex+1)
+		args = append(args, filter.Before.Timestamp.UnixNano(), filter.Before.Key)
+		argIndex += 2
+	}
+
+	if filter.Since != nil {
+		where += fmt.Sprintf(" AND (Timestamp, %s) > (fromUnixTimestamp64Nano($%d), $%d)", logCursorKeyExpr, argIndex, argIndex+1)
+		args = append(args, filter.Since.Timestamp.UnixNano(), filter.Since.Key)
+		argIndex += 2
+	}
+
+	if filter.At != nil {
+		where += fmt.Sprintf(" AND Timestamp = fromUnixTimestamp64Nano($%d) AND %s = $%d", argIndex, logCursorKeyExpr, argIndex+1)
+		args = append(args, filter.At.Timestamp.UnixNano(), filter.At.Key)
+	}
+
+	return where, args
+}
+
+// TailLogs returns up to filter.Limit entries after the cursor, oldest first,
+// along with the cursor to pass as after on the next call. Tailing on the
+// cursor rather than the timestamp neither repeats nor skips entries that
+// share the timestamp of the last one returned.
+func (c *ClickHouseClient) TailLogs(ctx context.Context, filter LogFilter, after LogCursor) ([]LogEntry, LogCursor, error) {
+	filter.Since = &after
+	filter.Before = nil
+	filter.Ascending = true
+	filter.Offset = 0
+
+	logs, err := c.GetLogs(ctx, filter)
+	if err != nil {
+		return nil, after, err
+	}
+
+	latest := after
+	if len(logs) > 0 {
+		latest = logs[len(logs)-1].Cursor()
+	}
+
+	return logs, latest, nil
+}
+
 func (c *ClickHouseClient) GetTop100Logs(ctx context.Context) ([]LogEntry, error) {
-	return c.GetLogs(ctx, 100, 0, "", "", "")
+	return c.GetLogs(ctx, LogFilter{Limit: 100})
+}
+
+// LogRecord represents a validated log row to be written to otel_logs
+type LogRecord struct {
+	Timestamp time.Time
+	Level     string
+	Component string
+	PID       string
+	Body      string
+	TraceId   string
+	SpanId    string
+}
+
+// InsertLogs writes a batch of log records to otel_logs in a single native batch insert
+func (c *ClickHouseClient) InsertLogs(ctx context.Context, records []LogRecord) (err error) {
+	if len(records) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO otel_logs (Timestamp, SeverityText, ServiceName, Body, ResourceAttributes, TraceId, SpanId)
+	`
+	ctx = withUserComment(ctx)
+	ctx, span := startQuerySpan(ctx, query)
+	span.SetAttributes(semconv.DBOperationBatchSize(len(records)))
+	defer func() { endQuerySpan(span, err) }()
+
+	release, err := c.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	batch, err := c.conn.PrepareBatch(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to prepare log batch: %w", err)
+	}
+	defer batch.Abort()
+
+	for _, record := range records {
+		resourceAttributes := map[string]string{}
+		if record.PID != "" {
+			resourceAttributes["process.pid"] = record.PID
+		}
+
+		if err := batch.Append(
+			record.Timestamp,
+			record.Level,
+			record.Component,
+			record.Body,
+			resourceAttributes,
+			record.TraceId,
+			record.SpanId,
+		); err != nil {
+			return fmt.Errorf("failed to append log record: %w", err)
+		}
+	}
+
+	if err := batch.Send(); err != nil {
+		return fmt.Errorf("failed to send log batch: %w", err)
+	}
+
+	return nil
 }
 
 // GetDatabases retrieves all databases from ClickHouse
 func (c *ClickHouseClient) GetDatabases(ctx context.Context) ([]string, error) {
 	query := `SELECT name FROM system.databases WHERE name NOT IN ('system', 'INFORMATION_SCHEMA', 'information_schema') ORDER BY name`
 	
-	rows, err := c.conn.Query(ctx, query)
+	rows, err := c.query(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query databases: %w", err)
 	}
@@ -161,7 +542,7 @@ func (c *ClickHouseClient) GetDatabases(ctx context.Context) ([]string, error) {
 	for rows.Next() {
 		var dbName string
 		if err := rows.Scan(&dbName); err != nil {
-			c.logger.Printf("Error scanning database row: %v", err)
+			c.logger.Error("error scanning database row", "error", err)
 			continue
 		}
 		databases = append(databases, dbName)
@@ -182,7 +563,7 @@ func (c *ClickHouseClient) GetTables(ctx context.Context, database string) ([]st
 
 	query := `SELECT name FROM system.tables WHERE database = ? ORDER BY name`
 	
-	rows, err := c.conn.Query(ctx, query, database)
+	rows, err := c.query(ctx, query, database)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query tables for database %s: %w", database, err)
 	}
@@ -192,7 +573,7 @@ func (c *ClickHouseClient) GetTables(ctx context.Context, database string) ([]st
 	for rows.Next() {
 		var tableName string
 		if err := rows.Scan(&tableName); err != nil {
-			c.logger.Printf("Error scanning table row: %v", err)
+			c.logger.Error("error scanning table row", "error", err)
 			continue
 		}
 		tables = append(tables, tableName)
@@ -207,11 +588,17 @@ func (c *ClickHouseClient) GetTables(ctx context.Context, database string) ([]st
 
 // TableField represents a column in a table
 type TableField struct {
-	Name string `json:"name"`
-	Type string `json:"type"`
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`     // raw ClickHouse type, for display
+	BaseType   string   `json:"baseType"` // e.g. "string", "int", "datetime", "enum"
+	Array      bool     `json:"array,omitempty"`
+	EnumValues []string `json:"enumValues,omitempty"`
+	// RenderHint suggests a formatter for the values, e.g. "bytes"; it is a
+	// best-effort guess from the name and type and omitted when none applies
+	RenderHint string `json:"renderHint,omitempty"`
 }
 
-// GetTableFields retrieves all fields from the specified table (excluding id fields)
+// GetTableFields retrieves all fields from the specified table
 func (c *ClickHouseClient) GetTableFields(ctx context.Context, database, table string) ([]TableField, error) {
 	if database == "" || table == "" {
 		return nil, fmt.Errorf("database and table names cannot be empty")
@@ -220,11 +607,11 @@ func (c *ClickHouseClient) GetTableFields(ctx context.Context, database, table s
 	query := `
 		SELECT name, type 
 		FROM system.columns 
-		WHERE database = ? AND table = ? AND lower(name) NOT LIKE '%id%'
+		WHERE database = ? AND table = ?
 		ORDER BY name
 	`
 	
-	rows, err := c.conn.Query(ctx, query, database, table)
+	rows, err := c.query(ctx, query, database, table)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query table fields for %s.%s: %w", database, table, err)
 	}
@@ -234,9 +621,11 @@ func (c *ClickHouseClient) GetTableFields(ctx context.Context, database, table s
 	for rows.Next() {
 		var field TableField
 		if err := rows.Scan(&field.Name, &field.Type); err != nil {
-			c.logger.Printf("Error scanning field row: %v", err)
+			c.logger.Error("error scanning field row", "error", err)
 			continue
 		}
+		field.BaseType, field.EnumValues, field.Array = describeColumnType(field.Type)
+		field.RenderHint = renderHintOf(field.Name, field.BaseType, field.Array)
 		fields = append(fields, field)
 	}
 
@@ -249,54 +638,108 @@ func (c *ClickHouseClient) GetTableFields(ctx context.Context, database, table s
 
 // ExploreRequest represents the request structure for explore queries
 type ExploreRequest struct {
-	Database  string   `json:"database"`
-	Table     string   `json:"table"`
-	Fields    []string `json:"fields"`
-	Aggregate string   `json:"aggregate,omitempty"`
-	GroupBy   []string `json:"groupBy,omitempty"`
-	OrderBy   string   `json:"orderBy,omitempty"`
-	OrderDir  string   `json:"orderDir,omitempty"`
-	FilterBy  string   `json:"filterBy,omitempty"`
-	FilterOp  string   `json:"filterOp,omitempty"`
-	FilterVal string   `json:"filterVal,omitempty"`
-	Limit     int      `json:"limit,omitempty"`
+	Database string   `json:"database"`
+	Table    string   `json:"table"`
+	Fields   []string `json:"fields"`
+	// Aliases renames selected fields in the result, keyed by field
+	Aliases    map[string]string `json:"aliases,omitempty"`
+	Aggregate  string            `json:"aggregate,omitempty"`
+	Aggregates []AggregateSpec   `json:"aggregates,omitempty"`
+	Joins      []JoinSpec        `json:"joins,omitempty"`
+	// JSONFields declares fields extracted from JSON text columns
+	JSONFields []JSONField `json:"jsonFields,omitempty"`
+	// MapFields declares fields reading one key of Map columns
+	MapFields []MapField `json:"mapFields,omitempty"`
+	// TimeoutSeconds stops the query once it has run this long; 0 means no limit
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+	// Settings are ClickHouse settings applied to this query only; the
+	// handlers only accept those listed in query.allowedSettings
+	Settings  map[string]interface{} `json:"settings,omitempty"`
+	GroupBy   []string               `json:"groupBy,omitempty"`
+	OrderBy   OrderByList            `json:"orderBy,omitempty"`
+	OrderDir  string                 `json:"orderDir,omitempty"`
+	FilterBy  string                 `json:"filterBy,omitempty"`
+	FilterOp  string                 `json:"filterOp,omitempty"`
+	FilterVal string                 `json:"filterVal,omitempty"`
+	// FilterVals holds the values of the in, notin and between filter operations
+	FilterVals []string `json:"filterVals,omitempty"`
+	// Filters is a tree of conditions combined with and/or, ANDed with filterBy
+	Filters *FilterNode `json:"filters,omitempty"`
+	Limit   int         `json:"limit,omitempty"`
+}
+
+// AggregateSpec describes one aggregate column of a multi-aggregate explore query
+type AggregateSpec struct {
+	Func  string `json:"func"`            // count, sum, avg, min, max
+	Field string `json:"field,omitempty"` // optional for count
+	Alias string `json:"alias,omitempty"` // defaults to func_field, or count
+}
+
+// ResultName returns the column name the aggregate is returned under
+func (a AggregateSpec) ResultName() string {
+	switch {
+	case a.Alias != "":
+		return a.Alias
+	case a.Field == "":
+		return a.Func
+	default:
+		return a.Func + "_" + a.Field
+	}
 }
 
 // ExploreResponse represents the response structure for explore queries
 type ExploreResponse struct {
-	Columns []string                 `json:"columns"`
-	Data    []map[string]interface{} `json:"data"`
-	Total   int                      `json:"total"`
+	Columns     []string                 `json:"columns"`
+	ColumnTypes []string                 `json:"columnTypes,omitempty"`
+	Data        []map[string]interface{} `json:"data"`
+	Total       int                      `json:"total"`
 }
 
-// ExecuteExploreQuery executes a dynamic explore query based on the request
-func (c *ClickHouseClient) ExecuteExploreQuery(ctx context.Context, req ExploreRequest) (*ExploreResponse, error) {
+// ColumnsFunc receives the result column names and ClickHouse types before any row is delivered
+type ColumnsFunc func(columns, columnTypes []string) error
+
+// RowFunc receives a single scanned row; returning an error stops the scan
+type RowFunc func(row map[string]interface{}) error
+
+// buildExploreQuery builds the SQL statement and bound arguments for an explore request
+func buildExploreQuery(req ExploreRequest) (string, []interface{}, error) {
 	if req.Database == "" || req.Table == "" {
-		return nil, fmt.Errorf("database and table are required")
+		return "", nil, fmt.Errorf("database and table are required")
 	}
 
-	// Build SELECT clause
+	// Build SELECT clause; every identifier is quoted after being validated
+	// against the table schema by validateExploreIdentifiers
 	var selectClause string
-	if req.Aggregate != "" && len(req.Fields) > 0 {
+	if len(req.Aggregates) > 0 {
+		// Plain columns (all of which are grouped) come first, then one column per aggregate
+		var columns []string
+		for _, field := range req.SelectedFields() {
+			columns = append(columns, req.selectColumnSQL(field))
+		}
+		for _, spec := range req.Aggregates {
+			expr, err := aggregateExpr(req, spec)
+			if err != nil {
+				return "", nil, err
+			}
+			columns = append(columns, expr+" as "+quoteIdentifier(spec.ResultName()))
+		}
+		selectClause = strings.Join(columns, ", ")
+	} else if req.Aggregate != "" && len(req.Fields) > 0 {
+		field := req.columnSQL(req.Fields[0])
+		alias := quoteIdentifier(aggregateAlias(req))
 		switch req.Aggregate {
 		case "count":
-			selectClause = "COUNT(*) as count"
-		case "sum":
-			selectClause = fmt.Sprintf("SUM(%s) as sum_%s", req.Fields[0], req.Fields[0])
-		case "avg":
-			selectClause = fmt.Sprintf("AVG(%s) as avg_%s", req.Fields[0], req.Fields[0])
-		case "min":
-			selectClause = fmt.Sprintf("MIN(%s) as min_%s", req.Fields[0], req.Fields[0])
-		case "max":
-			selectClause = fmt.Sprintf("MAX(%s) as max_%s", req.Fields[0], req.Fields[0])
+			selectClause = "COUNT(*) as " + alias
+		case "sum", "avg", "min", "max":
+			selectClause = fmt.Sprintf("%s(%s) as %s", nullForEmptyAggregates[req.Aggregate], field, alias)
 		default:
-			return nil, fmt.Errorf("unsupported aggregate function: %s", req.Aggregate)
+			return "", nil, fmt.Errorf("unsupported aggregate function: %s", req.Aggregate)
 		}
 		
 		// Add group by fields to select if specified
 		if len(req.GroupBy) > 0 {
 			for _, field := range req.GroupBy {
-				selectClause += fmt.Sprintf(", %s", field)
+				selectClause += ", " + req.selectColumnSQL(field)
 			}
 		}
 	} else {
@@ -304,275 +747,235 @@ func (c *ClickHouseClient) ExecuteExploreQuery(ctx context.Context, req ExploreR
 		if len(req.Fields) == 0 {
 			selectClause = "*"
 		} else {
-			selectClause = ""
+			columns := make([]string, len(req.Fields))
 			for i, field := range req.Fields {
-				if i > 0 {
-					selectClause += ", "
-				}
-				selectClause += field
+				columns[i] = req.selectColumnSQL(field)
 			}
+			selectClause = strings.Join(columns, ", ")
 		}
 	}
 
+	from, err := req.fromSQL()
+	if err != nil {
+		return "", nil, err
+	}
+
 	// Build query
-	query := fmt.Sprintf("SELECT %s FROM %s.%s", selectClause, req.Database, req.Table)
+	query := fmt.Sprintf("SELECT %s FROM %s", selectClause, from)
 	args := []interface{}{}
 	argIndex := 1
 
-	// Add WHERE clause if filter is specified
-	if req.FilterBy != "" && req.FilterOp != "" && req.FilterVal != "" {
-		switch req.FilterOp {
-		case "eq":
-			query += fmt.Sprintf(" WHERE %s = $%d", req.FilterBy, argIndex)
-		case "ne":
-			query += fmt.Sprintf(" WHERE %s != $%d", req.FilterBy, argIndex)
-		case "gt":
-			query += fmt.Sprintf(" WHERE %s > $%d", req.FilterBy, argIndex)
-		case "lt":
-			query += fmt.Sprintf(" WHERE %s < $%d", req.FilterBy, argIndex)
-		case "gte":
-			query += fmt.Sprintf(" WHERE %s >= $%d", req.FilterBy, argIndex)
-		case "lte":
-			query += fmt.Sprintf(" WHERE %s <= $%d", req.FilterBy, argIndex)
-		case "like":
-			query += fmt.Sprintf(" WHERE %s LIKE $%d", req.FilterBy, argIndex)
-			req.FilterVal = "%" + req.FilterVal + "%"
-		default:
-			return nil, fmt.Errorf("unsupported filter operation: %s", req.FilterOp)
-		}
-		args = append(args, req.FilterVal)
-		argIndex++
+	// Add WHERE clause if filters are specified
+	where, filterArgs, err := whereSQL(req, argIndex)
+	if err != nil {
+		return "", nil, err
+	}
+	if where != "" {
+		query += " WHERE " + where
+		args = append(args, filterArgs...)
+		argIndex += len(filterArgs)
 	}
 
 	// Add GROUP BY clause
 	if len(req.GroupBy) > 0 {
-		query += " GROUP BY "
+		groupBy := make([]string, len(req.GroupBy))
 		for i, field := range req.GroupBy {
-			if i > 0 {
-				query += ", "
-			}
-			query += field
+			groupBy[i] = req.columnSQL(field)
 		}
+		query += " GROUP BY " + strings.Join(groupBy, ", ")
 	}
 
 	// Add ORDER BY clause
-	if req.OrderBy != "" {
-		orderDir := "ASC"
-		if req.OrderDir == "desc" {
-			orderDir = "DESC"
+	if len(req.OrderBy) > 0 {
+		orderBy := make([]string, len(req.OrderBy))
+		for i, spec := range req.OrderBy {
+			column := req.columnSQL(spec.Field)
+			if isAggregateResult(req, spec.Field) || req.isFieldAlias(spec.Field) {
+				column = quoteIdentifier(spec.Field)
+			}
+			orderDir := "ASC"
+			if req.orderDirection(spec) == "desc" {
+				orderDir = "DESC"
+			}
+			orderBy[i] = column + " " + orderDir
 		}
-		query += fmt.Sprintf(" ORDER BY %s %s", req.OrderBy, orderDir)
+		query += " ORDER BY " + strings.Join(orderBy, ", ")
 	}
 
-	// Add LIMIT clause
-	if req.Limit > 0 {
-		query += fmt.Sprintf(" LIMIT $%d", argIndex)
-		args = append(args, req.Limit)
-	} else {
-		// Default limit
-		query += fmt.Sprintf(" LIMIT $%d", argIndex)
-		args = append(args, 1000)
+	// Add LIMIT clause; callers resolve Limit from query.defaultLimit and
+	// query.maxLimit, so there is no limit of its own to fall back to here
+	if req.Limit <= 0 {
+		return "", nil, fmt.Errorf("limit must be positive, got %d", req.Limit)
 	}
+	query += fmt.Sprintf(" LIMIT $%d", argIndex)
+	args = append(args, req.Limit)
 
-	c.logger.Printf("Executing explore query: %s with args: %v", query, args)
+	return query, args, nil
+}
 
-	rows, err := c.conn.Query(ctx, query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute explore query: %w", err)
+// SelectedFields returns the fields selected as plain columns, in order:
+// the grouped fields of an aggregate query, otherwise the requested fields
+func (req ExploreRequest) SelectedFields() []string {
+	switch {
+	case len(req.Aggregates) > 0 && len(req.Fields) > 0:
+		return req.Fields
+	case len(req.Aggregates) > 0:
+		return req.GroupBy
+	case req.Aggregate != "" && len(req.Fields) > 0:
+		return req.GroupBy
+	default:
+		return req.Fields
 	}
-	defer rows.Close()
+}
 
-	// Get column types
-	columnTypes := rows.ColumnTypes()
-	columns := make([]string, len(columnTypes))
-	for i, col := range columnTypes {
-		columns[i] = col.Name()
+// isFieldAlias reports whether name is the alias of a selected field
+func (req ExploreRequest) isFieldAlias(name string) bool {
+	for _, alias := range req.Aliases {
+		if alias == name {
+			return true
+		}
 	}
+	return false
+}
 
-	// Scan results
-	var data []map[string]interface{}
-	for rows.Next() {
-		values := make([]interface{}, len(columns))
-		valuePtrs := make([]interface{}, len(columns))
-		for i := range values {
-			valuePtrs[i] = &values[i]
-		}
+// nullForEmptyAggregates maps the aggregate functions of explore queries,
+// other than count, to their -OrNull form. Over no rows, or only NULLs, these
+// return NULL, where the plain functions would return 0 for sum, NaN for avg
+// and the type's default value, e.g. 1970-01-01, for min and max, or NULL for
+// a Nullable column. count is always a number, 0 when nothing matches.
+var nullForEmptyAggregates = map[string]string{
+	"sum": "sumOrNull",
+	"avg": "avgOrNull",
+	"min": "minOrNull",
+	"max": "maxOrNull",
+}
 
-		if err := rows.Scan(valuePtrs...); err != nil {
-			c.logger.Printf("Error scanning row: %v", err)
-			continue
-		}
+// aggregateExpr renders the SQL for a single aggregate spec of req
+func aggregateExpr(req ExploreRequest, spec AggregateSpec) (string, error) {
+	if spec.Func == "count" && spec.Field == "" {
+		return "COUNT(*)", nil
+	}
 
-		row := make(map[string]interface{})
-		for i, col := range columns {
-			row[col] = values[i]
-		}
-		data = append(data, row)
+	field := req.columnSQL(spec.Field)
+	switch spec.Func {
+	case "count":
+		return fmt.Sprintf("COUNT(%s)", field), nil
+	case "sum", "avg", "min", "max":
+		return fmt.Sprintf("%s(%s)", nullForEmptyAggregates[spec.Func], field), nil
+	default:
+		return "", fmt.Errorf("unsupported aggregate function: %s", spec.Func)
 	}
+}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating rows: %w", err)
+// StreamExploreQuery executes an explore query and hands each row to onRow as it is scanned
+func (c *ClickHouseClient) StreamExploreQuery(ctx context.Context, req ExploreRequest, onColumns ColumnsFunc, onRow RowFunc) error {
+	if err := c.validateExploreIdentifiers(ctx, req); err != nil {
+		return err
+	}
+
+	query, args, err := buildExploreQuery(req)
+	if err != nil {
+		return err
 	}
 
-	return &ExploreResponse{
-		Columns: columns,
-		Data:    data,
-		Total:   len(data),
-	}, nil
+	c.logger.Debug("executing explore query", "query", query, "args", args)
+
+	timeout := time.Duration(req.TimeoutSeconds) * time.Second
+	queryCtx, cancel := withQueryTimeout(trackProgress(c.withReadOnly(ctx)), timeout)
+	defer cancel()
+
+	err = c.streamExploreRows(queryCtx, query, args, onColumns, onRow)
+	return queryTimeoutErr(ctx, err, timeout)
 }
 
-// QueryRaw executes a raw SQL query and returns the results as a structured response
-func (c *ClickHouseClient) QueryRaw(ctx context.Context, query string) ([]string, []map[string]interface{}, error) {
-	c.logger.Printf("Executing raw query: %s", query)
-	
-	rows, err := c.conn.Query(ctx, query)
+// streamExploreRows runs a built explore query and hands its rows to onRow
+func (c *ClickHouseClient) streamExploreRows(ctx context.Context, query string, args []interface{}, onColumns ColumnsFunc, onRow RowFunc) error {
+	rows, err := c.query(ctx, query, args...)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to execute raw query: %w", err)
+		return fmt.Errorf("failed to execute explore query: %w", err)
 	}
 	defer rows.Close()
-	
-	// Get column types
-	columnTypes := rows.ColumnTypes()
-	columns := make([]string, len(columnTypes))
-	for i, col := range columnTypes {
-		columns[i] = col.Name()
-	}
-	
-	// Scan results
+
+	return c.scanTypedRows(rows, onColumns, onRow)
+}
+
+// QueryRaw executes a raw SQL query and returns the result columns, their
+// ClickHouse types and the rows; a non-zero timeout stops the query once it
+// has run that long
+func (c *ClickHouseClient) QueryRaw(ctx context.Context, query string, timeout time.Duration) ([]string, []string, []map[string]interface{}, error) {
+	var columns, columnTypes []string
 	var data []map[string]interface{}
-	for rows.Next() {
-		// Create typed variables based on column types
-		valuePtrs := make([]interface{}, len(columns))
-		
-		for i, colType := range columnTypes {
-			typeName := colType.DatabaseTypeName()
-			
-			switch {
-			case strings.HasPrefix(typeName, "DateTime64") || typeName == "DateTime":
-				var t time.Time
-				valuePtrs[i] = &t
-			case typeName == "Date":
-				var d time.Time
-				valuePtrs[i] = &d
-			case typeName == "String" || 
-				 strings.HasPrefix(typeName, "FixedString") || 
-				 typeName == "LowCardinality(String)":
-				var s string
-				valuePtrs[i] = &s
-			case typeName == "Int8":
-				var n int8
-				valuePtrs[i] = &n
-			case typeName == "Int16":
-				var n int16
-				valuePtrs[i] = &n
-			case typeName == "Int32":
-				var n int32
-				valuePtrs[i] = &n
-			case typeName == "Int64":
-				var n int64
-				valuePtrs[i] = &n
-			case typeName == "UInt8":
-				var n uint8
-				valuePtrs[i] = &n
-			case typeName == "UInt16":
-				var n uint16
-				valuePtrs[i] = &n
-			case typeName == "UInt32":
-				var n uint32
-				valuePtrs[i] = &n
-			case typeName == "UInt64":
-				var n uint64
-				valuePtrs[i] = &n
-			case typeName == "Float32":
-				var f float32
-				valuePtrs[i] = &f
-			case typeName == "Float64":
-				var f float64
-				valuePtrs[i] = &f
-			case typeName == "Bool":
-				var b bool
-				valuePtrs[i] = &b
-			case typeName == "UUID":
-				var u string
-				valuePtrs[i] = &u
-			case strings.HasPrefix(typeName, "Array("):
-				var arr string // We'll store arrays as JSON strings
-				valuePtrs[i] = &arr
-			case strings.HasPrefix(typeName, "Map("):
-				var m map[string]string
-				valuePtrs[i] = &m
-			default:
-				// For truly unknown types, try to scan as string first
-				var s string
-				valuePtrs[i] = &s
-			}
-		}
-		
-		if err := rows.Scan(valuePtrs...); err != nil {
-			continue
-		}
-		
-		row := make(map[string]interface{})
-		for i, col := range columns {
-			ptr := valuePtrs[i]
-			var val interface{}
-			
-			// Extract the actual value from the pointer
-			switch v := ptr.(type) {
-			case *time.Time:
-				if !(*v).IsZero() {
-					val = (*v).Format(time.RFC3339)
-				} else {
-					val = nil
-				}
-			case *string:
-				if *v != "" {
-					val = *v
-				} else {
-					val = *v // Keep empty strings as empty strings, not nil
-				}
-			case *int8:
-				val = int64(*v)
-			case *int16:
-				val = int64(*v)
-			case *int32:
-				val = int64(*v)
-			case *int64:
-				val = *v
-			case *uint8:
-				val = uint64(*v)
-			case *uint16:
-				val = uint64(*v)
-			case *uint32:
-				val = uint64(*v)
-			case *uint64:
-				val = *v
-			case *float32:
-				val = float64(*v)
-			case *float64:
-				val = *v
-			case *bool:
-				val = *v
-			case *map[string]string:
-				// Convert map to JSON for the response
-				if *v != nil {
-					val = *v
-				} else {
-					val = map[string]string{}
-				}
-			default:
-				// This should not happen now, but keeping as safety net
-				val = nil
-			}
-			
-			row[col] = val
-		}
-		data = append(data, row)
+
+	err := c.QueryRawStream(ctx, query, nil, timeout,
+		func(cols, types []string) error {
+			columns = cols
+			columnTypes = types
+			return nil
+		},
+		func(row map[string]interface{}) error {
+			data = append(data, row)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return columns, columnTypes, data, nil
+}
+
+// QueryRawStream executes a raw SQL query with args bound to its ?
+// placeholders and hands each typed row to onRow as it is scanned; a non-zero
+// timeout stops the query once it has run that long
+func (c *ClickHouseClient) QueryRawStream(ctx context.Context, query string, args []interface{}, timeout time.Duration, onColumns ColumnsFunc, onRow RowFunc) error {
+	c.logger.Debug("executing raw query", "query", query, "args", args, "timeout", timeout)
+	if len(args) > 0 {
+		query = HideNumberedPlaceholders(query)
 	}
 	
-	if err := rows.Err(); err != nil {
-		return nil, nil, fmt.Errorf("error iterating rows: %w", err)
+	queryCtx, cancel := withQueryTimeout(trackProgress(c.withReadOnly(ctx)), timeout)
+	defer cancel()
+	
+	rows, err := c.query(queryCtx, query, args...)
+	if err != nil {
+		return queryTimeoutErr(ctx, fmt.Errorf("failed to execute raw query: %w", err), timeout)
 	}
+	defer rows.Close()
 	
-	return columns, data, nil
-}
\ No newline at end of file
+	return queryTimeoutErr(ctx, c.scanTypedRows(rows, onColumns, onRow), timeout)
+}
+
+// PreviewTable returns the first limit rows of a table with their column types
+func (c *ClickHouseClient) PreviewTable(ctx context.Context, database, table string, limit int) (*ExploreResponse, error) {
+	if err := c.checkTableExists(ctx, database, table); err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("SELECT * FROM %s.%s LIMIT ?", quoteIdentifier(database), quoteIdentifier(table))
+	c.logger.Debug("executing table preview", "query", query, "limit", limit)
+
+	rows, err := c.query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to preview table %s.%s: %w", database, table, err)
+	}
+	defer rows.Close()
+
+	response := &ExploreResponse{}
+	err = c.scanTypedRows(rows,
+		func(columns, columnTypes []string) error {
+			response.Columns = columns
+			response.ColumnTypes = columnTypes
+			return nil
+		},
+		func(row map[string]interface{}) error {
+			response.Data = append(response.Data, row)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	response.Total = len(response.Data)
+	return response, nil
+}
@@ -0,0 +1,244 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/observio/backend/internal/auth"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ErrTooManyQueries is returned when no query slot frees up within the queue timeout
+var ErrTooManyQueries = errors.New("too many concurrent ClickHouse queries")
+
+// ErrTooManyUserQueries is returned when the user's own queries hold all of
+// their slots for the whole queue timeout; it matches ErrTooManyQueries
+var ErrTooManyUserQueries = fmt.Errorf("%w for this user", ErrTooManyQueries)
+
+// inflightQueries counts the ClickHouse queries holding a query slot
+var inflightQueries atomic.Int64
+
+// inflightQueriesGauge exposes inflightQueries at /metrics
+var inflightQueriesGauge = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+	Name: "clickhouse_inflight_queries",
+	Help: "ClickHouse queries currently holding a query slot.",
+}, func() float64 { return float64(inflightQueries.Load()) })
+
+// acquire waits for a free slot of the authenticated user, if any, and then
+// for a free server-wide slot, giving up after the queue timeout or when ctx
+// is done. The returned release func must be called exactly once.
+func (c *ClickHouseClient) acquire(ctx context.Context) (func(), error) {
+	userSlots := c.slotsOfUser(ctx)
+	if c.querySlots == nil && userSlots == nil {
+		return func() {}, nil
+	}
+
+	// Both waits share the queue timeout
+	deadline := time.Now().Add(c.queueTimeout)
+	if err := waitForSlot(ctx, userSlots, deadline, ErrTooManyUserQueries); err != nil {
+		return nil, err
+	}
+	if err := waitForSlot(ctx, c.querySlots, deadline, ErrTooManyQueries); err != nil {
+		if userSlots != nil {
+			<-userSlots
+		}
+		return nil, err
+	}
+
+	inflightQueries.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			inflightQueries.Add(-1)
+			if c.querySlots != nil {
+				<-c.querySlots
+			}
+			if userSlots != nil {
+				<-userSlots
+			}
+		})
+	}, nil
+}
+
+// slotsOfUser returns the query slots of the user authenticated in ctx, or nil
+// when there is no per-user limit or no user. A user's channel is kept once
+// created; it is a few bytes per user who ever ran a query.
+func (c *ClickHouseClient) slotsOfUser(ctx context.Context) chan struct{} {
+	if c.userSlots == nil {
+		return nil
+	}
+	user, ok := auth.UserFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	c.userSlotsMu.Lock()
+	defer c.userSlotsMu.Unlock()
+	slots, ok := c.userSlots[user]
+	if !ok {
+		slots = make(chan struct{}, c.maxUserQueries)
+		c.userSlots[user] = slots
+	}
+	return slots
+}
+
+// waitForSlot takes a slot of slots, waiting until deadline or until ctx is
+// done; it returns errFull when the deadline passes. A nil slots is unbounded.
+func waitForSlot(ctx context.Context, slots chan struct{}, deadline time.Time, errFull error) error {
+	if slots == nil {
+		return nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return errFull
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// query runs a SELECT while holding a query slot until the rows are closed
+func (c *ClickHouseClient) query(ctx context.Context, query string, args ...interface{}) (driver.Rows, error) {
+	ctx = withUserComment(ctx)
+	ctx, span := startQuerySpan(ctx, query)
+	release, err := c.acquire(ctx)
+	if err != nil {
+		endQuerySpan(span, err)
+		return nil, err
+	}
+	release = c.timeQuery(ctx, query, release)
+
+	var rows driver.Rows
+	err = c.withRetry(ctx, func() error {
+		var err error
+		rows, err = c.conn.Query(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		release()
+		endQuerySpan(span, err)
+		return nil, err
+	}
+
+	return &tracedRows{Rows: &slotRows{Rows: rows, release: release}, span: span}, nil
+}
+
+// queryRow runs a single-row SELECT while holding a query slot until it is scanned
+func (c *ClickHouseClient) queryRow(ctx context.Context, query string, args ...interface{}) driver.Row {
+	ctx = withUserComment(ctx)
+	ctx, span := startQuerySpan(ctx, query)
+	release, err := c.acquire(ctx)
+	if err != nil {
+		endQuerySpan(span, err)
+		return &errRow{err: err}
+	}
+	release = c.timeQuery(ctx, query, release)
+
+	var row driver.Row
+	err = c.withRetry(ctx, func() error {
+		row = c.conn.QueryRow(ctx, query, args...)
+		return row.Err()
+	})
+	if err != nil {
+		release()
+		endQuerySpan(span, err)
+		return &errRow{err: err}
+	}
+
+	return &tracedRow{Row: &slotRow{Row: row, release: release}, span: span}
+}
+
+// exec runs a statement that returns no rows while holding a query slot
+func (c *ClickHouseClient) exec(ctx context.Context, query string, args ...interface{}) (err error) {
+	ctx = withUserComment(ctx)
+	ctx, span := startQuerySpan(ctx, query)
+	defer func() { endQuerySpan(span, err) }()
+
+	release, err := c.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.timeQuery(ctx, query, release)()
+
+	return c.withRetry(ctx, func() error {
+		return c.conn.Exec(ctx, query, args...)
+	})
+}
+
+// timeQuery wraps the release of a query slot to log the query at warn level
+// when it held the slot for at least the slow query threshold. Time spent
+// waiting for the slot is not counted; time spent reading the rows is, since
+// the slot is held until they are closed.
+func (c *ClickHouseClient) timeQuery(ctx context.Context, query string, release func()) func() {
+	if c.slowQueryThreshold <= 0 {
+		return release
+	}
+	start := time.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			release()
+			elapsed := time.Since(start)
+			if elapsed < c.slowQueryThreshold {
+				return
+			}
+			args := []any{"elapsedMs", elapsed.Milliseconds(), "thresholdMs", c.slowQueryThreshold.Milliseconds(), "query", truncateQuery(query)}
+			if user, ok := auth.UserFromContext(ctx); ok {
+				args = append(args, "user", user)
+			}
+			c.logger.Warn("slow ClickHouse query", args...)
+		})
+	}
+}
+
+// slotRows releases its query slot when closed
+type slotRows struct {
+	driver.Rows
+	release func()
+}
+
+func (r *slotRows) Close() error {
+	defer r.release()
+	return r.Rows.Close()
+}
+
+// slotRow releases its query slot once scanned
+type slotRow struct {
+	driver.Row
+	release func()
+}
+
+func (r *slotRow) Scan(dest ...interface{}) error {
+	defer r.release()
+	return r.Row.Scan(dest...)
+}
+
+func (r *slotRow) ScanStruct(dest interface{}) error {
+	defer r.release()
+	return r.Row.ScanStruct(dest)
+}
+
+// errRow is a row that failed before the query was sent
+type errRow struct {
+	err error
+}
+
+func (r *errRow) Err() error                        { return r.err }
+func (r *errRow) Scan(dest ...interface{}) error    { return r.err }
+func (r *errRow) ScanStruct(dest interface{}) error { return r.err }
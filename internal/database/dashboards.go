@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrDashboardNotFound is returned when no live dashboard has the requested ID
+var ErrDashboardNotFound = errors.New("dashboard not found")
+
+// Dashboard represents a monitoring dashboard
+type Dashboard struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Panels      []Panel   `json:"panels"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	CreatedBy   string    `json:"createdBy"`
+}
+
+// Panel represents a visualization panel within a dashboard
+type Panel struct {
+	ID         string                 `json:"id"`
+	Title      string                 `json:"title"`
+	Type       string                 `json:"type"` // graph, singlestat, table, etc.
+	Query      string                 `json:"query"`
+	DataSource string                 `json:"dataSource"`
+	Position   map[string]int         `json:"position"` // x, y, w, h
+	Options    map[string]interface{} `json:"options"`
+}
+
+// dashboardColumns is the column list shared by the dashboard queries
+const dashboardColumns = `id, title, description, panels, created_by, created_at, updated_at`
+
+// ListDashboards retrieves all dashboards that have not been deleted
+func (c *ClickHouseClient) ListDashboards(ctx context.Context) ([]Dashboard, error) {
+	query := `SELECT ` + dashboardColumns + ` FROM dashboards FINAL WHERE deleted = 0 ORDER BY created_at`
+
+	rows, err := c.query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dashboards: %w", err)
+	}
+	defer rows.Close()
+
+	dashboards := []Dashboard{}
+	for rows.Next() {
+		dashboard, err := scanDashboard(rows)
+		if err != nil {
+			c.logger.Error("error scanning dashboard row", "error", err)
+			continue
+		}
+		dashboards = append(dashboards, dashboard)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating dashboard rows: %w", err)
+	}
+
+	return dashboards, nil
+}
+
+// GetDashboard retrieves a single dashboard by ID
+func (c *ClickHouseClient) GetDashboard(ctx context.Context, id string) (*Dashboard, error) {
+	query := `SELECT ` + dashboardColumns + ` FROM dashboards FINAL WHERE id = ? AND deleted = 0 LIMIT 1`
+
+	rows, err := c.query(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dashboard %s: %w", id, err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error iterating dashboard rows: %w", err)
+		}
+		return nil, ErrDashboardNotFound
+	}
+
+	dashboard, err := scanDashboard(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan dashboard %s: %w", id, err)
+	}
+
+	return &dashboard, nil
+}
+
+// SaveDashboard inserts a new version of a dashboard; the latest write wins
+func (c *ClickHouseClient) SaveDashboard(ctx context.Context, dashboard Dashboard) error {
+	if err := c.insertDashboard(ctx, dashboard, false); err != nil {
+		return fmt.Errorf("failed to store dashboard %s: %w", dashboard.ID, err)
+	}
+	return nil
+}
+
+// DeleteDashboard hides a dashboard by writing a newer, deleted version of it
+func (c *ClickHouseClient) DeleteDashboard(ctx context.Context, id string) error {
+	dashboard, err := c.GetDashboard(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	dashboard.UpdatedAt = time.Now().UTC()
+	if err := c.insertDashboard(ctx, *dashboard, true); err != nil {
+		return fmt.Errorf("failed to delete dashboard %s: %w", id, err)
+	}
+	return nil
+}
+
+// insertDashboard writes a single row to dashboards, storing the panels as JSON
+func (c *ClickHouseClient) insertDashboard(ctx context.Context, dashboard Dashboard, deleted bool) error {
+	panels := dashboard.Panels
+	if panels == nil {
+		panels = []Panel{}
+	}
+	panelsJSON, err := json.Marshal(panels)
+	if err != nil {
+		return fmt.Errorf("failed to encode panels: %w", err)
+	}
+
+	var deletedFlag uint8
+	if deleted {
+		deletedFlag = 1
+	}
+
+	query := `INSERT INTO dashboards (` + dashboardColumns + `, deleted) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	return c.exec(ctx, query,
+		dashboard.ID,
+		dashboard.Title,
+		dashboard.Description,
+		string(panelsJSON),
+		dashboard.CreatedBy,
+		dashboard.CreatedAt,
+		dashboard.UpdatedAt,
+		deletedFlag,
+	)
+}
+
+// scanDashboard scans a row selected with dashboardColumns
+func scanDashboard(row rowScanner) (Dashboard, error) {
+	var dashboard Dashboard
+	var panelsJSON string
+	err := row.Scan(
+		&dashboard.ID,
+		&dashboard.Title,
+		&dashboard.Description,
+		&panelsJSON,
+		&dashboard.CreatedBy,
+		&dashboard.CreatedAt,
+		&dashboard.UpdatedAt,
+	)
+	if err != nil {
+		return dashboard, err
+	}
+
+	if err := json.Unmarshal([]byte(panelsJSON), &dashboard.Panels); err != nil {
+		return dashboard, fmt.Errorf("failed to decode panels of dashboard %s: %w", dashboard.ID, err)
+	}
+	return dashboard, nil
+}
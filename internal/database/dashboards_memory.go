@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+// MemoryDashboardStore keeps dashboards in process memory. It implements the
+// same methods as the ClickHouse client and is meant for tests and local runs.
+type MemoryDashboardStore struct {
+	mu         sync.RWMutex
+	dashboards map[string]Dashboard
+}
+
+// NewMemoryDashboardStore creates an empty in-memory dashboard store
+func NewMemoryDashboardStore() *MemoryDashboardStore {
+	return &MemoryDashboardStore{dashboards: make(map[string]Dashboard)}
+}
+
+// ListDashboards returns all dashboards, oldest first
+func (s *MemoryDashboardStore) ListDashboards(ctx context.Context) ([]Dashboard, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	dashboards := make([]Dashboard, 0, len(s.dashboards))
+	for _, dashboard := range s.dashboards {
+		dashboards = append(dashboards, copyDashboard(dashboard))
+	}
+	sort.Slice(dashboards, func(i, j int) bool {
+		return dashboards[i].CreatedAt.Before(dashboards[j].CreatedAt)
+	})
+	return dashboards, nil
+}
+
+// GetDashboard returns the dashboard with the given ID
+func (s *MemoryDashboardStore) GetDashboard(ctx context.Context, id string) (*Dashboard, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	dashboard, ok := s.dashboards[id]
+	if !ok {
+		return nil, ErrDashboardNotFound
+	}
+	dashboard = copyDashboard(dashboard)
+	return &dashboard, nil
+}
+
+// SaveDashboard creates or replaces a dashboard
+func (s *MemoryDashboardStore) SaveDashboard(ctx context.Context, dashboard Dashboard) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dashboards[dashboard.ID] = copyDashboard(dashboard)
+	return nil
+}
+
+// DeleteDashboard removes a dashboard
+func (s *MemoryDashboardStore) DeleteDashboard(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.dashboards[id]; !ok {
+		return ErrDashboardNotFound
+	}
+	delete(s.dashboards, id)
+	return nil
+}
+
+// copyDashboard deep-copies a dashboard through JSON, the same round trip the
+// ClickHouse store makes, so callers cannot mutate stored panels
+func copyDashboard(dashboard Dashboard) Dashboard {
+	panels, err := json.Marshal(dashboard.Panels)
+	if err != nil {
+		return dashboard
+	}
+	dashboard.Panels = nil
+	json.Unmarshal(panels, &dashboard.Panels)
+	return dashboard
+}
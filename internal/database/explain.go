@@ -0,0 +1,230 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// ErrQueryRejected is wrapped by the errors of ClickHouse refusing to plan a
+// raw query, e.g. for a syntax error or an unknown table or column
+var ErrQueryRejected = errors.New("query rejected by ClickHouse")
+
+// ExploreEstimate is ClickHouse's estimate of what one table contributes to a query
+type ExploreEstimate struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	Parts    uint64 `json:"parts"`
+	Rows     uint64 `json:"rows"`
+	Marks    uint64 `json:"marks"`
+}
+
+// ExploreExplanation describes an explore query without running it
+type ExploreExplanation struct {
+	SQL       string            `json:"sql"`
+	Args      []interface{}     `json:"args"`
+	Estimates []ExploreEstimate `json:"estimates"`
+	// EstimatedRows is the sum of the rows ClickHouse expects to read across all tables
+	EstimatedRows uint64 `json:"estimatedRows"`
+}
+
+// ExplainExploreQuery validates an explore request against the schema, builds
+// its SQL and asks ClickHouse, via EXPLAIN ESTIMATE, how much data it would
+// read. Tables that are not MergeTree based have no estimate.
+func (c *ClickHouseClient) ExplainExploreQuery(ctx context.Context, req ExploreRequest) (*ExploreExplanation, error) {
+	if err := c.validateExploreIdentifiers(ctx, req); err != nil {
+		return nil, err
+	}
+
+	query, args, err := buildExploreQuery(req)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := c.query(ctx, "EXPLAIN ESTIMATE "+query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to estimate explore query: %w", err)
+	}
+	defer rows.Close()
+
+	explanation := &ExploreExplanation{SQL: query, Args: args, Estimates: []ExploreEstimate{}}
+	for rows.Next() {
+		var estimate ExploreEstimate
+		if err := rows.Scan(&estimate.Database, &estimate.Table, &estimate.Parts, &estimate.Rows, &estimate.Marks); err != nil {
+			return nil, fmt.Errorf("error scanning estimate row: %w", err)
+		}
+		explanation.Estimates = append(explanation.Estimates, estimate)
+		explanation.EstimatedRows += estimate.Rows
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating estimate rows: %w", err)
+	}
+
+	return explanation, nil
+}
+
+// CheckQuery reports whether a raw SQL query would run, without running it:
+// it must be a single read-only statement, and ClickHouse must be able to
+// plan it with EXPLAIN, which catches syntax errors and unknown tables,
+// columns and functions
+func (c *ClickHouseClient) CheckQuery(ctx context.Context, query string) error {
+	if err := ValidateReadOnlyQuery(query); err != nil {
+		return err
+	}
+
+	statement := strings.TrimSuffix(strings.TrimSpace(query), ";")
+	rows, err := c.query(c.withReadOnly(ctx), "EXPLAIN PLAN "+statement)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+// RawQueryEstimate is ClickHouse's estimate of what one table contributes to
+// a raw query. Bytes scales the estimated rows by the average uncompressed row
+// size of the table, so it overstates queries reading only a few columns.
+type RawQueryEstimate struct {
+	ExploreEstimate
+	Bytes uint64 `json:"bytes"`
+}
+
+// RawQueryExplanation describes a raw query without running it: its plan, as
+// printed by EXPLAIN PLAN, and the data it would read
+type RawQueryExplanation struct {
+	Plan      []string           `json:"plan"`
+	Estimates []RawQueryEstimate `json:"estimates"`
+	// The estimates summed across all tables
+	EstimatedParts uint64 `json:"estimatedParts"`
+	EstimatedRows  uint64 `json:"estimatedRows"`
+	EstimatedMarks uint64 `json:"estimatedMarks"`
+	EstimatedBytes uint64 `json:"estimatedBytes"`
+}
+
+// ExplainRawQuery plans a single read-only raw query, with args bound to its ?
+// placeholders, and asks ClickHouse via EXPLAIN ESTIMATE how much data it
+// would read, without running it. Tables that are not MergeTree based have no
+// estimate. Errors of ClickHouse rejecting the query wrap ErrQueryRejected.
+func (c *ClickHouseClient) ExplainRawQuery(ctx context.Context, query string, args []interface{}, timeout time.Duration) (*RawQueryExplanation, error) {
+	if err := ValidateReadOnlyQuery(query); err != nil {
+		return nil, err
+	}
+	statement := strings.TrimSuffix(strings.TrimSpace(query), ";")
+	if len(args) > 0 {
+		statement = HideNumberedPlaceholders(statement)
+	}
+
+	queryCtx, cancel := withQueryTimeout(c.withReadOnly(ctx), timeout)
+	defer cancel()
+
+	explanation := &RawQueryExplanation{Plan: []string{}, Estimates: []RawQueryEstimate{}}
+	err := c.explainRows(queryCtx, "EXPLAIN PLAN "+statement, args, func(row rowScanner) error {
+		var line string
+		if err := row.Scan(&line); err != nil {
+			return err
+		}
+		explanation.Plan = append(explanation.Plan, line)
+		return nil
+	})
+	if err != nil {
+		return nil, queryTimeoutErr(ctx, err, timeout)
+	}
+
+	err = c.explainRows(queryCtx, "EXPLAIN ESTIMATE "+statement, args, func(row rowScanner) error {
+		var estimate RawQueryEstimate
+		if err := row.Scan(&estimate.Database, &estimate.Table, &estimate.Parts, &estimate.Rows, &estimate.Marks); err != nil {
+			return err
+		}
+		explanation.Estimates = append(explanation.Estimates, estimate)
+		return nil
+	})
+	if err != nil {
+		return nil, queryTimeoutErr(ctx, err, timeout)
+	}
+
+	if err := c.estimateBytes(queryCtx, explanation.Estimates); err != nil {
+		return nil, queryTimeoutErr(ctx, err, timeout)
+	}
+	for _, estimate := range explanation.Estimates {
+		explanation.EstimatedParts += estimate.Parts
+		explanation.EstimatedRows += estimate.Rows
+		explanation.EstimatedMarks += estimate.Marks
+		explanation.EstimatedBytes += estimate.Bytes
+	}
+	return explanation, nil
+}
+
+// explainRows runs an EXPLAIN statement and hands each row to scan
+func (c *ClickHouseClient) explainRows(ctx context.Context, statement string, args []interface{}, scan func(row rowScanner) error) error {
+	rows, err := c.query(ctx, statement, args...)
+	if err != nil {
+		var exception *clickhouse.Exception
+		if errors.As(err, &exception) && exception.Code != timeoutExceededCode {
+			return fmt.Errorf("%w: %s", ErrQueryRejected, exception.Message)
+		}
+		return fmt.Errorf("failed to explain raw query: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return fmt.Errorf("error scanning explain row: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating explain rows: %w", err)
+	}
+	return nil
+}
+
+// estimateBytes fills in the Bytes of every estimate from the average
+// uncompressed row size of the active parts of its table
+func (c *ClickHouseClient) estimateBytes(ctx context.Context, estimates []RawQueryEstimate) error {
+	if len(estimates) == 0 {
+		return nil
+	}
+
+	conditions := make([]string, len(estimates))
+	args := make([]interface{}, 0, 2*len(estimates))
+	for i, estimate := range estimates {
+		conditions[i] = "(database = ? AND table = ?)"
+		args = append(args, estimate.Database, estimate.Table)
+	}
+	query := `SELECT database, table, sum(rows), sum(data_uncompressed_bytes) FROM system.parts
+		WHERE active AND (` + strings.Join(conditions, " OR ") + `) GROUP BY database, table`
+
+	rows, err := c.query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query table sizes: %w", err)
+	}
+	defer rows.Close()
+
+	rowBytes := map[[2]string]float64{}
+	for rows.Next() {
+		var database, table string
+		var totalRows, totalBytes uint64
+		if err := rows.Scan(&database, &table, &totalRows, &totalBytes); err != nil {
+			return fmt.Errorf("error scanning table size row: %w", err)
+		}
+		if totalRows > 0 {
+			rowBytes[[2]string{database, table}] = float64(totalBytes) / float64(totalRows)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating table size rows: %w", err)
+	}
+
+	for i := range estimates {
+		size := rowBytes[[2]string{estimates[i].Database, estimates[i].Table}]
+		estimates[i].Bytes = uint64(size * float64(estimates[i].Rows))
+	}
+	return nil
+}
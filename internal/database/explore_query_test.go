@@ -0,0 +1,81 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAggregateExprReturnsNullOverNoValues(t *testing.T) {
+	req := ExploreRequest{Database: "otel", Table: "traces"}
+	tests := []struct {
+		spec AggregateSpec
+		want string
+	}{
+		{AggregateSpec{Func: "sum", Field: "Duration"}, "sumOrNull(`Duration`)"},
+		{AggregateSpec{Func: "avg", Field: "Duration"}, "avgOrNull(`Duration`)"},
+		{AggregateSpec{Func: "min", Field: "Timestamp"}, "minOrNull(`Timestamp`)"},
+		{AggregateSpec{Func: "max", Field: "Timestamp"}, "maxOrNull(`Timestamp`)"},
+		// count is 0 over no rows, never NULL
+		{AggregateSpec{Func: "count"}, "COUNT(*)"},
+		{AggregateSpec{Func: "count", Field: "TraceId"}, "COUNT(`TraceId`)"},
+	}
+	for _, tt := range tests {
+		got, err := aggregateExpr(req, tt.spec)
+		if err != nil {
+			t.Errorf("aggregateExpr(%+v) failed: %v", tt.spec, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("aggregateExpr(%+v) = %s, want %s", tt.spec, got, tt.want)
+		}
+	}
+
+	if _, err := aggregateExpr(req, AggregateSpec{Func: "median", Field: "Duration"}); err == nil {
+		t.Error("aggregateExpr accepted an unsupported function")
+	}
+}
+
+func TestBuildExploreQueryAggregateReturnsNullOverNoValues(t *testing.T) {
+	for _, aggregate := range []string{"sum", "avg", "min", "max"} {
+		req := ExploreRequest{Database: "otel", Table: "traces", Fields: []string{"Duration"}, Aggregate: aggregate, Limit: 10}
+		query, _, err := buildExploreQuery(req)
+		if err != nil {
+			t.Fatalf("buildExploreQuery(%s) failed: %v", aggregate, err)
+		}
+		want := "SELECT " + aggregate + "OrNull(`Duration`) as `" + aggregate + "_Duration` FROM"
+		if !strings.HasPrefix(query, want) {
+			t.Errorf("buildExploreQuery(%s) = %s, want it to start with %s", aggregate, query, want)
+		}
+	}
+
+	req := ExploreRequest{
+		Database: "otel", Table: "traces", GroupBy: []string{"ServiceName"}, Limit: 10,
+		Aggregates: []AggregateSpec{{Func: "count"}, {Func: "avg", Field: "Duration", Alias: "latency"}},
+	}
+	query, _, err := buildExploreQuery(req)
+	if err != nil {
+		t.Fatalf("buildExploreQuery failed: %v", err)
+	}
+	want := "SELECT `ServiceName`, COUNT(*) as `count`, avgOrNull(`Duration`) as `latency` FROM"
+	if !strings.HasPrefix(query, want) {
+		t.Errorf("buildExploreQuery = %s, want it to start with %s", query, want)
+	}
+}
+
+func TestBuildExploreQueryRequiresLimit(t *testing.T) {
+	for _, limit := range []int{0, -1} {
+		req := ExploreRequest{Database: "otel", Table: "logs", Fields: []string{"Body"}, Limit: limit}
+		if _, _, err := buildExploreQuery(req); err == nil {
+			t.Errorf("buildExploreQuery accepted limit %d", limit)
+		}
+	}
+
+	req := ExploreRequest{Database: "otel", Table: "logs", Fields: []string{"Body"}, Limit: 25}
+	query, args, err := buildExploreQuery(req)
+	if err != nil {
+		t.Fatalf("buildExploreQuery failed: %v", err)
+	}
+	if !strings.HasSuffix(query, " LIMIT $1") || len(args) != 1 || args[0] != 25 {
+		t.Errorf("buildExploreQuery = %s %v, want the limit bound as the last argument", query, args)
+	}
+}
@@ -0,0 +1,198 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FilterCondition compares a field with values, e.g. Duration gt 1000
+type FilterCondition struct {
+	Field  string   `json:"field,omitempty"`
+	Op     string   `json:"op,omitempty"`
+	Value  string   `json:"value,omitempty"`
+	Values []string `json:"values,omitempty"` // for in, notin and between
+}
+
+// FilterNode is a node of an explore filter tree: a group combining its
+// children with and or or, e.g. {"or": [{"and": [...]}, {...}]}, or a single
+// condition
+type FilterNode struct {
+	And []FilterNode `json:"and,omitempty"`
+	Or  []FilterNode `json:"or,omitempty"`
+	FilterCondition
+}
+
+// IsGroup reports whether the node is an and or or group rather than a condition
+func (n FilterNode) IsGroup() bool {
+	return n.And != nil || n.Or != nil
+}
+
+// Children returns the nodes of a group and the keyword combining them; a
+// node setting both and and or is read as an and group
+func (n FilterNode) Children() ([]FilterNode, string) {
+	if n.And == nil && n.Or != nil {
+		return n.Or, "OR"
+	}
+	return n.And, "AND"
+}
+
+// Conditions returns the conditions of the tree in order
+func (n FilterNode) Conditions() []FilterCondition {
+	if !n.IsGroup() {
+		return []FilterCondition{n.FilterCondition}
+	}
+	children, _ := n.Children()
+	var conditions []FilterCondition
+	for _, child := range children {
+		conditions = append(conditions, child.Conditions()...)
+	}
+	return conditions
+}
+
+// FilterConditions returns every condition of the request: the filterBy
+// condition, if any, then the conditions of the filter tree
+func (req ExploreRequest) FilterConditions() []FilterCondition {
+	var conditions []FilterCondition
+	if cond, ok := req.filterByCondition(); ok {
+		conditions = append(conditions, cond)
+	}
+	if req.Filters != nil {
+		conditions = append(conditions, req.Filters.Conditions()...)
+	}
+	return conditions
+}
+
+// filterByCondition returns the condition set with filterBy, filterOp,
+// filterVal and filterVals
+func (req ExploreRequest) filterByCondition() (FilterCondition, bool) {
+	if req.FilterBy == "" || req.FilterOp == "" {
+		return FilterCondition{}, false
+	}
+	return FilterCondition{Field: req.FilterBy, Op: req.FilterOp, Value: req.FilterVal, Values: req.FilterVals}, true
+}
+
+// whereSQL renders the request's WHERE condition, the filterBy condition and
+// the filter tree combined with AND, with placeholders numbered from argIndex.
+// It returns no condition when there is nothing to filter on.
+func whereSQL(req ExploreRequest, argIndex int) (string, []interface{}, error) {
+	var parts []string
+	var args []interface{}
+
+	if cond, ok := req.filterByCondition(); ok {
+		where, condArgs, err := conditionSQL(req, cond, argIndex)
+		if err != nil {
+			return "", nil, err
+		}
+		if where != "" {
+			parts = append(parts, where)
+			args = append(args, condArgs...)
+		}
+	}
+	if req.Filters != nil {
+		where, treeArgs, err := filterNodeSQL(req, *req.Filters, argIndex+len(args))
+		if err != nil {
+			return "", nil, err
+		}
+		if where != "" {
+			parts = append(parts, where)
+			args = append(args, treeArgs...)
+		}
+	}
+
+	// A tree of more than one condition comes back parenthesized
+	return strings.Join(parts, " AND "), args, nil
+}
+
+// filterNodeSQL renders a filter tree, parenthesizing every group of more
+// than one condition so and and or nest as written
+func filterNodeSQL(req ExploreRequest, node FilterNode, argIndex int) (string, []interface{}, error) {
+	if !node.IsGroup() {
+		return conditionSQL(req, node.FilterCondition, argIndex)
+	}
+
+	children, operator := node.Children()
+
+	var parts []string
+	var args []interface{}
+	for _, child := range children {
+		where, childArgs, err := filterNodeSQL(req, child, argIndex+len(args))
+		if err != nil {
+			return "", nil, err
+		}
+		if where == "" {
+			continue
+		}
+		parts = append(parts, where)
+		args = append(args, childArgs...)
+	}
+
+	switch len(parts) {
+	case 0:
+		return "", nil, nil
+	case 1:
+		return parts[0], args, nil
+	}
+	return "(" + strings.Join(parts, " "+operator+" ") + ")", args, nil
+}
+
+// conditionSQL renders a single condition with placeholders numbered from
+// argIndex, along with the values to bind to them. It returns no condition
+// when a value the operation needs is missing.
+func conditionSQL(req ExploreRequest, cond FilterCondition, argIndex int) (string, []interface{}, error) {
+	field := req.columnSQL(cond.Field)
+
+	switch cond.Op {
+	case "isnull":
+		return field + " IS NULL", nil, nil
+	case "isnotnull":
+		return field + " IS NOT NULL", nil, nil
+	case "between":
+		if len(cond.Values) != 2 {
+			return "", nil, nil
+		}
+		return fmt.Sprintf("%s BETWEEN $%d AND $%d", field, argIndex, argIndex+1),
+			[]interface{}{cond.Values[0], cond.Values[1]}, nil
+	case "in", "notin":
+		if len(cond.Values) == 0 {
+			return "", nil, nil
+		}
+		// Each value is bound separately
+		placeholders := make([]string, len(cond.Values))
+		args := make([]interface{}, len(cond.Values))
+		for i, value := range cond.Values {
+			placeholders[i] = fmt.Sprintf("$%d", argIndex+i)
+			args[i] = value
+		}
+		operator := "IN"
+		if cond.Op == "notin" {
+			operator = "NOT IN"
+		}
+		return fmt.Sprintf("%s %s (%s)", field, operator, strings.Join(placeholders, ", ")), args, nil
+	}
+
+	if cond.Value == "" {
+		return "", nil, nil
+	}
+	value := cond.Value
+	var where string
+	switch cond.Op {
+	case "eq":
+		where = fmt.Sprintf("%s = $%d", field, argIndex)
+	case "ne":
+		where = fmt.Sprintf("%s != $%d", field, argIndex)
+	case "gt":
+		where = fmt.Sprintf("%s > $%d", field, argIndex)
+	case "lt":
+		where = fmt.Sprintf("%s < $%d", field, argIndex)
+	case "gte":
+		where = fmt.Sprintf("%s >= $%d", field, argIndex)
+	case "lte":
+		where = fmt.Sprintf("%s <= $%d", field, argIndex)
+	case "like":
+		where = fmt.Sprintf("%s LIKE $%d", field, argIndex)
+		value = "%" + value + "%"
+	default:
+		return "", nil, fmt.Errorf("unsupported filter operation: %s", cond.Op)
+	}
+	return where, []interface{}{value}, nil
+}
@@ -0,0 +1,181 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// QueryHistoryEntry represents a single recorded query execution
+type QueryHistoryEntry struct {
+	ID         string    `json:"id"`
+	QueryType  string    `json:"queryType"` // raw, explore
+	User       string    `json:"user"`
+	Database   string    `json:"database"`
+	Query      string    `json:"query"`
+	RowCount   uint64    `json:"rowCount"`
+	DurationMs uint64    `json:"durationMs"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+}
+
+// QueryHistoryFilter narrows down the entries returned by ListQueryHistory
+type QueryHistoryFilter struct {
+	QueryType     string
+	User          string
+	Start         *time.Time
+	End           *time.Time
+	Success       *bool
+	MinDurationMs uint64
+	Limit         int
+	Offset        int
+}
+
+// RecordQuery stores a query execution in the query_history table
+func (c *ClickHouseClient) RecordQuery(ctx context.Context, entry QueryHistoryEntry) error {
+	if entry.ID == "" {
+		entry.ID = uuid.NewString()
+	}
+
+	query := `
+		INSERT INTO query_history (id, query_type, user, database, query, row_count, duration_ms, success, error, started_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	err := c.exec(ctx, query,
+		entry.ID,
+		entry.QueryType,
+		entry.User,
+		entry.Database,
+		entry.Query,
+		entry.RowCount,
+		entry.DurationMs,
+		entry.Success,
+		entry.Error,
+		entry.StartedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record query history: %w", err)
+	}
+
+	return nil
+}
+
+// ListQueryHistory returns the most recent history entries matching the filter
+// along with the total number of matching entries
+func (c *ClickHouseClient) ListQueryHistory(ctx context.Context, filter QueryHistoryFilter) ([]QueryHistoryEntry, uint64, error) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.QueryType != "" {
+		conditions = append(conditions, "query_type = ?")
+		args = append(args, filter.QueryType)
+	}
+	if filter.User != "" {
+		conditions = append(conditions, "user = ?")
+		args = append(args, filter.User)
+	}
+	if filter.Start != nil {
+		conditions = append(conditions, "started_at >= ?")
+		args = append(args, *filter.Start)
+	}
+	if filter.End != nil {
+		conditions = append(conditions, "started_at <= ?")
+		args = append(args, *filter.End)
+	}
+	if filter.Success != nil {
+		conditions = append(conditions, "success = ?")
+		args = append(args, *filter.Success)
+	}
+	if filter.MinDurationMs > 0 {
+		conditions = append(conditions, "duration_ms >= ?")
+		args = append(args, filter.MinDurationMs)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total uint64
+	if err := c.queryRow(ctx, "SELECT count() FROM query_history"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count query history: %w", err)
+	}
+
+	query := `
+		SELECT toString(id), query_type, user, database, query, row_count, duration_ms, success, error, started_at
+		FROM query_history` + where + `
+		ORDER BY started_at DESC
+		LIMIT ? OFFSET ?
+	`
+	rows, err := c.query(ctx, query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query history: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []QueryHistoryEntry{}
+	for rows.Next() {
+		var entry QueryHistoryEntry
+		err := rows.Scan(
+			&entry.ID,
+			&entry.QueryType,
+			&entry.User,
+			&entry.Database,
+			&entry.Query,
+			&entry.RowCount,
+			&entry.DurationMs,
+			&entry.Success,
+			&entry.Error,
+			&entry.StartedAt,
+		)
+		if err != nil {
+			c.logger.Error("error scanning query history row", "error", err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating query history rows: %w", err)
+	}
+
+	return entries, total, nil
+}
+
+// PruneQueryHistory deletes entries older than maxAge and, when maxRows is set,
+// everything beyond the newest maxRows entries. Zero values disable each rule.
+func (c *ClickHouseClient) PruneQueryHistory(ctx context.Context, maxAge time.Duration, maxRows int) error {
+	if maxAge > 0 {
+		cutoff := time.Now().Add(-maxAge)
+		if err := c.exec(ctx, "ALTER TABLE query_history DELETE WHERE started_at < ?", cutoff); err != nil {
+			return fmt.Errorf("failed to prune query history by age: %w", err)
+		}
+	}
+
+	if maxRows > 0 {
+		var total uint64
+		if err := c.queryRow(ctx, "SELECT count() FROM query_history").Scan(&total); err != nil {
+			return fmt.Errorf("failed to count query history: %w", err)
+		}
+		if total <= uint64(maxRows) {
+			return nil
+		}
+
+		var cutoff time.Time
+		err := c.queryRow(ctx,
+			"SELECT started_at FROM query_history ORDER BY started_at DESC LIMIT 1 OFFSET ?", maxRows,
+		).Scan(&cutoff)
+		if err != nil {
+			return fmt.Errorf("failed to find query history row cutoff: %w", err)
+		}
+		if err := c.exec(ctx, "ALTER TABLE query_history DELETE WHERE started_at <= ?", cutoff); err != nil {
+			return fmt.Errorf("failed to prune query history by row count: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,259 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrTableNotFound is returned when a table does not exist in the requested database
+var ErrTableNotFound = errors.New("table not found")
+
+// TableNotFoundError names the missing table, or only the database when the
+// whole database is missing. It matches ErrTableNotFound with errors.Is.
+type TableNotFoundError struct {
+	Database string
+	Table    string // empty when the database itself does not exist
+}
+
+func (e *TableNotFoundError) Error() string {
+	if e.Table == "" {
+		return fmt.Sprintf("%v: database %s does not exist", ErrTableNotFound, e.Database)
+	}
+	return fmt.Sprintf("%v: %s.%s", ErrTableNotFound, e.Database, e.Table)
+}
+
+// Is makes errors.Is(err, ErrTableNotFound) hold for a *TableNotFoundError
+func (e *TableNotFoundError) Is(target error) bool {
+	return target == ErrTableNotFound
+}
+
+// ErrInvalidIdentifier is returned when an explore request names a database,
+// table or column that does not exist, before any SQL is built from it
+var ErrInvalidIdentifier = errors.New("invalid identifier")
+
+// quoteIdentifier wraps a database, table or column name in backticks, escaping any embedded ones
+func quoteIdentifier(name string) string {
+	name = strings.ReplaceAll(name, "\\", "\\\\")
+	return "`" + strings.ReplaceAll(name, "`", "\\`") + "`"
+}
+
+// quoteIdentifiers quotes each name and joins them into a comma-separated list
+func quoteIdentifiers(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdentifier(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// checkTableExists returns a *TableNotFoundError unless database.table is listed by GetDatabases and GetTables
+func (c *ClickHouseClient) checkTableExists(ctx context.Context, database, table string) error {
+	databases, err := c.GetDatabases(ctx)
+	if err != nil {
+		return err
+	}
+	if !containsString(databases, database) {
+		return &TableNotFoundError{Database: database}
+	}
+
+	tables, err := c.GetTables(ctx, database)
+	if err != nil {
+		return err
+	}
+	if !containsString(tables, table) {
+		return &TableNotFoundError{Database: database, Table: table}
+	}
+
+	return nil
+}
+
+// columnNames returns the names of every column of a table
+func (c *ClickHouseClient) columnNames(ctx context.Context, database, table string) (map[string]bool, error) {
+	rows, err := c.query(ctx, `SELECT name FROM system.columns WHERE database = ? AND table = ?`, database, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query columns for %s.%s: %w", database, table, err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			c.logger.Error("error scanning column row", "error", err)
+			continue
+		}
+		columns[name] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating column rows: %w", err)
+	}
+
+	return columns, nil
+}
+
+// validateExploreIdentifiers checks every identifier of an explore request against
+// the live schema so that only existing names are ever concatenated into SQL.
+// A missing table is reported as a *TableNotFoundError, anything else that
+// does not exist as ErrInvalidIdentifier.
+func (c *ClickHouseClient) validateExploreIdentifiers(ctx context.Context, req ExploreRequest) error {
+	if err := c.checkTableExists(ctx, req.Database, req.Table); err != nil {
+		return err
+	}
+
+	columns, err := c.columnNames(ctx, req.Database, req.Table)
+	if err != nil {
+		return err
+	}
+
+	// Column references may point into joined tables, which are checked too
+	isColumn := func(ref string) bool { return columns[ref] }
+	if len(req.Joins) > 0 {
+		tables, err := c.validateJoinIdentifiers(ctx, req, columns)
+		if err != nil {
+			return err
+		}
+		isColumn = func(ref string) bool {
+			database, table, column := req.ResolveColumn(ref)
+			return tables[database+"."+table][column]
+		}
+	}
+
+	// JSON fields extract from a column and may be referenced like one, but
+	// not under the name of a column, which would become ambiguous
+	for _, field := range req.JSONFields {
+		if !isColumn(field.Column) {
+			return fmt.Errorf("%w: unknown column %q of JSON field %q", ErrInvalidIdentifier, field.Column, field.Name)
+		}
+		if isColumn(field.Name) {
+			return fmt.Errorf("%w: JSON field %q has the name of a column", ErrInvalidIdentifier, field.Name)
+		}
+	}
+	for _, field := range req.MapFields {
+		if !isColumn(field.Column) {
+			return fmt.Errorf("%w: unknown column %q of map field %q", ErrInvalidIdentifier, field.Column, field.Name)
+		}
+		if isColumn(field.Name) {
+			return fmt.Errorf("%w: map field %q has the name of a column", ErrInvalidIdentifier, field.Name)
+		}
+	}
+	known := func(ref string) bool {
+		return req.isVirtualField(ref) || isColumn(ref)
+	}
+
+	for _, field := range req.Fields {
+		if !known(field) {
+			return fmt.Errorf("%w: unknown field %q", ErrInvalidIdentifier, field)
+		}
+	}
+	for _, field := range req.GroupBy {
+		if !known(field) {
+			return fmt.Errorf("%w: unknown group by field %q", ErrInvalidIdentifier, field)
+		}
+	}
+	for _, cond := range req.FilterConditions() {
+		if !known(cond.Field) {
+			return fmt.Errorf("%w: unknown filter field %q", ErrInvalidIdentifier, cond.Field)
+		}
+	}
+	for _, spec := range req.Aggregates {
+		if spec.Field != "" && !known(spec.Field) {
+			return fmt.Errorf("%w: unknown aggregate field %q", ErrInvalidIdentifier, spec.Field)
+		}
+	}
+	// ClickHouse resolves an alias before a column of the same name anywhere
+	// in the query, so an alias may only reuse the name of its own column
+	for field, alias := range req.Aliases {
+		if columns[alias] && alias != field {
+			return fmt.Errorf("%w: alias %q of field %q is the name of another column", ErrInvalidIdentifier, alias, field)
+		}
+	}
+	for _, spec := range req.OrderBy {
+		if !known(spec.Field) && !isAggregateResult(req, spec.Field) && !req.isFieldAlias(spec.Field) {
+			return fmt.Errorf("%w: unknown order by field %q", ErrInvalidIdentifier, spec.Field)
+		}
+	}
+
+	return nil
+}
+
+// GetDistinctValues returns up to limit distinct non-null values of a column as strings, in column order
+func (c *ClickHouseClient) GetDistinctValues(ctx context.Context, database, table, column string, limit int) ([]string, error) {
+	if err := c.checkTableExists(ctx, database, table); err != nil {
+		return nil, err
+	}
+
+	columns, err := c.columnNames(ctx, database, table)
+	if err != nil {
+		return nil, err
+	}
+	if !columns[column] {
+		return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidIdentifier, column)
+	}
+
+	col := quoteIdentifier(column)
+	query := fmt.Sprintf(
+		"SELECT toString(%s) FROM %s.%s WHERE %s IS NOT NULL GROUP BY %s ORDER BY %s LIMIT ?",
+		col, quoteIdentifier(database), quoteIdentifier(table), col, col, col,
+	)
+
+	rows, err := c.query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query distinct values of %s.%s.%s: %w", database, table, column, err)
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			c.logger.Error("error scanning distinct value row", "error", err)
+			continue
+		}
+		values = append(values, value)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating distinct value rows: %w", err)
+	}
+
+	return values, nil
+}
+
+// isAggregateResult reports whether name is the result column of one of the request's aggregates
+func isAggregateResult(req ExploreRequest, name string) bool {
+	if name == aggregateAlias(req) && name != "" {
+		return true
+	}
+	for _, spec := range req.Aggregates {
+		if spec.ResultName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// aggregateAlias returns the result column name of the request's aggregate, if any
+func aggregateAlias(req ExploreRequest) string {
+	// buildExploreQuery only aggregates when at least one field is selected
+	switch {
+	case req.Aggregate == "" || len(req.Fields) == 0:
+		return ""
+	case req.Aggregate == "count":
+		return "count"
+	default:
+		return req.Aggregate + "_" + req.Fields[0]
+	}
+}
+
+// containsString reports whether values contains s
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package database
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// maliciousNames are identifiers that would break out of a naively quoted name
+var maliciousNames = []string{
+	"x` FROM system.users --",
+	"x`; DROP TABLE logs; --",
+	"x\\` UNION SELECT password FROM system.users --",
+	"x\\",
+	"x``; DROP TABLE logs",
+	"`",
+}
+
+// maliciousValues are filter values that would break out of a string literal
+var maliciousValues = []string{
+	"' OR 1=1 --",
+	"'; DROP TABLE logs; --",
+	"\\'; SELECT sleep(3) --",
+	"$1",
+}
+
+// injectedKeywords are keywords none of the built queries use, so finding one
+// outside quotes means a name or value escaped its quoting
+var injectedKeywords = []string{"drop", "union", "users", "password", "sleep"}
+
+// assertNoInjectedKeywords fails when query has one of injectedKeywords
+// outside string literals and quoted identifiers
+func assertNoInjectedKeywords(t *testing.T, query string) {
+	t.Helper()
+	for _, word := range keywords(query) {
+		if slices.Contains(injectedKeywords, word) {
+			t.Errorf("query has %q outside quotes: %s", word, query)
+		}
+	}
+}
+
+func TestQuoteIdentifierEscapesMaliciousNames(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Body", "`Body`"},
+		{"x` FROM system.users --", "`x\\` FROM system.users --`"},
+		{"x\\` UNION", "`x\\\\\\` UNION`"},
+		{"x\\", "`x\\\\`"},
+	}
+	for _, tt := range tests {
+		if got := quoteIdentifier(tt.name); got != tt.want {
+			t.Errorf("quoteIdentifier(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	// Whatever the name, the quoted form is a single quoted section
+	for _, name := range maliciousNames {
+		quoted := quoteIdentifier(name)
+		if end := quotedEnd(quoted, 0); end != len(quoted) {
+			t.Errorf("quoteIdentifier(%q) = %s closes at %d of %d", name, quoted, end, len(quoted))
+		}
+	}
+}
+
+func TestBuildExploreQueryQuotesMaliciousIdentifiers(t *testing.T) {
+	for _, name := range maliciousNames {
+		requests := map[string]ExploreRequest{
+			"database": {Database: name, Table: "logs", Fields: []string{"Body"}, Limit: 10},
+			"table":    {Database: "otel", Table: name, Fields: []string{"Body"}, Limit: 10},
+			"field":    {Database: "otel", Table: "logs", Fields: []string{name}, Limit: 10},
+			"orderBy":  {Database: "otel", Table: "logs", Fields: []string{"Body"}, OrderBy: OrderByList{{Field: name}}, Limit: 10},
+			"groupBy": {
+				Database: "otel", Table: "logs", Fields: []string{name}, GroupBy: []string{name},
+				Aggregates: []AggregateSpec{{Func: "count"}}, Limit: 10,
+			},
+			"aggregate": {
+				Database: "otel", Table: "logs",
+				Aggregates: []AggregateSpec{{Func: "sum", Field: name, Alias: name}}, Limit: 10,
+			},
+			"filterBy": {Database: "otel", Table: "logs", Fields: []string{"Body"}, FilterBy: name, FilterOp: "eq", FilterVal: "x", Limit: 10},
+		}
+		for part, req := range requests {
+			query, _, err := buildExploreQuery(req)
+			if err != nil {
+				t.Errorf("buildExploreQuery(%s %q) failed: %v", part, name, err)
+				continue
+			}
+			if !strings.Contains(query, quoteIdentifier(name)) {
+				t.Errorf("buildExploreQuery(%s %q) = %s, want the name quoted", part, name, query)
+			}
+			assertNoInjectedKeywords(t, query)
+		}
+	}
+}
+
+func TestWhereSQLBindsMaliciousValues(t *testing.T) {
+	for _, value := range maliciousValues {
+		conditions := []FilterCondition{
+			{Field: "Body", Op: "eq", Value: value},
+			{Field: "Body", Op: "ne", Value: value},
+			{Field: "Body", Op: "gte", Value: value},
+			{Field: "Body", Op: "like", Value: value},
+			{Field: "Body", Op: "in", Values: []string{"a", value}},
+			{Field: "Body", Op: "notin", Values: []string{value}},
+			{Field: "Body", Op: "between", Values: []string{value, value}},
+		}
+		for _, cond := range conditions {
+			req := ExploreRequest{
+				Database: "otel", Table: "logs",
+				Filters: &FilterNode{Or: []FilterNode{{FilterCondition: cond}, {FilterCondition: cond}}},
+			}
+			where, args, err := whereSQL(req, 1)
+			if err != nil {
+				t.Errorf("whereSQL(%s %q) failed: %v", cond.Op, value, err)
+				continue
+			}
+			if value != "$1" && strings.Contains(where, value) {
+				t.Errorf("whereSQL(%s %q) = %s, want the value bound rather than inlined", cond.Op, value, where)
+			}
+			assertNoInjectedKeywords(t, where)
+
+			bound := false
+			for _, arg := range args {
+				if s, ok := arg.(string); ok && strings.Contains(s, value) {
+					bound = true
+				}
+			}
+			if !bound {
+				t.Errorf("whereSQL(%s %q) args = %v, want them to hold the value", cond.Op, value, args)
+			}
+		}
+	}
+}
+
+func TestValidateRejectsMaliciousDeclaredNames(t *testing.T) {
+	for _, name := range append(maliciousNames, "a b", "a.b", "a-b", "1a", "") {
+		req := ExploreRequest{JSONFields: []JSONField{{Name: name, Column: "Body", Type: "string", Path: "$.user"}}}
+		if err := req.ValidateJSONFields(); err == nil {
+			t.Errorf("ValidateJSONFields accepted name %q", name)
+		}
+
+		req = ExploreRequest{MapFields: []MapField{{Name: name, Column: "LogAttributes", Key: "http.status"}}}
+		if err := req.ValidateMapFields(); err == nil {
+			t.Errorf("ValidateMapFields accepted name %q", name)
+		}
+
+		if name == "" {
+			// An empty alias defaults to the table name
+			continue
+		}
+		req = ExploreRequest{
+			Database: "otel", Table: "logs",
+			Joins: []JoinSpec{{Table: "traces", Alias: name, On: []JoinCondition{{Left: "TraceId", Right: "TraceId"}}}},
+		}
+		if err := req.ValidateJoins(); err == nil {
+			t.Errorf("ValidateJoins accepted alias %q", name)
+		}
+	}
+}
+
+func TestValidateRejectsMaliciousLiterals(t *testing.T) {
+	keys := []string{"a']; DROP TABLE logs; --", "a'b", "a\\", "$1", "a?", "a b", "a\nb"}
+	for _, key := range keys {
+		req := ExploreRequest{MapFields: []MapField{{Name: "status", Column: "LogAttributes", Key: key}}}
+		if err := req.ValidateMapFields(); err == nil {
+			t.Errorf("ValidateMapFields accepted key %q", key)
+		}
+	}
+
+	paths := []string{"$.a'); DROP TABLE logs; --", "$.a'b", "$.a\\", "$.$1", "$.a?", "$.a[1 OR 1]"}
+	for _, path := range paths {
+		req := ExploreRequest{JSONFields: []JSONField{{Name: "user", Column: "Body", Type: "string", Path: path}}}
+		if err := req.ValidateJSONFields(); err == nil {
+			t.Errorf("ValidateJSONFields accepted path %q", path)
+		}
+	}
+}
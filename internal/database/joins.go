@@ -0,0 +1,228 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// JoinSpec joins another table into an explore query
+type JoinSpec struct {
+	Database string          `json:"database,omitempty"` // defaults to the request's database
+	Table    string          `json:"table"`
+	Alias    string          `json:"alias,omitempty"` // defaults to the table name
+	Type     string          `json:"type,omitempty"`  // inner (default) or left
+	On       []JoinCondition `json:"on"`
+}
+
+// JoinCondition equates a column of an already joined table with a column of
+// the table being joined
+type JoinCondition struct {
+	Left  string `json:"left"`  // column reference, e.g. "TraceId" or "otel_logs.TraceId"
+	Right string `json:"right"` // column of the joined table
+}
+
+// tableAliasPattern restricts table aliases to plain identifiers
+var tableAliasPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// joinTypes maps the accepted join types to their SQL keywords
+var joinTypes = map[string]string{
+	"":      "INNER JOIN",
+	"inner": "INNER JOIN",
+	"left":  "LEFT JOIN",
+}
+
+// JoinDatabase returns the database of the joined table
+func (j JoinSpec) JoinDatabase(req ExploreRequest) string {
+	if j.Database != "" {
+		return j.Database
+	}
+	return req.Database
+}
+
+// TableAlias returns the alias the joined table is referenced by
+func (j JoinSpec) TableAlias() string {
+	if j.Alias != "" {
+		return j.Alias
+	}
+	return j.Table
+}
+
+// ValidateJoins checks the shape of the request's joins: known join types,
+// plain and unique aliases and at least one ON condition each. Whether the
+// named tables and columns exist is checked against the schema at query time.
+func (req ExploreRequest) ValidateJoins() error {
+	aliases := map[string]bool{req.Table: true}
+	for i, join := range req.Joins {
+		if join.Table == "" {
+			return fmt.Errorf("joins[%d]: table is required", i)
+		}
+		if _, ok := joinTypes[strings.ToLower(join.Type)]; !ok {
+			return fmt.Errorf("joins[%d]: invalid join type %q (must be 'inner' or 'left')", i, join.Type)
+		}
+		alias := join.TableAlias()
+		if !tableAliasPattern.MatchString(alias) {
+			return fmt.Errorf("joins[%d]: invalid alias %q (letters, digits and underscores only)", i, alias)
+		}
+		if aliases[alias] {
+			return fmt.Errorf("joins[%d]: table alias %q is already in use, set a distinct alias", i, alias)
+		}
+		aliases[alias] = true
+		if len(join.On) == 0 {
+			return fmt.Errorf("joins[%d]: at least one on condition is required", i)
+		}
+		for j, cond := range join.On {
+			if cond.Left == "" || cond.Right == "" {
+				return fmt.Errorf("joins[%d].on[%d]: left and right columns are required", i, j)
+			}
+		}
+	}
+	return nil
+}
+
+// ResolveColumn returns the database, table and column a column reference of
+// the request points at. Once tables are joined, "alias.column" names a column
+// of the joined table (or the request's own table) with that alias; any other
+// reference is a column of the request's table.
+func (req ExploreRequest) ResolveColumn(ref string) (database, table, column string) {
+	if len(req.Joins) == 0 {
+		return req.Database, req.Table, ref
+	}
+	return req.resolveColumnIn(ref, req.Joins)
+}
+
+// resolveColumnIn resolves ref against the request's table and the given joins
+func (req ExploreRequest) resolveColumnIn(ref string, joins []JoinSpec) (database, table, column string) {
+	if alias, name, ok := strings.Cut(ref, "."); ok {
+		if alias == req.Table {
+			return req.Database, req.Table, name
+		}
+		for _, join := range joins {
+			if join.TableAlias() == alias {
+				return join.JoinDatabase(req), join.Table, name
+			}
+		}
+	}
+	return req.Database, req.Table, ref
+}
+
+// columnSQL renders a column reference; once tables are joined it is
+// qualified with its table alias so identically named columns stay apart.
+// A JSON field renders as its extraction, a map field as its lookup.
+func (req ExploreRequest) columnSQL(ref string) string {
+	if field, ok := req.JSONFieldByName(ref); ok {
+		return req.jsonFieldSQL(field)
+	}
+	if field, ok := req.MapFieldByName(ref); ok {
+		return req.mapFieldSQL(field)
+	}
+	return req.tableColumnSQL(ref)
+}
+
+// tableColumnSQL renders a reference to a column of one of the query's tables
+func (req ExploreRequest) tableColumnSQL(ref string) string {
+	if len(req.Joins) == 0 {
+		return quoteIdentifier(ref)
+	}
+	if alias, name, ok := strings.Cut(ref, "."); ok && req.isTableAlias(alias) {
+		return quoteIdentifier(alias) + "." + quoteIdentifier(name)
+	}
+	return quoteIdentifier(req.Table) + "." + quoteIdentifier(ref)
+}
+
+// selectColumnSQL renders a selected column under its alias, if any; with
+// joins, and for JSON and map fields, it is otherwise returned under the reference
+// the client asked for rather than a name ClickHouse picks
+func (req ExploreRequest) selectColumnSQL(ref string) string {
+	if alias := req.Aliases[ref]; alias != "" {
+		return req.columnSQL(ref) + " AS " + quoteIdentifier(alias)
+	}
+	if req.isVirtualField(ref) || len(req.Joins) > 0 {
+		return req.columnSQL(ref) + " AS " + quoteIdentifier(ref)
+	}
+	return quoteIdentifier(ref)
+}
+
+// isTableAlias reports whether alias names the request's table or a joined one
+func (req ExploreRequest) isTableAlias(alias string) bool {
+	if alias == req.Table {
+		return true
+	}
+	for _, join := range req.Joins {
+		if join.TableAlias() == alias {
+			return true
+		}
+	}
+	return false
+}
+
+// fromSQL renders the FROM clause including every join
+func (req ExploreRequest) fromSQL() (string, error) {
+	from := quoteIdentifier(req.Database) + "." + quoteIdentifier(req.Table)
+	if len(req.Joins) == 0 {
+		return from, nil
+	}
+
+	from += " AS " + quoteIdentifier(req.Table)
+	for i, join := range req.Joins {
+		keyword, ok := joinTypes[strings.ToLower(join.Type)]
+		if !ok {
+			return "", fmt.Errorf("joins[%d]: unsupported join type: %s", i, join.Type)
+		}
+		alias := join.TableAlias()
+
+		conditions := make([]string, len(join.On))
+		for j, cond := range join.On {
+			conditions[j] = fmt.Sprintf("%s = %s.%s", req.columnSQL(cond.Left), quoteIdentifier(alias), quoteIdentifier(join.rightColumn(cond)))
+		}
+
+		from += fmt.Sprintf(" %s %s.%s AS %s ON %s", keyword,
+			quoteIdentifier(join.JoinDatabase(req)), quoteIdentifier(join.Table), quoteIdentifier(alias),
+			strings.Join(conditions, " AND "))
+	}
+	return from, nil
+}
+
+// rightColumn strips an optional "alias." prefix from the right side of a condition
+func (j JoinSpec) rightColumn(cond JoinCondition) string {
+	if name, ok := strings.CutPrefix(cond.Right, j.TableAlias()+"."); ok {
+		return name
+	}
+	return cond.Right
+}
+
+// validateJoinIdentifiers checks the joined tables and their ON columns against
+// the live schema, and returns the columns of every table in the query keyed by
+// "database.table"
+func (c *ClickHouseClient) validateJoinIdentifiers(ctx context.Context, req ExploreRequest, baseColumns map[string]bool) (map[string]map[string]bool, error) {
+	tables := map[string]map[string]bool{req.Database + "." + req.Table: baseColumns}
+
+	for i, join := range req.Joins {
+		database := join.JoinDatabase(req)
+		key := database + "." + join.Table
+		if _, ok := tables[key]; !ok {
+			if err := c.checkTableExists(ctx, database, join.Table); err != nil {
+				return nil, err
+			}
+			columns, err := c.columnNames(ctx, database, join.Table)
+			if err != nil {
+				return nil, err
+			}
+			tables[key] = columns
+		}
+
+		// Conditions may only refer back to tables joined before this one
+		for _, cond := range join.On {
+			leftDatabase, leftTable, leftColumn := req.resolveColumnIn(cond.Left, req.Joins[:i])
+			if !tables[leftDatabase+"."+leftTable][leftColumn] {
+				return nil, fmt.Errorf("%w: unknown join column %q", ErrInvalidIdentifier, cond.Left)
+			}
+			if !tables[key][join.rightColumn(cond)] {
+				return nil, fmt.Errorf("%w: unknown join column %q in %s", ErrInvalidIdentifier, cond.Right, join.Table)
+			}
+		}
+	}
+
+	return tables, nil
+}
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// JSONField is a virtual field of an explore request holding a value
+// extracted from a column of JSON text, e.g. the status of
+// {"request": {"status": 404}} in a log Body. Once declared it is referenced
+// by its name like any column in fields, groupBy, orderBy, filterBy and
+// aggregates, and returned under that name.
+type JSONField struct {
+	Name   string `json:"name"`
+	Column string `json:"column"`         // column holding the JSON, e.g. "Body" or "alias.Body"
+	Path   string `json:"path"`           // e.g. "$.request.status" or "$.items[0].id"
+	Type   string `json:"type,omitempty"` // string (default), int, uint, float, bool or raw
+}
+
+// jsonExtractFuncs maps the accepted JSON field types to the ClickHouse
+// function extracting them
+var jsonExtractFuncs = map[string]string{
+	"":       "JSONExtractString",
+	"string": "JSONExtractString",
+	"int":    "JSONExtractInt",
+	"uint":   "JSONExtractUInt",
+	"float":  "JSONExtractFloat",
+	"bool":   "JSONExtractBool",
+	"raw":    "JSONExtractRaw",
+}
+
+// jsonFieldTypes maps the JSON field types to the ClickHouse type of the
+// extracted value
+var jsonFieldTypes = map[string]string{
+	"":       "String",
+	"string": "String",
+	"int":    "Int64",
+	"uint":   "UInt64",
+	"float":  "Float64",
+	"bool":   "Bool",
+	"raw":    "String",
+}
+
+// jsonPathKeyPattern restricts the keys of a JSON path, which are written
+// into the query as string literals
+var jsonPathKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// maxJSONPathDepth caps the number of keys and indexes in a JSON path
+const maxJSONPathDepth = 16
+
+// ValueType returns the ClickHouse type of the extracted value
+func (f JSONField) ValueType() string {
+	return jsonFieldTypes[f.Type]
+}
+
+// ValidateJSONFields checks the shape of the request's JSON fields: plain and
+// unique names, a column, a known type and a well-formed path. Whether the
+// column exists is checked against the schema at query time.
+func (req ExploreRequest) ValidateJSONFields() error {
+	names := make(map[string]bool, len(req.JSONFields))
+	for i, field := range req.JSONFields {
+		if !tableAliasPattern.MatchString(field.Name) {
+			return fmt.Errorf("jsonFields[%d]: invalid name %q (letters, digits and underscores only)", i, field.Name)
+		}
+		if names[field.Name] {
+			return fmt.Errorf("jsonFields[%d]: duplicate name %q", i, field.Name)
+		}
+		names[field.Name] = true
+		if field.Column == "" {
+			return fmt.Errorf("jsonFields[%d]: column is required", i)
+		}
+		if _, ok := jsonExtractFuncs[field.Type]; !ok {
+			return fmt.Errorf("jsonFields[%d]: invalid type %q (must be string, int, uint, float, bool or raw)", i, field.Type)
+		}
+		if _, err := parseJSONPath(field.Path); err != nil {
+			return fmt.Errorf("jsonFields[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// JSONFieldByName returns the JSON field declared under name, if any
+func (req ExploreRequest) JSONFieldByName(name string) (JSONField, bool) {
+	for _, field := range req.JSONFields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return JSONField{}, false
+}
+
+// jsonFieldSQL renders the extraction of a JSON field, e.g.
+// JSONExtractInt(`Body`, 'request', 'status')
+func (req ExploreRequest) jsonFieldSQL(field JSONField) string {
+	// The path was checked by ValidateJSONFields; an invalid one extracts nothing
+	path, _ := parseJSONPath(field.Path)
+	args := []string{req.tableColumnSQL(field.Column)}
+	args = append(args, path...)
+	return jsonExtractFuncs[field.Type] + "(" + strings.Join(args, ", ") + ")"
+}
+
+// parseJSONPath splits a path such as $.request.headers[0].name into the
+// arguments of the JSONExtract functions: keys as quoted string literals and
+// array indexes, which ClickHouse counts from 1, as numbers. The leading "$."
+// is optional.
+func parseJSONPath(path string) ([]string, error) {
+	rest := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if rest == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+
+	var args []string
+	for rest != "" {
+		if len(args) == maxJSONPathDepth {
+			return nil, fmt.Errorf("path %q is deeper than %d levels", path, maxJSONPathDepth)
+		}
+
+		if strings.HasPrefix(rest, "[") {
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("path %q has an unclosed [", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("path %q has an invalid array index %q", path, rest[1:end])
+			}
+			args = append(args, strconv.Itoa(index+1))
+			rest = rest[end+1:]
+			if rest != "" && rest[0] != '.' && rest[0] != '[' {
+				return nil, fmt.Errorf("path %q is missing a . after an array index", path)
+			}
+		} else {
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			if !jsonPathKeyPattern.MatchString(key) {
+				return nil, fmt.Errorf("path %q has an invalid key %q (letters, digits, underscores and hyphens only)", path, key)
+			}
+			args = append(args, "'"+key+"'")
+			rest = rest[end:]
+		}
+
+		if strings.HasPrefix(rest, ".") {
+			rest = rest[1:]
+			if rest == "" || strings.HasPrefix(rest, "[") {
+				return nil, fmt.Errorf("path %q has an empty key", path)
+			}
+		}
+	}
+	return args, nil
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrLogNotFound is returned when no log entry matches a line ID
+var ErrLogNotFound = errors.New("log entry not found")
+
+// LogContext is a log entry with the entries logged around it by the same component
+type LogContext struct {
+	// Logs holds the surrounding entries and the anchor, oldest first
+	Logs []LogEntry `json:"logs"`
+	// AnchorIndex is the position of the requested entry in Logs
+	AnchorIndex int `json:"anchorIndex"`
+}
+
+// GetLogContext returns up to before entries logged just before the entry
+// at anchor and up to after entries logged just after it, like grep -C, all
+// from the anchor's component. Entries sharing the anchor's timestamp are
+// ordered by the same key as pagination, so none is returned twice.
+func (c *ClickHouseClient) GetLogContext(ctx context.Context, anchor LogCursor, before, after int) (*LogContext, error) {
+	found, err := c.GetLogs(ctx, LogFilter{At: &anchor, Limit: 1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up log entry: %w", err)
+	}
+	if len(found) == 0 {
+		return nil, ErrLogNotFound
+	}
+	entry := found[0]
+
+	var older, newer []LogEntry
+	if before > 0 {
+		older, err = c.GetLogs(ctx, LogFilter{Service: entry.Component, Before: &anchor, Limit: before})
+		if err != nil {
+			return nil, fmt.Errorf("failed to query preceding log entries: %w", err)
+		}
+		// Fetched newest first to get the closest ones
+		slices.Reverse(older)
+	}
+	if after > 0 {
+		newer, err = c.GetLogs(ctx, LogFilter{Service: entry.Component, Since: &anchor, Ascending: true, Limit: after})
+		if err != nil {
+			return nil, fmt.Errorf("failed to query following log entries: %w", err)
+		}
+	}
+
+	logs := make([]LogEntry, 0, len(older)+1+len(newer))
+	logs = append(logs, older...)
+	logs = append(logs, entry)
+	logs = append(logs, newer...)
+	return &LogContext{Logs: logs, AnchorIndex: len(older)}, nil
+}
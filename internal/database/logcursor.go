@@ -0,0 +1,71 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// logCursorKeyExpr breaks ties between log entries that share a timestamp so
+// keyset pagination neither skips nor repeats rows
+const logCursorKeyExpr = "cityHash64(Timestamp, TraceId, SpanId, Body)"
+
+// LogCursor marks a position in the newest-first log order; GetLogs returns
+// only entries that sort strictly after it
+type LogCursor struct {
+	Timestamp time.Time
+	Key       uint64
+}
+
+// String encodes the cursor as an opaque URL-safe token
+func (c LogCursor) String() string {
+	raw := strconv.FormatInt(c.Timestamp.UnixNano(), 10) + ":" + strconv.FormatUint(c.Key, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseLogCursor decodes a token produced by LogCursor.String
+func ParseLogCursor(token string) (LogCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return LogCursor{}, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+
+	nanos, key, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return LogCursor{}, ErrInvalidCursor
+	}
+	ts, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return LogCursor{}, fmt.Errorf("%w: bad timestamp", ErrInvalidCursor)
+	}
+	k, err := strconv.ParseUint(key, 10, 64)
+	if err != nil {
+		return LogCursor{}, fmt.Errorf("%w: bad key", ErrInvalidCursor)
+	}
+
+	return LogCursor{Timestamp: time.Unix(0, ts).UTC(), Key: k}, nil
+}
+
+// InLocation returns the entry with its Timestamp shown in loc
+func (e LogEntry) InLocation(loc *time.Location) LogEntry {
+	e.Timestamp = formatLogTime(e.at.In(loc))
+	return e
+}
+
+// formatLogTime formats the timestamp of a log entry as RFC3339 with
+// nanoseconds, carrying the offset of its location
+func formatLogTime(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
+
+// Cursor returns the position just after this entry, to be passed as
+// LogFilter.Before to fetch the next page
+func (e LogEntry) Cursor() LogCursor {
+	return LogCursor{Timestamp: e.at, Key: e.cursorKey}
+}
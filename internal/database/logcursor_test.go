@@ -0,0 +1,38 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogCursorRoundTrip(t *testing.T) {
+	cursor := LogCursor{Timestamp: time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC), Key: 42}
+	parsed, err := ParseLogCursor(cursor.String())
+	if err != nil || !parsed.Timestamp.Equal(cursor.Timestamp) || parsed.Key != cursor.Key {
+		t.Errorf("ParseLogCursor(%s) = %+v, %v, want %+v", cursor, parsed, err, cursor)
+	}
+
+	for _, token := range []string{"!!", "MTIz", "YTox"} {
+		if _, err := ParseLogCursor(token); err == nil {
+			t.Errorf("ParseLogCursor(%q) succeeded, want an error", token)
+		}
+	}
+}
+
+func TestBuildLogsWhereBindsCursorsInNanoseconds(t *testing.T) {
+	cursor := LogCursor{Timestamp: time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC), Key: 42}
+	for name, filter := range map[string]LogFilter{
+		"since":  {Since: &cursor},
+		"before": {Before: &cursor},
+		"at":     {At: &cursor},
+	} {
+		where, args := buildLogsWhere(filter)
+		if !strings.Contains(where, "fromUnixTimestamp64Nano($1)") || !strings.Contains(where, logCursorKeyExpr) {
+			t.Errorf("%s: where is %s, want the cursor compared on the timestamp in nanoseconds and the key", name, where)
+		}
+		if len(args) != 2 || args[0] != cursor.Timestamp.UnixNano() || args[1] != cursor.Key {
+			t.Errorf("%s: args are %v, want the timestamp in nanoseconds and the key", name, args)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// logGroupOrders maps the sort orders accepted by GetGroupedLogs to their
+// ORDER BY clauses, each with the event ID as a tie-breaker
+var logGroupOrders = map[string]string{
+	"count":     "c DESC, event_id ASC",
+	"lastSeen":  "max(Timestamp) DESC, event_id ASC",
+	"firstSeen": "min(Timestamp) DESC, event_id ASC",
+}
+
+// LogGroupOrders returns the sort orders GetGroupedLogs accepts, sorted
+func LogGroupOrders() []string {
+	orders := make([]string, 0, len(logGroupOrders))
+	for order := range logGroupOrders {
+		orders = append(orders, order)
+	}
+	sort.Strings(orders)
+	return orders
+}
+
+// LogGroup is a set of log entries with the same message, identified by the
+// eventId of its entries
+type LogGroup struct {
+	EventId string `json:"eventId"`
+	Content string `json:"content"`
+	// Level is the most severe level among the entries of the group
+	Level string `json:"level"`
+	Count int64  `json:"count"`
+	// FirstSeen and LastSeen are formatted like LogEntry.Timestamp
+	FirstSeen string `json:"firstSeen"`
+	LastSeen  string `json:"lastSeen"`
+
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+// InLocation returns the group with its times shown in loc
+func (g LogGroup) InLocation(loc *time.Location) LogGroup {
+	g.FirstSeen = formatLogTime(g.firstSeen.In(loc))
+	g.LastSeen = formatLogTime(g.lastSeen.In(loc))
+	return g
+}
+
+// GetGroupedLogs collapses the log entries matching filter into one group per
+// distinct Body, hashed with cityHash64 like the eventId of GetLogs, and
+// returns up to filter.Limit groups ordered by orderBy, one of LogGroupOrders.
+// Offset and the cursors of filter are ignored.
+func (c *ClickHouseClient) GetGroupedLogs(ctx context.Context, filter LogFilter, orderBy string) ([]LogGroup, error) {
+	order, ok := logGroupOrders[orderBy]
+	if !ok {
+		return nil, fmt.Errorf("unsupported log group order %q (must be one of %s)", orderBy, strings.Join(LogGroupOrders(), ", "))
+	}
+
+	limit := filter.Limit
+	filter.Before = nil
+	filter.Since = nil
+	filter.At = nil
+	filter.Offset = 0
+	where, args := buildLogsWhere(filter)
+
+	query := `
+		SELECT
+			toString(cityHash64(Body)) as event_id,
+			any(Body) as content,
+			argMax(SeverityText, SeverityNumber) as level,
+			count() as c,
+			min(Timestamp) as first_seen,
+			max(Timestamp) as last_seen
+		FROM otel_logs
+	` + where + " GROUP BY cityHash64(Body) ORDER BY " + order
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT $%d", len(args)+1)
+		args = append(args, limit)
+	}
+
+	rows, err := c.query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query log groups: %w", err)
+	}
+	defer rows.Close()
+
+	groups := []LogGroup{}
+	for rows.Next() {
+		var group LogGroup
+		var count uint64
+		if err := rows.Scan(&group.EventId, &group.Content, &group.Level, &count, &group.firstSeen, &group.lastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan log group: %w", err)
+		}
+		group.Count = int64(count)
+		group = group.InLocation(time.UTC)
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,54 @@
+//go:build integration
+
+package database
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTailLogsDoesNotRepeatEntries(t *testing.T) {
+	c := newIntegrationClient(t, ClientOptions{})
+	ctx := context.Background()
+
+	var exists uint8
+	if err := c.queryRow(ctx, "EXISTS TABLE otel_logs").Scan(&exists); err != nil || exists == 0 {
+		t.Skipf("otel_logs is not set up: %v", err)
+	}
+
+	// Entries within one second, two of them sharing a timestamp
+	service := "observio_tail_check_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	start := time.Now().UTC().Truncate(time.Second)
+	records := []LogRecord{
+		{Timestamp: start.Add(100 * time.Millisecond), Level: "INFO", Component: service, Body: "first"},
+		{Timestamp: start.Add(200 * time.Millisecond), Level: "INFO", Component: service, Body: "second"},
+		{Timestamp: start.Add(200 * time.Millisecond), Level: "INFO", Component: service, Body: "third"},
+	}
+	if err := c.InsertLogs(ctx, records); err != nil {
+		t.Fatalf("InsertLogs: %v", err)
+	}
+
+	filter := LogFilter{Service: service, Limit: 2}
+	after := LogCursor{Timestamp: start}
+	var bodies []string
+	for range 3 {
+		logs, latest, err := c.TailLogs(ctx, filter, after)
+		if err != nil {
+			t.Fatalf("TailLogs: %v", err)
+		}
+		for _, entry := range logs {
+			bodies = append(bodies, entry.Content)
+		}
+		after = latest
+	}
+	if len(bodies) != len(records) {
+		t.Errorf("tailing returned %q, want every entry exactly once", bodies)
+	}
+
+	logs, _, err := c.TailLogs(ctx, filter, after)
+	if err != nil || len(logs) != 0 {
+		t.Errorf("TailLogs after the latest cursor returned %d entries, %v, want none", len(logs), err)
+	}
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// logTopNFields maps the fields accepted by GetTopN to their otel_logs expressions
+var logTopNFields = map[string]string{
+	"level":     "SeverityText",
+	"component": "ServiceName",
+	"content":   "Body",
+	"traceId":   "TraceId",
+	"spanId":    "SpanId",
+	"pid":       "ResourceAttributes['process.pid']",
+}
+
+// LogTopNFields returns the fields GetTopN can count by, sorted
+func LogTopNFields() []string {
+	fields := make([]string, 0, len(logTopNFields))
+	for field := range logTopNFields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// TopNEntry is one value of a field with the number of log entries that have it
+type TopNEntry struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// GetTopN returns the n most frequent values of field among the log entries
+// matching filter, most frequent first; field must be one of LogTopNFields.
+// Limit, Offset and the cursors of filter are ignored.
+func (c *ClickHouseClient) GetTopN(ctx context.Context, field string, n int, filter LogFilter) ([]TopNEntry, error) {
+	expr, ok := logTopNFields[field]
+	if !ok {
+		return nil, fmt.Errorf("unsupported top-n field %q (must be one of %s)", field, strings.Join(LogTopNFields(), ", "))
+	}
+	if n < 1 {
+		return nil, fmt.Errorf("top-n count must be at least 1")
+	}
+
+	filter.Before = nil
+	filter.Since = nil
+	filter.At = nil
+	where, args := buildLogsWhere(filter)
+
+	query := `
+		SELECT ` + expr + ` as value, count() as c
+		FROM otel_logs
+	` + where + fmt.Sprintf(" GROUP BY value ORDER BY c DESC, value ASC LIMIT $%d", len(args)+1)
+	args = append(args, n)
+
+	rows, err := c.query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query top %s values: %w", field, err)
+	}
+	defer rows.Close()
+
+	entries := []TopNEntry{}
+	for rows.Next() {
+		var entry TopNEntry
+		var count uint64
+		if err := rows.Scan(&entry.Value, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan top %s value: %w", field, err)
+		}
+		entry.Count = int64(count)
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return entries, nil
+}
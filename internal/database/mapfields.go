@@ -0,0 +1,84 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// MapField is a virtual field of an explore request holding the value of one
+// key of a Map column, e.g. LogAttributes['http.status'] of OpenTelemetry
+// logs. Once declared it is referenced by its name like any column in
+// fields, groupBy, orderBy, filterBy, filters and aggregates, and returned
+// under that name.
+//
+// Nested columns are not supported: ClickHouse stores them as parallel arrays,
+// e.g. Events.Name and Events.Attributes of OpenTelemetry traces, and there is
+// no way to pick one element of them. Their sub-columns can still be selected
+// as whole arrays under the flattened name.
+type MapField struct {
+	Name   string `json:"name"`
+	Column string `json:"column"` // Map column, e.g. "LogAttributes" or "alias.LogAttributes"
+	Key    string `json:"key"`    // e.g. "http.status"
+}
+
+// mapKeyPattern restricts map keys, which are written into the query as
+// string literals. The driver binds $1 and ? even inside literals, so quoting
+// alone would not make arbitrary keys safe.
+var mapKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.:/-]+$`)
+
+// maxMapKeyLength caps the length of a map key
+const maxMapKeyLength = 256
+
+// ValidateMapFields checks the shape of the request's map fields: plain names
+// unique among map and JSON fields, a column and a well-formed key. Whether
+// the column exists and is a Map is checked against the schema at query time.
+func (req ExploreRequest) ValidateMapFields() error {
+	names := make(map[string]bool, len(req.MapFields))
+	for i, field := range req.MapFields {
+		if !tableAliasPattern.MatchString(field.Name) {
+			return fmt.Errorf("mapFields[%d]: invalid name %q (letters, digits and underscores only)", i, field.Name)
+		}
+		if _, ok := req.JSONFieldByName(field.Name); ok || names[field.Name] {
+			return fmt.Errorf("mapFields[%d]: duplicate name %q", i, field.Name)
+		}
+		names[field.Name] = true
+		if field.Column == "" {
+			return fmt.Errorf("mapFields[%d]: column is required", i)
+		}
+		if field.Key == "" {
+			return fmt.Errorf("mapFields[%d]: key is required", i)
+		}
+		if len(field.Key) > maxMapKeyLength {
+			return fmt.Errorf("mapFields[%d]: key is longer than %d characters", i, maxMapKeyLength)
+		}
+		if !mapKeyPattern.MatchString(field.Key) {
+			return fmt.Errorf("mapFields[%d]: invalid key %q (letters, digits and _ . : / - only)", i, field.Key)
+		}
+	}
+	return nil
+}
+
+// MapFieldByName returns the map field declared under name, if any
+func (req ExploreRequest) MapFieldByName(name string) (MapField, bool) {
+	for _, field := range req.MapFields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return MapField{}, false
+}
+
+// mapFieldSQL renders the lookup of a map field, e.g. `LogAttributes`['http.status']
+func (req ExploreRequest) mapFieldSQL(field MapField) string {
+	// The key was checked by ValidateMapFields and needs no escaping
+	return req.tableColumnSQL(field.Column) + "['" + field.Key + "']"
+}
+
+// isVirtualField reports whether ref names a JSON or map field of the request
+func (req ExploreRequest) isVirtualField(ref string) bool {
+	if _, ok := req.JSONFieldByName(ref); ok {
+		return true
+	}
+	_, ok := req.MapFieldByName(ref)
+	return ok
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+)
+
+// OrderSpec sorts explore results by one column
+type OrderSpec struct {
+	Field string `json:"field"`
+	Dir   string `json:"dir,omitempty"` // asc or desc; defaults to the request's orderDir, then asc
+}
+
+// OrderByList is the orderBy of an explore request. It decodes from a list of
+// OrderSpecs or, as before multi-column sorting, from a single field name.
+type OrderByList []OrderSpec
+
+// UnmarshalJSON accepts either "field" or [{"field": ..., "dir": ...}, ...]
+func (o *OrderByList) UnmarshalJSON(data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(trimmed, []byte("null")):
+		*o = nil
+		return nil
+	case len(trimmed) > 0 && trimmed[0] == '"':
+		var field string
+		if err := json.Unmarshal(trimmed, &field); err != nil {
+			return err
+		}
+		*o = nil
+		if field != "" {
+			*o = OrderByList{{Field: field}}
+		}
+		return nil
+	case len(trimmed) > 0 && trimmed[0] == '[':
+		// Specs are decoded as strictly as the rest of the request
+		var specs []OrderSpec
+		dec := json.NewDecoder(bytes.NewReader(trimmed))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&specs); err != nil {
+			return err
+		}
+		*o = specs
+		return nil
+	}
+	return &json.UnmarshalTypeError{Value: string(trimmed), Type: reflect.TypeOf([]OrderSpec{}), Field: "orderBy"}
+}
+
+// orderDirection returns the direction spec sorts in, falling back to the
+// request-wide orderDir
+func (req ExploreRequest) orderDirection(spec OrderSpec) string {
+	if spec.Dir != "" {
+		return spec.Dir
+	}
+	if req.OrderDir != "" {
+		return req.OrderDir
+	}
+	return "asc"
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// QueryProgress is how much a running query has read so far
+type QueryProgress struct {
+	ReadRows  uint64 `json:"readRows"`
+	ReadBytes uint64 `json:"readBytes"`
+	// TotalRowsToRead is ClickHouse's estimate of the rows the query reads in
+	// total; it may grow as the query runs and is 0 when unknown
+	TotalRowsToRead uint64 `json:"totalRowsToRead"`
+	ElapsedMs       int64  `json:"elapsedMs"`
+}
+
+// ProgressFunc receives the progress of a running query. It is called from
+// the driver while rows are being scanned, so it must be safe to call
+// concurrently with the RowFunc of the query.
+type ProgressFunc func(QueryProgress)
+
+// progressKey holds the ProgressFunc attached to a context
+type progressKey struct{}
+
+// WithProgress asks for the progress of the explore or raw SQL query run with
+// the returned context to be reported to fn as ClickHouse sends it. Queries
+// run along the way, such as schema lookups, are not reported. ClickHouse
+// only sends progress over the native protocol.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// trackProgress reports the progress of the query run with the returned
+// context to the ProgressFunc of ctx, if any. The driver hands over the
+// progress made since its last report, which is added up here.
+func trackProgress(ctx context.Context) context.Context {
+	fn, ok := ctx.Value(progressKey{}).(ProgressFunc)
+	if !ok {
+		return ctx
+	}
+
+	var mu sync.Mutex
+	var total QueryProgress
+	startedAt := time.Now()
+	return clickhouse.Context(ctx, clickhouse.WithProgress(func(p *clickhouse.Progress) {
+		mu.Lock()
+		total.ReadRows += p.Rows
+		total.ReadBytes += p.Bytes
+		total.TotalRowsToRead += p.TotalRows
+		total.ElapsedMs = time.Since(startedAt).Milliseconds()
+		progress := total
+		mu.Unlock()
+		fn(progress)
+	}))
+}
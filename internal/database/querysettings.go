@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/observio/backend/internal/auth"
+)
+
+// querySettingsKey holds the ClickHouse settings attached to a context
+type querySettingsKey struct{}
+
+// withQuerySettings sends settings with the queries run with the returned
+// context, on top of those added earlier; clickhouse.WithSettings on its own
+// replaces any settings already attached
+func withQuerySettings(ctx context.Context, settings clickhouse.Settings) context.Context {
+	merged := clickhouse.Settings{}
+	if previous, ok := ctx.Value(querySettingsKey{}).(clickhouse.Settings); ok {
+		maps.Copy(merged, previous)
+	}
+	maps.Copy(merged, settings)
+
+	ctx = context.WithValue(ctx, querySettingsKey{}, merged)
+	return clickhouse.Context(ctx, clickhouse.WithSettings(merged))
+}
+
+// withReadOnly makes ClickHouse itself reject writes and DDL in the queries
+// run with the returned context, whatever the SQL checks let through.
+// readonly=2 rather than 1 so that the per-query settings such as
+// max_execution_time can still be sent.
+func (c *ClickHouseClient) withReadOnly(ctx context.Context) context.Context {
+	if !c.readOnlyQueries {
+		return ctx
+	}
+	return withQuerySettings(ctx, clickhouse.Settings{
+		"readonly":  2,
+		"allow_ddl": 0,
+	})
+}
+
+// withUserComment tags the queries run with the returned context with the
+// authenticated user of the request through the log_comment setting, so they
+// can be attributed in ClickHouse's system.query_log. Queries without a user,
+// such as those of background jobs, are left untagged.
+func withUserComment(ctx context.Context) context.Context {
+	user, ok := auth.UserFromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	return withQuerySettings(ctx, clickhouse.Settings{"log_comment": user})
+}
+
+// ValidateRequestSettings checks that a request only sets ClickHouse settings
+// named in allowed, to plain string, number or boolean values. The error names
+// every setting that is not allowed.
+func ValidateRequestSettings(settings map[string]interface{}, allowed []string) error {
+	var disallowed []string
+	for name, value := range settings {
+		if !slices.Contains(allowed, name) {
+			disallowed = append(disallowed, name)
+			continue
+		}
+		switch value.(type) {
+		case string, float64, bool:
+		default:
+			return fmt.Errorf("setting %s must be a string, number or boolean", name)
+		}
+	}
+	if len(disallowed) > 0 {
+		slices.Sort(disallowed)
+		return fmt.Errorf("settings not allowed: %s", strings.Join(disallowed, ", "))
+	}
+	return nil
+}
+
+// WithRequestSettings sends the ClickHouse settings a request asked for with
+// the queries run with the returned context. The settings the client adds
+// itself, such as readonly and max_execution_time, are applied afterwards and
+// win over them.
+func WithRequestSettings(ctx context.Context, settings map[string]interface{}) context.Context {
+	if len(settings) == 0 {
+		return ctx
+	}
+	converted := make(clickhouse.Settings, len(settings))
+	for name, value := range settings {
+		converted[name] = settingValue(value)
+	}
+	return withQuerySettings(ctx, converted)
+}
+
+// settingValue converts a decoded JSON value to the form ClickHouse expects,
+// as the driver sends settings formatted with fmt.Sprint: whole numbers
+// without an exponent and booleans as 0 or 1
+func settingValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+			return int64(v)
+		}
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	}
+	return value
+}
@@ -0,0 +1,99 @@
+//go:build integration
+
+package database
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newIntegrationClient connects to the ClickHouse server named by the
+// CLICKHOUSE_* environment variables, defaulting to localhost:9000, and skips
+// the test when it is not reachable
+func newIntegrationClient(t *testing.T, opts ClientOptions) *ClickHouseClient {
+	t.Helper()
+	host := os.Getenv("CLICKHOUSE_HOST")
+	if host == "" {
+		host = "localhost"
+	}
+	port := 9000
+	if value := os.Getenv("CLICKHOUSE_PORT"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			t.Fatalf("invalid CLICKHOUSE_PORT %q: %v", value, err)
+		}
+		port = parsed
+	}
+	user := os.Getenv("CLICKHOUSE_USER")
+	if user == "" {
+		user = "default"
+	}
+	database := os.Getenv("CLICKHOUSE_DATABASE")
+	if database == "" {
+		database = "default"
+	}
+
+	opts.DialTimeout = 5 * time.Second
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	c, err := NewClickHouseClient(host, port, user, os.Getenv("CLICKHOUSE_PASSWORD"), database, opts, logger)
+	if err != nil {
+		t.Fatalf("NewClickHouseClient: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if err := c.Ping(context.Background()); err != nil {
+		t.Skipf("ClickHouse is not reachable at %s:%d: %v", host, port, err)
+	}
+	return c
+}
+
+func TestReadOnlyQueriesRejectWrites(t *testing.T) {
+	c := newIntegrationClient(t, ClientOptions{ReadOnlyQueries: true})
+	ctx := context.Background()
+
+	// The table is set up outside the read-only queries, as the server's own tables are
+	table := "observio_readonly_check_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err := c.exec(ctx, "CREATE TABLE "+table+" (x UInt8) ENGINE = MergeTree ORDER BY x"); err != nil {
+		t.Fatalf("creating %s: %v", table, err)
+	}
+	t.Cleanup(func() { c.exec(context.Background(), "DROP TABLE IF EXISTS "+table) })
+	if err := c.exec(ctx, "INSERT INTO "+table+" VALUES (1)"); err != nil {
+		t.Fatalf("inserting into %s: %v", table, err)
+	}
+
+	statements := []string{
+		"INSERT INTO " + table + " VALUES (2)",
+		"ALTER TABLE " + table + " DELETE WHERE x = 1",
+		"DELETE FROM " + table + " WHERE x = 1",
+		"TRUNCATE TABLE " + table,
+		"DROP TABLE " + table,
+		"CREATE TABLE " + table + "_copy (x UInt8) ENGINE = Memory",
+		"RENAME TABLE " + table + " TO " + table + "_renamed",
+	}
+	for _, statement := range statements {
+		err := c.QueryRawStream(ctx, statement, nil, 0,
+			func([]string, []string) error { return nil },
+			func(map[string]interface{}) error { return nil })
+		if err == nil {
+			t.Errorf("%s succeeded in read-only mode", statement)
+			continue
+		}
+		if message := err.Error(); !strings.Contains(message, "READONLY") && !strings.Contains(message, "QUERY_IS_PROHIBITED") {
+			t.Errorf("%s: err = %v, want a readonly or allow_ddl rejection", statement, err)
+		}
+	}
+
+	// The table is untouched and reads still work
+	_, _, rows, err := c.QueryRaw(ctx, "SELECT count() AS n FROM "+table, 0)
+	if err != nil {
+		t.Fatalf("SELECT: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["n"] != uint64(1) {
+		t.Errorf("rows = %v after the rejected writes, want a count of 1", rows)
+	}
+}
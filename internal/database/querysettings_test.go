@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// settingsOf returns the ClickHouse settings attached to ctx
+func settingsOf(ctx context.Context) clickhouse.Settings {
+	settings, _ := ctx.Value(querySettingsKey{}).(clickhouse.Settings)
+	return settings
+}
+
+func TestWithReadOnly(t *testing.T) {
+	c := &ClickHouseClient{readOnlyQueries: true}
+	settings := settingsOf(c.withReadOnly(context.Background()))
+	if settings["readonly"] != 2 || settings["allow_ddl"] != 0 {
+		t.Errorf("settings = %v, want readonly=2 and allow_ddl=0", settings)
+	}
+
+	c = &ClickHouseClient{readOnlyQueries: false}
+	if settings := settingsOf(c.withReadOnly(context.Background())); settings != nil {
+		t.Errorf("settings = %v with readOnlyQueries off, want none", settings)
+	}
+}
+
+func TestWithReadOnlyWinsOverRequestSettings(t *testing.T) {
+	c := &ClickHouseClient{readOnlyQueries: true}
+	ctx := WithRequestSettings(context.Background(), map[string]interface{}{
+		"readonly":    float64(0),
+		"allow_ddl":   true,
+		"max_threads": float64(4),
+	})
+	settings := settingsOf(c.withReadOnly(ctx))
+	if settings["readonly"] != 2 || settings["allow_ddl"] != 0 {
+		t.Errorf("settings = %v, want the request's readonly and allow_ddl overridden", settings)
+	}
+	if settings["max_threads"] != int64(4) {
+		t.Errorf("settings = %v, want the request's max_threads kept", settings)
+	}
+}
+
+func TestValidateRequestSettings(t *testing.T) {
+	allowed := []string{"max_threads", "use_uncompressed_cache"}
+	tests := []struct {
+		settings map[string]interface{}
+		wantErr  bool
+	}{
+		{map[string]interface{}{"max_threads": float64(4), "use_uncompressed_cache": false}, false},
+		{map[string]interface{}{"readonly": float64(0)}, true},
+		{map[string]interface{}{"allow_ddl": float64(1), "max_threads": float64(4)}, true},
+		{map[string]interface{}{"max_threads": []interface{}{float64(4)}}, true},
+		{map[string]interface{}{"max_threads": nil}, true},
+	}
+	for _, tt := range tests {
+		if err := ValidateRequestSettings(tt.settings, allowed); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateRequestSettings(%v) = %v, want error %v", tt.settings, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSettingValue(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  interface{}
+	}{
+		{float64(20000000000), int64(20000000000)},
+		{float64(0.5), float64(0.5)},
+		{true, 1},
+		{false, 0},
+		{"hash", "hash"},
+	}
+	for _, tt := range tests {
+		if got := settingValue(tt.value); got != tt.want {
+			t.Errorf("settingValue(%v) = %v (%T), want %v (%T)", tt.value, got, got, tt.want, tt.want)
+		}
+	}
+}
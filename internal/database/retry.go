@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	sqldriver "database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"time"
+)
+
+// withRetry runs op, retrying up to maxRetries times with a doubling backoff
+// when it fails because the connection to ClickHouse was lost. Each retry
+// checks out a fresh connection from the pool, which reconnects to the server.
+func (c *ClickHouseClient) withRetry(ctx context.Context, op func() error) error {
+	backoff := c.retryBackoff
+	err := op()
+	for attempt := 1; attempt <= c.maxRetries && isConnectionError(ctx, err); attempt++ {
+		c.logger.Warn("ClickHouse connection error, reconnecting", "attempt", attempt, "maxRetries", c.maxRetries, "error", err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		backoff *= 2
+
+		err = op()
+	}
+	return err
+}
+
+// isConnectionError reports whether err means the connection to the server
+// failed, as opposed to the query itself being rejected or cancelled
+func isConnectionError(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, sqldriver.ErrBadConn) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+// IsConnectionError reports whether err means ClickHouse could not be reached
+func IsConnectionError(err error) bool {
+	return isConnectionError(context.Background(), err)
+}
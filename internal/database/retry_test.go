@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func newRetryClient(maxRetries int) *ClickHouseClient {
+	return &ClickHouseClient{
+		maxRetries:   maxRetries,
+		retryBackoff: time.Millisecond,
+		logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	dropped := &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+	rejected := errors.New("code: 60, message: table otel.missing does not exist")
+
+	tests := []struct {
+		name      string
+		failures  []error // returned by the successive attempts; nil afterwards
+		wantErr   error
+		wantCalls int
+	}{
+		{"succeeds at once", nil, nil, 1},
+		{"reconnects after a dropped connection", []error{io.EOF}, nil, 2},
+		{"reconnects until it succeeds", []error{dropped, io.ErrUnexpectedEOF, dropped}, nil, 4},
+		{"gives up after max retries", []error{dropped, dropped, dropped, dropped, dropped}, dropped, 4},
+		{"does not retry a rejected query", []error{rejected}, rejected, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := newRetryClient(3).withRetry(context.Background(), func() error {
+				calls++
+				if calls <= len(tt.failures) {
+					return tt.failures[calls-1]
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("op ran %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestWithRetryStopsWhenContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := newRetryClient(3).withRetry(ctx, func() error {
+		calls++
+		cancel()
+		return io.EOF
+	})
+	if !errors.Is(err, io.EOF) || calls != 1 {
+		t.Errorf("err = %v after %d calls, want io.EOF after 1", err, calls)
+	}
+}
+
+func TestQueryRowReturnsRetryError(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	c, err := NewClickHouseClient("127.0.0.1", 1, "default", "", "default", ClientOptions{
+		MaxConcurrentQueries: 1,
+		QueueTimeout:         time.Second,
+		MaxRetries:           2,
+		RetryBackoff:         time.Millisecond,
+		DialTimeout:          time.Second,
+	}, logger)
+	if err != nil {
+		t.Fatalf("NewClickHouseClient: %v", err)
+	}
+	defer c.Close()
+
+	row := c.queryRow(context.Background(), "SELECT 1")
+	// The slot is released as soon as the retries give up, without a Scan
+	var inflight dto.Metric
+	if err := inflightQueriesGauge.Write(&inflight); err != nil || inflight.GetGauge().GetValue() != 0 {
+		t.Errorf("clickhouse_inflight_queries is %v, %v after the retries gave up, want 0", inflight.GetGauge().GetValue(), err)
+	}
+	if err := row.Err(); !IsConnectionError(err) {
+		t.Errorf("row.Err() = %v, want the connection error", err)
+	}
+	var n int
+	if err := row.Scan(&n); !IsConnectionError(err) {
+		t.Errorf("row.Scan() = %v, want the connection error", err)
+	}
+}
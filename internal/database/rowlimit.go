@@ -0,0 +1,29 @@
+package database
+
+import "fmt"
+
+// TooManyRowsError is returned when a query produces more rows than its cap
+type TooManyRowsError struct {
+	Limit int
+}
+
+func (e *TooManyRowsError) Error() string {
+	return fmt.Sprintf("query returned more than %d rows", e.Limit)
+}
+
+// LimitRows wraps onRow so that the scan stops with a TooManyRowsError instead
+// of delivering row limit+1; a limit of 0 or less leaves onRow unchanged
+func LimitRows(limit int, onRow RowFunc) RowFunc {
+	if limit <= 0 {
+		return onRow
+	}
+
+	delivered := 0
+	return func(row map[string]interface{}) error {
+		if delivered >= limit {
+			return &TooManyRowsError{Limit: limit}
+		}
+		delivered++
+		return onRow(row)
+	}
+}
@@ -0,0 +1,168 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrSavedQueryNotFound is returned when no live saved query has the requested ID
+var ErrSavedQueryNotFound = errors.New("saved query not found")
+
+// SavedQuery is an explore query or raw SQL statement stored for reuse.
+// Exactly one of Explore and RawSQL is set.
+type SavedQuery struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Explore     *ExploreRequest `json:"explore,omitempty"`
+	RawSQL      *SavedSQL       `json:"rawSql,omitempty"`
+	CreatedBy   string          `json:"createdBy"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	UpdatedAt   time.Time       `json:"updatedAt"`
+}
+
+// SavedSQL is a stored raw SQL statement and the database it runs against
+type SavedSQL struct {
+	Database       string `json:"database"`
+	Query          string `json:"query"`
+	TimeoutSeconds int    `json:"timeoutSeconds,omitempty"`
+	// Settings are ClickHouse settings applied to the query, as in RawSQLRequest
+	Settings map[string]interface{} `json:"settings,omitempty"`
+}
+
+// savedQueryDefinition is the JSON stored in the definition column
+type savedQueryDefinition struct {
+	Explore *ExploreRequest `json:"explore,omitempty"`
+	RawSQL  *SavedSQL       `json:"rawSql,omitempty"`
+}
+
+// savedQueryColumns is the column list shared by the saved query queries
+const savedQueryColumns = `id, name, description, definition, created_by, created_at, updated_at`
+
+// ListSavedQueries retrieves all saved queries that have not been deleted
+func (c *ClickHouseClient) ListSavedQueries(ctx context.Context) ([]SavedQuery, error) {
+	query := `SELECT ` + savedQueryColumns + ` FROM saved_queries FINAL WHERE deleted = 0 ORDER BY created_at`
+
+	rows, err := c.query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query saved queries: %w", err)
+	}
+	defer rows.Close()
+
+	queries := []SavedQuery{}
+	for rows.Next() {
+		saved, err := scanSavedQuery(rows)
+		if err != nil {
+			c.logger.Error("error scanning saved query row", "error", err)
+			continue
+		}
+		queries = append(queries, saved)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating saved query rows: %w", err)
+	}
+
+	return queries, nil
+}
+
+// GetSavedQuery retrieves a single saved query by ID
+func (c *ClickHouseClient) GetSavedQuery(ctx context.Context, id string) (*SavedQuery, error) {
+	query := `SELECT ` + savedQueryColumns + ` FROM saved_queries FINAL WHERE id = ? AND deleted = 0 LIMIT 1`
+
+	rows, err := c.query(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query saved query %s: %w", id, err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error iterating saved query rows: %w", err)
+		}
+		return nil, ErrSavedQueryNotFound
+	}
+
+	saved, err := scanSavedQuery(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan saved query %s: %w", id, err)
+	}
+
+	return &saved, nil
+}
+
+// SaveSavedQuery inserts a new version of a saved query; the latest write wins
+func (c *ClickHouseClient) SaveSavedQuery(ctx context.Context, saved SavedQuery) error {
+	if err := c.insertSavedQuery(ctx, saved, false); err != nil {
+		return fmt.Errorf("failed to store saved query %s: %w", saved.ID, err)
+	}
+	return nil
+}
+
+// DeleteSavedQuery hides a saved query by writing a newer, deleted version of it
+func (c *ClickHouseClient) DeleteSavedQuery(ctx context.Context, id string) error {
+	saved, err := c.GetSavedQuery(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	saved.UpdatedAt = time.Now().UTC()
+	if err := c.insertSavedQuery(ctx, *saved, true); err != nil {
+		return fmt.Errorf("failed to delete saved query %s: %w", id, err)
+	}
+	return nil
+}
+
+// insertSavedQuery writes a single row to saved_queries, storing the query as JSON
+func (c *ClickHouseClient) insertSavedQuery(ctx context.Context, saved SavedQuery, deleted bool) error {
+	definition, err := json.Marshal(savedQueryDefinition{Explore: saved.Explore, RawSQL: saved.RawSQL})
+	if err != nil {
+		return fmt.Errorf("failed to encode query: %w", err)
+	}
+
+	var deletedFlag uint8
+	if deleted {
+		deletedFlag = 1
+	}
+
+	query := `INSERT INTO saved_queries (` + savedQueryColumns + `, deleted) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	return c.exec(ctx, query,
+		saved.ID,
+		saved.Name,
+		saved.Description,
+		string(definition),
+		saved.CreatedBy,
+		saved.CreatedAt,
+		saved.UpdatedAt,
+		deletedFlag,
+	)
+}
+
+// scanSavedQuery scans a row selected with savedQueryColumns
+func scanSavedQuery(row rowScanner) (SavedQuery, error) {
+	var saved SavedQuery
+	var definitionJSON string
+	err := row.Scan(
+		&saved.ID,
+		&saved.Name,
+		&saved.Description,
+		&definitionJSON,
+		&saved.CreatedBy,
+		&saved.CreatedAt,
+		&saved.UpdatedAt,
+	)
+	if err != nil {
+		return saved, err
+	}
+
+	var definition savedQueryDefinition
+	if err := json.Unmarshal([]byte(definitionJSON), &definition); err != nil {
+		return saved, fmt.Errorf("failed to decode query of saved query %s: %w", saved.ID, err)
+	}
+	saved.Explore = definition.Explore
+	saved.RawSQL = definition.RawSQL
+	return saved, nil
+}
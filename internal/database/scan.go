@@ -0,0 +1,125 @@
+package database
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// scanTypedRows scans rows into the Go type the driver uses for each column
+// and hands them to onRow as JSON-friendly values (see normalizeValue), so raw
+// SQL, explore queries and table previews return the same shapes
+func (c *ClickHouseClient) scanTypedRows(rows driver.Rows, onColumns ColumnsFunc, onRow RowFunc) error {
+	columnTypes := rows.ColumnTypes()
+	columns := make([]string, len(columnTypes))
+	typeNames := make([]string, len(columnTypes))
+	for i, col := range columnTypes {
+		columns[i] = col.Name()
+		typeNames[i] = col.DatabaseTypeName()
+	}
+
+	if err := onColumns(columns, typeNames); err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		// Nullable columns scan into pointers, which stay nil for NULL
+		valuePtrs := make([]interface{}, len(columnTypes))
+		for i, col := range columnTypes {
+			valuePtrs[i] = reflect.New(col.ScanType()).Interface()
+		}
+
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return fmt.Errorf("error scanning row: %w", err)
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, col := range columns {
+			row[col] = normalizeValue(reflect.ValueOf(valuePtrs[i]).Elem().Interface())
+		}
+		if err := onRow(row); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return nil
+}
+
+// normalizeValue converts a scanned value into one that encodes the same way
+// whatever the column type: NULL becomes nil, times RFC3339 strings keeping
+// DateTime64 fractions of a second (nil for the zero time), integers and floats int64, uint64 or float64 (nil for NaN and
+// infinities, which JSON cannot represent), values with a
+// text form such as UUIDs, IPs, decimals and big integers strings, and arrays,
+// tuples and maps are converted element by element.
+func normalizeValue(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return nil
+	}
+
+	switch v := value.(type) {
+	case time.Time:
+		if v.IsZero() {
+			return nil
+		}
+		return v.Format(time.RFC3339Nano)
+	case *time.Time:
+		return normalizeValue(*v)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil
+		}
+		return v
+	case string, bool, int64, uint64:
+		return v
+	case encoding.TextMarshaler:
+		text, err := v.MarshalText()
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(text)
+	}
+
+	switch rv.Kind() {
+	case reflect.Pointer:
+		return normalizeValue(rv.Elem().Interface())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint()
+	case reflect.Float32, reflect.Float64:
+		return normalizeValue(rv.Float())
+	case reflect.String:
+		return rv.String()
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return []interface{}{}
+		}
+		items := make([]interface{}, rv.Len())
+		for i := range items {
+			items[i] = normalizeValue(rv.Index(i).Interface())
+		}
+		return items
+	case reflect.Map:
+		entries := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			entries[fmt.Sprint(normalizeValue(iter.Key().Interface()))] = normalizeValue(iter.Value().Interface())
+		}
+		return entries
+	}
+
+	return value
+}
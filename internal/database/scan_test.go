@@ -0,0 +1,152 @@
+package database
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
+)
+
+func TestNormalizeValue(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 7, 0, 0, 123456789, time.UTC)
+	str := "error"
+	var nullString *string
+	var nullTime *time.Time
+	id := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+
+	tests := []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{"nil", nil, nil},
+		{"DateTime", time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC), "2024-05-01T07:00:00Z"},
+		{"DateTime64(9)", ts, "2024-05-01T07:00:00.123456789Z"},
+		{"DateTime64(3)", ts.Truncate(time.Millisecond), "2024-05-01T07:00:00.123Z"},
+		{"zero time", time.Time{}, nil},
+		{"Nullable(String)", &str, "error"},
+		{"Nullable(String) NULL", nullString, nil},
+		{"Nullable(DateTime64) NULL", nullTime, nil},
+		{"Nullable(DateTime64)", &ts, "2024-05-01T07:00:00.123456789Z"},
+		{"UInt8", uint8(7), uint64(7)},
+		{"Int32", int32(-7), int64(-7)},
+		{"Float32", float32(1.5), float64(1.5)},
+		{"UUID", id, "6ba7b810-9dad-11d1-80b4-00c04fd430c8"},
+		{"IPv4", net.ParseIP("10.0.0.1"), "10.0.0.1"},
+		{"Array(String)", []string{"a", "b"}, []interface{}{"a", "b"}},
+		{"empty Array", []string(nil), []interface{}{}},
+		{"Array(Nullable(Int64))", []*int64{nil, ptr(int64(3))}, []interface{}{nil, int64(3)}},
+		{"Array(DateTime64)", []time.Time{ts}, []interface{}{"2024-05-01T07:00:00.123456789Z"}},
+		{"Array(Array(UInt16))", [][]uint16{{1}, {2, 3}}, []interface{}{[]interface{}{uint64(1)}, []interface{}{uint64(2), uint64(3)}}},
+		{"Map(String, UInt64)", map[string]uint64{"a": 1}, map[string]interface{}{"a": uint64(1)}},
+		{"Map(UInt8, Nullable(String))", map[uint8]*string{1: nil}, map[string]interface{}{"1": nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeValue(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeValue(%#v) = %#v, want %#v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+// fakeColumn is a driver.ColumnType of a given scan type
+type fakeColumn struct {
+	name     string
+	typeName string
+	scanType reflect.Type
+}
+
+func (c fakeColumn) Name() string             { return c.name }
+func (c fakeColumn) Nullable() bool           { return false }
+func (c fakeColumn) ScanType() reflect.Type   { return c.scanType }
+func (c fakeColumn) DatabaseTypeName() string { return c.typeName }
+
+// fakeRows hands out one row per scan func; a scan func fills dest or fails
+type fakeRows struct {
+	driver.Rows
+	columns []driver.ColumnType
+	scans   []func(dest ...any) error
+	next    int
+}
+
+func (r *fakeRows) ColumnTypes() []driver.ColumnType { return r.columns }
+func (r *fakeRows) Err() error                       { return nil }
+func (r *fakeRows) Next() bool {
+	r.next++
+	return r.next <= len(r.scans)
+}
+func (r *fakeRows) Scan(dest ...any) error { return r.scans[r.next-1](dest...) }
+
+func TestScanTypedRows(t *testing.T) {
+	c := &ClickHouseClient{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	ts := time.Date(2024, 5, 1, 7, 0, 0, 5000, time.UTC)
+	scanErr := errors.New("converting UInt64 to *string is unsupported")
+
+	rows := &fakeRows{
+		columns: []driver.ColumnType{
+			fakeColumn{"Timestamp", "DateTime64(9)", reflect.TypeOf(time.Time{})},
+			fakeColumn{"Tags", "Array(String)", reflect.TypeOf([]string{})},
+		},
+		scans: []func(dest ...any) error{
+			func(dest ...any) error {
+				*dest[0].(*time.Time) = ts
+				*dest[1].(*[]string) = []string{"a"}
+				return nil
+			},
+			func(dest ...any) error { return scanErr },
+			func(dest ...any) error { return nil },
+		},
+	}
+
+	var columnTypes []string
+	var got []map[string]interface{}
+	err := c.scanTypedRows(rows,
+		func(_, types []string) error { columnTypes = types; return nil },
+		func(row map[string]interface{}) error { got = append(got, row); return nil },
+	)
+
+	// The failed row stops the scan instead of being skipped
+	if !errors.Is(err, scanErr) {
+		t.Fatalf("scanTypedRows error = %v, want the scan error", err)
+	}
+	if !reflect.DeepEqual(columnTypes, []string{"DateTime64(9)", "Array(String)"}) {
+		t.Errorf("column types = %v", columnTypes)
+	}
+	want := []map[string]interface{}{{"Timestamp": "2024-05-01T07:00:00.000005Z", "Tags": []interface{}{"a"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %#v, want %#v", got, want)
+	}
+}
+
+func TestNormalizeValueNonFiniteFloats(t *testing.T) {
+	for _, value := range []interface{}{math.NaN(), math.Inf(1), math.Inf(-1), float32(math.NaN()), float32(math.Inf(-1))} {
+		if got := normalizeValue(value); got != nil {
+			t.Errorf("normalizeValue(%v) = %v, want nil", value, got)
+		}
+	}
+	// avgOrNull over no rows scans into a nil *float64
+	var empty *float64
+	if got := normalizeValue(empty); got != nil {
+		t.Errorf("normalizeValue(nil *float64) = %v, want nil", got)
+	}
+	nan := math.NaN()
+	if got := normalizeValue(&nan); got != nil {
+		t.Errorf("normalizeValue(&NaN) = %v, want nil", got)
+	}
+	if got := normalizeValue([]float64{1, math.Inf(1)}); !reflect.DeepEqual(got, []interface{}{float64(1), nil}) {
+		t.Errorf("normalizeValue([1, +Inf]) = %v, want [1 <nil>]", got)
+	}
+	if got := normalizeValue(2.5); got != 2.5 {
+		t.Errorf("normalizeValue(2.5) = %v, want 2.5", got)
+	}
+}
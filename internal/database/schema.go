@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// schemaStatements holds the DDL for the tables owned by the server itself
+// (as opposed to the OTel tables populated by the collector).
+var schemaStatements = []string{
+	`CREATE TABLE IF NOT EXISTS settings (
+		namespace String,
+		key String,
+		value String,
+		updated_at DateTime64(3)
+	) ENGINE = ReplacingMergeTree(updated_at)
+	ORDER BY (namespace, key)`,
+	`CREATE TABLE IF NOT EXISTS query_history (
+		id UUID,
+		query_type LowCardinality(String),
+		user String,
+		database String,
+		query String,
+		row_count UInt64,
+		duration_ms UInt64,
+		success Bool,
+		error String,
+		started_at DateTime64(3)
+	) ENGINE = MergeTree
+	ORDER BY started_at`,
+	// Tables created before queries were attributed to users
+	`ALTER TABLE query_history ADD COLUMN IF NOT EXISTS user String AFTER query_type`,
+	`CREATE TABLE IF NOT EXISTS alert_rules (
+		id String,
+		name String,
+		description String,
+		query String,
+		threshold Float64,
+		operator LowCardinality(String),
+		severity LowCardinality(String),
+		no_data_state LowCardinality(String),
+		labels Map(String, String),
+		annotations Map(String, String),
+		enabled Bool,
+		created_at DateTime64(3),
+		updated_at DateTime64(3),
+		deleted UInt8
+	) ENGINE = ReplacingMergeTree(updated_at)
+	ORDER BY id`,
+	`CREATE TABLE IF NOT EXISTS dashboards (
+		id String,
+		title String,
+		description String,
+		panels String,
+		created_by String,
+		created_at DateTime64(3),
+		updated_at DateTime64(3),
+		deleted UInt8
+	) ENGINE = ReplacingMergeTree(updated_at)
+	ORDER BY id`,
+	`CREATE TABLE IF NOT EXISTS saved_queries (
+		id String,
+		name String,
+		description String,
+		definition String,
+		created_by String,
+		created_at DateTime64(3),
+		updated_at DateTime64(3),
+		deleted UInt8
+	) ENGINE = ReplacingMergeTree(updated_at)
+	ORDER BY id`,
+}
+
+// EnsureSchema creates the server-owned tables if they do not already exist
+func (c *ClickHouseClient) EnsureSchema(ctx context.Context) error {
+	for _, stmt := range schemaStatements {
+		if err := c.exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to apply schema statement: %w", err)
+		}
+	}
+	return nil
+}
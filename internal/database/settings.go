@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrSettingNotFound is returned when a setting key does not exist in the namespace
+var ErrSettingNotFound = errors.New("setting not found")
+
+// Setting represents a single namespaced key/value preference
+type Setting struct {
+	Namespace string          `json:"namespace"`
+	Key       string          `json:"key"`
+	Value     json.RawMessage `json:"value"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+// ListSettings retrieves all settings in the given namespace
+func (c *ClickHouseClient) ListSettings(ctx context.Context, namespace string) ([]Setting, error) {
+	query := `SELECT namespace, key, value, updated_at FROM settings FINAL WHERE namespace = ? ORDER BY key`
+
+	rows, err := c.query(ctx, query, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query settings: %w", err)
+	}
+	defer rows.Close()
+
+	settings := []Setting{}
+	for rows.Next() {
+		var setting Setting
+		var value string
+		if err := rows.Scan(&setting.Namespace, &setting.Key, &value, &setting.UpdatedAt); err != nil {
+			c.logger.Error("error scanning setting row", "error", err)
+			continue
+		}
+		setting.Value = json.RawMessage(value)
+		settings = append(settings, setting)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating setting rows: %w", err)
+	}
+
+	return settings, nil
+}
+
+// GetSetting retrieves a single setting by namespace and key
+func (c *ClickHouseClient) GetSetting(ctx context.Context, namespace, key string) (*Setting, error) {
+	query := `SELECT namespace, key, value, updated_at FROM settings FINAL WHERE namespace = ? AND key = ? LIMIT 1`
+
+	rows, err := c.query(ctx, query, namespace, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query setting %s/%s: %w", namespace, key, err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error iterating setting rows: %w", err)
+		}
+		return nil, ErrSettingNotFound
+	}
+
+	var setting Setting
+	var value string
+	if err := rows.Scan(&setting.Namespace, &setting.Key, &value, &setting.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("failed to scan setting %s/%s: %w", namespace, key, err)
+	}
+	setting.Value = json.RawMessage(value)
+
+	return &setting, nil
+}
+
+// PutSetting inserts or replaces a setting; the latest write wins
+func (c *ClickHouseClient) PutSetting(ctx context.Context, namespace, key string, value json.RawMessage) (*Setting, error) {
+	setting := &Setting{
+		Namespace: namespace,
+		Key:       key,
+		Value:     value,
+		UpdatedAt: time.Now().UTC(),
+	}
+
+	query := `INSERT INTO settings (namespace, key, value, updated_at) VALUES (?, ?, ?, ?)`
+	if err := c.exec(ctx, query, setting.Namespace, setting.Key, string(setting.Value), setting.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("failed to store setting %s/%s: %w", namespace, key, err)
+	}
+
+	return setting, nil
+}
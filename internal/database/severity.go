@@ -0,0 +1,74 @@
+package database
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OpenTelemetry severity number floors; each level spans four numbers
+// (e.g. WARN..WARN4 is 13..16)
+const (
+	SeverityTrace = 1
+	SeverityDebug = 5
+	SeverityInfo  = 9
+	SeverityWarn  = 13
+	SeverityError = 17
+	SeverityFatal = 21
+
+	maxSeverityNumber = 24
+)
+
+// severityAliases maps the level names emitted by common logging libraries to
+// the OTel severity number floor of that level
+var severityAliases = map[string]int{
+	"trace":       SeverityTrace,
+	"trc":         SeverityTrace,
+	"t":           SeverityTrace,
+	"debug":       SeverityDebug,
+	"dbg":         SeverityDebug,
+	"d":           SeverityDebug,
+	"info":        SeverityInfo,
+	"information": SeverityInfo,
+	"inf":         SeverityInfo,
+	"i":           SeverityInfo,
+	"notice":      SeverityInfo,
+	"warn":        SeverityWarn,
+	"warning":     SeverityWarn,
+	"wrn":         SeverityWarn,
+	"w":           SeverityWarn,
+	"error":       SeverityError,
+	"err":         SeverityError,
+	"e":           SeverityError,
+	"fatal":       SeverityFatal,
+	"critical":    SeverityFatal,
+	"crit":        SeverityFatal,
+	"panic":       SeverityFatal,
+	"emergency":   SeverityFatal,
+	"alert":       SeverityFatal,
+	"f":           SeverityFatal,
+}
+
+// SeverityNumber normalizes a level name or OTel severity number (1-24) to the
+// severity number it stands for. Names are matched case-insensitively.
+func SeverityNumber(level string) (int, bool) {
+	level = strings.ToLower(strings.TrimSpace(level))
+	if n, err := strconv.Atoi(level); err == nil {
+		return n, n >= SeverityTrace && n <= maxSeverityNumber
+	}
+	n, ok := severityAliases[level]
+	return n, ok
+}
+
+// severityTextsAtLeast returns the level names whose severity is at least min,
+// for matching rows that only carry a SeverityText
+func severityTextsAtLeast(min int) []string {
+	var texts []string
+	for text, n := range severityAliases {
+		if n >= min {
+			texts = append(texts, text)
+		}
+	}
+	sort.Strings(texts)
+	return texts
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSeverityNumber(t *testing.T) {
+	tests := []struct {
+		level  string
+		want   int
+		wantOK bool
+	}{
+		{"warn", SeverityWarn, true},
+		{"warning", SeverityWarn, true},
+		{"WARN", SeverityWarn, true},
+		{"Warning", SeverityWarn, true},
+		{" wrn ", SeverityWarn, true},
+		{"err", SeverityError, true},
+		{"error", SeverityError, true},
+		{"ERROR", SeverityError, true},
+		{"Err", SeverityError, true},
+		{"INFO", SeverityInfo, true},
+		{"Information", SeverityInfo, true},
+		{"debug", SeverityDebug, true},
+		{"TRACE", SeverityTrace, true},
+		{"Critical", SeverityFatal, true},
+		{"fatal", SeverityFatal, true},
+		{"13", 13, true},
+		{"24", 24, true},
+		{"1", 1, true},
+		{"0", 0, false},
+		{"25", 25, false},
+		{"verbose", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := SeverityNumber(tt.level)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("SeverityNumber(%q) = %d, %v, want %d, %v", tt.level, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestSeverityTextsAtLeast(t *testing.T) {
+	texts := severityTextsAtLeast(SeverityWarn)
+	for _, want := range []string{"warn", "warning", "err", "error", "fatal", "critical"} {
+		if !slices.Contains(texts, want) {
+			t.Errorf("severityTextsAtLeast(warn) = %v, want it to include %q", texts, want)
+		}
+	}
+	for _, unwanted := range []string{"info", "debug", "trace", "notice"} {
+		if slices.Contains(texts, unwanted) {
+			t.Errorf("severityTextsAtLeast(warn) = %v, want it to exclude %q", texts, unwanted)
+		}
+	}
+
+	// Texts are compared against lower(SeverityText), so they must all be lowercase
+	for _, text := range severityTextsAtLeast(SeverityTrace) {
+		if text != strings.ToLower(text) {
+			t.Errorf("severity alias %q is not lowercase", text)
+		}
+	}
+}
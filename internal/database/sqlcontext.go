@@ -0,0 +1,282 @@
+package database
+
+import (
+	"strings"
+)
+
+// SQLContext describes what is being typed at a cursor position in a SQL
+// query, as far as a tokenizer can tell without fully parsing it
+type SQLContext struct {
+	// Clause is the lowercased clause keyword the cursor is in at its
+	// parenthesis level, e.g. "select", "from", "where" or "order by"
+	Clause string
+	// Prefix is the part of the word before the cursor
+	Prefix string
+	// Qualifier is the name before a dot directly preceding Prefix, as in "l." or "default."
+	Qualifier string
+	// ExpectTable is set right after FROM, JOIN or a comma in a FROM clause;
+	// a Qualifier then names a database
+	ExpectTable bool
+	// InLiteral is set when the cursor is inside a string literal or comment
+	InLiteral bool
+	// Tables lists the tables named after FROM and JOIN anywhere in the query
+	Tables []SQLTableRef
+}
+
+// SQLTableRef is a table referenced by a query
+type SQLTableRef struct {
+	Database string // empty unless the table is qualified
+	Table    string
+	Alias    string // empty unless the table is aliased
+}
+
+// Name returns the name columns of the table are qualified with in the query
+func (t SQLTableRef) Name() string {
+	if t.Alias != "" {
+		return t.Alias
+	}
+	return t.Table
+}
+
+type sqlTokenKind int
+
+const (
+	sqlWord sqlTokenKind = iota
+	sqlQuotedIdent
+	sqlString
+	sqlComment
+	sqlSymbol
+)
+
+// sqlToken is a single token; text is unquoted for quoted identifiers
+type sqlToken struct {
+	kind       sqlTokenKind
+	text       string
+	start, end int
+	// open is set for literals and comments the cursor is still inside at end
+	open bool
+}
+
+// notAliases are keywords that may follow a table name but are never its alias
+var notAliases = map[string]bool{
+	"all": true, "anti": true, "any": true, "array": true, "as": true, "asof": true,
+	"cross": true, "except": true, "final": true, "format": true, "full": true,
+	"global": true, "group": true, "having": true, "inner": true, "intersect": true,
+	"into": true, "join": true, "left": true, "limit": true, "natural": true,
+	"offset": true, "on": true, "order": true, "outer": true, "paste": true,
+	"prewhere": true, "qualify": true, "right": true, "sample": true, "select": true,
+	"semi": true, "settings": true, "union": true, "using": true, "where": true,
+	"window": true, "with": true,
+}
+
+// clauseKeywords maps keywords that start a clause to the clause they start
+var clauseKeywords = map[string]string{
+	"select":   "select",
+	"from":     "from",
+	"join":     "from",
+	"on":       "on",
+	"using":    "using",
+	"where":    "where",
+	"prewhere": "where",
+	"group":    "group by",
+	"order":    "order by",
+	"having":   "having",
+	"limit":    "limit",
+	"offset":   "limit",
+	"settings": "settings",
+	"format":   "format",
+	"union":    "",
+}
+
+// AnalyzeSQL tokenizes query and describes the context at the byte offset
+// position; positions outside the query are clamped to it
+func AnalyzeSQL(query string, position int) SQLContext {
+	position = max(0, min(position, len(query)))
+	tokens := tokenizeSQL(query)
+
+	var ctx SQLContext
+	var before []sqlToken // significant tokens before the word being typed
+	var code []sqlToken   // every token except comments
+	for _, tok := range tokens {
+		if tok.kind == sqlString || tok.kind == sqlComment {
+			if tok.start < position && (position < tok.end || tok.open) {
+				ctx.InLiteral = true
+			}
+		}
+		if tok.kind == sqlComment {
+			continue
+		}
+		code = append(code, tok)
+
+		switch {
+		case tok.kind == sqlWord && tok.start < position && position <= tok.end:
+			ctx.Prefix = query[tok.start:position]
+		case tok.end <= position:
+			before = append(before, tok)
+		}
+	}
+
+	if n := len(before); n >= 2 && before[n-1].text == "." && before[n-1].kind == sqlSymbol &&
+		(before[n-2].kind == sqlWord || before[n-2].kind == sqlQuotedIdent) {
+		ctx.Qualifier = before[n-2].text
+		before = before[:n-2]
+	}
+
+	ctx.Clause = clauseAt(before)
+	if n := len(before); n > 0 {
+		last := before[n-1]
+		keyword := strings.ToLower(last.text)
+		ctx.ExpectTable = last.kind == sqlWord && (keyword == "from" || keyword == "join") ||
+			last.kind == sqlSymbol && last.text == "," && ctx.Clause == "from"
+	}
+
+	ctx.Tables = tableRefs(code)
+	return ctx
+}
+
+// clauseAt returns the clause the end of tokens is in, ignoring clauses of
+// closed subqueries
+func clauseAt(tokens []sqlToken) string {
+	clauses := []string{""}
+	for _, tok := range tokens {
+		switch {
+		case tok.kind == sqlSymbol && tok.text == "(":
+			clauses = append(clauses, clauses[len(clauses)-1])
+		case tok.kind == sqlSymbol && tok.text == ")":
+			if len(clauses) > 1 {
+				clauses = clauses[:len(clauses)-1]
+			}
+		case tok.kind == sqlWord:
+			if clause, ok := clauseKeywords[strings.ToLower(tok.text)]; ok {
+				clauses[len(clauses)-1] = clause
+			}
+		}
+	}
+	return clauses[len(clauses)-1]
+}
+
+// tableRefs collects the tables named after FROM and JOIN, including the
+// comma-separated tables of a FROM clause
+func tableRefs(tokens []sqlToken) []SQLTableRef {
+	var refs []SQLTableRef
+	for i := 0; i < len(tokens); i++ {
+		keyword := strings.ToLower(tokens[i].text)
+		if tokens[i].kind != sqlWord || (keyword != "from" && keyword != "join") {
+			continue
+		}
+		for j := i + 1; ; {
+			ref, next, ok := parseTableRef(tokens, j)
+			if !ok {
+				break
+			}
+			refs = append(refs, ref)
+			i = next - 1
+			if keyword != "from" || next >= len(tokens) || tokens[next].text != "," || tokens[next].kind != sqlSymbol {
+				break
+			}
+			j = next + 1
+		}
+	}
+	return refs
+}
+
+// parseTableRef parses "[database.]table [[AS] alias]" starting at tokens[i]
+// and returns the index of the token after it
+func parseTableRef(tokens []sqlToken, i int) (SQLTableRef, int, bool) {
+	isName := func(i int) bool {
+		return i < len(tokens) && (tokens[i].kind == sqlQuotedIdent ||
+			tokens[i].kind == sqlWord && !notAliases[strings.ToLower(tokens[i].text)])
+	}
+	isSymbol := func(i int, symbol string) bool {
+		return i < len(tokens) && tokens[i].kind == sqlSymbol && tokens[i].text == symbol
+	}
+
+	if !isName(i) {
+		return SQLTableRef{}, i, false
+	}
+	ref := SQLTableRef{Table: tokens[i].text}
+	i++
+	if isSymbol(i, ".") && isName(i+1) {
+		ref.Database, ref.Table = ref.Table, tokens[i+1].text
+		i += 2
+	}
+	if isSymbol(i, "(") {
+		// a table function such as numbers(10) rather than a table
+		return SQLTableRef{}, i, false
+	}
+
+	if i < len(tokens) && tokens[i].kind == sqlWord && strings.EqualFold(tokens[i].text, "as") {
+		i++
+	}
+	if isName(i) {
+		ref.Alias = tokens[i].text
+		i++
+	}
+	return ref, i, true
+}
+
+// tokenizeSQL splits a query into words, quoted identifiers, string
+// literals, comments and single-character symbols
+func tokenizeSQL(query string) []sqlToken {
+	var tokens []sqlToken
+	for i := 0; i < len(query); {
+		c := query[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == '\'':
+			i = quotedEnd(query, i)
+			tokens = append(tokens, sqlToken{kind: sqlString, start: start, end: i,
+				open: i == len(query) && !closedQuote(query, start)})
+		case c == '"' || c == '`':
+			i = quotedEnd(query, i)
+			text := strings.TrimSuffix(query[start+1:i], string(c))
+			text = strings.ReplaceAll(text, string(c)+string(c), string(c))
+			tokens = append(tokens, sqlToken{kind: sqlQuotedIdent, text: text, start: start, end: i})
+		case c == '-' && i+1 < len(query) && query[i+1] == '-', c == '#':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlComment, start: start, end: i, open: true})
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			end := strings.Index(query[i+2:], "*/")
+			open := end < 0
+			if open {
+				i = len(query)
+			} else {
+				i += end + 4
+			}
+			tokens = append(tokens, sqlToken{kind: sqlComment, start: start, end: i, open: open})
+		case isWordByte(c):
+			for i < len(query) && isWordByte(query[i]) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlWord, text: query[start:i], start: start, end: i})
+		default:
+			i++
+			tokens = append(tokens, sqlToken{kind: sqlSymbol, text: query[start:i], start: start, end: i})
+		}
+	}
+	return tokens
+}
+
+// closedQuote reports whether the quoted section opening at start is
+// terminated before the end of s, scanning it the way quotedEnd does
+func closedQuote(s string, start int) bool {
+	quote := s[start]
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			if i+1 < len(s) && s[i+1] == quote {
+				i++
+				continue
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,491 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsafeQuery is returned when a raw SQL query is not a single read-only statement
+var ErrUnsafeQuery = errors.New("unsafe query")
+
+// forbiddenKeywords may not start the statement, including after a WITH
+// clause, where they would smuggle a write past the SELECT check (e.g. a CTE
+// followed by ALTER TABLE system.query_log DELETE). Elsewhere they are
+// ordinary names, such as a column called update or an alias AS create.
+var forbiddenKeywords = map[string]bool{
+	"alter":    true,
+	"attach":   true,
+	"create":   true,
+	"delete":   true,
+	"detach":   true,
+	"drop":     true,
+	"grant":    true,
+	"insert":   true,
+	"kill":     true,
+	"optimize": true,
+	"rename":   true,
+	"revoke":   true,
+	"truncate": true,
+	"update":   true,
+}
+
+// ValidateReadOnlyQuery checks that query is a single SELECT (or WITH ... SELECT)
+// statement. Comments are ignored, a single trailing semicolon is allowed, and
+// anything written to a file with INTO OUTFILE is rejected.
+func ValidateReadOnlyQuery(query string) error {
+	statements := splitStatements(stripComments(query))
+	if len(statements) == 0 {
+		return fmt.Errorf("%w: query is empty", ErrUnsafeQuery)
+	}
+	if len(statements) > 1 {
+		return fmt.Errorf("%w: only a single statement is allowed", ErrUnsafeQuery)
+	}
+
+	words := keywords(statements[0])
+	if len(words) == 0 || (words[0] != "select" && words[0] != "with") {
+		return fmt.Errorf("%w: only SELECT queries are allowed", ErrUnsafeQuery)
+	}
+	if words[0] == "with" {
+		keyword := withStatementKeyword(outerTokens(statements[0]))
+		if forbiddenKeywords[keyword] {
+			return fmt.Errorf("%w: %s is not allowed", ErrUnsafeQuery, strings.ToUpper(keyword))
+		}
+		if keyword != "select" {
+			return fmt.Errorf("%w: only SELECT queries are allowed", ErrUnsafeQuery)
+		}
+	}
+
+	for i, word := range words {
+		if word == "into" && i+1 < len(words) && words[i+1] == "outfile" {
+			return fmt.Errorf("%w: INTO OUTFILE is not allowed", ErrUnsafeQuery)
+		}
+	}
+
+	return nil
+}
+
+// withStatementKeyword returns the keyword starting the statement that
+// follows a WITH clause, given the outerTokens of the statement. Every element
+// of the clause, "name AS (subquery)" or "expression AS name", ends with the
+// token after its outer AS, and elements are separated by commas. It returns
+// "" when the clause does not end.
+func withStatementKeyword(tokens []string) string {
+	i := 1
+	if i < len(tokens) && tokens[i] == "recursive" {
+		i++
+	}
+	for {
+		for i < len(tokens) && tokens[i] != "as" {
+			i++
+		}
+		i += 2
+		if i >= len(tokens) {
+			return ""
+		}
+		if tokens[i] != "," {
+			return tokens[i]
+		}
+		i++
+	}
+}
+
+// outerTokens returns the tokens of statement outside parentheses: lowercased
+// bare words, commas, "()" for each parenthesized group and "'" for each
+// string literal or quoted identifier
+func outerTokens(statement string) []string {
+	var tokens []string
+	depth := 0
+	for i := 0; i < len(statement); {
+		c := statement[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			if depth == 0 {
+				tokens = append(tokens, "'")
+			}
+			i = quotedEnd(statement, i)
+			continue
+		case c == '(':
+			if depth == 0 {
+				tokens = append(tokens, "()")
+			}
+			depth++
+		case c == ')':
+			if depth > 0 {
+				depth--
+			}
+		case depth > 0:
+		case c == ',':
+			tokens = append(tokens, ",")
+		case isWordByte(c):
+			start := i
+			for i < len(statement) && isWordByte(statement[i]) {
+				i++
+			}
+			tokens = append(tokens, strings.ToLower(statement[start:i]))
+			continue
+		}
+		i++
+	}
+	return tokens
+}
+
+// HasRowLimit reports whether a single SELECT statement, as accepted by
+// ValidateReadOnlyQuery, caps the number of rows it returns with a LIMIT,
+// FETCH or TOP clause of the outer query. Clauses inside subqueries and CTEs
+// do not count, nor does LIMIT n BY, which caps the rows per group. Queries
+// combined with UNION, EXCEPT or INTERSECT each need their own limit, as a
+// LIMIT at the end only applies to the last of them.
+func HasRowLimit(query string) bool {
+	statements := splitStatements(stripComments(query))
+	if len(statements) != 1 {
+		return false
+	}
+
+	words := outerKeywords(statements[0])
+	allLimited, limited := true, false
+	for i, word := range words {
+		switch word {
+		case "union", "except", "intersect":
+			allLimited = allLimited && limited
+			limited = false
+		case "limit":
+			// LIMIT [offset,] n BY columns limits each group
+			j := i + 1
+			for j < len(words) && isNumber(words[j]) {
+				j++
+			}
+			if j >= len(words) || words[j] != "by" {
+				limited = true
+			}
+		case "fetch":
+			limited = true
+		case "top":
+			// SELECT [DISTINCT] TOP n, as opposed to a column named top
+			if i > 0 && (words[i-1] == "select" || words[i-1] == "distinct") && i+1 < len(words) && isNumber(words[i+1]) {
+				limited = true
+			}
+		}
+	}
+	return allLimited && limited
+}
+
+// RowLimitValue returns the number of rows the outer LIMIT, FETCH or TOP
+// clause of a single SELECT statement allows, when HasRowLimit holds and the
+// clause is written with a number rather than a ? placeholder. Queries
+// combined with UNION, EXCEPT or INTERSECT have no single value.
+func RowLimitValue(query string) (int, bool) {
+	if !HasRowLimit(query) {
+		return 0, false
+	}
+	words := outerKeywords(splitStatements(stripComments(query))[0])
+
+	value, found := 0, false
+	for i, word := range words {
+		var count string
+		switch word {
+		case "union", "except", "intersect":
+			return 0, false
+		case "limit":
+			// LIMIT n, LIMIT offset, n and LIMIT n OFFSET m; LIMIT n BY limits groups
+			j := i + 1
+			for j < len(words) && isNumber(words[j]) {
+				j++
+			}
+			if j < len(words) && words[j] == "by" {
+				continue
+			}
+			if j == i+1 {
+				// A placeholder
+				return 0, false
+			}
+			count = words[j-1]
+		case "fetch":
+			// FETCH FIRST|NEXT n ROW[S] ONLY
+			if i+2 >= len(words) || !isNumber(words[i+2]) {
+				return 0, false
+			}
+			count = words[i+2]
+		case "top":
+			if i > 0 && (words[i-1] == "select" || words[i-1] == "distinct") && i+1 < len(words) && isNumber(words[i+1]) {
+				count = words[i+1]
+			}
+		}
+		if count != "" {
+			n, err := strconv.Atoi(count)
+			if err != nil {
+				return 0, false
+			}
+			value, found = n, true
+		}
+	}
+	return value, found
+}
+
+// WithRowLimit wraps a single SELECT statement into an outer query returning
+// at most limit of its rows. Comments and ? placeholders are kept as they are,
+// so params still bind the same way, and a trailing semicolon is dropped.
+func WithRowLimit(query string, limit int) string {
+	return fmt.Sprintf("SELECT * FROM (\n%s\n) LIMIT %d", withoutTerminator(query), limit)
+}
+
+// withoutTerminator replaces the first semicolon outside string literals,
+// quoted identifiers and comments with a space; in a single statement, that
+// is the one ending it
+func withoutTerminator(query string) string {
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			i = quotedEnd(query, i)
+		case c == '-' && i+1 < len(query) && query[i+1] == '-', c == '#':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return query
+			}
+			i += end + 4
+		case c == ';':
+			return query[:i] + " " + query[i+1:]
+		default:
+			i++
+		}
+	}
+	return query
+}
+
+// outerKeywords is keywords for the words of statement outside parentheses
+func outerKeywords(statement string) []string {
+	var outer strings.Builder
+	depth := 0
+	for i := 0; i < len(statement); {
+		c := statement[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := quotedEnd(statement, i)
+			if depth == 0 {
+				outer.WriteString(statement[i:end])
+			}
+			i = end
+			continue
+		case c == '(':
+			depth++
+			outer.WriteByte(' ')
+		case c == ')':
+			if depth > 0 {
+				depth--
+			}
+			outer.WriteByte(' ')
+		case depth == 0:
+			outer.WriteByte(c)
+		}
+		i++
+	}
+	return keywords(outer.String())
+}
+
+// isNumber reports whether word is made of digits only
+func isNumber(word string) bool {
+	for i := 0; i < len(word); i++ {
+		if word[i] < '0' || word[i] > '9' {
+			return false
+		}
+	}
+	return word != ""
+}
+
+// CountPlaceholders returns the number of ? placeholders in query the way the
+// driver binds args to them: every ? that is not escaped as \?, including
+// those inside string literals and comments. It fails for a query that also
+// holds $1-style placeholders outside string literals and comments, which the
+// driver would bind instead.
+func CountPlaceholders(query string) (int, error) {
+	if hasNumberedPlaceholder(query) {
+		return 0, fmt.Errorf("use ? placeholders, not $1")
+	}
+	count := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] == '?' && (i == 0 || query[i-1] != '\\') {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// hasNumberedPlaceholder reports whether query has a $ followed by a digit
+// outside quotes and comments
+func hasNumberedPlaceholder(query string) bool {
+	query = stripComments(query)
+	for i := 0; i < len(query); {
+		switch c := query[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			i = quotedEnd(query, i)
+		case c == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			return true
+		default:
+			i++
+		}
+	}
+	return false
+}
+
+// HideNumberedPlaceholders rewrites the $ followed by a digit in the quoted
+// sections and comments of query, which the driver would otherwise take for a
+// $1-style placeholder when binding args. In quotes the digit is written as a
+// \xHH escape, which ClickHouse reads back as the same digit; in comments a
+// space is inserted.
+func HideNumberedPlaceholders(query string) string {
+	var b strings.Builder
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := quotedEnd(query, i)
+			b.WriteString(hideDollarDigits(query[i:end], func(digit byte) string { return fmt.Sprintf("\\x%x", digit) }))
+			i = end
+		case c == '-' && i+1 < len(query) && query[i+1] == '-', c == '#':
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			b.WriteString(hideDollarDigits(query[i:i+end], func(digit byte) string { return " " + string(digit) }))
+			i += end
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				end = len(query) - i
+			} else {
+				end += 4
+			}
+			b.WriteString(hideDollarDigits(query[i:i+end], func(digit byte) string { return " " + string(digit) }))
+			i += end
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// hideDollarDigits replaces the digit after every $ in s with hide(digit)
+func hideDollarDigits(s string, hide func(digit byte) string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		b.WriteByte(s[i])
+		if s[i] == '$' && i+1 < len(s) && isDigit(s[i+1]) {
+			b.WriteString(hide(s[i+1]))
+			i++
+		}
+	}
+	return b.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// stripComments replaces -- and # line comments and /* */ block comments with
+// a space, leaving string literals and quoted identifiers untouched
+func stripComments(query string) string {
+	var b strings.Builder
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := quotedEnd(query, i)
+			b.WriteString(query[i:end])
+			i = end
+		case c == '-' && i+1 < len(query) && query[i+1] == '-', c == '#':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+			b.WriteByte(' ')
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				i = len(query)
+			} else {
+				i += end + 4
+			}
+			b.WriteByte(' ')
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// splitStatements splits on semicolons outside quotes and drops empty statements
+func splitStatements(query string) []string {
+	var statements []string
+	start := 0
+	for i := 0; i < len(query); {
+		switch query[i] {
+		case '\'', '"', '`':
+			i = quotedEnd(query, i)
+			continue
+		case ';':
+			statements = appendStatement(statements, query[start:i])
+			start = i + 1
+		}
+		i++
+	}
+	return appendStatement(statements, query[start:])
+}
+
+func appendStatement(statements []string, statement string) []string {
+	if statement = strings.TrimSpace(statement); statement != "" {
+		statements = append(statements, statement)
+	}
+	return statements
+}
+
+// keywords returns the lowercased bare words of a statement, skipping string
+// literals and quoted identifiers
+func keywords(statement string) []string {
+	var words []string
+	for i := 0; i < len(statement); {
+		c := statement[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			i = quotedEnd(statement, i)
+		case isWordByte(c):
+			start := i
+			for i < len(statement) && isWordByte(statement[i]) {
+				i++
+			}
+			words = append(words, strings.ToLower(statement[start:i]))
+		default:
+			i++
+		}
+	}
+	return words
+}
+
+// quotedEnd returns the index just past the quoted section opening at start,
+// honouring backslash escapes and doubled quote characters
+func quotedEnd(s string, start int) int {
+	quote := s[start]
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			if i+1 < len(s) && s[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,223 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateReadOnlyQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantErr string // empty when the query is accepted
+	}{
+		{"select", "SELECT * FROM logs", ""},
+		{"trailing semicolon", "SELECT 1;", ""},
+		{"with", "WITH recent AS (SELECT * FROM logs) SELECT count() FROM recent", ""},
+		{"with expression", "WITH 10 AS n SELECT n", ""},
+		{"with several elements", "WITH a AS (SELECT 1), toDate('2024-01-01') AS d, [1, 2] AS arr SELECT * FROM a", ""},
+		{"with recursive", "WITH RECURSIVE t AS (SELECT 1) SELECT * FROM t", ""},
+		{"union", "SELECT 1 UNION ALL SELECT 2", ""},
+		{"comments", "-- DROP TABLE logs\nSELECT /* DELETE */ 1 # ALTER", ""},
+		{"keyword in string", "SELECT * FROM logs WHERE Body = 'DROP TABLE logs'", ""},
+
+		// Forbidden keywords are only keywords where a statement starts
+		{"column named update", "SELECT update FROM t", ""},
+		{"alias named create", "SELECT count() AS create FROM t", ""},
+		{"column named delete in where", "SELECT * FROM t WHERE delete = 1 ORDER BY drop", ""},
+		{"with alias named update", "WITH 1 AS update SELECT update", ""},
+		{"cte named alter", "WITH alter AS (SELECT 1) SELECT * FROM alter", ""},
+		{"function argument named insert", "SELECT sum(insert) FROM t", ""},
+
+		{"empty", "  ; -- nothing", "query is empty"},
+		{"two statements", "SELECT 1; SELECT 2", "only a single statement"},
+		{"smuggled statement", "SELECT 1; DROP TABLE logs", "only a single statement"},
+		{"insert", "INSERT INTO logs SELECT * FROM logs", "only SELECT queries"},
+		{"alter", "ALTER TABLE logs DELETE WHERE 1", "only SELECT queries"},
+		{"show", "SHOW TABLES", "only SELECT queries"},
+		{"cte then alter", "WITH x AS (SELECT 1) ALTER TABLE system.query_log DELETE WHERE 1", "ALTER is not allowed"},
+		{"cte then insert", "WITH x AS (SELECT 1), y AS (SELECT 2) INSERT INTO t SELECT * FROM x", "INSERT is not allowed"},
+		{"expression then drop", "WITH 1 AS n DROP TABLE t", "DROP is not allowed"},
+		{"cte then show", "WITH x AS (SELECT 1) SHOW TABLES", "only SELECT queries"},
+		{"unfinished with", "WITH x", "only SELECT queries"},
+		{"into outfile", "SELECT * FROM logs INTO OUTFILE '/tmp/logs.csv'", "INTO OUTFILE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateReadOnlyQuery(tt.query)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateReadOnlyQuery(%q) = %v, want nil", tt.query, err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrUnsafeQuery) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateReadOnlyQuery(%q) = %v, want ErrUnsafeQuery containing %q", tt.query, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHasRowLimit(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"SELECT * FROM logs LIMIT 10", true},
+		{"SELECT * FROM logs LIMIT 10;", true},
+		{"SELECT * FROM logs LIMIT 10 ;  ", true},
+		{"SELECT * FROM logs LIMIT 10, 20", true},
+		{"SELECT * FROM logs LIMIT 10 OFFSET 20", true},
+		{"SELECT * FROM logs ORDER BY Timestamp OFFSET 5 ROWS FETCH FIRST 10 ROWS ONLY", true},
+		{"SELECT TOP 10 * FROM logs", true},
+		{"SELECT DISTINCT TOP 10 ServiceName FROM logs", true},
+		{"select * from logs limit 10", true},
+		{"SELECT * FROM logs LIMIT 10 -- trailing comment", true},
+		{"SELECT * FROM logs /* no limit here */ LIMIT 10 # done", true},
+		{"SELECT * FROM logs LIMIT 10; -- comment after the semicolon", true},
+		{"SELECT 1 LIMIT 1 UNION ALL SELECT 2 LIMIT 1", true},
+
+		{"SELECT * FROM logs", false},
+		{"SELECT * FROM logs;", false},
+		{"SELECT * FROM logs -- LIMIT 10", false},
+		{"SELECT * FROM logs /* LIMIT 10 */", false},
+		{"SELECT * FROM logs # LIMIT 10", false},
+		{"SELECT * FROM logs WHERE Body = 'LIMIT 10'", false},
+		{"SELECT `limit` FROM logs", false},
+		{"SELECT * FROM (SELECT * FROM logs LIMIT 10)", false},
+		{"WITH recent AS (SELECT * FROM logs LIMIT 10) SELECT * FROM recent", false},
+		{"SELECT * FROM logs LIMIT 1 BY ServiceName", false},
+		{"SELECT * FROM logs LIMIT 2, 1 BY ServiceName", false},
+		{"SELECT * FROM logs LIMIT 1 BY ServiceName LIMIT 10", true},
+		{"SELECT 1 UNION ALL SELECT 2 LIMIT 1", false},
+		{"SELECT top FROM logs", false},
+		{"SELECT 1 LIMIT 1; SELECT 2 LIMIT 1", false},
+	}
+	for _, tt := range tests {
+		if got := HasRowLimit(tt.query); got != tt.want {
+			t.Errorf("HasRowLimit(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestWithRowLimit(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT * FROM logs", "SELECT * FROM (\nSELECT * FROM logs\n) LIMIT 11"},
+		{"SELECT * FROM logs;", "SELECT * FROM (\nSELECT * FROM logs \n) LIMIT 11"},
+		{"SELECT * FROM logs; ", "SELECT * FROM (\nSELECT * FROM logs  \n) LIMIT 11"},
+		// Comments stay inside the subquery, which the newlines close off
+		{"SELECT * FROM logs -- recent", "SELECT * FROM (\nSELECT * FROM logs -- recent\n) LIMIT 11"},
+		{"SELECT * FROM logs # recent;", "SELECT * FROM (\nSELECT * FROM logs # recent;\n) LIMIT 11"},
+		{"SELECT * /* ; */ FROM logs;", "SELECT * FROM (\nSELECT * /* ; */ FROM logs \n) LIMIT 11"},
+		{"SELECT ';' AS s, `a;b` FROM logs;", "SELECT * FROM (\nSELECT ';' AS s, `a;b` FROM logs \n) LIMIT 11"},
+		{"SELECT * FROM logs WHERE level = ? LIMIT ?", "SELECT * FROM (\nSELECT * FROM logs WHERE level = ? LIMIT ?\n) LIMIT 11"},
+	}
+	for _, tt := range tests {
+		got := WithRowLimit(tt.query, 11)
+		if got != tt.want {
+			t.Errorf("WithRowLimit(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+		// The wrapped query has its own limit and is still a single read-only query
+		if !HasRowLimit(got) {
+			t.Errorf("HasRowLimit(WithRowLimit(%q)) = false", tt.query)
+		}
+		if err := ValidateReadOnlyQuery(got); err != nil {
+			t.Errorf("ValidateReadOnlyQuery(WithRowLimit(%q)) = %v", tt.query, err)
+		}
+	}
+}
+
+func TestRowLimitValue(t *testing.T) {
+	tests := []struct {
+		query  string
+		want   int
+		wantOK bool
+	}{
+		{"SELECT * FROM logs LIMIT 10", 10, true},
+		{"SELECT * FROM logs LIMIT 10;", 10, true},
+		{"SELECT * FROM logs LIMIT 20, 10", 10, true},
+		{"SELECT * FROM logs LIMIT 10 OFFSET 20", 10, true},
+		{"SELECT * FROM logs ORDER BY Timestamp OFFSET 5 ROWS FETCH FIRST 10 ROWS ONLY", 10, true},
+		{"SELECT TOP 10 * FROM logs", 10, true},
+		{"SELECT * FROM logs LIMIT 1 BY ServiceName LIMIT 10", 10, true},
+		{"SELECT * FROM (SELECT * FROM logs LIMIT 5) LIMIT 10 -- LIMIT 20", 10, true},
+
+		{"SELECT * FROM logs", 0, false},
+		{"SELECT * FROM logs LIMIT ?", 0, false},
+		{"SELECT * FROM logs LIMIT ? OFFSET ?", 0, false},
+		{"SELECT * FROM logs LIMIT 1 BY ServiceName", 0, false},
+		{"SELECT 1 LIMIT 1 UNION ALL SELECT 2 LIMIT 1", 0, false},
+		{"SELECT * FROM logs LIMIT 99999999999999999999", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := RowLimitValue(tt.query)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("RowLimitValue(%q) = %d, %v, want %d, %v", tt.query, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestCountPlaceholders(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    int
+		wantErr bool
+	}{
+		{"SELECT * FROM logs", 0, false},
+		{"SELECT * FROM logs WHERE level = ? LIMIT ?", 2, false},
+		{`SELECT * FROM logs WHERE Body LIKE 'what\?' AND level = ?`, 1, false},
+		{"SELECT * FROM logs WHERE Body = '?'", 1, false},
+		{"SELECT * FROM logs WHERE Body = 'costs $5' AND level = ?", 1, false},
+		{"SELECT `$1` FROM logs WHERE level = ?", 1, false},
+		{"SELECT * FROM logs WHERE level = ? -- was $1", 1, false},
+		{"SELECT * FROM logs /* $1 */ WHERE level = ?", 1, false},
+
+		{"SELECT * FROM logs WHERE level = $1", 0, true},
+		{"SELECT * FROM logs WHERE Body = 'x' AND level = $1", 0, true},
+		{"SELECT * FROM logs WHERE level = ? -- note\nAND x = $2", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := CountPlaceholders(tt.query)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("CountPlaceholders(%q) = %d, %v, want %d, error %v", tt.query, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestHideNumberedPlaceholders(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT * FROM logs WHERE level = ?", "SELECT * FROM logs WHERE level = ?"},
+		{"SELECT 'costs $5', '$' WHERE x = ?", `SELECT 'costs $\x35', '$' WHERE x = ?`},
+		{"SELECT `$10` FROM logs", "SELECT `$\\x310` FROM logs"},
+		{"SELECT 1 -- $1\nWHERE x = ?", "SELECT 1 -- $ 1\nWHERE x = ?"},
+		{"SELECT 1 /* $2 */ WHERE x = ?", "SELECT 1 /* $ 2 */ WHERE x = ?"},
+		{`SELECT 'it\'s $1' # $3`, `SELECT 'it\'s $\x31' # $ 3`},
+	}
+	for _, tt := range tests {
+		got := HideNumberedPlaceholders(tt.query)
+		if got != tt.want {
+			t.Errorf("HideNumberedPlaceholders(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+		// The driver binds by number whenever the query matches \$[0-9]+
+		if hasDollarDigit(got) {
+			t.Errorf("HideNumberedPlaceholders(%q) = %q still has a $1-style placeholder", tt.query, got)
+		}
+	}
+}
+
+// hasDollarDigit reports whether s has a $ followed by a digit anywhere
+func hasDollarDigit(s string) bool {
+	for i := 0; i+1 < len(s); i++ {
+		if s[i] == '$' && isDigit(s[i+1]) {
+			return true
+		}
+	}
+	return false
+}
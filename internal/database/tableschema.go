@@ -0,0 +1,144 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// TableSchema describes how a table is laid out on disk: its engine, the
+// keys that decide partitioning and sort order, and its columns and data
+// skipping indexes. Filters on the leading sorting key columns and on the
+// partition key let ClickHouse skip most of the data.
+type TableSchema struct {
+	Database     string              `json:"database"`
+	Table        string              `json:"table"`
+	Engine       string              `json:"engine"`
+	PartitionKey string              `json:"partitionKey"`
+	SortingKey   string              `json:"sortingKey"`
+	PrimaryKey   string              `json:"primaryKey"`
+	SamplingKey  string              `json:"samplingKey"`
+	TotalRows    *uint64             `json:"totalRows"`  // null for engines that do not track it
+	TotalBytes   *uint64             `json:"totalBytes"` // null for engines that do not track it
+	Columns      []TableSchemaColumn `json:"columns"`
+	Indexes      []DataSkippingIndex `json:"indexes"`
+}
+
+// TableSchemaColumn is a column with the keys it belongs to
+type TableSchemaColumn struct {
+	Name              string `json:"name"`
+	Type              string `json:"type"`
+	DefaultKind       string `json:"defaultKind,omitempty"` // DEFAULT, MATERIALIZED, ALIAS or EPHEMERAL
+	DefaultExpression string `json:"defaultExpression,omitempty"`
+	Codec             string `json:"codec,omitempty"`
+	Comment           string `json:"comment,omitempty"`
+	InPartitionKey    bool   `json:"inPartitionKey"`
+	InSortingKey      bool   `json:"inSortingKey"`
+	InPrimaryKey      bool   `json:"inPrimaryKey"`
+}
+
+// DataSkippingIndex is a secondary index such as a bloom_filter or minmax index
+type DataSkippingIndex struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Expression  string `json:"expression"`
+	Granularity uint64 `json:"granularity"`
+}
+
+// GetTableSchema returns the engine, keys, columns and data skipping indexes
+// of a table, or a *TableNotFoundError when it does not exist
+func (c *ClickHouseClient) GetTableSchema(ctx context.Context, database, table string) (*TableSchema, error) {
+	if err := c.checkTableExists(ctx, database, table); err != nil {
+		return nil, err
+	}
+
+	schema := &TableSchema{Database: database, Table: table}
+	err := c.queryRow(ctx, `
+		SELECT engine, partition_key, sorting_key, primary_key, sampling_key, total_rows, total_bytes
+		FROM system.tables
+		WHERE database = ? AND name = ?
+	`, database, table).Scan(
+		&schema.Engine, &schema.PartitionKey, &schema.SortingKey, &schema.PrimaryKey,
+		&schema.SamplingKey, &schema.TotalRows, &schema.TotalBytes,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Dropped since the existence check
+		return nil, &TableNotFoundError{Database: database, Table: table}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query table schema for %s.%s: %w", database, table, err)
+	}
+
+	if schema.Columns, err = c.tableSchemaColumns(ctx, database, table); err != nil {
+		return nil, err
+	}
+	if schema.Indexes, err = c.dataSkippingIndexes(ctx, database, table); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// tableSchemaColumns lists the columns of a table in definition order
+func (c *ClickHouseClient) tableSchemaColumns(ctx context.Context, database, table string) ([]TableSchemaColumn, error) {
+	rows, err := c.query(ctx, `
+		SELECT name, type, default_kind, default_expression, compression_codec, comment,
+			is_in_partition_key, is_in_sorting_key, is_in_primary_key
+		FROM system.columns
+		WHERE database = ? AND table = ?
+		ORDER BY position
+	`, database, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query columns for %s.%s: %w", database, table, err)
+	}
+	defer rows.Close()
+
+	columns := []TableSchemaColumn{}
+	for rows.Next() {
+		var col TableSchemaColumn
+		var inPartitionKey, inSortingKey, inPrimaryKey uint8
+		if err := rows.Scan(&col.Name, &col.Type, &col.DefaultKind, &col.DefaultExpression, &col.Codec, &col.Comment,
+			&inPartitionKey, &inSortingKey, &inPrimaryKey); err != nil {
+			c.logger.Error("error scanning column row", "error", err)
+			continue
+		}
+		col.InPartitionKey = inPartitionKey != 0
+		col.InSortingKey = inSortingKey != 0
+		col.InPrimaryKey = inPrimaryKey != 0
+		columns = append(columns, col)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating column rows: %w", err)
+	}
+	return columns, nil
+}
+
+// dataSkippingIndexes lists the secondary indexes of a table
+func (c *ClickHouseClient) dataSkippingIndexes(ctx context.Context, database, table string) ([]DataSkippingIndex, error) {
+	rows, err := c.query(ctx, `
+		SELECT name, type, expr, granularity
+		FROM system.data_skipping_indices
+		WHERE database = ? AND table = ?
+		ORDER BY name
+	`, database, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query indexes for %s.%s: %w", database, table, err)
+	}
+	defer rows.Close()
+
+	indexes := []DataSkippingIndex{}
+	for rows.Next() {
+		var index DataSkippingIndex
+		if err := rows.Scan(&index.Name, &index.Type, &index.Expression, &index.Granularity); err != nil {
+			c.logger.Error("error scanning index row", "error", err)
+			continue
+		}
+		indexes = append(indexes, index)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating index rows: %w", err)
+	}
+	return indexes, nil
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// timeoutExceededCode is the ClickHouse TIMEOUT_EXCEEDED error code
+const timeoutExceededCode = 159
+
+// queryTimeoutGrace is how much longer than its limit the client waits for a
+// query, so that ClickHouse reports the timeout itself whenever it can
+const queryTimeoutGrace = 2 * time.Second
+
+// QueryTimeoutError is returned when a query runs longer than its time limit
+type QueryTimeoutError struct {
+	Limit time.Duration
+}
+
+func (e *QueryTimeoutError) Error() string {
+	return fmt.Sprintf("query exceeded %d seconds", int(math.Ceil(e.Limit.Seconds())))
+}
+
+// withQueryTimeout limits queries run with the returned context to timeout:
+// ClickHouse stops them through max_execution_time, and the context deadline
+// gives up on the connection should the server not respond. A zero timeout
+// leaves ctx unchanged.
+func withQueryTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+
+	ctx = withQuerySettings(ctx, clickhouse.Settings{
+		"max_execution_time": int(math.Ceil(timeout.Seconds())),
+	})
+	return context.WithTimeout(ctx, timeout+queryTimeoutGrace)
+}
+
+// queryTimeoutErr replaces err with a QueryTimeoutError when it was caused by
+// the query hitting its limit rather than the caller going away; parent is the
+// context the query was started with
+func queryTimeoutErr(parent context.Context, err error, timeout time.Duration) error {
+	if err == nil || timeout <= 0 || parent.Err() != nil {
+		return err
+	}
+
+	var exception *clickhouse.Exception
+	if errors.As(err, &exception) && exception.Code == timeoutExceededCode {
+		return &QueryTimeoutError{Limit: timeout}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &QueryTimeoutError{Limit: timeout}
+	}
+	return err
+}
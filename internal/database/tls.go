@@ -0,0 +1,33 @@
+package database
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// tlsConfig returns the TLS settings of a secure connection, or nil when the
+// connection is not secure
+func (o ClientOptions) tlsConfig() (*tls.Config, error) {
+	if !o.Secure {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ClickHouse CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ClickHouse CA file %s", o.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
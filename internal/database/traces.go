@@ -0,0 +1,252 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrTraceNotFound is returned when otel_traces has no spans for a trace ID
+var ErrTraceNotFound = errors.New("trace not found")
+
+// Span represents a single span read from otel_traces
+type Span struct {
+	TraceId       string            `json:"traceId"`
+	SpanId        string            `json:"spanId"`
+	ParentSpanId  string            `json:"parentSpanId,omitempty"`
+	OperationName string            `json:"operationName"`
+	ServiceName   string            `json:"serviceName"`
+	Kind          string            `json:"kind"`
+	StartTime     time.Time         `json:"startTime"`
+	DurationNs    int64             `json:"durationNs"`
+	StatusCode    string            `json:"statusCode"`
+	StatusMessage string            `json:"statusMessage,omitempty"`
+	Attributes    map[string]string `json:"attributes"`
+	Depth         int               `json:"depth"`
+	ChildSpanIds  []string          `json:"childSpanIds"`
+}
+
+// Trace is the full set of spans sharing a trace ID
+type Trace struct {
+	TraceId     string   `json:"traceId"`
+	RootSpanIds []string `json:"rootSpanIds"`
+	Spans       []Span   `json:"spans"`
+}
+
+// TraceSummary describes a trace in search results without its spans
+type TraceSummary struct {
+	TraceId       string    `json:"traceId"`
+	RootService   string    `json:"rootService"`
+	RootOperation string    `json:"rootOperation"`
+	StartTime     time.Time `json:"startTime"`
+	DurationNs    int64     `json:"durationNs"`
+	SpanCount     uint64    `json:"spanCount"`
+	ErrorCount    uint64    `json:"errorCount"`
+}
+
+// TraceFilter narrows down the traces returned by SearchTraces. A trace matches
+// when at least one of its spans satisfies every set condition.
+type TraceFilter struct {
+	Service       string
+	Operation     string
+	MinDurationNs int64
+	MaxDurationNs int64
+	// Start and End bound the span timestamps considered
+	Start *time.Time
+	End   *time.Time
+	Limit int
+}
+
+// GetTrace returns every span of a trace, linked to its parent and children
+func (c *ClickHouseClient) GetTrace(ctx context.Context, traceID string) (*Trace, error) {
+	query := `
+		SELECT
+			TraceId,
+			SpanId,
+			ParentSpanId,
+			SpanName,
+			ServiceName,
+			SpanKind,
+			Timestamp,
+			toInt64(Duration),
+			StatusCode,
+			StatusMessage,
+			SpanAttributes
+		FROM otel_traces
+		WHERE TraceId = ?
+		ORDER BY Timestamp ASC
+	`
+
+	rows, err := c.query(ctx, query, traceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query trace %s: %w", traceID, err)
+	}
+	defer rows.Close()
+
+	var spans []Span
+	for rows.Next() {
+		var span Span
+		err := rows.Scan(
+			&span.TraceId,
+			&span.SpanId,
+			&span.ParentSpanId,
+			&span.OperationName,
+			&span.ServiceName,
+			&span.Kind,
+			&span.StartTime,
+			&span.DurationNs,
+			&span.StatusCode,
+			&span.StatusMessage,
+			&span.Attributes,
+		)
+		if err != nil {
+			c.logger.Error("error scanning span row", "error", err)
+			continue
+		}
+		spans = append(spans, span)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating span rows: %w", err)
+	}
+
+	if len(spans) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrTraceNotFound, traceID)
+	}
+
+	return linkSpans(traceID, spans), nil
+}
+
+// SearchTraces returns the most recent traces with a span matching the filter
+func (c *ClickHouseClient) SearchTraces(ctx context.Context, filter TraceFilter) ([]TraceSummary, error) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.Service != "" {
+		conditions = append(conditions, "ServiceName = ?")
+		args = append(args, filter.Service)
+	}
+	if filter.Operation != "" {
+		conditions = append(conditions, "SpanName = ?")
+		args = append(args, filter.Operation)
+	}
+	if filter.MinDurationNs > 0 {
+		conditions = append(conditions, "Duration >= ?")
+		args = append(args, filter.MinDurationNs)
+	}
+	if filter.MaxDurationNs > 0 {
+		conditions = append(conditions, "Duration <= ?")
+		args = append(args, filter.MaxDurationNs)
+	}
+	if filter.Start != nil {
+		conditions = append(conditions, "Timestamp >= ?")
+		args = append(args, *filter.Start)
+	}
+	if filter.End != nil {
+		conditions = append(conditions, "Timestamp <= ?")
+		args = append(args, *filter.End)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query := `
+		SELECT
+			TraceId,
+			anyIf(ServiceName, ParentSpanId = '') AS root_service,
+			anyIf(SpanName, ParentSpanId = '') AS root_operation,
+			min(Timestamp) AS start_time,
+			max(toUnixTimestamp64Nano(Timestamp) + toInt64(Duration)) - min(toUnixTimestamp64Nano(Timestamp)) AS duration_ns,
+			count() AS span_count,
+			countIf(StatusCode = 'Error' OR StatusCode = 'STATUS_CODE_ERROR') AS error_count
+		FROM otel_traces
+		WHERE TraceId IN (
+			SELECT TraceId
+			FROM otel_traces` + where + `
+			GROUP BY TraceId
+			ORDER BY max(Timestamp) DESC
+			LIMIT ?
+		)
+		GROUP BY TraceId
+		ORDER BY start_time DESC
+	`
+
+	rows, err := c.query(ctx, query, append(args, filter.Limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search traces: %w", err)
+	}
+	defer rows.Close()
+
+	traces := []TraceSummary{}
+	for rows.Next() {
+		var trace TraceSummary
+		err := rows.Scan(
+			&trace.TraceId,
+			&trace.RootService,
+			&trace.RootOperation,
+			&trace.StartTime,
+			&trace.DurationNs,
+			&trace.SpanCount,
+			&trace.ErrorCount,
+		)
+		if err != nil {
+			c.logger.Error("error scanning trace summary row", "error", err)
+			continue
+		}
+		traces = append(traces, trace)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating trace rows: %w", err)
+	}
+
+	return traces, nil
+}
+
+// linkSpans fills in child IDs and depths; spans whose parent is missing from
+// the trace (e.g. not yet ingested) are treated as roots
+func linkSpans(traceID string, spans []Span) *Trace {
+	index := make(map[string]int, len(spans))
+	for i := range spans {
+		spans[i].ChildSpanIds = []string{}
+		if spans[i].Attributes == nil {
+			spans[i].Attributes = map[string]string{}
+		}
+		index[spans[i].SpanId] = i
+	}
+
+	trace := &Trace{TraceId: traceID, RootSpanIds: []string{}}
+	var queue []int
+	for i := range spans {
+		parent, ok := index[spans[i].ParentSpanId]
+		if spans[i].ParentSpanId == "" || !ok || parent == i {
+			trace.RootSpanIds = append(trace.RootSpanIds, spans[i].SpanId)
+			queue = append(queue, i)
+			continue
+		}
+		spans[parent].ChildSpanIds = append(spans[parent].ChildSpanIds, spans[i].SpanId)
+	}
+
+	// Walk down from the roots to assign depths
+	visited := make([]bool, len(spans))
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		if visited[i] {
+			continue
+		}
+		visited[i] = true
+		for _, childID := range spans[i].ChildSpanIds {
+			child := index[childID]
+			spans[child].Depth = spans[i].Depth + 1
+			queue = append(queue, child)
+		}
+	}
+
+	trace.Spans = spans
+	return trace
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxTracedQueryLength caps the query text recorded on a span
+const maxTracedQueryLength = 2048
+
+// tracer creates the spans of ClickHouse queries; it does nothing until a
+// tracer provider is installed
+var tracer = otel.Tracer("github.com/observio/backend/internal/database")
+
+// queryDuration is exposed at /metrics, labeled by first keyword and outcome
+var queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "clickhouse_query_duration_seconds",
+	Help:    "Time taken by ClickHouse statements, including waiting for a query slot.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"operation", "status"})
+
+// querySpan is the span of a ClickHouse statement along with what is needed
+// to record its latency when it ends
+type querySpan struct {
+	trace.Span
+	operation string
+	start     time.Time
+}
+
+// startQuerySpan starts a client span for a ClickHouse statement, named after
+// its first keyword, e.g. "clickhouse SELECT"
+func startQuerySpan(ctx context.Context, query string) (context.Context, *querySpan) {
+	operation := "QUERY"
+	if words := keywords(stripComments(query)); len(words) > 0 {
+		operation = strings.ToUpper(words[0])
+	}
+
+	ctx, span := tracer.Start(ctx, "clickhouse "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNameClickHouse,
+			semconv.DBOperationName(operation),
+			semconv.DBQueryText(truncateQuery(query)),
+		),
+	)
+	return ctx, &querySpan{Span: span, operation: operation, start: time.Now()}
+}
+
+// endQuerySpan records err, if any, on span, ends it and observes the
+// statement's duration
+func endQuerySpan(span *querySpan, err error) {
+	status := "ok"
+	if err != nil {
+		status = "error"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+	queryDuration.WithLabelValues(span.operation, status).Observe(time.Since(span.start).Seconds())
+}
+
+// truncateQuery shortens query to maxTracedQueryLength bytes without
+// splitting a multi-byte character
+func truncateQuery(query string) string {
+	if len(query) <= maxTracedQueryLength {
+		return query
+	}
+	cut := maxTracedQueryLength
+	for cut > 0 && !utf8.RuneStart(query[cut]) {
+		cut--
+	}
+	return query[:cut] + "..."
+}
+
+// tracedRows counts the rows read and ends the query's span when closed
+type tracedRows struct {
+	driver.Rows
+	span  *querySpan
+	count int64
+}
+
+func (r *tracedRows) Next() bool {
+	if r.Rows.Next() {
+		r.count++
+		return true
+	}
+	return false
+}
+
+func (r *tracedRows) Close() error {
+	err := r.Rows.Close()
+	spanErr := r.Rows.Err()
+	if spanErr == nil {
+		spanErr = err
+	}
+	r.span.SetAttributes(semconv.DBResponseReturnedRows(int(r.count)))
+	endQuerySpan(r.span, spanErr)
+	return err
+}
+
+// tracedRow ends the query's span once the row is scanned; finding no row
+// is not recorded as an error
+type tracedRow struct {
+	driver.Row
+	span *querySpan
+}
+
+func (r *tracedRow) Scan(dest ...interface{}) error {
+	err := r.Row.Scan(dest...)
+	r.end(err)
+	return err
+}
+
+func (r *tracedRow) ScanStruct(dest interface{}) error {
+	err := r.Row.ScanStruct(dest)
+	r.end(err)
+	return err
+}
+
+func (r *tracedRow) end(err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	endQuerySpan(r.span, err)
+}
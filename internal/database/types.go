@@ -0,0 +1,256 @@
+package database
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Normalized base types reported for table fields
+const (
+	BaseTypeString   = "string"
+	BaseTypeInt      = "int"
+	BaseTypeFloat    = "float"
+	BaseTypeDecimal  = "decimal"
+	BaseTypeBool     = "bool"
+	BaseTypeDate     = "date"
+	BaseTypeDateTime = "datetime"
+	BaseTypeEnum     = "enum"
+	BaseTypeUUID     = "uuid"
+	BaseTypeMap      = "map"
+	BaseTypeOther    = "other"
+)
+
+// Render hints suggested for table fields, telling a client how to format
+// their values
+const (
+	RenderHintTimestamp  = "timestamp"
+	RenderHintDate       = "date"
+	RenderHintBytes      = "bytes"
+	RenderHintDurationNs = "duration-ns"
+	RenderHintDurationUs = "duration-us"
+	RenderHintDurationMs = "duration-ms"
+	RenderHintDurationS  = "duration-s"
+	RenderHintEnum       = "enum"
+	RenderHintJSON       = "json"
+	RenderHintID         = "id"
+)
+
+// durationUnitHints maps the unit word ending a duration column name, as in
+// latency_ms or elapsedSeconds, to its render hint
+var durationUnitHints = map[string]string{
+	"ns":           RenderHintDurationNs,
+	"nanos":        RenderHintDurationNs,
+	"nanoseconds":  RenderHintDurationNs,
+	"us":           RenderHintDurationUs,
+	"micros":       RenderHintDurationUs,
+	"microseconds": RenderHintDurationUs,
+	"ms":           RenderHintDurationMs,
+	"millis":       RenderHintDurationMs,
+	"milliseconds": RenderHintDurationMs,
+	"s":            RenderHintDurationS,
+	"sec":          RenderHintDurationS,
+	"secs":         RenderHintDurationS,
+	"seconds":      RenderHintDurationS,
+}
+
+// durationWords mark a numeric column as a duration
+var durationWords = []string{"duration", "latency", "elapsed", "took"}
+
+// describeColumnType derives the normalized base type of a raw ClickHouse
+// type, unwrapping LowCardinality(...), Nullable(...) and Array(...), along
+// with the enum values and whether the column holds an array
+func describeColumnType(columnType string) (baseType string, enumValues []string, array bool) {
+	inner := strings.TrimSpace(columnType)
+	for {
+		switch {
+		case unwrapType(&inner, "LowCardinality("), unwrapType(&inner, "Nullable("):
+		case unwrapType(&inner, "Array("):
+			array = true
+		default:
+			baseType = baseTypeOf(inner)
+			if baseType == BaseTypeEnum {
+				enumValues = parseEnumValues(inner)
+			}
+			return baseType, enumValues, array
+		}
+	}
+}
+
+// unwrapType strips wrapper( ... ) from columnType if it has that wrapper
+func unwrapType(columnType *string, wrapper string) bool {
+	if strings.HasPrefix(*columnType, wrapper) && strings.HasSuffix(*columnType, ")") {
+		*columnType = strings.TrimSpace((*columnType)[len(wrapper) : len(*columnType)-1])
+		return true
+	}
+	return false
+}
+
+// baseTypeOf maps an unwrapped ClickHouse type to its normalized base type
+func baseTypeOf(columnType string) string {
+	switch {
+	case columnType == "String", strings.HasPrefix(columnType, "FixedString"):
+		return BaseTypeString
+	case strings.HasPrefix(columnType, "Enum"):
+		return BaseTypeEnum
+	case strings.HasPrefix(columnType, "Int"), strings.HasPrefix(columnType, "UInt"):
+		return BaseTypeInt
+	case strings.HasPrefix(columnType, "Float"):
+		return BaseTypeFloat
+	case strings.HasPrefix(columnType, "Decimal"):
+		return BaseTypeDecimal
+	case columnType == "Bool":
+		return BaseTypeBool
+	case strings.HasPrefix(columnType, "DateTime"):
+		return BaseTypeDateTime
+	case strings.HasPrefix(columnType, "Date"):
+		return BaseTypeDate
+	case columnType == "UUID":
+		return BaseTypeUUID
+	case strings.HasPrefix(columnType, "Map("):
+		return BaseTypeMap
+	default:
+		return BaseTypeOther
+	}
+}
+
+// parseEnumValues extracts the value names of an Enum8('a' = 1, 'b' = 2)
+// or Enum16(...) type in declaration order
+func parseEnumValues(columnType string) []string {
+	start := strings.Index(columnType, "(")
+	if start < 0 {
+		return nil
+	}
+
+	values := []string{}
+	var current strings.Builder
+	inQuote, escaped := false, false
+	for _, r := range columnType[start+1:] {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case inQuote && r == '\\':
+			escaped = true
+		case r == '\'':
+			if inQuote {
+				values = append(values, current.String())
+				current.Reset()
+			}
+			inQuote = !inQuote
+		case inQuote:
+			current.WriteRune(r)
+		}
+	}
+	return values
+}
+
+// renderHintOf guesses how the values of a column are best displayed from its
+// name and type, e.g. bytes for a UInt64 named response_bytes, or returns ""
+// when nothing more specific than its base type applies. It is a heuristic:
+// a column is only recognized from the words of its name, not its contents.
+func renderHintOf(name, baseType string, array bool) string {
+	if array {
+		return ""
+	}
+	switch baseType {
+	case BaseTypeDateTime:
+		return RenderHintTimestamp
+	case BaseTypeDate:
+		return RenderHintDate
+	case BaseTypeEnum:
+		return RenderHintEnum
+	case BaseTypeMap:
+		return RenderHintJSON
+	}
+
+	words := nameWords(name)
+	switch baseType {
+	case BaseTypeString:
+		if slices.Contains(words, "json") {
+			return RenderHintJSON
+		}
+		if IsIDColumn(name) {
+			return RenderHintID
+		}
+	case BaseTypeUUID:
+		return RenderHintID
+	case BaseTypeInt, BaseTypeFloat, BaseTypeDecimal:
+		if len(words) == 0 {
+			return ""
+		}
+		if slices.Contains(words, "bytes") {
+			return RenderHintBytes
+		}
+		last := words[len(words)-1]
+		if hint, ok := durationUnitHints[last]; ok && len(words) > 1 {
+			return hint
+		}
+		if baseType == BaseTypeInt && slices.ContainsFunc(words, func(w string) bool { return slices.Contains(durationWords, w) }) {
+			// An integer duration without a unit, such as the Duration of
+			// OpenTelemetry spans, is in nanoseconds
+			return RenderHintDurationNs
+		}
+	}
+	return ""
+}
+
+// nameWords splits a column name into its lowercase words, as IsIDColumn does
+func nameWords(name string) []string {
+	runes := []rune(name)
+	var words []string
+	start := 0
+	for i := 1; i <= len(runes); i++ {
+		if i < len(runes) && !isWordBoundary(runes, i) {
+			continue
+		}
+		word := string(runes[start:i])
+		if isAlphanumeric(runes[start]) {
+			words = append(words, strings.ToLower(word))
+		}
+		start = i
+	}
+	return words
+}
+
+// IsIDColumn reports whether a column name has "id" as one of its words, as in
+// id, span_id, TraceId or parentSpanID, without matching names that merely
+// contain the letters, such as width, video or guid
+func IsIDColumn(name string) bool {
+	runes := []rune(name)
+	start := 0
+	for i := 1; i <= len(runes); i++ {
+		if i < len(runes) && !isWordBoundary(runes, i) {
+			continue
+		}
+		if strings.EqualFold(string(runes[start:i]), "id") {
+			return true
+		}
+		start = i
+	}
+	return false
+}
+
+// isWordBoundary reports whether a new word starts at runes[i], splitting on
+// non-alphanumeric separators and camelCase humps
+func isWordBoundary(runes []rune, i int) bool {
+	prev, cur := runes[i-1], runes[i]
+	switch {
+	case !isAlphanumeric(cur) || !isAlphanumeric(prev):
+		return true
+	case unicode.IsLower(prev) && unicode.IsUpper(cur):
+		return true
+	case unicode.IsUpper(prev) && unicode.IsUpper(cur) && i+1 < len(runes) && unicode.IsLower(runes[i+1]):
+		// the last capital of an acronym starts the next word, as in HTTPId
+		return true
+	case unicode.IsDigit(prev) != unicode.IsDigit(cur):
+		return true
+	default:
+		return false
+	}
+}
+
+// isAlphanumeric reports whether r is a letter or digit
+func isAlphanumeric(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
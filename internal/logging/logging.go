@@ -0,0 +1,152 @@
+// Package logging builds the structured, leveled logger used by the server.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/observio/backend/internal/config"
+)
+
+// Logger is the leveled logger threaded through handlers, services and the
+// database client; *slog.Logger implements it. args are alternating key/value
+// pairs, e.g. logger.Error("query failed", "table", table, "error", err).
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// Output is where a logger built by New writes. Its level and format can be
+// changed while the logger is in use; the file is only opened once.
+type Output struct {
+	out       io.Writer
+	closeFile func() error
+	level     slog.LevelVar
+	handler   atomic.Pointer[slog.Handler]
+}
+
+// New creates a logger writing cfg.Format ("text" or "json") records at
+// cfg.Level and above to stdout and, when cfg.File is set, appending them to
+// that file too. Close the returned Output to close the file.
+func New(cfg config.LoggingConfig) (*slog.Logger, *Output, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	o := &Output{out: os.Stdout, closeFile: func() error { return nil }}
+	if cfg.File != "" {
+		if err := os.MkdirAll(filepath.Dir(cfg.File), 0o755); err != nil {
+			return nil, nil, fmt.Errorf("error creating log directory: %w", err)
+		}
+		file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error opening log file: %w", err)
+		}
+		o.out = io.MultiWriter(os.Stdout, file)
+		o.closeFile = file.Close
+	}
+
+	o.level.Set(level)
+	if err := o.setFormat(cfg.Format); err != nil {
+		o.Close()
+		return nil, nil, err
+	}
+
+	return slog.New(&switchHandler{output: o}), o, nil
+}
+
+// Reconfigure switches the level and format of the loggers writing to o;
+// the file is left as it is
+func (o *Output) Reconfigure(cfg config.LoggingConfig) error {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+	if err := o.setFormat(cfg.Format); err != nil {
+		return err
+	}
+	o.level.Set(level)
+	return nil
+}
+
+// Close closes the log file, if any
+func (o *Output) Close() error {
+	return o.closeFile()
+}
+
+func (o *Output) setFormat(format string) error {
+	opts := &slog.HandlerOptions{Level: &o.level}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "json":
+		handler = slog.NewJSONHandler(o.out, opts)
+	case "text", "":
+		handler = slog.NewTextHandler(o.out, opts)
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	o.handler.Store(&handler)
+	return nil
+}
+
+// switchHandler sends records to the current handler of its Output. Attributes
+// and groups added with With and WithGroup are kept as a list and applied to
+// whichever handler is current when a record is written.
+type switchHandler struct {
+	output *Output
+	wrap   []func(slog.Handler) slog.Handler
+}
+
+func (h *switchHandler) current() slog.Handler {
+	handler := *h.output.handler.Load()
+	for _, wrap := range h.wrap {
+		handler = wrap(handler)
+	}
+	return handler
+}
+
+func (h *switchHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.output.level.Level()
+}
+
+func (h *switchHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.current().Handle(ctx, record)
+}
+
+func (h *switchHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+func (h *switchHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+func (h *switchHandler) with(wrap func(slog.Handler) slog.Handler) slog.Handler {
+	return &switchHandler{output: h.output, wrap: append(slices.Clip(h.wrap), wrap)}
+}
+
+// ParseLevel converts a configured level name (debug, info, warn or error) to
+// its slog level; an empty name means info
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
@@ -0,0 +1,164 @@
+// Package prometheus is a minimal client for the Prometheus HTTP query API.
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxResponseBytes caps how much of a Prometheus response is read
+const maxResponseBytes = 64 << 20
+
+// Client queries a single Prometheus server
+type Client struct {
+	baseURL  string
+	username string
+	password string
+	http     *http.Client
+}
+
+// NewClient creates a client for the Prometheus server at baseURL; username
+// and password are sent as basic auth when set
+func NewClient(baseURL, username, password string, timeout time.Duration) *Client {
+	return &Client{
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		username: username,
+		password: password,
+		http:     &http.Client{Timeout: timeout},
+	}
+}
+
+// Sample is a single point of a series
+type Sample struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// Series is one time series of a range query result
+type Series struct {
+	Metric  map[string]string
+	Samples []Sample
+}
+
+// APIError is an error reported by Prometheus itself, such as invalid PromQL
+type APIError struct {
+	StatusCode int
+	Type       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("prometheus %s: %s", e.Type, e.Message)
+}
+
+// BadQuery reports whether Prometheus rejected the query or its parameters
+func (e *APIError) BadQuery() bool {
+	return e.Type == "bad_data" || e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnprocessableEntity
+}
+
+// apiResponse is the envelope of every Prometheus API response
+type apiResponse struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data"`
+	ErrorType string          `json:"errorType"`
+	Error     string          `json:"error"`
+}
+
+// QueryRange runs a PromQL range query via /api/v1/query_range. step is passed
+// through unchanged and may be a duration ("15s") or a number of seconds.
+func (c *Client) QueryRange(ctx context.Context, query string, start, end time.Time, step string) ([]Series, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("start", formatTime(start))
+	params.Set("end", formatTime(end))
+	params.Set("step", step)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/v1/query_range", strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Prometheus URL: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Prometheus: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Prometheus response: %w", err)
+	}
+
+	var envelope apiResponse
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("unexpected Prometheus response (%s): %w", resp.Status, err)
+	}
+	if envelope.Status != "success" {
+		return nil, &APIError{StatusCode: resp.StatusCode, Type: envelope.ErrorType, Message: envelope.Error}
+	}
+
+	var data struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			Values [][2]interface{}  `json:"values"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(envelope.Data, &data); err != nil {
+		return nil, fmt.Errorf("failed to decode Prometheus result: %w", err)
+	}
+	if data.ResultType != "matrix" {
+		return nil, fmt.Errorf("unexpected Prometheus result type %q", data.ResultType)
+	}
+
+	series := make([]Series, 0, len(data.Result))
+	for _, result := range data.Result {
+		s := Series{Metric: result.Metric, Samples: make([]Sample, 0, len(result.Values))}
+		for _, pair := range result.Values {
+			sample, err := parseSample(pair)
+			if err != nil {
+				return nil, err
+			}
+			s.Samples = append(s.Samples, sample)
+		}
+		series = append(series, s)
+	}
+
+	return series, nil
+}
+
+// parseSample decodes a [unixSeconds, "value"] pair
+func parseSample(pair [2]interface{}) (Sample, error) {
+	ts, ok := pair[0].(float64)
+	if !ok {
+		return Sample{}, fmt.Errorf("invalid sample timestamp %v", pair[0])
+	}
+	raw, ok := pair[1].(string)
+	if !ok {
+		return Sample{}, fmt.Errorf("invalid sample value %v", pair[1])
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return Sample{}, fmt.Errorf("invalid sample value %q", raw)
+	}
+
+	sec := int64(ts)
+	nsec := int64((ts - float64(sec)) * 1e9)
+	return Sample{Timestamp: time.Unix(sec, nsec).UTC(), Value: value}, nil
+}
+
+// formatTime formats t as Unix seconds with millisecond precision
+func formatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', 3, 64)
+}
@@ -0,0 +1,93 @@
+package prometheus
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxPoints is the most points per series Prometheus returns for a range
+// query before rejecting it; see MaxRangePoints
+const MaxPoints = 11000
+
+// promDurationPattern matches a Prometheus duration such as "1d12h" or "500ms":
+// whole numbers, each with a unit, from the largest unit to the smallest
+var promDurationPattern = regexp.MustCompile(`^(?:(\d+)y)?(?:(\d+)w)?(?:(\d+)d)?(?:(\d+)h)?(?:(\d+)m)?(?:(\d+)s)?(?:(\d+)ms)?$`)
+
+// promDurationUnits are the units of the groups of promDurationPattern
+var promDurationUnits = []time.Duration{
+	365 * 24 * time.Hour,
+	7 * 24 * time.Hour,
+	24 * time.Hour,
+	time.Hour,
+	time.Minute,
+	time.Second,
+	time.Millisecond,
+}
+
+// ParseStep parses the step of a range query, given as a number of seconds
+// ("15", "0.5"), a Prometheus duration ("1m", "1d", "1w") or a Go duration
+// ("1m30s", "1.5h"). The step must be positive and a whole number of
+// milliseconds, the resolution of Prometheus.
+func ParseStep(step string) (time.Duration, error) {
+	step = strings.TrimSpace(step)
+	d, err := parseStepDuration(step)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("step %q must be positive", step)
+	}
+	if d%time.Millisecond != 0 {
+		return 0, fmt.Errorf("step %q must be a whole number of milliseconds", step)
+	}
+	return d, nil
+}
+
+// parseStepDuration converts step to a duration without checking its value
+func parseStepDuration(step string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(step, 64); err == nil {
+		if math.IsNaN(seconds) || math.IsInf(seconds, 0) || seconds > math.MaxInt64/float64(time.Second) {
+			return 0, fmt.Errorf("step %q is out of range", step)
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	if d, err := time.ParseDuration(step); err == nil {
+		return d, nil
+	}
+
+	match := promDurationPattern.FindStringSubmatch(step)
+	if step == "" || match == nil {
+		return 0, fmt.Errorf("step %q is not a number of seconds or a duration such as 30s, 5m or 1h", step)
+	}
+	var d time.Duration
+	for i, unit := range promDurationUnits {
+		if match[i+1] == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(match[i+1], 10, 64)
+		if err != nil || n > math.MaxInt64/int64(unit) || d > math.MaxInt64-time.Duration(n)*unit {
+			return 0, fmt.Errorf("step %q is out of range", step)
+		}
+		d += time.Duration(n) * unit
+	}
+	return d, nil
+}
+
+// FormatStep formats step as the number of seconds sent to Prometheus, which
+// accepts it from every version unlike durations such as "1.5h"
+func FormatStep(step time.Duration) string {
+	return strconv.FormatFloat(step.Seconds(), 'f', -1, 64)
+}
+
+// MaxRangePoints returns the number of points per series a range query from
+// start to end with the given step returns
+func MaxRangePoints(start, end time.Time, step time.Duration) int64 {
+	if end.Before(start) || step <= 0 {
+		return 0
+	}
+	return int64(end.Sub(start)/step) + 1
+}
@@ -0,0 +1,137 @@
+// Package ratelimit throttles API clients with a token bucket per client IP
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/observio/backend/internal/api/httputil"
+)
+
+const (
+	// sweepInterval is how often buckets that have refilled are dropped
+	sweepInterval = time.Minute
+	// maxBuckets bounds the number of clients tracked at once
+	maxBuckets = 100000
+)
+
+// bucket holds the tokens left for one client as of its last request
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter allows each client a burst of perMinute requests, refilled evenly
+// over a minute. Clients whose bucket has refilled are forgotten, so memory
+// only grows with the clients seen in roughly the last minute.
+type Limiter struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	perMinute int
+	rate      float64 // tokens per second
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// New returns a limiter allowing perMinute requests per client and minute;
+// a limit of 0 or less allows every request
+func New(perMinute int) *Limiter {
+	l := &Limiter{
+		now:       time.Now,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+	l.SetLimit(perMinute)
+	return l
+}
+
+// SetLimit changes the number of requests allowed per client and minute.
+// Clients start over with a full bucket of the new size.
+func (l *Limiter) SetLimit(perMinute int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if perMinute == l.perMinute {
+		return
+	}
+	l.perMinute = perMinute
+	l.rate = float64(perMinute) / 60
+	l.buckets = make(map[string]*bucket)
+}
+
+// Allow takes a token from the client's bucket. When none is left it returns
+// false along with how long until the next token is available.
+func (l *Limiter) Allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.perMinute <= 0 {
+		return true, 0
+	}
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= sweepInterval || len(l.buckets) >= maxBuckets {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: float64(l.perMinute), last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(float64(l.perMinute), b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops every bucket that would be full by now, since a new bucket
+// starts out full anyway. If that frees nothing while at the cap (a burst of
+// distinct clients), all buckets are dropped rather than growing further.
+func (l *Limiter) sweep(now time.Time) {
+	l.lastSweep = now
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= float64(l.perMinute) {
+			delete(l.buckets, client)
+		}
+	}
+	if len(l.buckets) >= maxBuckets {
+		l.buckets = make(map[string]*bucket)
+	}
+}
+
+// Middleware rejects requests from clients over their limit with 429 and a
+// Retry-After header. Clients are keyed by IP; run it after middleware.RealIP
+// so proxied requests are keyed by the original client.
+func Middleware(limiter *Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowed, wait := limiter.Allow(clientIP(r))
+			if !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				httputil.RespondError(w, http.StatusTooManyRequests, httputil.CodeRateLimited,
+					"Too many requests, please retry later")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP returns the IP part of the request's remote address
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
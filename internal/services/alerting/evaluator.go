@@ -0,0 +1,337 @@
+// Package alerting evaluates alert rules against ClickHouse and tracks the
+// resulting alerts.
+package alerting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/observio/backend/internal/config"
+	"github.com/observio/backend/internal/database"
+	"github.com/observio/backend/internal/logging"
+)
+
+// Alert statuses
+const (
+	StatusActive   = "active"
+	StatusResolved = "resolved"
+	StatusNoData   = "no_data"
+	StatusError    = "error"
+)
+
+// Alert is the current state of an alert rule, as of its last evaluation
+type Alert struct {
+	ID              string            `json:"id"`
+	RuleID          string            `json:"ruleId"`
+	Name            string            `json:"name"`
+	Description     string            `json:"description"`
+	Query           string            `json:"query"`
+	Threshold       float64           `json:"threshold"`
+	Operator        string            `json:"operator"` // >, <, ==, !=, >=, <=
+	Severity        string            `json:"severity"` // critical, warning, info
+	Status          string            `json:"status"`   // active, resolved, no_data, error
+	Value           *float64          `json:"value,omitempty"`
+	Error           string            `json:"error,omitempty"`
+	Labels          map[string]string `json:"labels"`
+	Annotations     map[string]string `json:"annotations"`
+	CreatedAt       time.Time         `json:"createdAt"`
+	UpdatedAt       time.Time         `json:"updatedAt"`
+	LastEvaluatedAt time.Time         `json:"lastEvaluatedAt"`
+	LastFiredAt     *time.Time        `json:"lastFiredAt,omitempty"`
+}
+
+// RuleSource lists the alert rules to evaluate
+type RuleSource interface {
+	ListAlertRules(ctx context.Context) ([]database.AlertRule, error)
+}
+
+// Querier runs a rule query; *database.ClickHouseClient implements it
+type Querier interface {
+	QueryRaw(ctx context.Context, query string, timeout time.Duration) ([]string, []string, []map[string]interface{}, error)
+}
+
+// errNoData is returned by a rule query that produced no rows
+var errNoData = errors.New("query returned no rows")
+
+// Evaluator periodically runs every enabled alert rule and keeps one Alert per
+// rule whose condition fired, returned no data or failed to evaluate
+type Evaluator struct {
+	rules        RuleSource
+	querier      Querier
+	logger       logging.Logger
+	interval     time.Duration
+	queryTimeout time.Duration
+
+	mu     sync.RWMutex
+	alerts map[string]*Alert
+}
+
+// NewEvaluator creates an evaluator from the alerting configuration
+func NewEvaluator(rules RuleSource, querier Querier, cfg config.AlertingConfig, logger logging.Logger) *Evaluator {
+	queryTimeout := time.Duration(cfg.QueryTimeoutSeconds) * time.Second
+	if queryTimeout <= 0 {
+		queryTimeout = 30 * time.Second
+	}
+
+	return &Evaluator{
+		rules:        rules,
+		querier:      querier,
+		logger:       logger,
+		interval:     time.Duration(cfg.EvaluationIntervalSeconds) * time.Second,
+		queryTimeout: queryTimeout,
+		alerts:       make(map[string]*Alert),
+	}
+}
+
+// Run evaluates all rules on every tick until ctx is cancelled
+func (e *Evaluator) Run(ctx context.Context) {
+	if e.interval <= 0 {
+		e.logger.Info("alert rule evaluation disabled")
+		return
+	}
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		e.EvaluateAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// EvaluateAll evaluates every enabled rule once. Alerts of rules that were
+// deleted or disabled are dropped.
+func (e *Evaluator) EvaluateAll(ctx context.Context) {
+	rules, err := e.rules.ListAlertRules(ctx)
+	if err != nil {
+		e.logger.Error("error listing alert rules for evaluation", "error", err)
+		return
+	}
+
+	live := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		live[rule.ID] = true
+		e.evaluate(ctx, rule)
+	}
+
+	e.mu.Lock()
+	for id := range e.alerts {
+		if !live[id] {
+			delete(e.alerts, id)
+		}
+	}
+	e.mu.Unlock()
+}
+
+// evaluate runs one rule and records the outcome
+func (e *Evaluator) evaluate(ctx context.Context, rule database.AlertRule) {
+	value, err := e.queryValue(ctx, rule.Query)
+	now := time.Now().UTC()
+
+	switch {
+	case errors.Is(err, errNoData):
+		switch rule.NoDataState {
+		case database.NoDataStateOK:
+			e.record(rule, now, StatusResolved, nil, "")
+		case database.NoDataStateAlerting:
+			e.record(rule, now, StatusActive, nil, "")
+		default:
+			e.record(rule, now, StatusNoData, nil, err.Error())
+		}
+	case err != nil:
+		if ctx.Err() != nil && errors.Is(ctx.Err(), context.Canceled) {
+			return
+		}
+		e.logger.Warn("error evaluating alert rule", "ruleId", rule.ID, "rule", rule.Name, "error", err)
+		e.record(rule, now, StatusError, nil, err.Error())
+	default:
+		firing, err := compare(value, rule.Operator, rule.Threshold)
+		if err != nil {
+			e.record(rule, now, StatusError, &value, err.Error())
+			return
+		}
+		status := StatusResolved
+		if firing {
+			status = StatusActive
+		}
+		e.record(rule, now, status, &value, "")
+	}
+}
+
+// record stores the outcome of an evaluation. A rule that is resolved and has
+// never had an alert does not create one.
+func (e *Evaluator) record(rule database.AlertRule, now time.Time, status string, value *float64, errMsg string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	alert, exists := e.alerts[rule.ID]
+	if !exists {
+		if status == StatusResolved {
+			return
+		}
+		alert = &Alert{ID: rule.ID, RuleID: rule.ID, CreatedAt: now}
+		e.alerts[rule.ID] = alert
+	}
+
+	if status == StatusActive && alert.Status != StatusActive {
+		firedAt := now
+		alert.LastFiredAt = &firedAt
+		e.logger.Info("alert rule is firing", "ruleId", rule.ID, "rule", rule.Name)
+	}
+	if status != alert.Status {
+		alert.UpdatedAt = now
+	}
+
+	alert.Name = rule.Name
+	alert.Description = rule.Description
+	alert.Query = rule.Query
+	alert.Threshold = rule.Threshold
+	alert.Operator = rule.Operator
+	alert.Severity = rule.Severity
+	alert.Labels = rule.Labels
+	alert.Annotations = rule.Annotations
+	alert.Status = status
+	alert.Value = value
+	alert.Error = errMsg
+	alert.LastEvaluatedAt = now
+}
+
+// queryValue runs a rule query and returns the first column of its first row
+// as a number
+func (e *Evaluator) queryValue(ctx context.Context, query string) (float64, error) {
+	if err := database.ValidateReadOnlyQuery(query); err != nil {
+		return 0, err
+	}
+
+	columns, _, rows, err := e.querier.QueryRaw(ctx, query, e.queryTimeout)
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 || len(columns) == 0 {
+		return 0, errNoData
+	}
+
+	return toFloat(rows[0][columns[0]])
+}
+
+// toFloat converts a scanned ClickHouse value to a float64
+func toFloat(value interface{}) (float64, error) {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return 0, fmt.Errorf("query returned NULL")
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return 1, nil
+		}
+		return 0, nil
+	case reflect.String:
+		f, err := strconv.ParseFloat(v.String(), 64)
+		if err != nil {
+			return 0, fmt.Errorf("query returned non-numeric value %q", v.String())
+		}
+		return f, nil
+	case reflect.Invalid:
+		return 0, fmt.Errorf("query returned NULL")
+	}
+
+	if s, ok := value.(fmt.Stringer); ok {
+		if f, err := strconv.ParseFloat(s.String(), 64); err == nil {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("query returned non-numeric value of type %T", value)
+}
+
+// compare applies a rule operator to value and threshold
+func compare(value float64, operator string, threshold float64) (bool, error) {
+	switch operator {
+	case ">":
+		return value > threshold, nil
+	case ">=":
+		return value >= threshold, nil
+	case "<":
+		return value < threshold, nil
+	case "<=":
+		return value <= threshold, nil
+	case "==":
+		return value == threshold, nil
+	case "!=":
+		return value != threshold, nil
+	default:
+		return false, fmt.Errorf("unknown operator %q", operator)
+	}
+}
+
+// Alerts returns the current alerts, optionally filtered by status and
+// severity, most recently updated first
+func (e *Evaluator) Alerts(status, severity string) []Alert {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	alerts := []Alert{}
+	for _, alert := range e.alerts {
+		if status != "" && alert.Status != status {
+			continue
+		}
+		if severity != "" && alert.Severity != severity {
+			continue
+		}
+		alerts = append(alerts, *alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].UpdatedAt.After(alerts[j].UpdatedAt)
+	})
+	return alerts
+}
+
+// Alert returns the alert with the given ID
+func (e *Evaluator) Alert(id string) (Alert, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	alert, ok := e.alerts[id]
+	if !ok {
+		return Alert{}, false
+	}
+	return *alert, true
+}
+
+// Resolve marks an alert as resolved until its rule fires again
+func (e *Evaluator) Resolve(id string) (Alert, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	alert, ok := e.alerts[id]
+	if !ok {
+		return Alert{}, false
+	}
+	alert.Status = StatusResolved
+	alert.UpdatedAt = time.Now().UTC()
+	return *alert, true
+}
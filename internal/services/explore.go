@@ -2,29 +2,80 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/observio/backend/internal/database"
+	"github.com/observio/backend/internal/logging"
 )
 
+// ErrInvalidRequest is wrapped by errors caused by a malformed explore request
+// so callers can tell client mistakes apart from query execution failures
+var ErrInvalidRequest = errors.New("invalid explore request")
+
+// schemaLookupError is a failure to read the schema while validating a
+// request, such as ClickHouse being down; it is the server's fault, not the
+// client's, and is never wrapped with ErrInvalidRequest
+type schemaLookupError struct {
+	err error
+}
+
+func (e *schemaLookupError) Error() string { return e.err.Error() }
+func (e *schemaLookupError) Unwrap() error { return e.err }
+
+// invalidRequest wraps an error of ValidateExploreRequest or an unknown
+// identifier with ErrInvalidRequest, keeping its chain; schema lookup
+// failures are returned unwrapped so they are answered as server errors
+func invalidRequest(err error) error {
+	var lookupErr *schemaLookupError
+	if errors.As(err, &lookupErr) {
+		return lookupErr.err
+	}
+	return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+}
+
+// aliasPattern restricts aggregate and field aliases to plain identifiers
+var aliasPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// What ValidateExploreRequest accepts; also reported by the Get* methods so
+// clients can build queries from the same lists
+var (
+	availableAggregates       = []string{"count", "sum", "avg", "min", "max"}
+	availableFilterOperations = []string{"eq", "ne", "gt", "lt", "gte", "lte", "like", "in", "notin", "between", "isnull", "isnotnull"}
+	availableOrderDirections  = []string{"asc", "desc"}
+)
+
+// maxFilterValues caps the values of an in or notin filter
+const maxFilterValues = 1000
+
+// maxFilterDepth caps the nesting of and/or groups in a filter tree
+const maxFilterDepth = 8
+
 // ExploreService provides business logic for explore functionality
 type ExploreService struct {
-	db     *database.ClickHouseClient
-	logger *log.Logger
+	db       *database.ClickHouseClient
+	logger   logging.Logger
+	metadata *MetadataCache
 }
 
-// NewExploreService creates a new explore service
-func NewExploreService(db *database.ClickHouseClient, logger *log.Logger) *ExploreService {
+// NewExploreService creates a new explore service; database, table and field
+// lists are cached for metadataTTL
+func NewExploreService(db *database.ClickHouseClient, metadataTTL time.Duration, logger logging.Logger) *ExploreService {
 	return &ExploreService{
-		db:     db,
-		logger: logger,
+		db:       db,
+		logger:   logger,
+		metadata: NewMetadataCache(db, metadataTTL),
 	}
 }
 
 // GetDatabases retrieves all available databases
 func (s *ExploreService) GetDatabases(ctx context.Context) ([]string, error) {
-	return s.db.GetDatabases(ctx)
+	return s.metadata.Databases(ctx)
 }
 
 // GetTables retrieves all tables for the specified database
@@ -32,19 +83,25 @@ func (s *ExploreService) GetTables(ctx context.Context, database string) ([]stri
 	if database == "" {
 		return nil, fmt.Errorf("database name is required")
 	}
-	return s.db.GetTables(ctx, database)
+	return s.metadata.Tables(ctx, database)
 }
 
-// GetTableFields retrieves all fields for the specified table (excluding id fields)
+// GetTableFields retrieves all fields for the specified table
 func (s *ExploreService) GetTableFields(ctx context.Context, database, table string) ([]database.TableField, error) {
 	if database == "" || table == "" {
 		return nil, fmt.Errorf("database and table names are required")
 	}
-	return s.db.GetTableFields(ctx, database, table)
+	return s.metadata.Fields(ctx, database, table)
 }
 
-// ValidateExploreRequest validates the explore request parameters
-func (s *ExploreService) ValidateExploreRequest(req database.ExploreRequest) error {
+// RefreshMetadata forgets the cached database, table and field lists
+func (s *ExploreService) RefreshMetadata() {
+	s.metadata.Invalidate()
+}
+
+// ValidateExploreRequest validates the explore request parameters, including
+// that the filter operation is compatible with the filtered column's type
+func (s *ExploreService) ValidateExploreRequest(ctx context.Context, req database.ExploreRequest) error {
 	if req.Database == "" {
 		return fmt.Errorf("database is required")
 	}
@@ -54,14 +111,7 @@ func (s *ExploreService) ValidateExploreRequest(req database.ExploreRequest) err
 	
 	// Validate aggregate function
 	if req.Aggregate != "" {
-		validAggregates := map[string]bool{
-			"count": true,
-			"sum":   true,
-			"avg":   true,
-			"min":   true,
-			"max":   true,
-		}
-		if !validAggregates[req.Aggregate] {
+		if !slices.Contains(availableAggregates, req.Aggregate) {
 			return fmt.Errorf("invalid aggregate function: %s", req.Aggregate)
 		}
 		
@@ -71,77 +121,466 @@ func (s *ExploreService) ValidateExploreRequest(req database.ExploreRequest) err
 		}
 	}
 	
+	if len(req.Aggregates) > 0 {
+		if err := validateAggregates(req); err != nil {
+			return err
+		}
+	}
+	
+	if err := req.ValidateJoins(); err != nil {
+		return err
+	}
+
+	if err := req.ValidateJSONFields(); err != nil {
+		return err
+	}
+
+	if err := req.ValidateMapFields(); err != nil {
+		return err
+	}
+
+	if len(req.Aliases) > 0 {
+		if err := validateAliases(req); err != nil {
+			return err
+		}
+	}
+	
 	// Validate filter operation
 	if req.FilterOp != "" {
-		validOps := map[string]bool{
-			"eq":   true,
-			"ne":   true,
-			"gt":   true,
-			"lt":   true,
-			"gte":  true,
-			"lte":  true,
-			"like": true,
-		}
-		if !validOps[req.FilterOp] {
+		if !slices.Contains(availableFilterOperations, req.FilterOp) {
 			return fmt.Errorf("invalid filter operation: %s", req.FilterOp)
 		}
 		
-		// Ensure filter field and value are provided
-		if req.FilterBy == "" || req.FilterVal == "" {
-			return fmt.Errorf("filter field and value are required when filter operation is specified")
+		if req.FilterBy == "" {
+			return fmt.Errorf("filter field is required when filter operation is specified")
+		}
+		cond := database.FilterCondition{Field: req.FilterBy, Op: req.FilterOp, Value: req.FilterVal, Values: req.FilterVals}
+		if err := validateFilterValues(cond, "filterVal", "filterVals"); err != nil {
+			return err
+		}
+	}
+	
+	if req.Filters != nil {
+		if err := validateFilterNode(*req.Filters, "filters", 1); err != nil {
+			return err
 		}
 	}
 	
 	// Validate order direction
-	if req.OrderDir != "" && req.OrderDir != "asc" && req.OrderDir != "desc" {
+	if req.OrderDir != "" && !slices.Contains(availableOrderDirections, req.OrderDir) {
 		return fmt.Errorf("invalid order direction: %s (must be 'asc' or 'desc')", req.OrderDir)
 	}
+	for i, spec := range req.OrderBy {
+		if spec.Field == "" {
+			return fmt.Errorf("orderBy[%d]: field is required", i)
+		}
+		if spec.Dir != "" && !slices.Contains(availableOrderDirections, spec.Dir) {
+			return fmt.Errorf("orderBy[%d]: invalid order direction: %s (must be 'asc' or 'desc')", i, spec.Dir)
+		}
+	}
 	
-	// Validate limit
+	// The handlers apply the configured default and maximum limits
 	if req.Limit < 0 {
 		return fmt.Errorf("limit cannot be negative")
 	}
-	if req.Limit > 10000 {
-		return fmt.Errorf("limit cannot exceed 10000 rows")
+	
+	if len(req.JSONFields) > 0 {
+		if err := s.validateJSONColumns(ctx, req); err != nil {
+			return err
+		}
+	}
+	
+	if len(req.MapFields) > 0 {
+		if err := s.validateMapColumns(ctx, req); err != nil {
+			return err
+		}
+	}
+	
+	for _, cond := range req.FilterConditions() {
+		if err := s.validateFilterType(ctx, req, cond); err != nil {
+			return err
+		}
 	}
 	
 	return nil
 }
 
-// ExecuteExploreQuery executes a validated explore query
-func (s *ExploreService) ExecuteExploreQuery(ctx context.Context, req database.ExploreRequest) (*database.ExploreResponse, error) {
-	// Validate the request
-	if err := s.ValidateExploreRequest(req); err != nil {
-		return nil, fmt.Errorf("validation error: %w", err)
+// validateFilterNode checks a filter tree: every group holds only and or only
+// or with at least one node, groups nest at most maxFilterDepth deep, and every
+// condition has a field, a known operation and the values it takes. path names
+// the node in errors, e.g. filters.or[1].and[0].
+func validateFilterNode(node database.FilterNode, path string, depth int) error {
+	if node.IsGroup() {
+		if node.Field != "" || node.Op != "" || node.Value != "" || len(node.Values) > 0 {
+			return fmt.Errorf("%s: a group cannot also be a condition", path)
+		}
+		if node.And != nil && node.Or != nil {
+			return fmt.Errorf("%s: a group takes either and or or, not both", path)
+		}
+		if depth > maxFilterDepth {
+			return fmt.Errorf("%s: groups cannot nest more than %d deep", path, maxFilterDepth)
+		}
+		children, operator := node.Children()
+		key := strings.ToLower(operator)
+		if len(children) == 0 {
+			return fmt.Errorf("%s: %s group must hold at least one condition or group", path, key)
+		}
+		for i, child := range children {
+			if err := validateFilterNode(child, fmt.Sprintf("%s.%s[%d]", path, key, i), depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if node.Field == "" {
+		return fmt.Errorf("%s: field is required", path)
+	}
+	if !slices.Contains(availableFilterOperations, node.Op) {
+		return fmt.Errorf("%s: invalid filter operation: %s", path, node.Op)
+	}
+	if err := validateFilterValues(node.FilterCondition, "value", "values"); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// validateJSONColumns checks that every JSON field extracts from a string column
+func (s *ExploreService) validateJSONColumns(ctx context.Context, req database.ExploreRequest) error {
+	for i, field := range req.JSONFields {
+		columnType, err := s.columnType(ctx, req, field.Column)
+		if err != nil {
+			return err
+		}
+		// An unknown column is reported when the query is checked against the schema
+		if columnType != "" && !isStringType(unwrapColumnType(columnType)) {
+			return fmt.Errorf("jsonFields[%d]: column %s is %s, JSON can only be extracted from a string column", i, field.Column, columnType)
+		}
+	}
+	return nil
+}
+
+// validateMapColumns checks that every map field reads a Map column with string keys
+func (s *ExploreService) validateMapColumns(ctx context.Context, req database.ExploreRequest) error {
+	for i, field := range req.MapFields {
+		columnType, err := s.columnType(ctx, req, field.Column)
+		if err != nil {
+			return err
+		}
+		// An unknown column is reported when the query is checked against the schema
+		if columnType == "" {
+			continue
+		}
+		keyType, _, ok := splitMapType(columnType)
+		if !ok {
+			return fmt.Errorf("mapFields[%d]: column %s is %s, not a Map", i, field.Column, columnType)
+		}
+		if !isStringType(unwrapColumnType(keyType)) {
+			return fmt.Errorf("mapFields[%d]: column %s has %s keys, only string keys are supported", i, field.Column, keyType)
+		}
+	}
+	return nil
+}
+
+// columnType looks up the ClickHouse type of a column reference of the
+// request; it is empty when the column is not in the cached field list
+func (s *ExploreService) columnType(ctx context.Context, req database.ExploreRequest, ref string) (string, error) {
+	databaseName, table, column := req.ResolveColumn(ref)
+	fields, err := s.metadata.Fields(ctx, databaseName, table)
+	if err != nil {
+		return "", &schemaLookupError{err: fmt.Errorf("could not look up fields for %s.%s: %w", databaseName, table, err)}
+	}
+	for _, field := range fields {
+		if field.Name == column {
+			return field.Type, nil
+		}
+	}
+	return "", nil
+}
+
+// validateAggregates checks a multi-aggregate request: known functions, a field
+// for everything but count, unique result names, and every plain field grouped
+func validateAggregates(req database.ExploreRequest) error {
+	if req.Aggregate != "" {
+		return fmt.Errorf("use either aggregate or aggregates, not both")
+	}
+
+	seen := make(map[string]bool)
+	for i, spec := range req.Aggregates {
+		switch spec.Func {
+		case "count":
+		case "sum", "avg", "min", "max":
+			if spec.Field == "" {
+				return fmt.Errorf("aggregates[%d]: field is required for aggregate function: %s", i, spec.Func)
+			}
+		default:
+			return fmt.Errorf("aggregates[%d]: invalid aggregate function: %s", i, spec.Func)
+		}
+
+		if spec.Alias != "" && !aliasPattern.MatchString(spec.Alias) {
+			return fmt.Errorf("aggregates[%d]: invalid alias %q (letters, digits and underscores only)", i, spec.Alias)
+		}
+
+		name := spec.ResultName()
+		if seen[name] {
+			return fmt.Errorf("aggregates[%d]: duplicate result column %q, set a distinct alias", i, name)
+		}
+		seen[name] = true
+	}
+
+	grouped := make(map[string]bool, len(req.GroupBy))
+	for _, field := range req.GroupBy {
+		grouped[field] = true
+	}
+	for _, field := range req.Fields {
+		if !grouped[field] {
+			return fmt.Errorf("field %s must appear in groupBy when aggregates are used", field)
+		}
+	}
+
+	return nil
+}
+
+// validateAliases checks that every alias renames a selected field to a plain
+// identifier that no other result column is named
+func validateAliases(req database.ExploreRequest) error {
+	selected := req.SelectedFields()
+
+	// Names of the result columns that are not aliased
+	taken := make(map[string]bool)
+	for _, field := range selected {
+		if req.Aliases[field] == "" {
+			taken[field] = true
+		}
+	}
+	for _, spec := range req.Aggregates {
+		taken[spec.ResultName()] = true
+	}
+	switch {
+	case req.Aggregate == "count":
+		taken["count"] = true
+	case req.Aggregate != "" && len(req.Fields) > 0:
+		taken[req.Aggregate+"_"+req.Fields[0]] = true
+	}
+
+	seen := make(map[string]bool)
+	for field, alias := range req.Aliases {
+		if !slices.Contains(selected, field) {
+			return fmt.Errorf("aliases: field %s is not selected", field)
+		}
+		if !aliasPattern.MatchString(alias) {
+			return fmt.Errorf("aliases: invalid alias %q for field %s (letters, digits and underscores only)", alias, field)
+		}
+		if seen[alias] || taken[alias] {
+			return fmt.Errorf("aliases: alias %q of field %s repeats the name of another result column", alias, field)
+		}
+		seen[alias] = true
+	}
+	return nil
+}
+
+// validateFilterValues checks that each filter operation comes with the values
+// it takes: a list in values for in and notin, exactly two in values for
+// between, none for isnull and isnotnull, and a single value otherwise.
+// valueKey and valuesKey name the value and values fields in errors.
+func validateFilterValues(cond database.FilterCondition, valueKey, valuesKey string) error {
+	switch cond.Op {
+	case "isnull", "isnotnull":
+		if cond.Value != "" || len(cond.Values) > 0 {
+			return fmt.Errorf("filter operation %s takes no value", cond.Op)
+		}
+	case "between":
+		if cond.Value != "" {
+			return fmt.Errorf("filter operation between takes its low and high values in %s, not %s", valuesKey, valueKey)
+		}
+		if len(cond.Values) != 2 {
+			return fmt.Errorf("filter operation between requires exactly two values in %s, got %d", valuesKey, len(cond.Values))
+		}
+	case "in", "notin":
+		if cond.Value != "" {
+			return fmt.Errorf("filter operation %s takes a list of values in %s, not %s", cond.Op, valuesKey, valueKey)
+		}
+		if len(cond.Values) == 0 {
+			return fmt.Errorf("%s must list at least one value for filter operation %s", valuesKey, cond.Op)
+		}
+		if len(cond.Values) > maxFilterValues {
+			return fmt.Errorf("%s cannot list more than %d values", valuesKey, maxFilterValues)
+		}
+	default:
+		if cond.Value == "" {
+			return fmt.Errorf("filter operation %s requires a value in %s", cond.Op, valueKey)
+		}
+		if len(cond.Values) > 0 {
+			return fmt.Errorf("%s is only used by the in, notin and between filter operations, use %s", valuesKey, valueKey)
+		}
+	}
+	return nil
+}
+
+// validateFilterType checks a filter condition's operation and value against the column type
+func (s *ExploreService) validateFilterType(ctx context.Context, req database.ExploreRequest, cond database.FilterCondition) error {
+	var columnType string
+	if field, ok := req.JSONFieldByName(cond.Field); ok {
+		columnType = field.ValueType()
+	} else if field, ok := req.MapFieldByName(cond.Field); ok {
+		mapType, err := s.columnType(ctx, req, field.Column)
+		if err != nil {
+			return err
+		}
+		_, columnType, _ = splitMapType(mapType)
+	} else {
+		var err error
+		if columnType, err = s.columnType(ctx, req, cond.Field); err != nil {
+			return err
+		}
+	}
+	if columnType == "" {
+		// The column may have been added since the fields were cached; let ClickHouse decide
+		return nil
+	}
+
+	baseType := unwrapColumnType(columnType)
+	numeric := isNumericType(baseType)
+
+	switch cond.Op {
+	case "isnull", "isnotnull":
+		return nil
+	case "gt", "lt", "gte", "lte", "between":
+		if !numeric && !isDateType(baseType) {
+			return fmt.Errorf("filter operation %s requires a numeric or date column, but %s is %s", cond.Op, cond.Field, columnType)
+		}
+	case "like":
+		if !isStringType(baseType) {
+			return fmt.Errorf("filter operation like requires a string column, but %s is %s", cond.Field, columnType)
+		}
+	}
+
+	if numeric {
+		values := cond.Values
+		if len(values) == 0 {
+			values = []string{cond.Value}
+		}
+		for _, value := range values {
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return fmt.Errorf("filter value %q is not a valid number for %s column %s", value, columnType, cond.Field)
+			}
+		}
+	}
+
+	return nil
+}
+
+// unwrapColumnType strips Nullable(...) and LowCardinality(...) wrappers from a ClickHouse type
+func unwrapColumnType(columnType string) string {
+	for {
+		switch {
+		case strings.HasPrefix(columnType, "Nullable(") && strings.HasSuffix(columnType, ")"):
+			columnType = columnType[len("Nullable(") : len(columnType)-1]
+		case strings.HasPrefix(columnType, "LowCardinality(") && strings.HasSuffix(columnType, ")"):
+			columnType = columnType[len("LowCardinality(") : len(columnType)-1]
+		default:
+			return columnType
+		}
+	}
+}
+
+// splitMapType returns the key and value types of a Map(K, V) type
+func splitMapType(columnType string) (keyType, valueType string, ok bool) {
+	if !strings.HasPrefix(columnType, "Map(") || !strings.HasSuffix(columnType, ")") {
+		return "", "", false
+	}
+	inner := columnType[len("Map(") : len(columnType)-1]
+	// The key type may itself take arguments, e.g. LowCardinality(String)
+	depth := 0
+	for i, r := range inner {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				return strings.TrimSpace(inner[:i]), strings.TrimSpace(inner[i+1:]), true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// isNumericType reports whether an unwrapped ClickHouse type is numeric
+func isNumericType(baseType string) bool {
+	return strings.HasPrefix(baseType, "Int") ||
+		strings.HasPrefix(baseType, "UInt") ||
+		strings.HasPrefix(baseType, "Float") ||
+		strings.HasPrefix(baseType, "Decimal")
+}
+
+// isDateType reports whether an unwrapped ClickHouse type is a date or timestamp
+func isDateType(baseType string) bool {
+	return strings.HasPrefix(baseType, "Date")
+}
+
+// isStringType reports whether an unwrapped ClickHouse type holds text
+func isStringType(baseType string) bool {
+	return baseType == "String" || strings.HasPrefix(baseType, "FixedString") || strings.HasPrefix(baseType, "Enum")
+}
+
+// StreamExploreQuery validates an explore query and streams its rows to onRow
+func (s *ExploreService) StreamExploreQuery(ctx context.Context, req database.ExploreRequest, onColumns database.ColumnsFunc, onRow database.RowFunc) error {
+	if err := s.ValidateExploreRequest(ctx, req); err != nil {
+		return invalidRequest(err)
 	}
 	
-	s.logger.Printf("Executing explore query for %s.%s with aggregate: %s", req.Database, req.Table, req.Aggregate)
+	s.logger.Debug("streaming explore query", "database", req.Database, "table", req.Table, "aggregate", req.Aggregate)
 	
-	// Execute the query
-	result, err := s.db.ExecuteExploreQuery(ctx, req)
+	err := s.db.StreamExploreQuery(ctx, req, onColumns, onRow)
+	if errors.Is(err, database.ErrInvalidIdentifier) {
+		return invalidRequest(err)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("query execution error: %w", err)
+		return fmt.Errorf("query execution error: %w", err)
 	}
 	
-	s.logger.Printf("Query executed successfully, returned %d rows", result.Total)
+	return nil
+}
+
+// ExplainExploreQuery validates an explore query and returns its SQL and scan
+// estimate without running it
+func (s *ExploreService) ExplainExploreQuery(ctx context.Context, req database.ExploreRequest) (*database.ExploreExplanation, error) {
+	if err := s.ValidateExploreRequest(ctx, req); err != nil {
+		return nil, invalidRequest(err)
+	}
 	
-	return result, nil
+	explanation, err := s.db.ExplainExploreQuery(ctx, req)
+	if errors.Is(err, database.ErrInvalidIdentifier) {
+		return nil, invalidRequest(err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query estimation error: %w", err)
+	}
+	
+	return explanation, nil
 }
 
 // GetAvailableAggregates returns the list of available aggregate functions
 func (s *ExploreService) GetAvailableAggregates() []string {
-	return []string{"count", "sum", "avg", "min", "max"}
+	return slices.Clone(availableAggregates)
 }
 
 // GetAvailableFilterOperations returns the list of available filter operations
 func (s *ExploreService) GetAvailableFilterOperations() []string {
-	return []string{"eq", "ne", "gt", "lt", "gte", "lte", "like"}
+	return slices.Clone(availableFilterOperations)
+}
+
+// GetAvailableOrderDirections returns the list of accepted order directions
+func (s *ExploreService) GetAvailableOrderDirections() []string {
+	return slices.Clone(availableOrderDirections)
 }
 
 // BuildExploreRequest helps build an explore request with sensible defaults
-func (s *ExploreService) BuildExploreRequest(database, table string) database.ExploreRequest {
+func (s *ExploreService) BuildExploreRequest(dbName, table string) database.ExploreRequest {
 	return database.ExploreRequest{
-		Database: database,
+		Database: dbName,
 		Table:    table,
 		Fields:   []string{}, // Will select all fields
 		Limit:    100,        // Default limit
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/observio/backend/internal/database"
+)
+
+// newUnreachableExploreService returns a service whose ClickHouse server
+// refuses connections, so every schema lookup fails
+func newUnreachableExploreService(t *testing.T) *ExploreService {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	db, err := database.NewClickHouseClient("127.0.0.1", 1, "default", "", "default",
+		database.ClientOptions{DialTimeout: time.Second}, logger)
+	if err != nil {
+		t.Fatalf("NewClickHouseClient: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewExploreService(db, 0, logger)
+}
+
+func TestStreamExploreQueryRejectsInvalidRequest(t *testing.T) {
+	s := newUnreachableExploreService(t)
+	req := database.ExploreRequest{Database: "otel", Table: "logs", Fields: []string{"Body"}, FilterBy: "Body", FilterOp: "matches", FilterVal: "x"}
+
+	err := s.StreamExploreQuery(context.Background(), req, nil, nil)
+	if !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("err = %v, want ErrInvalidRequest", err)
+	}
+	if !strings.Contains(err.Error(), "invalid filter operation: matches") {
+		t.Errorf("err = %q, want it to name the filter operation", err)
+	}
+}
+
+func TestStreamExploreQueryPassesOnSchemaLookupFailure(t *testing.T) {
+	s := newUnreachableExploreService(t)
+	req := database.ExploreRequest{Database: "otel", Table: "logs", Fields: []string{"Body"}, FilterBy: "Body", FilterOp: "eq", FilterVal: "x"}
+
+	err := s.StreamExploreQuery(context.Background(), req, nil, nil)
+	if err == nil {
+		t.Fatal("expected an error from an unreachable server")
+	}
+	if errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("err = %v, a schema lookup failure must not be an invalid request", err)
+	}
+	if !database.IsConnectionError(err) {
+		t.Errorf("err = %v, want the connection error to stay in the chain", err)
+	}
+}
+
+func TestInvalidRequestKeepsChain(t *testing.T) {
+	err := invalidRequest(fmt.Errorf("%w: unknown field %q", database.ErrInvalidIdentifier, "x"))
+	if !errors.Is(err, ErrInvalidRequest) || !errors.Is(err, database.ErrInvalidIdentifier) {
+		t.Errorf("err = %v, want both ErrInvalidRequest and ErrInvalidIdentifier", err)
+	}
+
+	lookup := &schemaLookupError{err: context.DeadlineExceeded}
+	if err := invalidRequest(fmt.Errorf("validating: %w", lookup)); errors.Is(err, ErrInvalidRequest) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the lookup failure unwrapped", err)
+	}
+}
+
+func TestValidateAliasesRejectsMaliciousAliases(t *testing.T) {
+	aliases := []string{"x` FROM system.users --", "x`; DROP TABLE logs", "a b", "a.b", "1a", "x\\", ""}
+	for _, alias := range aliases {
+		req := database.ExploreRequest{Database: "otel", Table: "logs", Fields: []string{"Body"}, Aliases: map[string]string{"Body": alias}}
+		if err := validateAliases(req); err == nil {
+			t.Errorf("validateAliases accepted alias %q", alias)
+		}
+		if alias == "" {
+			// An empty aggregate alias falls back to the default name
+			continue
+		}
+		req = database.ExploreRequest{Database: "otel", Table: "logs", Aggregates: []database.AggregateSpec{{Func: "count", Alias: alias}}}
+		if err := validateAggregates(req); err == nil {
+			t.Errorf("validateAggregates accepted alias %q", alias)
+		}
+	}
+
+	req := database.ExploreRequest{Database: "otel", Table: "logs", Fields: []string{"Body"}, Aliases: map[string]string{"Body": "message"}}
+	if err := validateAliases(req); err != nil {
+		t.Errorf("validateAliases rejected a plain alias: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/observio/backend/internal/config"
+	"github.com/observio/backend/internal/database"
+	"github.com/observio/backend/internal/logging"
+)
+
+// HistoryRetention periodically prunes the query history table
+type HistoryRetention struct {
+	db       *database.ClickHouseClient
+	logger   logging.Logger
+	maxAge   time.Duration
+	maxRows  int
+	interval time.Duration
+}
+
+// NewHistoryRetention creates a retention job from the history configuration
+func NewHistoryRetention(db *database.ClickHouseClient, cfg config.HistoryConfig, logger logging.Logger) *HistoryRetention {
+	interval := time.Duration(cfg.CleanupIntervalMinutes) * time.Minute
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	return &HistoryRetention{
+		db:       db,
+		logger:   logger,
+		maxAge:   time.Duration(cfg.RetentionDays) * 24 * time.Hour,
+		maxRows:  cfg.MaxRows,
+		interval: interval,
+	}
+}
+
+// Run enforces the retention policy on every tick until ctx is cancelled
+func (h *HistoryRetention) Run(ctx context.Context) {
+	if h.maxAge <= 0 && h.maxRows <= 0 {
+		h.logger.Info("query history retention disabled")
+		return
+	}
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		h.prune(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// prune applies the retention policy once
+func (h *HistoryRetention) prune(ctx context.Context) {
+	if err := h.db.PruneQueryHistory(ctx, h.maxAge, h.maxRows); err != nil {
+		h.logger.Error("error pruning query history", "error", err)
+	}
+}
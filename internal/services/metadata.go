@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/observio/backend/internal/database"
+)
+
+// MetadataCache keeps database, table and field lists read from ClickHouse
+// for a while so that autocomplete and the explore UI do not query the system
+// tables on every request. It is safe for concurrent use; a TTL of zero or
+// less disables caching.
+//
+// Only the tables of existing databases and the fields of existing tables
+// are cached, so the cache is bounded by the schema however many unknown
+// names requests ask for.
+type MetadataCache struct {
+	db  metadataSource
+	ttl time.Duration
+	now func() time.Time
+
+	mu sync.Mutex
+	// generation is bumped by Invalidate so lookups started before it do not
+	// store what they read
+	generation uint64
+	databases  *metadataEntry[[]string]
+	tables     map[string]metadataEntry[[]string]              // keyed by database
+	fields     map[string]metadataEntry[[]database.TableField] // keyed by database.table
+}
+
+// metadataSource reads the lists the cache holds; *database.ClickHouseClient
+// implements it
+type metadataSource interface {
+	GetDatabases(ctx context.Context) ([]string, error)
+	GetTables(ctx context.Context, database string) ([]string, error)
+	GetTableFields(ctx context.Context, database, table string) ([]database.TableField, error)
+}
+
+// metadataEntry is a cached list and when it goes stale
+type metadataEntry[T any] struct {
+	value   T
+	expires time.Time
+}
+
+// NewMetadataCache creates an empty cache in front of db
+func NewMetadataCache(db *database.ClickHouseClient, ttl time.Duration) *MetadataCache {
+	return &MetadataCache{
+		db:     db,
+		ttl:    ttl,
+		now:    time.Now,
+		tables: make(map[string]metadataEntry[[]string]),
+		fields: make(map[string]metadataEntry[[]database.TableField]),
+	}
+}
+
+// Databases returns the database names, from the cache while they are fresh
+func (c *MetadataCache) Databases(ctx context.Context) ([]string, error) {
+	c.mu.Lock()
+	entry, generation := c.databases, c.generation
+	c.mu.Unlock()
+	if entry != nil && c.now().Before(entry.expires) {
+		return slices.Clone(entry.value), nil
+	}
+
+	databases, err := c.db.GetDatabases(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.storable(generation) {
+		c.databases = &metadataEntry[[]string]{value: databases, expires: c.now().Add(c.ttl)}
+	}
+	c.mu.Unlock()
+	return slices.Clone(databases), nil
+}
+
+// Tables returns the table names of a database, from the cache while they are fresh
+func (c *MetadataCache) Tables(ctx context.Context, databaseName string) ([]string, error) {
+	c.mu.Lock()
+	entry, ok := c.tables[databaseName]
+	generation := c.generation
+	c.mu.Unlock()
+	if ok && c.now().Before(entry.expires) {
+		return slices.Clone(entry.value), nil
+	}
+
+	tables, err := c.db.GetTables(ctx, databaseName)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	// A database without tables is most likely one that does not exist
+	if c.storable(generation) && len(tables) > 0 {
+		c.tables[databaseName] = metadataEntry[[]string]{value: tables, expires: c.now().Add(c.ttl)}
+	}
+	c.mu.Unlock()
+	return slices.Clone(tables), nil
+}
+
+// Fields returns the fields of a table, from the cache while they are fresh
+func (c *MetadataCache) Fields(ctx context.Context, databaseName, table string) ([]database.TableField, error) {
+	key := databaseName + "." + table
+
+	c.mu.Lock()
+	entry, ok := c.fields[key]
+	generation := c.generation
+	c.mu.Unlock()
+	if ok && c.now().Before(entry.expires) {
+		return slices.Clone(entry.value), nil
+	}
+
+	fields, err := c.db.GetTableFields(ctx, databaseName, table)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	// Every existing table has columns
+	if c.storable(generation) && len(fields) > 0 {
+		c.fields[key] = metadataEntry[[]database.TableField]{value: fields, expires: c.now().Add(c.ttl)}
+	}
+	c.mu.Unlock()
+	return slices.Clone(fields), nil
+}
+
+// storable reports whether a list read during generation may be cached: caching
+// is enabled and the cache was not invalidated since. It is called with the
+// mutex held.
+func (c *MetadataCache) storable(generation uint64) bool {
+	return c.ttl > 0 && c.generation == generation
+}
+
+// Invalidate drops everything cached so the next lookups read ClickHouse again
+func (c *MetadataCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.databases = nil
+	c.tables = make(map[string]metadataEntry[[]string])
+	c.fields = make(map[string]metadataEntry[[]database.TableField])
+}
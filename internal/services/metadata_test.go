@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/observio/backend/internal/database"
+)
+
+// fakeMetadata serves a fixed schema, counting the lookups
+type fakeMetadata struct {
+	tables map[string][]string // keyed by database
+	calls  int
+}
+
+func (f *fakeMetadata) GetDatabases(ctx context.Context) ([]string, error) {
+	f.calls++
+	var databases []string
+	for name := range f.tables {
+		databases = append(databases, name)
+	}
+	return databases, nil
+}
+
+func (f *fakeMetadata) GetTables(ctx context.Context, databaseName string) ([]string, error) {
+	f.calls++
+	return f.tables[databaseName], nil
+}
+
+func (f *fakeMetadata) GetTableFields(ctx context.Context, databaseName, table string) ([]database.TableField, error) {
+	f.calls++
+	for _, name := range f.tables[databaseName] {
+		if name == table {
+			return []database.TableField{{Name: "Timestamp", Type: "DateTime64(9)"}}, nil
+		}
+	}
+	return nil, nil
+}
+
+func newTestMetadataCache(ttl time.Duration) (*MetadataCache, *fakeMetadata) {
+	source := &fakeMetadata{tables: map[string][]string{"otel": {"logs", "traces"}}}
+	cache := NewMetadataCache(nil, ttl)
+	cache.db = source
+	return cache, source
+}
+
+func TestMetadataCacheServesFreshEntries(t *testing.T) {
+	cache, source := newTestMetadataCache(time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		cache.Tables(ctx, "otel")
+		cache.Fields(ctx, "otel", "logs")
+	}
+	if source.calls != 2 {
+		t.Errorf("%d lookups, want 2 while the entries are fresh", source.calls)
+	}
+
+	now = now.Add(time.Minute)
+	cache.Tables(ctx, "otel")
+	if source.calls != 3 {
+		t.Errorf("%d lookups, want the stale entry read again", source.calls)
+	}
+
+	cache.Invalidate()
+	cache.Fields(ctx, "otel", "logs")
+	if source.calls != 4 {
+		t.Errorf("%d lookups, want the invalidated entry read again", source.calls)
+	}
+}
+
+func TestMetadataCacheSkipsUnknownNames(t *testing.T) {
+	cache, _ := newTestMetadataCache(time.Minute)
+	ctx := context.Background()
+
+	for i := 0; i < 1000; i++ {
+		cache.Tables(ctx, fmt.Sprintf("missing_%d", i))
+		cache.Fields(ctx, "otel", fmt.Sprintf("missing_%d", i))
+		cache.Fields(ctx, fmt.Sprintf("missing_%d", i), "logs")
+	}
+	cache.Tables(ctx, "otel")
+	cache.Fields(ctx, "otel", "logs")
+
+	if len(cache.tables) != 1 || len(cache.fields) != 1 {
+		t.Errorf("cache holds %d table lists and %d field lists, want only the existing database and table", len(cache.tables), len(cache.fields))
+	}
+}
+
+func TestMetadataCacheDisabled(t *testing.T) {
+	cache, source := newTestMetadataCache(0)
+	ctx := context.Background()
+
+	cache.Databases(ctx)
+	cache.Databases(ctx)
+	cache.Tables(ctx, "otel")
+	cache.Fields(ctx, "otel", "logs")
+	if source.calls != 4 {
+		t.Errorf("%d lookups, want every lookup to read ClickHouse", source.calls)
+	}
+	if cache.databases != nil || len(cache.tables) != 0 || len(cache.fields) != 0 {
+		t.Error("cache stored entries with caching disabled")
+	}
+}